@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"juraji.nl/chat-quest/core/assets"
+)
+
+func AssetsRoutes(router *gin.RouterGroup) {
+	assetsRouter := router.Group("/assets")
+
+	assetsRouter.POST("", func(c *gin.Context) {
+		data, err := readUploadedFile(c, "file", assets.MaxAssetSize)
+		if err != nil {
+			respondBadRequest(c, "Invalid asset file", err)
+			return
+		}
+		if _, _, err = assets.ValidateImage(data); err != nil {
+			respondBadRequest(c, "Unsupported asset, expected a PNG, JPEG, GIF or WebP image", err)
+			return
+		}
+
+		asset, err := assets.StoreAsset(data)
+		respondSingle(c, asset, err)
+	})
+
+	assetsRouter.GET("/:name", func(c *gin.Context) {
+		size, _ := strconv.Atoi(c.Query("size"))
+
+		path, ok := assets.AssetFilePath(c.Param("name"), size)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+			return
+		}
+
+		// Assets are content addressed, so they never change
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.File(path)
+	})
+}
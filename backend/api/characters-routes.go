@@ -2,10 +2,14 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	cc "juraji.nl/chat-quest/model/character-cards"
 	ch "juraji.nl/chat-quest/model/characters"
 	"juraji.nl/chat-quest/processing"
 )
 
+// maxCharacterCardSize is the maximum size of an imported character card, PNG cards include their avatar.
+const maxCharacterCardSize = 32 << 20
+
 func CharactersRoutes(router *gin.RouterGroup) {
 	charactersRouter := router.Group("/characters")
 
@@ -36,6 +40,25 @@ func CharactersRoutes(router *gin.RouterGroup) {
 		respondSingle(c, &newCharacter, err)
 	})
 
+	charactersRouter.POST("/import", func(c *gin.Context) {
+		worldId := getQueryParamAsIntP(c, "worldId")
+
+		data, err := readUploadedFile(c, "file", maxCharacterCardSize)
+		if err != nil || len(data) == 0 {
+			respondBadRequest(c, "Invalid character card file", err)
+			return
+		}
+
+		card, err := cc.ParseCard(data)
+		if err != nil {
+			respondBadRequest(c, "Invalid character card", err)
+			return
+		}
+
+		character, err := processing.ImportCharacterCard(card, data, worldId)
+		respondSingle(c, character, err)
+	})
+
 	charactersRouter.PUT("/:characterId", func(c *gin.Context) {
 		characterId, ok := getParamAsID(c, "characterId")
 		if !ok {
@@ -147,6 +170,39 @@ func CharactersRoutes(router *gin.RouterGroup) {
 		respondSingle(c, &template, err)
 	})
 
+	charactersRouter.POST("/:characterId/export/card", func(c *gin.Context) {
+		characterId, ok := getParamAsID(c, "characterId")
+		if !ok {
+			respondBadRequest(c, "Invalid character ID", nil)
+			return
+		}
+
+		var spec string
+		switch c.DefaultQuery("spec", "v3") {
+		case "v2":
+			spec = cc.SpecV2
+		case "v3":
+			spec = cc.SpecV3
+		default:
+			respondBadRequest(c, "Invalid card spec, expected v2 or v3", nil)
+			return
+		}
+
+		card, err := processing.ExportCharacterAsCard(characterId, spec)
+		respondSingle(c, card, err)
+	})
+
+	charactersRouter.POST("/:characterId/export/png", func(c *gin.Context) {
+		characterId, ok := getParamAsID(c, "characterId")
+		if !ok {
+			respondBadRequest(c, "Invalid character ID", nil)
+			return
+		}
+
+		cardPng, err := processing.ExportCharacterAsCardPNG(characterId)
+		respondData(c, "image/png", cardPng, err)
+	})
+
 	charactersRouter.POST("/build", func(c *gin.Context) {
 		var request *processing.CharacterBuilderRequest
 		err := c.BindJSON(&request)
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	cs "juraji.nl/chat-quest/model/chat-sessions"
 	"juraji.nl/chat-quest/processing"
 )
@@ -162,6 +164,75 @@ func ChatSessionsRoutes(router *gin.RouterGroup) {
 		respondEmpty(c, err)
 	})
 
+	sessionRouter.GET("/:sessionId/chat-messages/:messageId/alternatives", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+		messageId, ok := getParamAsID(c, "messageId")
+		if !ok {
+			respondBadRequest(c, "Invalid chat message ID", nil)
+			return
+		}
+
+		alternatives, err := cs.GetChatMessageAlternatives(sessionId, messageId)
+		respondList(c, alternatives, err)
+	})
+
+	sessionRouter.POST("/:sessionId/chat-messages/:messageId/alternatives/:alternativeId/activate", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+		messageId, ok := getParamAsID(c, "messageId")
+		if !ok {
+			respondBadRequest(c, "Invalid chat message ID", nil)
+			return
+		}
+		alternativeId, ok := getParamAsID(c, "alternativeId")
+		if !ok {
+			respondBadRequest(c, "Invalid alternative ID", nil)
+			return
+		}
+
+		message, err := cs.SetActiveChatMessageAlternative(sessionId, messageId, alternativeId)
+		respondSingle(c, message, err)
+	})
+
+	sessionRouter.POST("/:sessionId/chat-messages/:messageId/regenerate", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+		messageId, ok := getParamAsID(c, "messageId")
+		if !ok {
+			respondBadRequest(c, "Invalid chat message ID", nil)
+			return
+		}
+
+		err := processing.RegenerateResponse(c, sessionId, messageId)
+		respondGenerateIntoMessage(c, err)
+	})
+
+	sessionRouter.POST("/:sessionId/chat-messages/:messageId/continue", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+		messageId, ok := getParamAsID(c, "messageId")
+		if !ok {
+			respondBadRequest(c, "Invalid chat message ID", nil)
+			return
+		}
+
+		err := processing.ContinueResponse(c, sessionId, messageId)
+		respondGenerateIntoMessage(c, err)
+	})
+
 	sessionRouter.POST("/:sessionId/chat-messages/:messageId/fork", func(c *gin.Context) {
 		sessionId, ok := getParamAsID(c, "sessionId")
 		if !ok {
@@ -178,6 +249,67 @@ func ChatSessionsRoutes(router *gin.RouterGroup) {
 		respondSingle(c, session, err)
 	})
 
+	sessionRouter.GET("/:sessionId/summary", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+
+		summary, err := cs.GetChatSessionSummary(sessionId)
+		respondSingle(c, summary, err)
+	})
+
+	sessionRouter.PUT("/:sessionId/summary", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+
+		var summary cs.ChatSessionSummary
+		if err := c.ShouldBindJSON(&summary); err != nil {
+			respondBadRequest(c, "Invalid summary data", nil)
+			return
+		}
+
+		updated, err := cs.UpdateChatSessionSummaryContent(sessionId, summary.Content)
+		respondSingle(c, updated, err)
+	})
+
+	sessionRouter.DELETE("/:sessionId/summary", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+
+		err := cs.DeleteChatSessionSummary(sessionId)
+		respondEmpty(c, err)
+	})
+
+	sessionRouter.GET("/:sessionId/generations", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+
+		generations := processing.GetActiveGenerations(sessionId)
+		respondList(c, generations, nil)
+	})
+
+	sessionRouter.DELETE("/:sessionId/generations", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+
+		processing.CancelSessionGenerations(sessionId)
+		respondEmpty(c, nil)
+	})
+
 	sessionRouter.GET("/:sessionId/participants", func(c *gin.Context) {
 		sessionId, ok := getParamAsID(c, "sessionId")
 		if !ok {
@@ -245,6 +377,22 @@ func ChatSessionsRoutes(router *gin.RouterGroup) {
 		respondEmpty(c, err)
 	})
 
+	sessionRouter.GET("/:sessionId/memories/explain/:characterId", func(c *gin.Context) {
+		sessionId, ok := getParamAsID(c, "sessionId")
+		if !ok {
+			respondBadRequest(c, "Invalid session ID", nil)
+			return
+		}
+		characterId, ok := getParamAsID(c, "characterId")
+		if !ok {
+			respondBadRequest(c, "Invalid character ID", nil)
+			return
+		}
+
+		explanation, err := processing.ExplainMemoryRetrieval(sessionId, characterId)
+		respondSingle(c, explanation, err)
+	})
+
 	sessionRouter.POST("/:sessionId/generate-title", func(c *gin.Context) {
 		sessionId, ok := getParamAsID(c, "sessionId")
 		if !ok {
@@ -256,3 +404,20 @@ func ChatSessionsRoutes(router *gin.RouterGroup) {
 		respondEmpty(c, err)
 	})
 }
+
+// respondGenerateIntoMessage responds to requests generating into an existing message,
+// mapping the errors caused by the request to 404 or 400.
+func respondGenerateIntoMessage(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, processing.ErrChatMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat message not found"})
+	case errors.Is(err, processing.ErrNotCharacterMessage):
+		respondBadRequest(c, "Only character messages can be generated", err)
+	case errors.Is(err, processing.ErrNotLastChatMessage):
+		respondBadRequest(c, "Only the last message in a session can be continued", err)
+	case errors.Is(err, cs.ErrChatMessageGenerating):
+		respondBadRequest(c, "Chat message is already being generated", err)
+	default:
+		respondEmpty(c, err)
+	}
+}
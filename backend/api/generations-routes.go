@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"juraji.nl/chat-quest/processing"
+)
+
+func GenerationsRoutes(router *gin.RouterGroup) {
+	generationsRouter := router.Group("/generations")
+
+	generationsRouter.GET("", func(c *gin.Context) {
+		generations := processing.GetActiveGenerations(0)
+		respondList(c, generations, nil)
+	})
+
+	generationsRouter.DELETE("", func(c *gin.Context) {
+		processing.CancelAllGenerations()
+		respondEmpty(c, nil)
+	})
+
+	generationsRouter.DELETE("/:generationId", func(c *gin.Context) {
+		generationId := c.Param("generationId")
+
+		if !processing.CancelGeneration(generationId) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Generation not found"})
+			return
+		}
+
+		respondEmpty(c, nil)
+	})
+}
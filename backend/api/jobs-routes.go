@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"juraji.nl/chat-quest/core/jobs"
+)
+
+func JobsRoutes(router *gin.RouterGroup) {
+	jobsRouter := router.Group("/jobs")
+
+	jobsRouter.GET("", func(c *gin.Context) {
+		state, hasState := c.GetQuery("state")
+		if !hasState {
+			allJobs, err := jobs.GetAllJobs()
+			respondList(c, allJobs, err)
+			return
+		}
+
+		jobState := jobs.JobState(state)
+		if !jobState.IsValid() {
+			respondBadRequest(c, "Invalid job state", nil)
+			return
+		}
+
+		jobsInState, err := jobs.GetJobsByState(jobState)
+		respondList(c, jobsInState, err)
+	})
+
+	jobsRouter.GET("/:jobId", func(c *gin.Context) {
+		jobId, ok := getParamAsID(c, "jobId")
+		if !ok {
+			respondBadRequest(c, "Invalid job ID", nil)
+			return
+		}
+
+		job, err := jobs.JobById(jobId)
+		respondSingle(c, job, err)
+	})
+
+	jobsRouter.POST("/:jobId/retry", func(c *gin.Context) {
+		jobId, ok := getParamAsID(c, "jobId")
+		if !ok {
+			respondBadRequest(c, "Invalid job ID", nil)
+			return
+		}
+
+		job, err := jobs.RetryJob(jobId)
+		respondSingle(c, job, err)
+	})
+
+	jobsRouter.DELETE("", func(c *gin.Context) {
+		jobState := jobs.JobState(c.Query("state"))
+		if !jobState.IsValid() || jobState == jobs.JobRunning {
+			respondBadRequest(c, "Invalid job state", nil)
+			return
+		}
+
+		err := jobs.DeleteJobsByState(jobState)
+		respondEmpty(c, err)
+	})
+
+	jobsRouter.DELETE("/:jobId", func(c *gin.Context) {
+		jobId, ok := getParamAsID(c, "jobId")
+		if !ok {
+			respondBadRequest(c, "Invalid job ID", nil)
+			return
+		}
+
+		err := jobs.DeleteJob(jobId)
+		respondEmpty(c, err)
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	lb "juraji.nl/chat-quest/model/lorebook"
+)
+
+func LorebookRoutes(router *gin.RouterGroup) {
+	lorebookRouter := router.Group("/worlds/:worldId/lorebook")
+
+	lorebookRouter.GET("", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+
+		entries, err := lb.GetLorebookEntriesByWorldId(worldId)
+		respondList(c, entries, err)
+	})
+
+	lorebookRouter.GET("/:entryId", func(c *gin.Context) {
+		entryId, ok := getParamAsID(c, "entryId")
+		if !ok {
+			respondBadRequest(c, "Invalid lorebook entry ID", nil)
+			return
+		}
+
+		entry, err := lb.LorebookEntryById(entryId)
+		respondSingle(c, entry, err)
+	})
+
+	lorebookRouter.POST("", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+
+		var newEntry lb.LorebookEntry
+		if err := c.ShouldBindJSON(&newEntry); err != nil {
+			respondBadRequest(c, "Invalid lorebook entry data", err)
+			return
+		}
+		if err := newEntry.Validate(); err != nil {
+			respondBadRequest(c, "Invalid lorebook entry data", err)
+			return
+		}
+
+		err := lb.CreateLorebookEntry(worldId, &newEntry)
+		respondSingle(c, &newEntry, err)
+	})
+
+	lorebookRouter.PUT("/:entryId", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+		entryId, ok := getParamAsID(c, "entryId")
+		if !ok {
+			respondBadRequest(c, "Invalid lorebook entry ID", nil)
+			return
+		}
+
+		var entry lb.LorebookEntry
+		if err := c.ShouldBindJSON(&entry); err != nil {
+			respondBadRequest(c, "Invalid lorebook entry data", err)
+			return
+		}
+		if err := entry.Validate(); err != nil {
+			respondBadRequest(c, "Invalid lorebook entry data", err)
+			return
+		}
+
+		entry.WorldId = worldId
+
+		err := lb.UpdateLorebookEntry(entryId, &entry)
+		respondSingle(c, &entry, err)
+	})
+
+	lorebookRouter.DELETE("/:entryId", func(c *gin.Context) {
+		entryId, ok := getParamAsID(c, "entryId")
+		if !ok {
+			respondBadRequest(c, "Invalid lorebook entry ID", nil)
+			return
+		}
+
+		err := lb.DeleteLorebookEntry(entryId)
+		respondEmpty(c, err)
+	})
+}
@@ -1,11 +1,17 @@
 package api
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	cs "juraji.nl/chat-quest/model/chat-sessions"
 	m "juraji.nl/chat-quest/model/memories"
 	"juraji.nl/chat-quest/processing"
 )
 
+// maxMemoriesFileSize is the maximum size of an imported memories file, which may include embeddings.
+const maxMemoriesFileSize = 64 << 20
+
 func MemoriesRoutes(router *gin.RouterGroup) {
 	memoriesRouter := router.Group("/worlds/:worldId/memories")
 
@@ -49,6 +55,10 @@ func MemoriesRoutes(router *gin.RouterGroup) {
 			respondBadRequest(c, "Invalid memory data", nil)
 			return
 		}
+		if newMemory.Importance < 0 || newMemory.Importance > 1 {
+			respondBadRequest(c, "Memory importance must be between 0 and 1", nil)
+			return
+		}
 
 		err := m.CreateMemory(worldId, &newMemory)
 		respondSingle(c, &newMemory, err)
@@ -71,6 +81,10 @@ func MemoriesRoutes(router *gin.RouterGroup) {
 			respondBadRequest(c, "Invalid memory data", nil)
 			return
 		}
+		if memory.Importance < 0 || memory.Importance > 1 {
+			respondBadRequest(c, "Memory importance must be between 0 and 1", nil)
+			return
+		}
 
 		memory.WorldId = worldId
 
@@ -89,6 +103,149 @@ func MemoriesRoutes(router *gin.RouterGroup) {
 		respondEmpty(c, err)
 	})
 
+	memoriesRouter.GET("/:memoryId/sources", func(c *gin.Context) {
+		memoryId, ok := getParamAsID(c, "memoryId")
+		if !ok {
+			respondBadRequest(c, "Invalid memory ID", nil)
+			return
+		}
+
+		sources, err := m.GetMemoryMergeSources(memoryId)
+		respondList(c, sources, err)
+	})
+
+	memoriesRouter.GET("/:memoryId/source-messages", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+		memoryId, ok := getParamAsID(c, "memoryId")
+		if !ok {
+			respondBadRequest(c, "Invalid memory ID", nil)
+			return
+		}
+
+		memory, err := m.MemoryById(memoryId)
+		if err != nil || memory == nil || memory.WorldId != worldId || memory.SourceChatSessionId == nil {
+			respondSingle[m.Memory](c, nil, err)
+			return
+		}
+
+		messages, err := cs.GetMessagesInSessionBetweenIds(
+			*memory.SourceChatSessionId, *memory.SourceFromMessageId, *memory.SourceToMessageId)
+		respondList(c, messages, err)
+	})
+
+	memoriesRouter.GET("/consolidation", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+
+		proposals, err := m.GetConsolidationProposals(worldId)
+		respondList(c, proposals, err)
+	})
+
+	memoriesRouter.POST("/consolidation", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+
+		err := processing.EnqueueMemoryConsolidation(worldId)
+		respondEmpty(c, err)
+	})
+
+	memoriesRouter.POST("/consolidation/:proposalId/apply", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+		proposalId, ok := getParamAsID(c, "proposalId")
+		if !ok {
+			respondBadRequest(c, "Invalid proposal ID", nil)
+			return
+		}
+
+		proposal, err := m.ConsolidationProposalById(proposalId)
+		if err != nil || proposal == nil || proposal.WorldId != worldId {
+			respondSingle[m.ConsolidationProposal](c, nil, err)
+			return
+		}
+
+		memories, err := processing.ApplyConsolidationProposal(proposal)
+		respondList(c, memories, err)
+	})
+
+	memoriesRouter.DELETE("/consolidation/:proposalId", func(c *gin.Context) {
+		proposalId, ok := getParamAsID(c, "proposalId")
+		if !ok {
+			respondBadRequest(c, "Invalid proposal ID", nil)
+			return
+		}
+
+		err := m.DeleteConsolidationProposal(proposalId)
+		respondEmpty(c, err)
+	})
+
+	memoriesRouter.GET("/export", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+
+		characterId := getQueryParamAsIntP(c, "characterId")
+		includeEmbeddings := strings.ToLower(c.Query("includeEmbeddings")) == "true"
+		format := processing.MemoryTransferFormat(c.DefaultQuery("format", "json"))
+		if !format.IsValid() {
+			respondBadRequest(c, "Invalid format, expected json or jsonl", nil)
+			return
+		}
+
+		data, err := processing.ExportMemories(worldId, characterId, format, includeEmbeddings)
+		respondData(c, format.ContentType(), data, err)
+	})
+
+	memoriesRouter.POST("/import", func(c *gin.Context) {
+		worldId, ok := getParamAsID(c, "worldId")
+		if !ok {
+			respondBadRequest(c, "Invalid world ID", nil)
+			return
+		}
+
+		characterId := getQueryParamAsIntP(c, "characterId")
+		format := processing.MemoryTransferFormat(c.Query("format"))
+		if format != "" && !format.IsValid() {
+			respondBadRequest(c, "Invalid format, expected json or jsonl", nil)
+			return
+		}
+		conflict := processing.MemoryImportConflict(c.DefaultQuery("conflict", "SKIP"))
+		if !conflict.IsValid() {
+			respondBadRequest(c, "Invalid conflict handling, expected SKIP, REPLACE or DUPLICATE", nil)
+			return
+		}
+
+		data, err := readUploadedFile(c, "file", maxMemoriesFileSize)
+		if err != nil || len(data) == 0 {
+			respondBadRequest(c, "Invalid memories file", err)
+			return
+		}
+
+		records, err := processing.ParseMemoryRecords(data, format)
+		if err != nil {
+			respondBadRequest(c, "Invalid memories file", err)
+			return
+		}
+
+		result, err := processing.ImportMemories(worldId, records, conflict, characterId)
+		respondSingle(c, result, err)
+	})
+
 	memoriesRouter.GET("/bookmarks/:chatSessionId", func(c *gin.Context) {
 		chatSessionId, ok := getParamAsID(c, "chatSessionId")
 		if !ok {
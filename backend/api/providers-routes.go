@@ -30,6 +30,11 @@ func ProvidersRoutes(router *gin.RouterGroup) {
 			respondBadRequest(c, "Invalid connection profile data", nil)
 			return
 		}
+		if newProfile.MaxConcurrentRequests < 0 || newProfile.RequestsPerMinute < 0 ||
+			newProfile.MaxRetries < 0 || newProfile.MaxRetries > providers.MaxRetriesLimit || newProfile.RetryBackoffMillis < 0 {
+			respondBadRequest(c, "Invalid connection profile request limits or retries", nil)
+			return
+		}
 
 		llmModels, err := providers.GetAvailableModels(&newProfile)
 		if err != nil {
@@ -56,6 +61,11 @@ func ProvidersRoutes(router *gin.RouterGroup) {
 			respondBadRequest(c, "Invalid connection profile type", nil)
 			return
 		}
+		if profile.MaxConcurrentRequests < 0 || profile.RequestsPerMinute < 0 ||
+			profile.MaxRetries < 0 || profile.MaxRetries > providers.MaxRetriesLimit || profile.RetryBackoffMillis < 0 {
+			respondBadRequest(c, "Invalid connection profile request limits or retries", nil)
+			return
+		}
 
 		err := providers.UpdateConnectionProfile(profileId, &profile)
 		respondSingle(c, &profile, err)
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core/log"
 )
@@ -47,6 +49,43 @@ func getQueryParamsAsInts(c *gin.Context, key string) ([]int, bool) {
 	return ints, true
 }
 
+// uploadOverhead allows for the multipart encoding around an uploaded file.
+const uploadOverhead = 1 << 20
+
+// readUploadedFile reads the file from the multipart form field, or the raw request body when the request
+// is not a multipart form. Files larger than maxSize bytes are rejected, without reading them entirely.
+func readUploadedFile(c *gin.Context, field string, maxSize int64) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+uploadOverhead)
+
+	var reader io.Reader = c.Request.Body
+	if c.ContentType() == gin.MIMEMultipartPOSTForm {
+		fileHeader, err := c.FormFile(field)
+		if err != nil {
+			return nil, err
+		}
+		if fileHeader.Size > maxSize {
+			return nil, errors.Errorf("uploaded file exceeds the maximum size of %d bytes", maxSize)
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errors.Errorf("uploaded file exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	return data, nil
+}
+
 func respondList[T any](c *gin.Context, list []T, err error) {
 	if err != nil {
 		respondInternalError(c, err)
@@ -70,6 +109,16 @@ func respondSingle[T any](c *gin.Context, entity *T, err error) {
 	}
 }
 
+func respondData(c *gin.Context, contentType string, data []byte, err error) {
+	if err != nil {
+		respondInternalError(c, err)
+	} else if data == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found"})
+	} else {
+		c.Data(http.StatusOK, contentType, data)
+	}
+}
+
 func respondEmpty(c *gin.Context, err error) {
 	if err != nil {
 		respondInternalError(c, err)
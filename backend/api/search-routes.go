@@ -0,0 +1,56 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"juraji.nl/chat-quest/model/search"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+func SearchRoutes(router *gin.RouterGroup) {
+	router.GET("/search", func(c *gin.Context) {
+		query := search.Query{
+			Text:          c.Query("q"),
+			WorldID:       getQueryParamAsIntP(c, "worldId"),
+			ChatSessionID: getQueryParamAsIntP(c, "sessionId"),
+			CharacterID:   getQueryParamAsIntP(c, "characterId"),
+			Limit:         defaultSearchLimit,
+		}
+
+		if strings.TrimSpace(query.Text) == "" {
+			respondBadRequest(c, "Query parameter 'q' is required", nil)
+			return
+		}
+
+		if types, ok := c.GetQuery("types"); ok && types != "" {
+			for _, t := range strings.Split(types, ",") {
+				resultType := search.ResultType(strings.ToUpper(strings.TrimSpace(t)))
+				if !resultType.IsValid() {
+					respondBadRequest(c, "Invalid result type: "+t, nil)
+					return
+				}
+				query.Types = append(query.Types, resultType)
+			}
+		}
+
+		if limit := getQueryParamAsIntP(c, "limit"); limit != nil {
+			query.Limit = min(max(*limit, 1), maxSearchLimit)
+		}
+		if offset := getQueryParamAsIntP(c, "offset"); offset != nil {
+			query.Offset = max(*offset, 0)
+		}
+
+		page, err := search.Search(query)
+		if errors.Is(err, search.ErrEmptyQuery) {
+			respondBadRequest(c, "Query parameter 'q' contains no search terms", err)
+			return
+		}
+		respondSingle(c, page, err)
+	})
+}
@@ -1,18 +1,24 @@
 package api
 
 import (
+	"bytes"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/backup"
 	"juraji.nl/chat-quest/core/database"
 	"juraji.nl/chat-quest/core/log"
 	"juraji.nl/chat-quest/core/providers"
 	"juraji.nl/chat-quest/core/system"
+	"juraji.nl/chat-quest/processing"
 )
 
+// maxBackupUploadSize is the maximum size of an uploaded backup archive, which is restored from memory.
+const maxBackupUploadSize = 1 << 30
+
 func SystemRoutes(router *gin.RouterGroup) {
 	systemRouter := router.Group("/system")
 
@@ -42,8 +48,63 @@ func SystemRoutes(router *gin.RouterGroup) {
 		version, _ := getParamAsID(c, "version")
 		log.Get().Info("Migrating to version", zap.Int("version", version))
 
-		database.GoToVersion(database.GetDB(), uint(version))
-		respondEmpty(c, nil)
+		err := database.GoToVersion(database.GetDB(), uint(version))
+		respondEmpty(c, err)
+	})
+
+	systemRouter.POST("/backup", func(c *gin.Context) {
+		file, err := backup.CreateBackup(backup.ManualSuffix)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+
+		path, _ := backup.BackupFilePath(file.Name)
+		c.FileAttachment(path, file.Name)
+	})
+
+	systemRouter.POST("/restore", func(c *gin.Context) {
+		data, err := readUploadedFile(c, "file", maxBackupUploadSize)
+		if err != nil {
+			respondBadRequest(c, "Failed to read backup archive", nil)
+			return
+		}
+
+		archive := bytes.NewReader(data)
+		if _, err = backup.ValidateBackup(archive, archive.Size()); err != nil {
+			respondBadRequest(c, err.Error(), nil)
+			return
+		}
+
+		manifest, err := backup.RestoreBackup(archive, archive.Size())
+		respondSingle(c, manifest, err)
+	})
+
+	systemRouter.GET("/backups", func(c *gin.Context) {
+		backups, err := backup.ListBackups()
+		respondList(c, backups, err)
+	})
+
+	systemRouter.GET("/backups/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		path, ok := backup.BackupFilePath(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+			return
+		}
+
+		c.FileAttachment(path, name)
+	})
+
+	systemRouter.POST("/backups/:name/restore", func(c *gin.Context) {
+		name := c.Param("name")
+		if _, ok := backup.BackupFilePath(name); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+			return
+		}
+
+		manifest, err := backup.RestoreStoredBackup(name)
+		respondSingle(c, manifest, err)
 	})
 
 	systemRouter.POST("/shutdown", func(c *gin.Context) {
@@ -51,6 +112,8 @@ func SystemRoutes(router *gin.RouterGroup) {
 		log.Get().Info("Shutting down by API...")
 
 		go func() {
+			processing.SaveMemoryIndex()
+
 			// Give Gin some time to process and send the response
 			time.Sleep(100 * time.Millisecond)
 			os.Exit(0)
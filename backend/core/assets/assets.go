@@ -0,0 +1,203 @@
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	_ "golang.org/x/image/webp"
+	"juraji.nl/chat-quest/core"
+)
+
+const (
+	// UrlPrefix is the prefix of asset urls, as stored in the database.
+	// Asset urls are relative to the API base path, so they do not depend on the host serving the API.
+	UrlPrefix = "assets/"
+	// MaxAssetSize is the maximum size of an uploaded asset in bytes.
+	MaxAssetSize = 16 << 20
+	// maxImagePixels limits the decoded size of images, to protect against decompression bombs.
+	maxImagePixels = 50_000_000
+
+	assetsDir = "assets"
+)
+
+// ThumbnailSizes are the sizes (longest edge in pixels) of the thumbnails created for each image.
+var ThumbnailSizes = []int{128, 256, 512}
+
+var (
+	assetNamePattern = regexp.MustCompile(`^[0-9a-f]{64}\.(png|jpg|gif|webp)$`)
+	mimeExtensions   = map[string]string{
+		"image/png":  "png",
+		"image/jpeg": "jpg",
+		"image/gif":  "gif",
+		"image/webp": "webp",
+	}
+)
+
+type Asset struct {
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	MimeType string `json:"mimeType"`
+	Size     int    `json:"size"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// ValidateImage checks whether data is a supported image and returns its MIME type.
+func ValidateImage(data []byte) (string, image.Config, error) {
+	if len(data) == 0 {
+		return "", image.Config{}, errors.New("asset is empty")
+	}
+	if len(data) > MaxAssetSize {
+		return "", image.Config{}, errors.Errorf("asset exceeds the maximum size of %d bytes", MaxAssetSize)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if _, ok := mimeExtensions[mimeType]; !ok {
+		return "", image.Config{}, errors.Errorf("unsupported asset type '%s'", mimeType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", image.Config{}, errors.Wrap(err, "invalid image")
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return "", image.Config{}, errors.Errorf("unsupported image dimensions %dx%d", config.Width, config.Height)
+	}
+
+	return mimeType, config, nil
+}
+
+// StoreAsset stores the image under its content hash and creates its thumbnails.
+// Storing an image that already exists only refreshes its modification time, so it is not swept
+// before it is referenced.
+func StoreAsset(data []byte) (*Asset, error) {
+	mimeType, config, err := ValidateImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	name := hex.EncodeToString(hash[:]) + "." + mimeExtensions[mimeType]
+	asset := &Asset{
+		Name:     name,
+		Url:      UrlPrefix + name,
+		MimeType: mimeType,
+		Size:     len(data),
+		Width:    config.Width,
+		Height:   config.Height,
+	}
+
+	path := originalPath(name)
+	if _, err = os.Stat(path); err == nil {
+		now := time.Now()
+		return asset, os.Chtimes(path, now, now)
+	}
+
+	if err = createThumbnails(name, data); err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(path, data); err != nil {
+		return nil, errors.Wrap(err, "failed to write asset")
+	}
+
+	return asset, nil
+}
+
+// AssetFilePath returns the path of the asset file with the given name. When size is one of ThumbnailSizes
+// the path of that thumbnail is returned, or the original if the image is smaller than the thumbnail size.
+// Returns false if the name is invalid or the asset does not exist.
+func AssetFilePath(name string, size int) (string, bool) {
+	if !assetNamePattern.MatchString(name) {
+		return "", false
+	}
+
+	if slices.Contains(ThumbnailSizes, size) {
+		path := thumbnailPath(name, size)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+
+	path := originalPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func IsAssetUrl(url string) bool {
+	return strings.HasPrefix(url, UrlPrefix)
+}
+
+// ReadAssetByUrl reads the original image referenced by the asset url and returns its MIME type and data.
+func ReadAssetByUrl(url string) (string, []byte, error) {
+	path, ok := AssetFilePath(strings.TrimPrefix(url, UrlPrefix), 0)
+	if !ok || !IsAssetUrl(url) {
+		return "", nil, errors.Errorf("asset '%s' not found", url)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to read asset")
+	}
+
+	return http.DetectContentType(data), data, nil
+}
+
+// DecodeDataUrl returns the MIME type and the decoded data of a base64 encoded data URL.
+func DecodeDataUrl(url string) (string, []byte, bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", nil, false
+	}
+
+	header, encoded, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", nil, false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
+func originalPath(name string) string {
+	return filepath.Join(core.Env().MkDataDir(assetsDir, "originals"), name)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), core.Env().DefaultFSPerm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,180 @@
+package assets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/log"
+	"juraji.nl/chat-quest/core/util"
+)
+
+const (
+	sweepInterval = 6 * time.Hour
+	// sweepGracePeriod keeps recently uploaded assets, which are not yet saved on an entity.
+	sweepGracePeriod = time.Hour
+)
+
+// avatarTables are the tables referencing assets through their avatar_url column.
+var avatarTables = []string{"characters", "worlds", "scenarios", "species"}
+
+type avatarRecord struct {
+	ID        int
+	AvatarUrl string
+}
+
+// StartSweeper moves avatars still stored as data URL into asset storage and periodically removes
+// assets that are no longer referenced.
+func StartSweeper(ctx context.Context) {
+	logger := log.Get().With(zap.String("source", "Assets"))
+
+	if converted, err := convertDataUrlAvatars(); err != nil {
+		logger.Error("Failed to move data URL avatars to asset storage", zap.Error(err))
+	} else if converted > 0 {
+		logger.Info("Moved data URL avatars to asset storage", zap.Int("count", converted))
+	}
+
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+
+		for {
+			if removed, err := SweepUnreferencedAssets(); err != nil {
+				logger.Error("Failed to sweep unreferenced assets", zap.Error(err))
+			} else if removed > 0 {
+				logger.Info("Removed unreferenced assets", zap.Int("count", removed))
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// SweepUnreferencedAssets removes assets (and their thumbnails) that are not referenced by any entity,
+// and were not uploaded within the grace period. Returns the number of removed assets.
+func SweepUnreferencedAssets() (int, error) {
+	referenced, err := referencedAssetNames()
+	if err != nil {
+		return 0, err
+	}
+
+	originalsDir := core.Env().MkDataDir(assetsDir, "originals")
+	originals, err := os.ReadDir(originalsDir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	keptHashes := util.NewSet[string](len(originals))
+	for _, entry := range originals {
+		name := entry.Name()
+		info, err := entry.Info()
+		if err != nil || !assetNamePattern.MatchString(name) {
+			continue
+		}
+
+		if referenced.Contains(name) || time.Since(info.ModTime()) < sweepGracePeriod {
+			keptHashes.Add(assetHash(name))
+			continue
+		}
+
+		if err = os.Remove(filepath.Join(originalsDir, name)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	// Thumbnails of removed (or otherwise missing) originals
+	for _, size := range ThumbnailSizes {
+		thumbnailsDir := core.Env().MkDataDir(assetsDir, "thumbnails", fmt.Sprint(size))
+		thumbnails, err := os.ReadDir(thumbnailsDir)
+		if err != nil {
+			return removed, err
+		}
+
+		for _, entry := range thumbnails {
+			// Skip thumbnails that are being written
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if !keptHashes.Contains(assetHash(entry.Name())) {
+				if err = os.Remove(filepath.Join(thumbnailsDir, entry.Name())); err != nil {
+					return removed, err
+				}
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+func referencedAssetNames() (*util.Set[string], error) {
+	var queries []string
+	for _, table := range avatarTables {
+		queries = append(queries, fmt.Sprintf("SELECT avatar_url FROM %s WHERE avatar_url LIKE '%s%%'", table, UrlPrefix))
+	}
+
+	urls, err := database.QueryForList(strings.Join(queries, " UNION "), nil, database.StringScanner)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewSetFrom(urls, func(url string) string {
+		return strings.TrimPrefix(url, UrlPrefix)
+	}), nil
+}
+
+// convertDataUrlAvatars stores avatars that are data URLs as assets and replaces them with the asset url.
+// Avatars that are not valid images are left as-is.
+func convertDataUrlAvatars() (int, error) {
+	scanner := func(scanner database.RowScanner, dest *avatarRecord) error {
+		return scanner.Scan(&dest.ID, &dest.AvatarUrl)
+	}
+
+	converted := 0
+	for _, table := range avatarTables {
+		query := fmt.Sprintf("SELECT id, avatar_url FROM %s WHERE avatar_url LIKE 'data:%%'", table)
+		records, err := database.QueryForList(query, nil, scanner)
+		if err != nil {
+			return converted, err
+		}
+
+		for _, record := range records {
+			_, data, ok := DecodeDataUrl(record.AvatarUrl)
+			if !ok {
+				continue
+			}
+
+			asset, err := StoreAsset(data)
+			if err != nil {
+				log.Get().Warn("Skipping invalid data URL avatar",
+					zap.String("table", table),
+					zap.Int("id", record.ID),
+					zap.Error(err))
+				continue
+			}
+
+			update := fmt.Sprintf("UPDATE %s SET avatar_url = ? WHERE id = ?", table)
+			if err = database.UpdateRecord(update, []any{asset.Url, record.ID}); err != nil {
+				return converted, err
+			}
+			converted++
+		}
+	}
+
+	return converted, nil
+}
+
+func assetHash(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
@@ -0,0 +1,63 @@
+package assets
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+	"juraji.nl/chat-quest/core"
+)
+
+const thumbnailJpegQuality = 85
+
+// createThumbnails scales the image down to each of the ThumbnailSizes, skipping sizes the image already fits in.
+// Thumbnails of JPEG images are stored as JPEG, all others as PNG.
+func createThumbnails(name string, data []byte) error {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to decode image")
+	}
+
+	bounds := img.Bounds()
+	longestEdge := max(bounds.Dx(), bounds.Dy())
+
+	for _, size := range ThumbnailSizes {
+		if longestEdge <= size {
+			break
+		}
+
+		width := bounds.Dx() * size / longestEdge
+		height := bounds.Dy() * size / longestEdge
+		thumbnail := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+		draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Src, nil)
+
+		var buf bytes.Buffer
+		if strings.HasSuffix(name, ".jpg") {
+			err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: thumbnailJpegQuality})
+		} else {
+			err = png.Encode(&buf, thumbnail)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode %dpx thumbnail", size)
+		}
+
+		if err = writeFileAtomic(thumbnailPath(name, size), buf.Bytes()); err != nil {
+			return errors.Wrapf(err, "failed to write %dpx thumbnail", size)
+		}
+	}
+
+	return nil
+}
+
+func thumbnailPath(name string, size int) string {
+	if !strings.HasSuffix(name, ".jpg") {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".png"
+	}
+	return filepath.Join(core.Env().MkDataDir(assetsDir, "thumbnails", fmt.Sprint(size)), name)
+}
@@ -0,0 +1,370 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/jobs"
+	"juraji.nl/chat-quest/core/log"
+)
+
+const (
+	// FormatVersion is the version of the backup archive layout, increment when the layout changes.
+	FormatVersion = 1
+
+	manifestFileName = "manifest.json"
+	databaseFileName = "chat-quest.db"
+)
+
+// restoreQuiesceTimeout is the time a restore waits for running jobs and generations to stop.
+const restoreQuiesceTimeout = 30 * time.Second
+
+// dataDirs are the directories in the data directory that are included in backups, next to the database.
+var dataDirs = []string{"assets", "instructions"}
+
+// backupMutex prevents backups and restores from running at the same time.
+var backupMutex sync.Mutex
+
+type Manifest struct {
+	FormatVersion    int       `json:"formatVersion"`
+	CreatedAt        time.Time `json:"createdAt"`
+	MigrationVersion uint      `json:"migrationVersion"`
+	Files            []string  `json:"files"`
+}
+
+// writeBackup writes a backup archive of the database and data directories to w.
+// The database is copied using VACUUM INTO, so the archive holds a consistent snapshot.
+func writeBackup(w io.Writer) (*Manifest, error) {
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	migrationVersion, err := database.MigrationVersion(database.GetDB())
+	if err != nil {
+		return nil, err
+	}
+
+	stagingDir, err := os.MkdirTemp(core.Env().DataDirectory, ".backup-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create staging directory")
+	}
+	defer os.RemoveAll(stagingDir)
+
+	dbCopyPath := filepath.Join(stagingDir, databaseFileName)
+	if err = database.VacuumInto(dbCopyPath); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		FormatVersion:    FormatVersion,
+		CreatedAt:        time.Now().UTC(),
+		MigrationVersion: migrationVersion,
+	}
+
+	archive := zip.NewWriter(w)
+	if err = addFileToArchive(archive, dbCopyPath, databaseFileName, zip.Deflate); err != nil {
+		return nil, err
+	}
+	manifest.Files = append(manifest.Files, databaseFileName)
+
+	for _, dir := range dataDirs {
+		files, err := addDirToArchive(archive, dir)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, files...)
+	}
+
+	manifestWriter, err := archive.Create(manifestFileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add manifest")
+	}
+	encoder := json.NewEncoder(manifestWriter)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to write manifest")
+	}
+
+	if err = archive.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to finish backup archive")
+	}
+
+	return manifest, nil
+}
+
+// addDirToArchive adds all files in the data directory dir to the archive, skipping hidden (temporary) files.
+// Returns the names of the added files.
+func addDirToArchive(archive *zip.Writer, dir string) ([]string, error) {
+	root := filepath.Join(core.Env().DataDirectory, dir)
+	var names []string
+
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && filePath == root {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(core.Env().DataDirectory, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		// Images are compressed already
+		method := zip.Deflate
+		if dir == "assets" {
+			method = zip.Store
+		}
+
+		if err = addFileToArchive(archive, filePath, name, method); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to add %s to backup", dir)
+	}
+
+	return names, nil
+}
+
+func addFileToArchive(archive *zip.Writer, filePath string, name string, method uint16) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = method
+
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// RestoreBackup replaces the database and data directories with the contents of the backup archive.
+// Before restoring, a backup of the current data is created. Backups of older versions are migrated to
+// the current version.
+// Job workers are paused and generations are stopped while restoring. Jobs that were queued or running when the
+// backup was created are marked as failed, rather than running them again.
+func RestoreBackup(archive io.ReaderAt, size int64) (*Manifest, error) {
+	logger := log.Get()
+
+	reader, manifest, err := openBackup(archive, size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop everything that writes to the database
+	resumeWorkers := jobs.PauseWorkers()
+	defer resumeWorkers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), restoreQuiesceTimeout)
+	defer cancel()
+	if err = BackupRestoringSignal.Emit(ctx, manifest).Wait(); err != nil {
+		return nil, errors.Wrap(err, "failed to stop running work before restoring")
+	}
+	if err = jobs.WaitForRunningJobs(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to stop running work before restoring")
+	}
+
+	// Old backups are not removed, which could remove the backup being restored
+	logger.Info("Creating backup before restoring...")
+	if _, err = createBackup(preRestoreSuffix, false); err != nil {
+		return nil, errors.Wrap(err, "failed to create backup before restoring")
+	}
+
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	logger.Info("Restoring backup...",
+		zap.Time("createdAt", manifest.CreatedAt),
+		zap.Uint("migrationVersion", manifest.MigrationVersion))
+
+	stagingDir, err := os.MkdirTemp(core.Env().DataDirectory, ".restore-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create staging directory")
+	}
+	defer os.RemoveAll(stagingDir)
+
+	for _, file := range reader.File {
+		if file.Name == manifestFileName || strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		if err = extractFile(file, stagingDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = database.RestoreDatabase(filepath.Join(stagingDir, databaseFileName)); err != nil {
+		return nil, errors.Wrap(err, "failed to restore database")
+	}
+	if err = jobs.FailUnfinishedJobs("unfinished when the backup was created"); err != nil {
+		logger.Error("Failed to fail unfinished jobs of the restored backup", zap.Error(err))
+	}
+
+	// The database is restored at this point, so data directories are replaced on a best-effort basis.
+	for _, dir := range dataDirs {
+		if err = replaceDataDir(stagingDir, dir); err != nil {
+			logger.Error("Failed to restore data directory", zap.String("dir", dir), zap.Error(err))
+		}
+	}
+
+	logger.Info("Backup restored")
+	BackupRestoredSignal.EmitBG(manifest)
+	return manifest, nil
+}
+
+// ValidateBackup checks whether the archive is a backup that can be restored by this version and returns
+// its manifest.
+func ValidateBackup(archive io.ReaderAt, size int64) (*Manifest, error) {
+	_, manifest, err := openBackup(archive, size)
+	return manifest, err
+}
+
+func openBackup(archive io.ReaderAt, size int64) (*zip.Reader, *Manifest, error) {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid backup archive")
+	}
+
+	manifest, err := readManifest(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reader, manifest, nil
+}
+
+func readManifest(reader *zip.Reader) (*Manifest, error) {
+	manifestFile, err := reader.Open(manifestFileName)
+	if err != nil {
+		return nil, errors.New("backup archive has no manifest")
+	}
+	defer manifestFile.Close()
+
+	var manifest Manifest
+	if err = json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "invalid backup manifest")
+	}
+
+	if manifest.FormatVersion != FormatVersion {
+		return nil, errors.Errorf("unsupported backup format version %d", manifest.FormatVersion)
+	}
+
+	latestVersion, err := database.LatestMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.MigrationVersion == 0 || manifest.MigrationVersion > latestVersion {
+		return nil, errors.Errorf("backup has migration version %d, this version of ChatQuest supports up to %d",
+			manifest.MigrationVersion, latestVersion)
+	}
+
+	if !slices.Contains(manifest.Files, databaseFileName) {
+		return nil, errors.New("backup does not contain a database")
+	}
+	for _, name := range manifest.Files {
+		if !isRestorableFile(name) {
+			return nil, errors.Errorf("backup contains unexpected file '%s'", name)
+		}
+		if _, err = fs.Stat(reader, name); err != nil {
+			return nil, errors.Errorf("backup is missing file '%s'", name)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// isRestorableFile checks whether name is the database or a file in one of the data directories,
+// guarding against archive entries that would be extracted elsewhere.
+func isRestorableFile(name string) bool {
+	if name == databaseFileName {
+		return true
+	}
+	if !fs.ValidPath(name) {
+		return false
+	}
+
+	dir, _, _ := strings.Cut(name, "/")
+	return slices.Contains(dataDirs, dir) && path.Clean(name) != dir
+}
+
+func extractFile(file *zip.File, stagingDir string) error {
+	if !isRestorableFile(file.Name) {
+		return errors.Errorf("backup contains unexpected file '%s'", file.Name)
+	}
+
+	target := filepath.Join(stagingDir, filepath.FromSlash(file.Name))
+	if err := os.MkdirAll(filepath.Dir(target), core.Env().DefaultFSPerm|0111); err != nil {
+		return errors.Wrapf(err, "failed to extract '%s'", file.Name)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract '%s'", file.Name)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, core.Env().DefaultFSPerm)
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract '%s'", file.Name)
+	}
+	defer dst.Close()
+
+	if _, err = io.Copy(dst, src); err != nil {
+		return errors.Wrapf(err, "failed to extract '%s'", file.Name)
+	}
+
+	return nil
+}
+
+// replaceDataDir replaces the data directory dir with the one extracted into stagingDir.
+// The current directory is moved into the staging directory, so it is removed along with it.
+func replaceDataDir(stagingDir string, dir string) error {
+	current := filepath.Join(core.Env().DataDirectory, dir)
+	restored := filepath.Join(stagingDir, dir)
+
+	if err := os.Rename(current, filepath.Join(stagingDir, ".replaced-"+dir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, err := os.Stat(restored); os.IsNotExist(err) {
+		return nil
+	}
+
+	return os.Rename(restored, current)
+}
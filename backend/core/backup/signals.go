@@ -0,0 +1,10 @@
+package backup
+
+import "juraji.nl/chat-quest/core/util/signals"
+
+// BackupRestoringSignal is emitted before a backup replaces the database. The restore waits for the listeners, which
+// should stop any work that writes to the database, until the context is done.
+var BackupRestoringSignal = signals.New[*Manifest]()
+
+// BackupRestoredSignal is emitted after a backup has replaced the database and data directories.
+var BackupRestoredSignal = signals.New[*Manifest]()
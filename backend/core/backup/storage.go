@@ -0,0 +1,192 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/log"
+)
+
+const (
+	backupsDir           = "backups"
+	backupFileTimeFormat = "2006-01-02T15-04-05"
+
+	ManualSuffix     = "manual"
+	scheduledSuffix  = "scheduled"
+	preRestoreSuffix = "pre-restore"
+)
+
+var backupNamePattern = regexp.MustCompile(`^chat-quest-backup_[0-9T-]+_[a-z-]+\.zip$`)
+
+type BackupFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateBackup writes a backup archive to the backups directory, with the suffix appended to its name to
+// tell why it was created. Old backups are removed afterward, keeping core.Environment.KeepNBackups backups.
+func CreateBackup(suffix string) (*BackupFile, error) {
+	return createBackup(suffix, true)
+}
+
+// createBackup writes a backup archive to the backups directory, removing old backups when prune is set.
+func createBackup(suffix string, prune bool) (*BackupFile, error) {
+	dir := core.Env().MkDataDir(backupsDir)
+	name := fmt.Sprintf("chat-quest-backup_%s_%s.zip", time.Now().UTC().Format(backupFileTimeFormat), suffix)
+
+	tmp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create backup file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = writeBackup(tmp); err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+	if err = tmp.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to write backup file")
+	}
+
+	path := filepath.Join(dir, name)
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, errors.Wrap(err, "failed to write backup file")
+	}
+
+	if prune {
+		removeOldBackups()
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupFile{Name: name, Size: info.Size(), CreatedAt: info.ModTime()}, nil
+}
+
+// ListBackups lists the backups in the backups directory, newest first.
+func ListBackups() ([]BackupFile, error) {
+	entries, err := os.ReadDir(core.Env().MkDataDir(backupsDir))
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]BackupFile, 0, len(entries))
+	for _, entry := range entries {
+		if !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, BackupFile{Name: entry.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+
+	// Names start with the creation time
+	slices.SortFunc(backups, func(a, b BackupFile) int {
+		return strings.Compare(b.Name, a.Name)
+	})
+
+	return backups, nil
+}
+
+// BackupFilePath returns the path of the backup with the given name.
+// Returns false if the name is invalid or the backup does not exist.
+func BackupFilePath(name string) (string, bool) {
+	if !backupNamePattern.MatchString(name) {
+		return "", false
+	}
+
+	path := filepath.Join(core.Env().MkDataDir(backupsDir), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// RestoreStoredBackup restores the backup with the given name from the backups directory.
+func RestoreStoredBackup(name string) (*Manifest, error) {
+	path, ok := BackupFilePath(name)
+	if !ok {
+		return nil, errors.Errorf("backup '%s' not found", name)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return RestoreBackup(file, info.Size())
+}
+
+// StartScheduler creates a backup every core.Environment.BackupIntervalHours hours.
+// The first backup is created as soon as the interval has passed since the latest backup.
+func StartScheduler(ctx context.Context) {
+	interval := time.Duration(core.Env().BackupIntervalHours) * time.Hour
+	if interval <= 0 {
+		return
+	}
+
+	logger := log.Get().With(zap.String("source", "Backups"))
+
+	go func() {
+		delay := time.Duration(0)
+		if backups, err := ListBackups(); err == nil && len(backups) > 0 {
+			delay = max(0, interval-time.Since(backups[0].CreatedAt))
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+
+			if backup, err := CreateBackup(scheduledSuffix); err != nil {
+				logger.Error("Failed to create scheduled backup", zap.Error(err))
+			} else {
+				logger.Info("Created scheduled backup", zap.String("name", backup.Name))
+			}
+
+			timer.Reset(interval)
+		}
+	}()
+}
+
+func removeOldBackups() {
+	backups, err := ListBackups()
+	if err != nil {
+		log.Get().Error("Failed to list backups", zap.Error(err))
+		return
+	}
+
+	for idx, backup := range backups {
+		if idx < core.Env().KeepNBackups {
+			// Skip n backups to keep
+			continue
+		}
+		if err = os.Remove(filepath.Join(core.Env().MkDataDir(backupsDir), backup.Name)); err != nil {
+			log.Get().Error("Failed removing old backup", zap.String("name", backup.Name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/log"
+)
+
+// VacuumInto writes a consistent copy of the database to path, which must not exist yet.
+func VacuumInto(path string) error {
+	if _, err := GetDB().Exec("VACUUM INTO ?", path); err != nil {
+		return errors.Wrap(err, "failed to copy database")
+	}
+	return nil
+}
+
+// RestoreDatabase replaces the contents of the database with the database at path.
+// The database at path is checked and migrated to the latest version first, so the current database is
+// only touched once the restored database is known to be usable. Returns the migration version of
+// the database at path before it was migrated.
+func RestoreDatabase(path string) (uint, error) {
+	logger := log.Get().With(zap.String("source", path))
+
+	restoreDB, err := sql.Open("sqlite3", path+"?_foreign_keys=true")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open database to restore")
+	}
+	defer restoreDB.Close()
+
+	var integrity string
+	if err = restoreDB.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, errors.Wrap(err, "failed to check database integrity")
+	}
+	if integrity != "ok" {
+		return 0, errors.Errorf("database integrity check failed: %s", integrity)
+	}
+
+	fromVersion, err := MigrationVersion(restoreDB)
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Info("Migrating database to restore...", zap.Uint("version", fromVersion))
+	event, err := runUsingMigrations(restoreDB, func(m *migrate.Migrate) error {
+		return m.Up()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Info("Replacing database...")
+	if err = copyDatabase(restoreDB, GetDB()); err != nil {
+		return 0, err
+	}
+
+	// Handlers run against the current database, which now holds the restored data.
+	if err = runMigrationHandlers(GetDB(), event); err != nil {
+		return 0, err
+	}
+
+	return fromVersion, nil
+}
+
+// copyDatabase replaces all contents of dst with those of src, using the SQLite online backup API.
+func copyDatabase(src *sql.DB, dst *sql.DB) error {
+	ctx := context.Background()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get source connection")
+	}
+	defer srcConn.Close()
+
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get destination connection")
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := dstDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return errors.Wrap(err, "failed to start database copy")
+			}
+
+			if _, err = backup.Step(-1); err != nil {
+				_ = backup.Finish()
+				return errors.Wrap(err, "failed to copy database")
+			}
+
+			return errors.Wrap(backup.Finish(), "failed to finish database copy")
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core"
 	"juraji.nl/chat-quest/core/log"
@@ -37,9 +38,26 @@ func InitDB(env core.Environment) func() {
 		}
 	}
 
+	// Full-text search requires the sqlite_fts5 build tag, fail with a clear message rather than a failing migration
+	if err := checkFts5(db); err != nil {
+		dbLogger.Fatal("SQLite FTS5 is not available, build with '-tags sqlite_fts5'", zap.Error(err))
+	}
+
 	// Run migrations (will panic if fails)
 	runLatestMigrations(db)
 
 	// Return the db closer
 	return closeDB
 }
+
+// checkFts5 verifies that the SQLite library was built with the FTS5 extension.
+func checkFts5(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("sqlite was built without ENABLE_FTS5")
+	}
+	return nil
+}
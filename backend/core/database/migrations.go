@@ -2,11 +2,12 @@ package database
 
 import (
 	"database/sql"
-	"errors"
+	"io/fs"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core/log"
 )
@@ -17,75 +18,132 @@ import "embed"
 var migrationsFs embed.FS
 
 func runLatestMigrations(db *sql.DB) {
-	runUsingMigrations(db, func(m *migrate.Migrate) error {
+	event, err := runUsingMigrations(db, func(m *migrate.Migrate) error {
 		return m.Up()
 	})
+	if err != nil {
+		log.Get().Fatal("Failed to run migrations", zap.Error(err))
+	}
+
+	if err = runMigrationHandlers(db, event); err != nil {
+		log.Get().Fatal("Failed to run migration handlers", zap.Error(err))
+	}
 }
 
-func GoToVersion(db *sql.DB, version uint) {
-	runUsingMigrations(db, func(m *migrate.Migrate) error {
+func GoToVersion(db *sql.DB, version uint) error {
+	event, err := runUsingMigrations(db, func(m *migrate.Migrate) error {
 		return m.Migrate(version)
 	})
+	if err != nil {
+		return err
+	}
+
+	return runMigrationHandlers(db, event)
+}
+
+// LatestMigrationVersion returns the version of the latest available migration.
+func LatestMigrationVersion() (uint, error) {
+	fsDriver, err := iofs.New(migrationsFs, "migrations")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create fs driver")
+	}
+	defer fsDriver.Close()
+
+	version, err := fsDriver.First()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read migrations")
+	}
+
+	for {
+		next, err := fsDriver.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read migrations")
+		}
+		version = next
+	}
 }
 
-func runUsingMigrations(db *sql.DB, action func(m *migrate.Migrate) error) {
-	logger := log.Get()
-	var err error
+// MigrationVersion returns the current migration version of the database.
+// Returns an error if the database has no version or is left dirty by a failed migration.
+func MigrationVersion(db *sql.DB) (uint, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get migration version")
+	}
+	if dirty {
+		return 0, errors.Errorf("database is dirty at migration version %d", version)
+	}
+
+	return version, nil
+}
+
+// runUsingMigrations applies the migrations performed by action to db.
+func runUsingMigrations(db *sql.DB, action func(m *migrate.Migrate) error) (MigratedEvent, error) {
+	var event MigratedEvent
 
 	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
 	if err != nil {
-		logger.Fatal("Failed to open database for migrations", zap.Error(err))
+		return event, errors.Wrap(err, "failed to open database for migrations")
 	}
 
 	fsDriver, err := iofs.New(migrationsFs, "migrations")
 	if err != nil {
-		logger.Fatal("Failed to create fs driver", zap.Error(err))
+		return event, errors.Wrap(err, "failed to create fs driver")
 	}
 
 	m, err := migrate.NewWithInstance("iofs", fsDriver, "main", driver)
 	if err != nil {
-		logger.Fatal("Failed to create migrations object", zap.Error(err))
+		return event, errors.Wrap(err, "failed to create migrations object")
 	}
 
 	m.PrefetchMigrations = 0
 
-	fromVersion, _, err := m.Version()
+	event.FromVersion, _, err = m.Version()
 	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
-		logger.Fatal("Failed to get old version from migrations", zap.Error(err))
+		return event, errors.Wrap(err, "failed to get old version from migrations")
 	}
 
 	err = action(m)
 	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		logger.Fatal("Failed to apply migrations", zap.Error(err))
+		return event, errors.Wrap(err, "failed to apply migrations")
 	}
 
-	toVersion, _, err := m.Version()
+	event.ToVersion, _, err = m.Version()
 	if err != nil {
-		logger.Fatal("Failed to get new version from migrations", zap.Error(err))
+		return event, errors.Wrap(err, "failed to get new version from migrations")
 	}
 
-	// Emit migration event and wait for all listeners to complete
-	migratedEvent := MigratedEvent{FromVersion: fromVersion, ToVersion: toVersion}
-	err = MigrationsVersionUpgradeCompletedSignal.EmitBG(migratedEvent).Wait()
+	return event, nil
+}
+
+// runMigrationHandlers emits the migration signals, waiting for all listeners to complete,
+// and runs "post_migration.sql".
+func runMigrationHandlers(db *sql.DB, event MigratedEvent) error {
+	err := MigrationsVersionUpgradeCompletedSignal.EmitBG(event).Wait()
 	if err != nil {
-		logger.Fatal("Failed running version upgrade handlers")
+		return errors.Wrap(err, "failed running version upgrade handlers")
 	}
 
 	// Run "post_migration.sql" (Only when migrating up)
-	if fromVersion >= toVersion {
-		postMigrationSqlRaw, err := migrationsFs.ReadFile("migrations/post_migration.sql")
+	if event.FromVersion >= event.ToVersion {
+		postMigrationSql, err := migrationsFs.ReadFile("migrations/post_migration.sql")
 		if err != nil {
-			logger.Fatal("Failed to read post migrations file", zap.Error(err))
+			return errors.Wrap(err, "failed to read post migrations file")
 		}
-		postMigrationSql := string(postMigrationSqlRaw)
-		_, err = db.Exec(postMigrationSql)
-		if err != nil {
-			logger.Fatal("Failed to execute post migration", zap.Error(err))
+		if _, err = db.Exec(string(postMigrationSql)); err != nil {
+			return errors.Wrap(err, "failed to execute post migration")
 		}
 	}
 
-	err = MigrationsPostMigrationCompletedSignal.EmitBG(migratedEvent).Wait()
+	err = MigrationsPostMigrationCompletedSignal.EmitBG(event).Wait()
 	if err != nil {
-		logger.Fatal("Failed running post upgrade handlers")
+		return errors.Wrap(err, "failed running post upgrade handlers")
 	}
+
+	return nil
 }
@@ -0,0 +1,4 @@
+DROP TRIGGER chat_messages_sync_active_alternative;
+ALTER TABLE chat_messages
+  DROP COLUMN active_alternative_id;
+DROP TABLE chat_message_alternatives;
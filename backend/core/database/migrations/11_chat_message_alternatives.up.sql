@@ -0,0 +1,24 @@
+CREATE TABLE chat_message_alternatives
+(
+  id              INTEGER PRIMARY KEY AUTOINCREMENT,
+  chat_message_id INTEGER   NOT NULL REFERENCES chat_messages (id) ON DELETE CASCADE,
+  created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  content         TEXT      NOT NULL,
+  reasoning       TEXT      NOT NULL
+);
+
+ALTER TABLE chat_messages
+  ADD COLUMN active_alternative_id INTEGER REFERENCES chat_message_alternatives (id) ON DELETE SET NULL;
+
+-- Keep the active alternative in sync with the message content, this way any update to the message
+-- (streaming, user edits) is reflected in the alternative currently shown.
+CREATE TRIGGER chat_messages_sync_active_alternative
+  AFTER UPDATE OF content, reasoning
+  ON chat_messages
+  WHEN NEW.active_alternative_id IS NOT NULL
+BEGIN
+  UPDATE chat_message_alternatives
+  SET content   = NEW.content,
+      reasoning = NEW.reasoning
+  WHERE id = NEW.active_alternative_id;
+END;
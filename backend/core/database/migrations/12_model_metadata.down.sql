@@ -0,0 +1,15 @@
+ALTER TABLE instructions
+  DROP COLUMN top_k;
+ALTER TABLE instructions
+  DROP COLUMN min_p;
+ALTER TABLE instructions
+  DROP COLUMN repeat_penalty;
+ALTER TABLE instructions
+  DROP COLUMN mirostat;
+ALTER TABLE instructions
+  DROP COLUMN mirostat_tau;
+ALTER TABLE instructions
+  DROP COLUMN mirostat_eta;
+
+ALTER TABLE llm_models
+  DROP COLUMN context_length;
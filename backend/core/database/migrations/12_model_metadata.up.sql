@@ -0,0 +1,17 @@
+-- Extended sampler options, only supported by some providers (NULL = provider default)
+ALTER TABLE instructions
+  ADD COLUMN top_k INTEGER;
+ALTER TABLE instructions
+  ADD COLUMN min_p FLOAT;
+ALTER TABLE instructions
+  ADD COLUMN repeat_penalty FLOAT;
+ALTER TABLE instructions
+  ADD COLUMN mirostat INTEGER;
+ALTER TABLE instructions
+  ADD COLUMN mirostat_tau FLOAT;
+ALTER TABLE instructions
+  ADD COLUMN mirostat_eta FLOAT;
+
+-- Context length as reported by the provider (NULL = unknown)
+ALTER TABLE llm_models
+  ADD COLUMN context_length INTEGER;
@@ -0,0 +1,8 @@
+ALTER TABLE preferences
+  DROP COLUMN summary_model_id;
+ALTER TABLE preferences
+  DROP COLUMN summary_instruction_id;
+ALTER TABLE preferences
+  DROP COLUMN summary_trigger_after;
+
+DROP TABLE chat_session_summaries;
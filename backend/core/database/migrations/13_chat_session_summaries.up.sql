@@ -0,0 +1,16 @@
+CREATE TABLE chat_session_summaries
+(
+  chat_session_id  INTEGER PRIMARY KEY REFERENCES chat_sessions (id) ON DELETE CASCADE,
+  -- The last message folded into the summary. Deleting it (or any message before it) invalidates the summary,
+  -- the application deletes the summary along with messages before it.
+  up_to_message_id INTEGER   NOT NULL REFERENCES chat_messages (id) ON DELETE CASCADE,
+  updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  content          TEXT      NOT NULL
+);
+
+ALTER TABLE preferences
+  ADD COLUMN summary_model_id INTEGER REFERENCES llm_models (id) ON DELETE SET NULL;
+ALTER TABLE preferences
+  ADD COLUMN summary_instruction_id INTEGER REFERENCES instructions (id) ON DELETE SET NULL;
+ALTER TABLE preferences
+  ADD COLUMN summary_trigger_after INTEGER NOT NULL DEFAULT 10;
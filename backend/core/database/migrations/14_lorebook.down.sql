@@ -0,0 +1,6 @@
+ALTER TABLE preferences
+  DROP COLUMN lorebook_scan_depth;
+ALTER TABLE preferences
+  DROP COLUMN lorebook_token_budget;
+
+DROP TABLE lorebook_entries;
@@ -0,0 +1,26 @@
+CREATE TABLE lorebook_entries
+(
+  id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+  world_id           INTEGER     NOT NULL REFERENCES worlds (id) ON DELETE CASCADE,
+  -- When set, the entry is only used when this character is responding.
+  character_id       INTEGER REFERENCES characters (id) ON DELETE CASCADE,
+  name               VARCHAR(100) NOT NULL,
+  content            TEXT        NOT NULL,
+  -- Comma separated, entries formatted as /pattern/ are regular expressions.
+  keywords           TEXT        NOT NULL,
+  secondary_keywords TEXT DEFAULT NULL,
+  secondary_logic    VARCHAR(10) NOT NULL DEFAULT 'AND_ANY',
+  case_sensitive     BIT(1)      NOT NULL DEFAULT 0,
+  always_include     BIT(1)      NOT NULL DEFAULT 0,
+  enabled            BIT(1)      NOT NULL DEFAULT 1,
+  priority           INTEGER     NOT NULL DEFAULT 0,
+  position           VARCHAR(20) NOT NULL DEFAULT 'WORLD_INFO',
+  token_budget       INTEGER DEFAULT NULL
+);
+
+CREATE INDEX lorebook_entries_world_id_idx ON lorebook_entries (world_id);
+
+ALTER TABLE preferences
+  ADD COLUMN lorebook_scan_depth INTEGER NOT NULL DEFAULT 4;
+ALTER TABLE preferences
+  ADD COLUMN lorebook_token_budget INTEGER NOT NULL DEFAULT 1024;
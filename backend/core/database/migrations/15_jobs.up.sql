@@ -0,0 +1,18 @@
+CREATE TABLE jobs
+(
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  type         VARCHAR(100) NOT NULL,
+  state        VARCHAR(10)  NOT NULL DEFAULT 'QUEUED',
+  -- Jobs with the same ordering key are run one at a time, in order of creation.
+  ordering_key VARCHAR(100) DEFAULT NULL,
+  payload      TEXT         NOT NULL,
+  attempts     INTEGER      NOT NULL DEFAULT 0,
+  max_attempts INTEGER      NOT NULL,
+  last_error   TEXT         DEFAULT NULL,
+  run_after    TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  created_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX jobs_state_run_after_idx ON jobs (state, run_after);
+CREATE INDEX jobs_ordering_key_idx ON jobs (ordering_key);
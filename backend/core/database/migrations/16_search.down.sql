@@ -0,0 +1,14 @@
+DROP TRIGGER characters_fts_au;
+DROP TRIGGER characters_fts_ad;
+DROP TRIGGER characters_fts_ai;
+DROP TABLE characters_fts;
+
+DROP TRIGGER memories_fts_au;
+DROP TRIGGER memories_fts_ad;
+DROP TRIGGER memories_fts_ai;
+DROP TABLE memories_fts;
+
+DROP TRIGGER chat_messages_fts_au;
+DROP TRIGGER chat_messages_fts_ad;
+DROP TRIGGER chat_messages_fts_ai;
+DROP TABLE chat_messages_fts;
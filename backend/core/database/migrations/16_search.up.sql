@@ -0,0 +1,103 @@
+-- Full-text search indexes, using external content tables kept in sync by triggers.
+-- Requires SQLite with FTS5 (build with the "sqlite_fts5" tag).
+CREATE VIRTUAL TABLE chat_messages_fts USING fts5
+(
+  content,
+  content = 'chat_messages',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER chat_messages_fts_ai
+  AFTER INSERT
+  ON chat_messages
+BEGIN
+  INSERT INTO chat_messages_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER chat_messages_fts_ad
+  AFTER DELETE
+  ON chat_messages
+BEGIN
+  INSERT INTO chat_messages_fts (chat_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER chat_messages_fts_au
+  AFTER UPDATE OF content
+  ON chat_messages
+BEGIN
+  INSERT INTO chat_messages_fts (chat_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+  INSERT INTO chat_messages_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE VIRTUAL TABLE memories_fts USING fts5
+(
+  content,
+  content = 'memories',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER memories_fts_ai
+  AFTER INSERT
+  ON memories
+BEGIN
+  INSERT INTO memories_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER memories_fts_ad
+  AFTER DELETE
+  ON memories
+BEGIN
+  INSERT INTO memories_fts (memories_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER memories_fts_au
+  AFTER UPDATE OF content
+  ON memories
+BEGIN
+  INSERT INTO memories_fts (memories_fts, rowid, content) VALUES ('delete', old.id, old.content);
+  INSERT INTO memories_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE VIRTUAL TABLE characters_fts USING fts5
+(
+  name,
+  appearance,
+  personality,
+  history,
+  content = 'characters',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER characters_fts_ai
+  AFTER INSERT
+  ON characters
+BEGIN
+  INSERT INTO characters_fts (rowid, name, appearance, personality, history)
+  VALUES (new.id, new.name, new.appearance, new.personality, new.history);
+END;
+
+CREATE TRIGGER characters_fts_ad
+  AFTER DELETE
+  ON characters
+BEGIN
+  INSERT INTO characters_fts (characters_fts, rowid, name, appearance, personality, history)
+  VALUES ('delete', old.id, old.name, old.appearance, old.personality, old.history);
+END;
+
+CREATE TRIGGER characters_fts_au
+  AFTER UPDATE OF name, appearance, personality, history
+  ON characters
+BEGIN
+  INSERT INTO characters_fts (characters_fts, rowid, name, appearance, personality, history)
+  VALUES ('delete', old.id, old.name, old.appearance, old.personality, old.history);
+  INSERT INTO characters_fts (rowid, name, appearance, personality, history)
+  VALUES (new.id, new.name, new.appearance, new.personality, new.history);
+END;
+
+-- Index existing data
+INSERT INTO chat_messages_fts (chat_messages_fts) VALUES ('rebuild');
+INSERT INTO memories_fts (memories_fts) VALUES ('rebuild');
+INSERT INTO characters_fts (characters_fts) VALUES ('rebuild');
@@ -0,0 +1,4 @@
+ALTER TABLE preferences
+  DROP COLUMN memory_vector_weight;
+ALTER TABLE preferences
+  DROP COLUMN memory_keyword_weight;
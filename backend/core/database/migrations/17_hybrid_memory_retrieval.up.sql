@@ -0,0 +1,5 @@
+-- Memory relevance is the weighted sum of the embedding similarity and the (normalized) BM25 keyword score.
+ALTER TABLE preferences
+  ADD COLUMN memory_vector_weight REAL NOT NULL DEFAULT 1.0;
+ALTER TABLE preferences
+  ADD COLUMN memory_keyword_weight REAL NOT NULL DEFAULT 0.3;
@@ -0,0 +1,15 @@
+ALTER TABLE preferences
+  DROP COLUMN memory_mmr_lambda;
+ALTER TABLE preferences
+  DROP COLUMN memory_importance_weight;
+ALTER TABLE preferences
+  DROP COLUMN memory_recency_half_life_days;
+ALTER TABLE preferences
+  DROP COLUMN memory_recency_weight;
+ALTER TABLE preferences
+  DROP COLUMN memory_token_budget;
+ALTER TABLE preferences
+  DROP COLUMN memory_top_k;
+
+ALTER TABLE memories
+  DROP COLUMN importance;
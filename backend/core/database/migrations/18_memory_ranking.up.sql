@@ -0,0 +1,18 @@
+-- How important a memory is to the character, from 0 (trivial) to 1 (defining).
+ALTER TABLE memories
+  ADD COLUMN importance REAL NOT NULL DEFAULT 0.5;
+
+-- Memories passing Min P are ranked by relevance, boosted by recency and importance, and selected using maximal
+-- marginal relevance until the top K or the token budget is reached (0 is unlimited).
+ALTER TABLE preferences
+  ADD COLUMN memory_top_k INTEGER NOT NULL DEFAULT 10;
+ALTER TABLE preferences
+  ADD COLUMN memory_token_budget INTEGER NOT NULL DEFAULT 1024;
+ALTER TABLE preferences
+  ADD COLUMN memory_recency_weight REAL NOT NULL DEFAULT 0.1;
+ALTER TABLE preferences
+  ADD COLUMN memory_recency_half_life_days REAL NOT NULL DEFAULT 30.0;
+ALTER TABLE preferences
+  ADD COLUMN memory_importance_weight REAL NOT NULL DEFAULT 0.1;
+ALTER TABLE preferences
+  ADD COLUMN memory_mmr_lambda REAL NOT NULL DEFAULT 0.7;
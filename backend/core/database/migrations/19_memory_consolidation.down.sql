@@ -0,0 +1,14 @@
+ALTER TABLE preferences
+  DROP COLUMN memory_consolidation_auto_apply;
+ALTER TABLE preferences
+  DROP COLUMN memory_consolidation_interval_hours;
+ALTER TABLE preferences
+  DROP COLUMN memory_consolidation_threshold;
+ALTER TABLE preferences
+  DROP COLUMN memory_consolidation_instruction_id;
+ALTER TABLE preferences
+  DROP COLUMN memory_consolidation_model_id;
+
+DROP TABLE memory_consolidation_runs;
+DROP TABLE memory_merge_sources;
+DROP TABLE memory_consolidation_proposals;
@@ -0,0 +1,46 @@
+-- Proposed merges of similar memories, replacing the source memories by the proposed memories once applied.
+CREATE TABLE memory_consolidation_proposals
+(
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  world_id          INTEGER   NOT NULL REFERENCES worlds (id) ON DELETE CASCADE,
+  character_id      INTEGER REFERENCES characters (id) ON DELETE CASCADE,
+  created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  -- JSON array of the IDs of the memories to replace
+  source_memory_ids TEXT      NOT NULL,
+  -- JSON array of the memories to replace them with
+  memories          TEXT      NOT NULL
+);
+
+CREATE INDEX memory_consolidation_proposals_world_id_idx ON memory_consolidation_proposals (world_id);
+
+-- Provenance of consolidated memories, the memories that were merged into them.
+CREATE TABLE memory_merge_sources
+(
+  id               INTEGER PRIMARY KEY AUTOINCREMENT,
+  memory_id        INTEGER   NOT NULL REFERENCES memories (id) ON DELETE CASCADE,
+  -- The merged memory no longer exists, so its contents are kept here
+  source_memory_id INTEGER   NOT NULL,
+  content          TEXT      NOT NULL,
+  created_at       TIMESTAMP,
+  merged_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX memory_merge_sources_memory_id_idx ON memory_merge_sources (memory_id);
+
+CREATE TABLE memory_consolidation_runs
+(
+  world_id    INTEGER PRIMARY KEY REFERENCES worlds (id) ON DELETE CASCADE,
+  last_run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Consolidation is disabled when no model is set, an interval of 0 only consolidates on demand.
+ALTER TABLE preferences
+  ADD COLUMN memory_consolidation_model_id INTEGER REFERENCES llm_models (id) ON DELETE SET NULL;
+ALTER TABLE preferences
+  ADD COLUMN memory_consolidation_instruction_id INTEGER REFERENCES instructions (id) ON DELETE SET NULL;
+ALTER TABLE preferences
+  ADD COLUMN memory_consolidation_threshold REAL NOT NULL DEFAULT 0.9;
+ALTER TABLE preferences
+  ADD COLUMN memory_consolidation_interval_hours INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE preferences
+  ADD COLUMN memory_consolidation_auto_apply BIT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+ALTER TABLE preferences
+  DROP COLUMN memory_on_messages_deleted;
+
+DROP INDEX memories_source_idx;
+
+ALTER TABLE memories
+  DROP COLUMN source_to_message_id;
+ALTER TABLE memories
+  DROP COLUMN source_from_message_id;
+ALTER TABLE memories
+  DROP COLUMN source_chat_session_id;
@@ -0,0 +1,13 @@
+-- Messages are not referenced, so the source range is kept when they are deleted.
+ALTER TABLE memories
+  ADD COLUMN source_chat_session_id INTEGER REFERENCES chat_sessions (id) ON DELETE SET NULL;
+ALTER TABLE memories
+  ADD COLUMN source_from_message_id INTEGER;
+ALTER TABLE memories
+  ADD COLUMN source_to_message_id INTEGER;
+
+CREATE INDEX memories_source_idx ON memories (source_chat_session_id, source_to_message_id);
+
+-- What to do with memories generated from messages that are deleted: KEEP, DELETE or REGENERATE.
+ALTER TABLE preferences
+  ADD COLUMN memory_on_messages_deleted VARCHAR(50) NOT NULL DEFAULT 'KEEP';
@@ -0,0 +1,2 @@
+-- Embeddings are rewritten back to float64 in Go, see model/memories/setup.go.
+SELECT 1;
@@ -0,0 +1,4 @@
+-- Embeddings are rewritten from float64 to the versioned encoding (float32 or int8) in Go,
+-- see model/memories/setup.go. Both encodings are told apart by their byte length, so the rewrite resumes on the
+-- next startup when it was interrupted.
+SELECT 1;
@@ -0,0 +1,4 @@
+ALTER TABLE connection_profiles
+  DROP COLUMN requests_per_minute;
+ALTER TABLE connection_profiles
+  DROP COLUMN max_concurrent_requests;
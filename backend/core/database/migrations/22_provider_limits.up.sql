@@ -0,0 +1,6 @@
+-- Maximum number of requests running at the same time, requests beyond it wait in line.
+ALTER TABLE connection_profiles
+  ADD COLUMN max_concurrent_requests INTEGER NOT NULL DEFAULT 1;
+-- Maximum number of requests started per minute, 0 for no limit.
+ALTER TABLE connection_profiles
+  ADD COLUMN requests_per_minute INTEGER NOT NULL DEFAULT 0;
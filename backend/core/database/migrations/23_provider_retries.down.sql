@@ -0,0 +1,9 @@
+ALTER TABLE chat_sessions
+  DROP COLUMN chat_fallback_model_ids;
+ALTER TABLE preferences
+  DROP COLUMN chat_fallback_model_ids;
+
+ALTER TABLE connection_profiles
+  DROP COLUMN retry_backoff_millis;
+ALTER TABLE connection_profiles
+  DROP COLUMN max_retries;
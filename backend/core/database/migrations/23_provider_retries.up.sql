@@ -0,0 +1,13 @@
+-- Retries of requests that failed with a temporary error (rate limits, server errors, connection problems).
+ALTER TABLE connection_profiles
+  ADD COLUMN max_retries INTEGER NOT NULL DEFAULT 2;
+-- Wait before the first retry, doubles for every next retry. A Retry-After from the provider takes precedence.
+ALTER TABLE connection_profiles
+  ADD COLUMN retry_backoff_millis INTEGER NOT NULL DEFAULT 1000;
+
+-- Ordered JSON arrays of LLM model IDs, tried when the chat model keeps failing.
+-- Sessions without fallback models use those of the preferences.
+ALTER TABLE preferences
+  ADD COLUMN chat_fallback_model_ids TEXT;
+ALTER TABLE chat_sessions
+  ADD COLUMN chat_fallback_model_ids TEXT;
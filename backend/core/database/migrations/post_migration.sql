@@ -13,3 +13,13 @@ UPDATE preferences
 SET title_generation_instruction_id = (SELECT id FROM instructions WHERE type = 'TITLE_GENERATION' LIMIT 1)
 WHERE id = 0
   AND title_generation_instruction_id is null;
+-- Default Summary Instruction
+UPDATE preferences
+SET summary_instruction_id = (SELECT id FROM instructions WHERE type = 'SUMMARY' LIMIT 1)
+WHERE id = 0
+  AND summary_instruction_id is null;
+-- Default Memory Consolidation Instruction
+UPDATE preferences
+SET memory_consolidation_instruction_id = (SELECT id FROM instructions WHERE type = 'MEMORY_CONSOLIDATION' LIMIT 1)
+WHERE id = 0
+  AND memory_consolidation_instruction_id is null;
@@ -49,16 +49,11 @@ func Transactional(action func(ctx *TxContext) error) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to begin transaction")
 	}
-	defer func(err error) {
-		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				panic(rbErr)
-			}
-		}
-	}(err)
-
 	err = action(&TxContext{tx: tx})
 	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			panic(rbErr)
+		}
 		return errors.Wrap(err, "failed to execute transaction")
 	}
 
@@ -70,6 +65,11 @@ func Transactional(action func(ctx *TxContext) error) error {
 	return nil
 }
 
+// QueryForRecordTx is QueryForRecord within a transaction, as methods cannot have type parameters.
+func QueryForRecordTx[T any](ctx *TxContext, query string, args []any, scanFunc RowScannerFunc[T]) (*T, error) {
+	return queryForRecord[T](ctx.tx, query, args, scanFunc)
+}
+
 func (tx *TxContext) InsertRecord(query string, args []any, scanTo ...any) error {
 	return insertRecord(tx.tx, query, args, scanTo)
 }
@@ -80,6 +80,12 @@ func (tx *TxContext) DeleteRecord(query string, args []any) ([]int, error) {
 	return deleteRecord(tx.tx, query, args)
 }
 
+// Exec executes the query, without requiring any rows to be affected.
+func (tx *TxContext) Exec(query string, args []any) error {
+	_, err := tx.tx.Exec(query, args...)
+	return err
+}
+
 func queryForList[T any](
 	q queryExecutor,
 	query string,
@@ -21,6 +21,12 @@ type Environment struct {
 	ApiBasePath      string
 	DefaultFSPerm    os.FileMode
 	KeepNLogFiles    int
+	// BackupIntervalHours is the interval of automatic backups, 0 disables them.
+	BackupIntervalHours int
+	KeepNBackups        int
+	// QuantizeEmbeddings stores embeddings quantized to int8 instead of float32, a quarter of the size at a small
+	// loss of precision.
+	QuantizeEmbeddings bool
 }
 
 // MkDataDir creates directories in the application data directory and returns the full path.
@@ -52,15 +58,17 @@ func InitEnvironment() {
 	var err error
 
 	currentEnvironment = Environment{
-		DataDirectory:    "./data",
-		ChatQuestUIRoot:  "./browser",
-		DebugEnabled:     false,
-		CorsAllowOrigins: []string{"http://localhost:8080", "http://127.0.0.1:8080"},
-		ApplicationHost:  "localhost",
-		ApplicationPort:  "8080",
-		ApiBasePath:      "/api",
-		DefaultFSPerm:    0644,
-		KeepNLogFiles:    5,
+		DataDirectory:       "./data",
+		ChatQuestUIRoot:     "./browser",
+		DebugEnabled:        false,
+		CorsAllowOrigins:    []string{"http://localhost:8080", "http://127.0.0.1:8080"},
+		ApplicationHost:     "localhost",
+		ApplicationPort:     "8080",
+		ApiBasePath:         "/api",
+		DefaultFSPerm:       0644,
+		KeepNLogFiles:       5,
+		BackupIntervalHours: 24,
+		KeepNBackups:        7,
 	}
 
 	setStringFromEnvIfPresent("CHAT_QUEST_DATA_DIR", &currentEnvironment.DataDirectory)
@@ -82,10 +90,16 @@ func InitEnvironment() {
 	setStringFromEnvIfPresent("CHAT_QUEST_APPLICATION_PORT", &currentEnvironment.ApplicationPort)
 	setStringFromEnvIfPresent("CHAT_QUEST_API_BASE_PATH", &currentEnvironment.ApiBasePath)
 	setIntFromEnvIfPresent("CHAT_QUEST_KEEP_NLOG_FILES", &currentEnvironment.KeepNLogFiles)
+	setIntFromEnvIfPresent("CHAT_QUEST_BACKUP_INTERVAL_HOURS", &currentEnvironment.BackupIntervalHours)
+	setIntFromEnvIfPresent("CHAT_QUEST_KEEP_NBACKUPS", &currentEnvironment.KeepNBackups)
 
 	var debugModeVal string
 	setStringFromEnvIfPresent("CHAT_QUEST_DEBUG", &debugModeVal)
 	currentEnvironment.DebugEnabled = debugModeVal == "true"
+
+	var quantizeEmbeddingsVal string
+	setStringFromEnvIfPresent("CHAT_QUEST_QUANTIZE_EMBEDDINGS", &quantizeEmbeddingsVal)
+	currentEnvironment.QuantizeEmbeddings = quantizeEmbeddingsVal == "true"
 }
 
 func Env() Environment {
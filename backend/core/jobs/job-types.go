@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxAttempts is the number of times a job is attempted before it is marked as failed.
+const DefaultMaxAttempts = 3
+
+// SingleAttempt is for jobs that are not safe to retry, such as jobs that leave partial results behind on failure.
+const SingleAttempt = 1
+
+// JobHandler processes the payload of a job.
+// Returning an error marks the attempt as failed, after which the job is retried with backoff.
+type JobHandler[T any] func(ctx context.Context, payload T) error
+
+// JobType describes a type of job, with a JSON serializable payload of type T.
+type JobType[T any] struct {
+	name        string
+	maxAttempts int
+}
+
+// jobRunner runs a job from its stored (JSON) payload.
+type jobRunner func(ctx context.Context, payload []byte) error
+
+var (
+	jobRunners   = make(map[string]jobRunner)
+	jobRunnersMu sync.RWMutex
+)
+
+// NewJobType registers a new type of job and returns it.
+// Provide a unique name for each job type, as it is used to look up the handler for stored jobs.
+func NewJobType[T any](name string, maxAttempts int, handler JobHandler[T]) *JobType[T] {
+	jobRunnersMu.Lock()
+	defer jobRunnersMu.Unlock()
+
+	if _, exists := jobRunners[name]; exists {
+		panic(fmt.Sprintf("job type %s already exists", name))
+	}
+
+	jobRunners[name] = func(ctx context.Context, payload []byte) error {
+		var p T
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return errors.Wrap(err, "failed to unmarshal job payload")
+		}
+		return handler(ctx, p)
+	}
+
+	return &JobType[T]{
+		name:        name,
+		maxAttempts: max(maxAttempts, 1),
+	}
+}
+
+// Enqueue stores a new job with the given payload and notifies the workers.
+// Jobs with the same (non-empty) orderingKey are run one at a time, in the order they were enqueued.
+func (t *JobType[T]) Enqueue(payload T, orderingKey string) error {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal payload for job type %s", t.name)
+	}
+
+	var key *string
+	if orderingKey != "" {
+		key = &orderingKey
+	}
+
+	if _, err = createJob(t.name, payloadJson, key, t.maxAttempts); err != nil {
+		return errors.Wrapf(err, "failed to enqueue job of type %s", t.name)
+	}
+
+	wakeDispatcher()
+	return nil
+}
+
+func getJobRunner(name string) (jobRunner, bool) {
+	jobRunnersMu.RLock()
+	defer jobRunnersMu.RUnlock()
+
+	runner, ok := jobRunners[name]
+	return runner, ok
+}
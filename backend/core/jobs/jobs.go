@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"encoding/json"
+	"time"
+
+	"juraji.nl/chat-quest/core/database"
+)
+
+type JobState string
+
+const (
+	JobQueued  JobState = "QUEUED"
+	JobRunning JobState = "RUNNING"
+	JobFailed  JobState = "FAILED"
+	JobDone    JobState = "DONE"
+)
+
+func (s JobState) IsValid() bool {
+	switch s {
+	case JobQueued, JobRunning, JobFailed, JobDone:
+		return true
+	default:
+		return false
+	}
+}
+
+type Job struct {
+	ID          int             `json:"id"`
+	Type        string          `json:"type"`
+	State       JobState        `json:"state"`
+	OrderingKey *string         `json:"orderingKey"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	LastError   *string         `json:"lastError"`
+	RunAfter    *time.Time      `json:"runAfter"`
+	CreatedAt   *time.Time      `json:"createdAt"`
+	UpdatedAt   *time.Time      `json:"updatedAt"`
+}
+
+// JobProgress is emitted by running jobs that report their progress.
+type JobProgress struct {
+	JobID    int     `json:"jobId"`
+	Type     string  `json:"type"`
+	Progress float64 `json:"progress"`
+	Message  string  `json:"message"`
+}
+
+func jobScanner(scanner database.RowScanner, dest *Job) error {
+	var payload string
+	err := scanner.Scan(
+		&dest.ID,
+		&dest.Type,
+		&dest.State,
+		&dest.OrderingKey,
+		&payload,
+		&dest.Attempts,
+		&dest.MaxAttempts,
+		&dest.LastError,
+		&dest.RunAfter,
+		&dest.CreatedAt,
+		&dest.UpdatedAt,
+	)
+	dest.Payload = json.RawMessage(payload)
+	return err
+}
+
+func GetAllJobs() ([]Job, error) {
+	query := "SELECT * FROM jobs ORDER BY id"
+	return database.QueryForList(query, nil, jobScanner)
+}
+
+func GetJobsByState(state JobState) ([]Job, error) {
+	query := "SELECT * FROM jobs WHERE state = ? ORDER BY id"
+	args := []any{state}
+	return database.QueryForList(query, args, jobScanner)
+}
+
+func JobById(id int) (*Job, error) {
+	query := "SELECT * FROM jobs WHERE id = ?"
+	args := []any{id}
+	return database.QueryForRecord(query, args, jobScanner)
+}
+
+// RetryJob re-queues a failed job, resetting its attempts.
+// Returns nil if the job does not exist or has not failed.
+func RetryJob(id int) (*Job, error) {
+	query := `UPDATE jobs
+              SET state = ?, attempts = 0, last_error = NULL, run_after = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+              WHERE id = ? AND state = ?
+              RETURNING *`
+	args := []any{JobQueued, id, JobFailed}
+
+	job, err := database.QueryForRecord(query, args, jobScanner)
+	if err == nil && job != nil {
+		JobUpdatedSignal.EmitBG(job)
+		wakeDispatcher()
+	}
+
+	return job, err
+}
+
+// DeleteJob deletes a job, unless it is running.
+func DeleteJob(id int) error {
+	query := "DELETE FROM jobs WHERE id = ? AND state != ? RETURNING id"
+	args := []any{id, JobRunning}
+
+	ids, err := database.DeleteRecord(query, args)
+
+	if err == nil && len(ids) > 0 {
+		JobDeletedSignal.EmitBG(id)
+	}
+
+	return err
+}
+
+// DeleteJobsByState deletes all jobs in the given state, running jobs can not be deleted.
+func DeleteJobsByState(state JobState) error {
+	query := "DELETE FROM jobs WHERE state = ? AND state != ? RETURNING id"
+	args := []any{state, JobRunning}
+
+	ids, err := database.DeleteRecord(query, args)
+
+	if err == nil {
+		JobDeletedSignal.EmitAllBG(ids)
+	}
+
+	return err
+}
+
+func createJob(jobType string, payload []byte, orderingKey *string, maxAttempts int) (*Job, error) {
+	query := `INSERT INTO jobs (type, ordering_key, payload, max_attempts) VALUES (?, ?, ?, ?) RETURNING *`
+	args := []any{jobType, orderingKey, string(payload), maxAttempts}
+
+	job, err := database.QueryForRecord(query, args, jobScanner)
+	if err == nil {
+		JobCreatedSignal.EmitBG(job)
+	}
+
+	return job, err
+}
+
+// getRunnableJobs returns queued jobs that are due, skipping jobs that have an earlier unfinished job with the
+// same ordering key.
+func getRunnableJobs(limit int) ([]Job, error) {
+	query := `SELECT *
+              FROM jobs j
+              WHERE j.state = ?
+                AND j.run_after <= CURRENT_TIMESTAMP
+                AND (j.ordering_key IS NULL OR NOT EXISTS(SELECT 1
+                                                          FROM jobs o
+                                                          WHERE o.ordering_key = j.ordering_key
+                                                            AND o.id < j.id
+                                                            AND o.state IN (?, ?)))
+              ORDER BY j.id
+              LIMIT ?`
+	args := []any{JobQueued, JobQueued, JobRunning, limit}
+	return database.QueryForList(query, args, jobScanner)
+}
+
+func markJobRunning(id int) (*Job, error) {
+	query := `UPDATE jobs
+              SET state = ?, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+              WHERE id = ?
+              RETURNING *`
+	args := []any{JobRunning, id}
+	return updateJobState(query, args)
+}
+
+func markJobDone(id int) (*Job, error) {
+	query := `UPDATE jobs
+              SET state = ?, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+              WHERE id = ?
+              RETURNING *`
+	args := []any{JobDone, id}
+	return updateJobState(query, args)
+}
+
+func markJobFailed(id int, jobErr string) (*Job, error) {
+	query := `UPDATE jobs
+              SET state = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+              WHERE id = ?
+              RETURNING *`
+	args := []any{JobFailed, jobErr, id}
+	return updateJobState(query, args)
+}
+
+func markJobForRetry(id int, jobErr string, delay time.Duration) (*Job, error) {
+	query := `UPDATE jobs
+              SET state = ?,
+                  last_error = ?,
+                  run_after = DATETIME('now', '+' || ? || ' seconds'),
+                  updated_at = CURRENT_TIMESTAMP
+              WHERE id = ?
+              RETURNING *`
+	args := []any{JobQueued, jobErr, int(delay.Seconds()), id}
+	return updateJobState(query, args)
+}
+
+func updateJobState(query string, args []any) (*Job, error) {
+	job, err := database.QueryForRecord(query, args, jobScanner)
+	if err == nil && job != nil {
+		JobUpdatedSignal.EmitBG(job)
+	}
+	return job, err
+}
+
+// requeueInterruptedJobs puts jobs that were running when the application stopped back in the queue.
+// The interrupted attempt does not count towards the maximum attempts, unless it was the last attempt: those jobs
+// are marked as failed, as they may have left partial results behind (see SingleAttempt).
+// Returns the number of requeued and failed jobs.
+func requeueInterruptedJobs() (int, int, error) {
+	query := `UPDATE jobs
+              SET state = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+              WHERE state = ? AND attempts >= max_attempts
+              RETURNING id`
+	args := []any{JobFailed, "interrupted by shutdown", JobRunning}
+
+	failed, err := database.QueryForList(query, args, database.IntScanner)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = `UPDATE jobs
+              SET state = ?, attempts = MAX(attempts - 1, 0), updated_at = CURRENT_TIMESTAMP
+              WHERE state = ?
+              RETURNING id`
+	args = []any{JobQueued, JobRunning}
+
+	requeued, err := database.QueryForList(query, args, database.IntScanner)
+	return len(requeued), len(failed), err
+}
+
+// FailUnfinishedJobs marks all queued and running jobs as failed with the given reason, so they do not run (again).
+// They can still be retried manually. Meant for jobs that ended up in the database from elsewhere, like a backup.
+func FailUnfinishedJobs(reason string) error {
+	query := `UPDATE jobs
+              SET state = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+              WHERE state IN (?, ?)
+              RETURNING *`
+	args := []any{JobFailed, reason, JobQueued, JobRunning}
+
+	failedJobs, err := database.QueryForList(query, args, jobScanner)
+	if err == nil {
+		for i := range failedJobs {
+			JobUpdatedSignal.EmitBG(&failedJobs[i])
+		}
+	}
+
+	return err
+}
+
+// deleteFinishedJobsBefore removes jobs that are done since before the given time.
+func deleteFinishedJobsBefore(before time.Duration) error {
+	query := `DELETE FROM jobs WHERE state = ? AND updated_at < DATETIME('now', '-' || ? || ' seconds')`
+	args := []any{JobDone, int(before.Seconds())}
+	_, err := database.DeleteRecord(query, args)
+	return err
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/log"
+)
+
+// setupTestDB initializes a migrated database in a temporary data directory.
+// Skipped when SQLite is built without FTS5, which the migrations require (build with '-tags sqlite_fts5').
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	var fts5 bool
+	err = db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+	_ = db.Close()
+	if err != nil || !fts5 {
+		t.Skip("SQLite is built without FTS5, run with '-tags sqlite_fts5'")
+	}
+
+	env := core.Environment{DataDirectory: t.TempDir(), DefaultFSPerm: 0o644}
+	log.InitLogger(env)
+	t.Cleanup(database.InitDB(env))
+}
+
+func createTestJob(t *testing.T, orderingKey *string) int {
+	t.Helper()
+
+	job, err := createJob("test", []byte("{}"), orderingKey, DefaultMaxAttempts)
+	if err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	return job.ID
+}
+
+func runnableJobIds(t *testing.T, limit int) []int {
+	t.Helper()
+
+	runnable, err := getRunnableJobs(limit)
+	if err != nil {
+		t.Fatalf("failed to get runnable jobs: %v", err)
+	}
+	ids := make([]int, len(runnable))
+	for i, job := range runnable {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+func TestGetRunnableJobsOrdering(t *testing.T) {
+	setupTestDB(t)
+
+	keyA, keyB := "session-1", "session-2"
+	a1 := createTestJob(t, &keyA)
+	a2 := createTestJob(t, &keyA)
+	unordered := createTestJob(t, nil)
+	b1 := createTestJob(t, &keyB)
+	a3 := createTestJob(t, &keyA)
+
+	steps := []struct {
+		name     string
+		action   func() (*Job, error)
+		limit    int
+		expected []int
+	}{
+		{
+			name:     "only the first job per ordering key is runnable",
+			limit:    10,
+			expected: []int{a1, unordered, b1},
+		},
+		{
+			name:     "runnable jobs are limited in order of creation",
+			limit:    2,
+			expected: []int{a1, unordered},
+		},
+		{
+			name:     "a running job blocks later jobs with its key",
+			action:   func() (*Job, error) { return markJobRunning(a1) },
+			limit:    10,
+			expected: []int{unordered, b1},
+		},
+		{
+			name:     "a done job unblocks the next job with its key",
+			action:   func() (*Job, error) { return markJobDone(a1) },
+			limit:    10,
+			expected: []int{a2, unordered, b1},
+		},
+		{
+			name:     "a job waiting for a retry is not runnable, but blocks later jobs with its key",
+			action:   func() (*Job, error) { return markJobForRetry(a2, "failed", time.Hour) },
+			limit:    10,
+			expected: []int{unordered, b1},
+		},
+		{
+			name:     "a failed job unblocks the next job with its key",
+			action:   func() (*Job, error) { return markJobFailed(a2, "failed") },
+			limit:    10,
+			expected: []int{unordered, b1, a3},
+		},
+	}
+
+	for _, step := range steps {
+		if step.action != nil {
+			if _, err := step.action(); err != nil {
+				t.Fatalf("%s: unexpected error: %v", step.name, err)
+			}
+		}
+		if ids := runnableJobIds(t, step.limit); !slices.Equal(ids, step.expected) {
+			t.Errorf("%s: expected runnable jobs %v, got %v", step.name, step.expected, ids)
+		}
+	}
+}
+
+func TestRequeueInterruptedJobs(t *testing.T) {
+	setupTestDB(t)
+
+	queued := createTestJob(t, nil)
+	interrupted := createTestJob(t, nil)
+	lastAttempt := createTestJob(t, nil)
+
+	if _, err := markJobRunning(interrupted); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range DefaultMaxAttempts {
+		if _, err := markJobRunning(lastAttempt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	requeued, failed, err := requeueInterruptedJobs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requeued != 1 || failed != 1 {
+		t.Errorf("expected 1 requeued and 1 failed job, got %d and %d", requeued, failed)
+	}
+
+	expected := map[int]struct {
+		state    JobState
+		attempts int
+	}{
+		queued:      {JobQueued, 0},
+		interrupted: {JobQueued, 0},
+		lastAttempt: {JobFailed, DefaultMaxAttempts},
+	}
+	for id, exp := range expected {
+		job, err := JobById(id)
+		if err != nil || job == nil {
+			t.Fatalf("failed to get job %d: %v", id, err)
+		}
+		if job.State != exp.state || job.Attempts != exp.attempts {
+			t.Errorf("expected job %d to be %s after %d attempts, got %s after %d attempts",
+				id, exp.state, exp.attempts, job.State, job.Attempts)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: retryBaseDelay},
+		{attempts: 2, expected: 2 * retryBaseDelay},
+		{attempts: 3, expected: 4 * retryBaseDelay},
+		{attempts: 7, expected: retryMaxDelay},
+		{attempts: 100, expected: retryMaxDelay},
+	}
+
+	for _, test := range tests {
+		if delay := retryDelay(test.attempts); delay != test.expected {
+			t.Errorf("expected a delay of %v after %d attempts, got %v", test.expected, test.attempts, delay)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package jobs
+
+import (
+	"juraji.nl/chat-quest/core/sse"
+	"juraji.nl/chat-quest/core/util/signals"
+)
+
+var JobCreatedSignal = signals.New[*Job]()
+var JobUpdatedSignal = signals.New[*Job]()
+var JobDeletedSignal = signals.New[int]()
+var JobProgressSignal = signals.New[*JobProgress]()
+
+func init() {
+	sse.RegisterOnSSE("JobCreated", JobCreatedSignal)
+	sse.RegisterOnSSE("JobUpdated", JobUpdatedSignal)
+	sse.RegisterOnSSE("JobDeleted", JobDeletedSignal)
+	sse.RegisterOnSSE("JobProgress", JobProgressSignal)
+}
@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/log"
+)
+
+const (
+	// maxConcurrentJobs limits the number of jobs running at the same time.
+	maxConcurrentJobs = 4
+	// pollInterval is the interval at which the queue is checked for jobs that became due (retries).
+	pollInterval = 2 * time.Second
+	// retryBaseDelay is the delay before the first retry, doubled for each following attempt.
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = 10 * time.Minute
+	// finishedJobRetention is the time done jobs are kept, before being cleaned up on start.
+	finishedJobRetention = 24 * time.Hour
+)
+
+type jobContextKey struct{}
+
+var wakeChan = make(chan struct{}, 1)
+
+var (
+	// pauseMu is held by the dispatcher while starting jobs, pauses counts the active PauseWorkers calls.
+	pauseMu sync.Mutex
+	pauses  int
+	// runningJobs tracks the jobs started by the dispatcher.
+	runningJobs sync.WaitGroup
+)
+
+// wakeDispatcher notifies the dispatcher that there might be new jobs to run.
+func wakeDispatcher() {
+	select {
+	case wakeChan <- struct{}{}:
+	default:
+		// Dispatcher is already notified
+	}
+}
+
+// StartWorkers resumes jobs that were interrupted by a shutdown and starts processing the queue.
+// All job types should be registered before starting the workers.
+func StartWorkers(ctx context.Context) {
+	logger := log.Get().With(zap.String("source", "Jobs"))
+
+	if err := deleteFinishedJobsBefore(finishedJobRetention); err != nil {
+		logger.Warn("Failed to clean up finished jobs", zap.Error(err))
+	}
+
+	resumed, failed, err := requeueInterruptedJobs()
+	if err != nil {
+		logger.Error("Failed to requeue interrupted jobs", zap.Error(err))
+	} else {
+		if resumed > 0 {
+			logger.Info("Resuming interrupted jobs", zap.Int("count", resumed))
+		}
+		if failed > 0 {
+			logger.Warn("Interrupted jobs without attempts left were marked as failed", zap.Int("count", failed))
+		}
+	}
+
+	go dispatch(ctx, logger)
+}
+
+// PauseWorkers stops the workers from starting new jobs, until the returned resume function is called.
+// Jobs that are already running are not affected, use WaitForRunningJobs to wait for them to finish.
+func PauseWorkers() func() {
+	pauseMu.Lock()
+	pauses++
+	pauseMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			pauseMu.Lock()
+			pauses--
+			pauseMu.Unlock()
+			wakeDispatcher()
+		})
+	}
+}
+
+// WaitForRunningJobs waits for the running jobs to finish, or until ctx is done. Pause the workers first, or new jobs
+// may keep it waiting.
+func WaitForRunningJobs(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		runningJobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "jobs are still running")
+	}
+}
+
+// ReportProgress emits the progress (0-1) of the job running in ctx.
+// Does nothing when ctx does not belong to a job.
+func ReportProgress(ctx context.Context, progress float64, message string) {
+	job, ok := ctx.Value(jobContextKey{}).(*Job)
+	if !ok {
+		return
+	}
+
+	JobProgressSignal.EmitBG(&JobProgress{
+		JobID:    job.ID,
+		Type:     job.Type,
+		Progress: progress,
+		Message:  message,
+	})
+}
+
+func dispatch(ctx context.Context, logger *zap.Logger) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	finished := make(chan struct{}, maxConcurrentJobs)
+	running := 0
+
+	for {
+		pauseMu.Lock()
+		if free := maxConcurrentJobs - running; free > 0 && pauses == 0 {
+			runnable, err := getRunnableJobs(free)
+			if err != nil {
+				logger.Error("Failed to fetch runnable jobs", zap.Error(err))
+			}
+
+			for _, job := range runnable {
+				runningJob, err := markJobRunning(job.ID)
+				if err != nil || runningJob == nil {
+					logger.Error("Failed to mark job as running", zap.Int("jobId", job.ID), zap.Error(err))
+					continue
+				}
+
+				running++
+				runningJobs.Add(1)
+				go func() {
+					defer func() { finished <- struct{}{} }()
+					defer runningJobs.Done()
+					runJob(ctx, logger, runningJob)
+				}()
+			}
+		}
+		pauseMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-finished:
+			running--
+		case <-wakeChan:
+		case <-ticker.C:
+		}
+	}
+}
+
+func runJob(ctx context.Context, logger *zap.Logger, job *Job) {
+	logger = logger.With(
+		zap.Int("jobId", job.ID),
+		zap.String("jobType", job.Type),
+		zap.Int("attempt", job.Attempts))
+
+	var err error
+	if runner, ok := getJobRunner(job.Type); ok {
+		logger.Debug("Running job")
+		err = safeRun(context.WithValue(ctx, jobContextKey{}, job), runner, job.Payload)
+	} else {
+		// Job was stored by a version that knew this type, it will never succeed
+		err = fmt.Errorf("unknown job type %s", job.Type)
+		job.Attempts = job.MaxAttempts
+	}
+
+	switch {
+	case err == nil:
+		_, err = markJobDone(job.ID)
+	case job.Attempts >= job.MaxAttempts:
+		logger.Error("Job failed", zap.Error(err))
+		_, err = markJobFailed(job.ID, err.Error())
+	default:
+		delay := retryDelay(job.Attempts)
+		logger.Warn("Job attempt failed, retrying...", zap.Duration("delay", delay), zap.Error(err))
+		_, err = markJobForRetry(job.ID, err.Error(), delay)
+	}
+
+	if err != nil {
+		logger.Error("Failed to update job state", zap.Error(err))
+	}
+}
+
+// retryDelay returns the delay before retrying a job after the given number of failed attempts.
+// The delay is doubled step by step, as shifting by the attempts overflows for large counts.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+// safeRun runs the job, recovering panics as errors, so a single job can not take down the dispatcher.
+func safeRun(ctx context.Context, runner jobRunner, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return runner(ctx, payload)
+}
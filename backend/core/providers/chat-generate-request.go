@@ -11,8 +11,20 @@ type LlmParameters struct {
 	Stream           bool
 	StopSequences    *string
 
+	// Extended sampler options, nil when not set (Not supported by all providers)
+	TopK          *int
+	MinP          *float32
+	RepeatPenalty *float32
+	Mirostat      *int
+	MirostatTau   *float32
+	MirostatEta   *float32
+
 	// An optional response format (JSON Schema)
 	ResponseFormat *string
+
+	// ContextLength is the context size the model should run with, nil for the provider default.
+	// Set from the model, only providers that run models themselves (Ollama) use it.
+	ContextLength *int
 }
 
 func (params *LlmParameters) StopSequencesAsSlice() []string {
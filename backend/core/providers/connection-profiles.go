@@ -7,13 +7,19 @@ import (
 type ProviderType string
 
 const (
-	ProviderOpenAi ProviderType = "OPEN_AI"
+	ProviderOpenAi    ProviderType = "OPEN_AI"
+	ProviderAnthropic ProviderType = "ANTHROPIC"
+	ProviderOllama    ProviderType = "OLLAMA"
 )
 
 func (p ProviderType) IsValid() bool {
 	switch p {
 	case ProviderOpenAi:
 		return true
+	case ProviderAnthropic:
+		return true
+	case ProviderOllama:
+		return true
 	default:
 		return false
 	}
@@ -25,6 +31,15 @@ type ConnectionProfile struct {
 	ProviderType ProviderType `json:"providerType"`
 	BaseUrl      string       `json:"baseUrl"`
 	ApiKey       string       `json:"apiKey"`
+
+	// MaxConcurrentRequests is the number of requests sent to the provider at the same time, at least 1.
+	MaxConcurrentRequests int `json:"maxConcurrentRequests"`
+	// RequestsPerMinute limits the number of requests started per minute, 0 for no limit.
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	// MaxRetries is the number of times a request that failed with a temporary error is retried.
+	MaxRetries int `json:"maxRetries"`
+	// RetryBackoffMillis is the wait before the first retry, it doubles for every next retry.
+	RetryBackoffMillis int `json:"retryBackoffMillis"`
 }
 
 func connectionProfileScanner(scanner database.RowScanner, dest *ConnectionProfile) error {
@@ -34,6 +49,10 @@ func connectionProfileScanner(scanner database.RowScanner, dest *ConnectionProfi
 		&dest.ProviderType,
 		&dest.BaseUrl,
 		&dest.ApiKey,
+		&dest.MaxConcurrentRequests,
+		&dest.RequestsPerMinute,
+		&dest.MaxRetries,
+		&dest.RetryBackoffMillis,
 	)
 }
 
@@ -49,9 +68,14 @@ func ConnectionProfileById(id int) (*ConnectionProfile, error) {
 }
 
 func CreateConnectionProfile(profile *ConnectionProfile, llmModels []*LlmModel) error {
+	profile.MaxConcurrentRequests = max(profile.MaxConcurrentRequests, 1)
+
 	err := database.Transactional(func(ctx *database.TxContext) error {
-		query := "INSERT INTO connection_profiles (name, provider_type, base_url, api_key) VALUES (?, ?, ?, ?) RETURNING id"
-		args := []any{profile.Name, profile.ProviderType, profile.BaseUrl, profile.ApiKey}
+		query := `INSERT INTO connection_profiles (name, provider_type, base_url, api_key, max_concurrent_requests,
+                                                 requests_per_minute, max_retries, retry_backoff_millis)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+		args := []any{profile.Name, profile.ProviderType, profile.BaseUrl, profile.ApiKey,
+			profile.MaxConcurrentRequests, profile.RequestsPerMinute, profile.MaxRetries, profile.RetryBackoffMillis}
 
 		if err := ctx.InsertRecord(query, args, &profile.ID); err != nil {
 			return err
@@ -75,13 +99,20 @@ func CreateConnectionProfile(profile *ConnectionProfile, llmModels []*LlmModel)
 }
 
 func UpdateConnectionProfile(id int, profile *ConnectionProfile) error {
+	profile.MaxConcurrentRequests = max(profile.MaxConcurrentRequests, 1)
+
 	query := `UPDATE connection_profiles
             SET name = ?,
                 provider_type = ?,
                 base_url = ?,
-                api_key = ?
+                api_key = ?,
+                max_concurrent_requests = ?,
+                requests_per_minute = ?,
+                max_retries = ?,
+                retry_backoff_millis = ?
             WHERE id = ?`
-	args := []any{profile.Name, profile.ProviderType, profile.BaseUrl, profile.ApiKey, id}
+	args := []any{profile.Name, profile.ProviderType, profile.BaseUrl, profile.ApiKey,
+		profile.MaxConcurrentRequests, profile.RequestsPerMinute, profile.MaxRetries, profile.RetryBackoffMillis, id}
 
 	err := database.UpdateRecord(query, args)
 
@@ -7,10 +7,22 @@ import (
 	"math"
 
 	"github.com/pkg/errors"
+	"juraji.nl/chat-quest/core"
 )
 
 type Embedding []float64
 
+// Embeddings are stored with a leading format byte. Before formats were introduced they were stored as float64, the
+// byte length of these legacy embeddings is always a multiple of 8. The byte length of formatted embeddings never is,
+// which tells them apart: float32 embeddings are 1+4n bytes, int8 embeddings 5+n bytes and stored as float32 instead
+// when that would be a multiple of 8.
+const (
+	// embeddingFormatFloat32 is followed by the little-endian float32 values.
+	embeddingFormatFloat32 byte = 1
+	// embeddingFormatInt8 is followed by a little-endian float32 scale and the values quantized to int8.
+	embeddingFormatInt8 byte = 2
+)
+
 // Scan implements the sql.Scanner interface for Embedding type.
 // It converts a database value to an Embedding object.
 //
@@ -25,23 +37,17 @@ func (e *Embedding) Scan(value any) error {
 	if !ok {
 		return fmt.Errorf("unsupported type: %T", value)
 	}
-	if len(b)%8 != 0 {
-		return errors.New("invalid byte length for float64 array")
-	}
 
-	n := len(b) / 8
-	embedding := make(Embedding, n)
-	for i := 0; i < n; i++ {
-		start := i * 8
-		bits := binary.LittleEndian.Uint64(b[start : start+8])
-		embedding[i] = math.Float64frombits(bits)
+	embedding, err := DecodeEmbedding(b)
+	if err != nil {
+		return err
 	}
 	*e = embedding
 	return nil
 }
 
 // Value implements the driver.Valuer interface for Embedding type.
-// It converts an Embedding object to a database value.
+// It converts an Embedding object to a database value, quantized to int8 when enabled in the environment.
 //
 //goland:noinspection GoMixedReceiverTypes as needed by the driver.Valuer interface.
 func (e Embedding) Value() (driver.Value, error) {
@@ -49,13 +55,94 @@ func (e Embedding) Value() (driver.Value, error) {
 		return nil, nil
 	}
 
+	return EncodeEmbedding(e, core.Env().QuantizeEmbeddings), nil
+}
+
+// EncodeEmbedding encodes the embedding as float32, or quantized to int8 when quantize is set.
+func EncodeEmbedding(e Embedding, quantize bool) []byte {
+	if quantize && (5+len(e))%8 != 0 {
+		q := e.Quantize()
+		b := make([]byte, 5+len(q.Values))
+		b[0] = embeddingFormatInt8
+		binary.LittleEndian.PutUint32(b[1:], math.Float32bits(q.Scale))
+		for i, v := range q.Values {
+			b[5+i] = byte(v)
+		}
+		return b
+	}
+
+	b := make([]byte, 1+len(e)*4)
+	b[0] = embeddingFormatFloat32
+	for i, v := range e {
+		binary.LittleEndian.PutUint32(b[1+i*4:], math.Float32bits(float32(v)))
+	}
+	return b
+}
+
+// DecodeEmbedding decodes an embedding encoded by EncodeEmbedding, or a legacy float64 embedding.
+// Quantized embeddings are normalized again after dequantizing, so their dot product is their cosine similarity.
+func DecodeEmbedding(b []byte) (Embedding, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty embedding")
+	}
+	if IsFloat64Embedding(b) {
+		return DecodeFloat64Embedding(b)
+	}
+
+	switch b[0] {
+	case embeddingFormatFloat32:
+		if (len(b)-1)%4 != 0 {
+			return nil, errors.New("invalid byte length for float32 embedding")
+		}
+		embedding := make(Embedding, (len(b)-1)/4)
+		for i := range embedding {
+			embedding[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[1+i*4:])))
+		}
+		return embedding, nil
+	case embeddingFormatInt8:
+		if len(b) < 5 {
+			return nil, errors.New("invalid byte length for int8 embedding")
+		}
+		q := QuantizedEmbedding{
+			Scale:  math.Float32frombits(binary.LittleEndian.Uint32(b[1:])),
+			Values: make([]int8, len(b)-5),
+		}
+		for i := range q.Values {
+			q.Values[i] = int8(b[5+i])
+		}
+		embedding := q.Dequantize()
+		return embedding.Normalize(), nil
+	default:
+		return nil, errors.Errorf("unknown embedding format %d", b[0])
+	}
+}
+
+// EncodeFloat64Embedding encodes the embedding as little-endian float64 values, without format byte. This is how
+// embeddings were stored before formats were introduced.
+func EncodeFloat64Embedding(e Embedding) []byte {
 	b := make([]byte, len(e)*8)
 	for i, v := range e {
-		bits := math.Float64bits(v)
-		binary.LittleEndian.PutUint64(b[i*8:], bits)
+		binary.LittleEndian.PutUint64(b[i*8:], math.Float64bits(v))
 	}
+	return b
+}
 
-	return b, nil
+// IsFloat64Embedding returns whether the encoded embedding is a legacy float64 embedding.
+func IsFloat64Embedding(b []byte) bool {
+	return len(b)%8 == 0
+}
+
+// DecodeFloat64Embedding decodes an embedding encoded by EncodeFloat64Embedding.
+func DecodeFloat64Embedding(b []byte) (Embedding, error) {
+	if len(b)%8 != 0 {
+		return nil, errors.New("invalid byte length for float64 array")
+	}
+
+	embedding := make(Embedding, len(b)/8)
+	for i := range embedding {
+		embedding[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[i*8:]))
+	}
+	return embedding, nil
 }
 
 // CosineSimilarity calculates the cosine similarity between two embeddings.
@@ -108,3 +195,61 @@ func (e *Embedding) Normalize() Embedding {
 	}
 	return normalized
 }
+
+// QuantizedEmbedding is an embedding with its values scaled to int8. Value i of the embedding is approximately
+// Values[i] * Scale, where Scale maps the largest absolute value to 127.
+type QuantizedEmbedding struct {
+	Scale  float32
+	Values []int8
+}
+
+// Quantize scales the embedding to int8 values.
+//
+//goland:noinspection GoMixedReceiverTypes See Scan and Value methods
+func (e Embedding) Quantize() QuantizedEmbedding {
+	maxAbs := 0.0
+	for _, v := range e {
+		maxAbs = max(maxAbs, math.Abs(v))
+	}
+
+	q := QuantizedEmbedding{Values: make([]int8, len(e))}
+	if maxAbs == 0 {
+		return q
+	}
+
+	q.Scale = float32(maxAbs / 127)
+	for i, v := range e {
+		q.Values[i] = int8(math.Round(v / float64(q.Scale)))
+	}
+	return q
+}
+
+// Dequantize converts the quantized values back to an embedding.
+func (q QuantizedEmbedding) Dequantize() Embedding {
+	embedding := make(Embedding, len(q.Values))
+	for i, v := range q.Values {
+		embedding[i] = float64(v) * float64(q.Scale)
+	}
+	return embedding
+}
+
+// CosineSimilarity calculates the cosine similarity between two quantized embeddings, without dequantizing them.
+// The scales cancel out, so the similarity is calculated on the int8 values alone.
+func (q QuantizedEmbedding) CosineSimilarity(other QuantizedEmbedding) float64 {
+	if len(q.Values) != len(other.Values) {
+		panic(fmt.Sprintf("embedding dimensions must match (this %d, other %d)", len(q.Values), len(other.Values)))
+	}
+
+	var dotProduct, normA, normB int64
+	for i, a := range q.Values {
+		b := other.Values[i]
+		dotProduct += int64(a) * int64(b)
+		normA += int64(a) * int64(a)
+		normB += int64(b) * int64(b)
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float64(dotProduct) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB)))
+}
@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func randomEmbedding(rng *rand.Rand, dimensions int) Embedding {
+	embedding := make(Embedding, dimensions)
+	for i := range embedding {
+		embedding[i] = rng.NormFloat64()
+	}
+	return embedding.Normalize()
+}
+
+func TestEncodeDecodeEmbedding(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+
+	dimensions := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 16, 384, 768, 1024, 1536, 3072}
+	tests := []struct {
+		name          string
+		quantize      bool
+		minSimilarity float64
+		maxDifference float64
+	}{
+		{name: "float32", quantize: false, minSimilarity: 0.999999, maxDifference: 1e-6},
+		{name: "int8", quantize: true, minSimilarity: 0.999, maxDifference: 0.01},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, dims := range dimensions {
+				embedding := randomEmbedding(rng, dims)
+				encoded := EncodeEmbedding(embedding, test.quantize)
+
+				// Formatted embeddings are told apart from legacy float64 embeddings by their byte length
+				if IsFloat64Embedding(encoded) {
+					t.Fatalf("%d dimensions: encoded length %d is taken for a float64 embedding", dims, len(encoded))
+				}
+
+				decoded, err := DecodeEmbedding(encoded)
+				if err != nil {
+					t.Fatalf("%d dimensions: unexpected error: %v", dims, err)
+				}
+				if len(decoded) != dims {
+					t.Fatalf("%d dimensions: decoded %d dimensions", dims, len(decoded))
+				}
+
+				for i := range embedding {
+					if diff := math.Abs(decoded[i] - embedding[i]); diff > test.maxDifference {
+						t.Fatalf("%d dimensions: value %d differs by %f", dims, i, diff)
+					}
+				}
+				if similarity := decoded.CosineSimilarity(embedding); similarity < test.minSimilarity {
+					t.Errorf("%d dimensions: expected a similarity of at least %f, got %f",
+						dims, test.minSimilarity, similarity)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeEmbeddingFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		dimensions     int
+		quantize       bool
+		expectedFormat byte
+		expectedLength int
+	}{
+		{name: "float32", dimensions: 768, quantize: false, expectedFormat: embeddingFormatFloat32, expectedLength: 1 + 768*4},
+		{name: "int8", dimensions: 768, quantize: true, expectedFormat: embeddingFormatInt8, expectedLength: 5 + 768},
+		// 5+n would be a multiple of 8, which is taken for a float64 embedding
+		{name: "int8 stored as float32", dimensions: 3, quantize: true, expectedFormat: embeddingFormatFloat32, expectedLength: 1 + 3*4},
+		{name: "int8 stored as float32 at 1019", dimensions: 1019, quantize: true, expectedFormat: embeddingFormatFloat32, expectedLength: 1 + 1019*4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := EncodeEmbedding(make(Embedding, test.dimensions), test.quantize)
+			if encoded[0] != test.expectedFormat || len(encoded) != test.expectedLength {
+				t.Errorf("expected format %d with length %d, got format %d with length %d",
+					test.expectedFormat, test.expectedLength, encoded[0], len(encoded))
+			}
+		})
+	}
+}
+
+func TestDecodeFloat64Embedding(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+
+	for _, dims := range []int{1, 3, 768, 1536} {
+		embedding := randomEmbedding(rng, dims)
+		encoded := EncodeFloat64Embedding(embedding)
+		if !IsFloat64Embedding(encoded) {
+			t.Fatalf("%d dimensions: expected a float64 embedding", dims)
+		}
+
+		decoded, err := DecodeEmbedding(encoded)
+		if err != nil {
+			t.Fatalf("%d dimensions: unexpected error: %v", dims, err)
+		}
+		for i := range embedding {
+			if decoded[i] != embedding[i] {
+				t.Fatalf("%d dimensions: expected value %d to be %f, got %f", dims, i, embedding[i], decoded[i])
+			}
+		}
+	}
+}
+
+func TestDecodeEmbeddingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded []byte
+	}{
+		{name: "empty", encoded: nil},
+		{name: "unknown format", encoded: []byte{9, 0, 0, 0, 0}},
+		{name: "truncated float32", encoded: []byte{embeddingFormatFloat32, 0, 0, 0, 0, 0, 0}},
+		{name: "truncated int8", encoded: []byte{embeddingFormatInt8, 0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if embedding, err := DecodeEmbedding(test.encoded); err == nil {
+				t.Errorf("expected an error, got %v", embedding)
+			}
+		})
+	}
+}
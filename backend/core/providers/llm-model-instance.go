@@ -1,7 +1,11 @@
 package providers
 
 import (
+	"time"
+
+	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/log"
 )
 
 type LlmModelInstance struct {
@@ -10,6 +14,43 @@ type LlmModelInstance struct {
 	BaseUrl      string
 	ApiKey       string
 	ModelId      string
+
+	// Request limits of the connection profile
+	MaxConcurrentRequests int
+	RequestsPerMinute     int
+	// Retry policy of the connection profile
+	MaxRetries         int
+	RetryBackoffMillis int
+
+	// ContextLength is the context size of the model in tokens, nil when unknown
+	ContextLength *int
+}
+
+// connectionProfile returns the parts of the connection profile needed to get its provider.
+func (l *LlmModelInstance) connectionProfile() *ConnectionProfile {
+	return &ConnectionProfile{
+		ID:                    l.ProviderId,
+		ProviderType:          l.ProviderType,
+		BaseUrl:               l.BaseUrl,
+		ApiKey:                l.ApiKey,
+		MaxConcurrentRequests: l.MaxConcurrentRequests,
+		RequestsPerMinute:     l.RequestsPerMinute,
+	}
+}
+
+// retryPolicy returns the retry policy of the connection profile.
+func (l *LlmModelInstance) retryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: min(max(l.MaxRetries, 0), MaxRetriesLimit),
+		Backoff:    time.Duration(min(max(l.RetryBackoffMillis, 0), int(retryMaxBackoff.Milliseconds()))) * time.Millisecond,
+	}
+}
+
+func (l *LlmModelInstance) logger() *zap.Logger {
+	return log.Get().With(
+		zap.Int("connectionProfileId", l.ProviderId),
+		zap.String("providerType", string(l.ProviderType)),
+		zap.String("modelId", l.ModelId))
 }
 
 func llmModelInstanceScanner(scanner database.RowScanner, dest *LlmModelInstance) error {
@@ -19,6 +60,11 @@ func llmModelInstanceScanner(scanner database.RowScanner, dest *LlmModelInstance
 		&dest.BaseUrl,
 		&dest.ApiKey,
 		&dest.ModelId,
+		&dest.MaxConcurrentRequests,
+		&dest.RequestsPerMinute,
+		&dest.MaxRetries,
+		&dest.RetryBackoffMillis,
+		&dest.ContextLength,
 	)
 }
 
@@ -28,7 +74,12 @@ func GetLlmModelInstanceById(llmModelId int) (*LlmModelInstance, error) {
                 cp.provider_type AS provider_type,
                 cp.base_url AS base_url,
                 cp.api_key AS api_key,
-                lm.model_id AS model_id
+                lm.model_id AS model_id,
+                cp.max_concurrent_requests AS max_concurrent_requests,
+                cp.requests_per_minute AS requests_per_minute,
+                cp.max_retries AS max_retries,
+                cp.retry_backoff_millis AS retry_backoff_millis,
+                lm.context_length AS context_length
             FROM llm_models lm
                 JOIN connection_profiles cp on cp.id = lm.connection_profile_id
                 WHERE lm.id = ?`
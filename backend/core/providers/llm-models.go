@@ -1,6 +1,10 @@
 package providers
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core/database"
 	"juraji.nl/chat-quest/core/log"
@@ -34,6 +38,7 @@ type LlmModel struct {
 	ModelId             string       `json:"modelId"`
 	ModelType           LlmModelType `json:"modelType"`
 	Disabled            bool         `json:"disabled"`
+	ContextLength       *int         `json:"contextLength"`
 }
 
 type LlmModelView struct {
@@ -44,6 +49,44 @@ type LlmModelView struct {
 	ConnectionProfileName string       `json:"profileName"`
 }
 
+// LlmModelIds is an ordered list of LLM model IDs, stored as JSON array.
+type LlmModelIds []int
+
+// Scan implements the sql.Scanner interface for LlmModelIds type.
+//
+//goland:noinspection GoMixedReceiverTypes as needed by the sql.Scanner interface.
+func (ids *LlmModelIds) Scan(value any) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*ids = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported type: %T", value)
+	}
+
+	return json.Unmarshal(data, (*[]int)(ids))
+}
+
+// Value implements the driver.Valuer interface for LlmModelIds type.
+//
+//goland:noinspection GoMixedReceiverTypes as needed by the driver.Valuer interface.
+func (ids LlmModelIds) Value() (driver.Value, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal([]int(ids))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
 func llmModelScanner(scanner database.RowScanner, dest *LlmModel) error {
 	return scanner.Scan(
 		&dest.ID,
@@ -51,6 +94,7 @@ func llmModelScanner(scanner database.RowScanner, dest *LlmModel) error {
 		&dest.ModelId,
 		&dest.ModelType,
 		&dest.Disabled,
+		&dest.ContextLength,
 	)
 }
 
@@ -77,13 +121,14 @@ func createLlmModel(ctx *database.TxContext, profileId int, llmModel *LlmModel)
 	}
 
 	query := `INSERT INTO llm_models
-            (connection_profile_id, model_id, model_type, disabled)
-            VALUES (?, ?, ?, ?) RETURNING id`
+            (connection_profile_id, model_id, model_type, disabled, context_length)
+            VALUES (?, ?, ?, ?, ?) RETURNING id`
 	args := []any{
 		llmModel.ConnectionProfileId,
 		llmModel.ModelId,
 		llmModel.ModelType,
 		llmModel.Disabled,
+		llmModel.ContextLength,
 	}
 
 	return ctx.InsertRecord(query, args, &llmModel.ID)
@@ -92,11 +137,13 @@ func createLlmModel(ctx *database.TxContext, profileId int, llmModel *LlmModel)
 func UpdateLlmModel(id int, llmModel *LlmModel) error {
 	query := `UPDATE llm_models
               SET model_type= ?,
-                  disabled = ?
+                  disabled = ?,
+                  context_length = ?
               WHERE id = ?`
 	args := []any{
 		llmModel.ModelType,
 		llmModel.Disabled,
+		llmModel.ContextLength,
 		id,
 	}
 
@@ -109,6 +156,13 @@ func UpdateLlmModel(id int, llmModel *LlmModel) error {
 	return err
 }
 
+func updateLlmModelMetadata(ctx *database.TxContext, llmModel *LlmModel) error {
+	query := "UPDATE llm_models SET context_length = ? WHERE id = ?"
+	args := []any{llmModel.ContextLength, llmModel.ID}
+
+	return ctx.UpdateRecord(query, args)
+}
+
 func DeleteLlmModelById(id int) error {
 	return database.Transactional(func(ctx *database.TxContext) error {
 		return deleteLlmModelById(ctx, id)
@@ -145,6 +199,7 @@ func MergeLlmModels(profileId int, newModels []*LlmModel) error {
 	})
 
 	var createdModels []*LlmModel
+	var updatedModels []*LlmModel
 	var deletedModelIds []int
 	logger := log.Get().With(zap.Int("profileId", profileId))
 
@@ -161,6 +216,29 @@ func MergeLlmModels(profileId int, newModels []*LlmModel) error {
 			}
 		}
 
+		// Update metadata of existing models, if reported by the provider
+		newModelsById := make(map[string]*LlmModel, len(newModels))
+		for _, newModel := range newModels {
+			newModelsById[newModel.ModelId] = newModel
+		}
+		for _, existingModel := range existingModels {
+			newModel, ok := newModelsById[existingModel.ModelId]
+			if !ok || newModel.ContextLength == nil {
+				continue
+			}
+			if existingModel.ContextLength != nil && *existingModel.ContextLength == *newModel.ContextLength {
+				continue
+			}
+
+			existingModel.ContextLength = newModel.ContextLength
+			if err := updateLlmModelMetadata(ctx, &existingModel); err != nil {
+				logger.Error("Error updating existing llm model",
+					zap.Int("id", existingModel.ID), zap.Error(err))
+				return err
+			}
+			updatedModels = append(updatedModels, &existingModel)
+		}
+
 		// Remove models not in new set
 		for _, existingModel := range existingModels {
 			if newModelIdSet.NotContains(existingModel.ModelId) {
@@ -178,6 +256,7 @@ func MergeLlmModels(profileId int, newModels []*LlmModel) error {
 
 	if err == nil {
 		LlmModelCreatedSignal.EmitAllBG(createdModels)
+		LlmModelUpdatedSignal.EmitAllBG(updatedModels)
 		LlmModelDeletedSignal.EmitAllBG(deletedModelIds)
 	}
 
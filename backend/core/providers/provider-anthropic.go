@@ -0,0 +1,434 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	anthropicApiVersion       = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+	anthropicModelsPageSize   = 100
+	// anthropicLeadingUserMessage is sent as the first message when the conversation does not start with a user
+	// message, e.g. when it opens with the character's greeting, as the Messages API requires it.
+	anthropicLeadingUserMessage = "Continue the conversation."
+)
+
+type anthropicProvider struct {
+	baseUrl string
+	apiKey  string
+	client  *http.Client
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicMessagesRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float32           `json:"temperature,omitempty"`
+	TopP          *float32           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type anthropicMessagesResponse struct {
+	Content []anthropicContentBlock `json:"content"`
+	Usage   anthropicUsage          `json:"usage"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage anthropicUsage  `json:"usage"`
+	Error *anthropicError `json:"error"`
+}
+
+type anthropicModelsPage struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastId  string `json:"last_id"`
+}
+
+func newAnthropicProvider(baseUrl string, apiKey string) *anthropicProvider {
+	return &anthropicProvider{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{},
+	}
+}
+
+func (a *anthropicProvider) getAvailableModelIds(ctx context.Context) ([]*LlmModel, error) {
+	var llmModels []*LlmModel
+	afterId := ""
+
+	for {
+		query := url.Values{}
+		query.Set("limit", fmt.Sprintf("%d", anthropicModelsPageSize))
+		if afterId != "" {
+			query.Set("after_id", afterId)
+		}
+
+		var page anthropicModelsPage
+		if err := a.doJsonRequest(ctx, http.MethodGet, "/models?"+query.Encode(), nil, &page); err != nil {
+			return nil, fmt.Errorf("anthropicProvider failed to list models: %w", err)
+		}
+
+		for _, model := range page.Data {
+			// Anthropic only serves chat models
+			llmModels = append(llmModels, &LlmModel{
+				ModelId:   model.ID,
+				ModelType: ChatModel,
+			})
+		}
+
+		if !page.HasMore || page.LastId == "" {
+			break
+		}
+		afterId = page.LastId
+	}
+
+	return llmModels, nil
+}
+
+func (a *anthropicProvider) generateEmbeddings(_ context.Context, _ []string, _ string) ([]Embedding, error) {
+	return nil, errors.New("anthropicProvider does not support embeddings")
+}
+
+func (a *anthropicProvider) generateChatResponse(
+	ctx context.Context,
+	messages []ChatRequestMessage,
+	modelId string,
+	params LlmParameters,
+) <-chan ChatGenerateResponse {
+	system, aMessages := toAnthropicMessages(messages)
+
+	if params.ResponseFormat != nil {
+		// The Messages API has no structured output option, so we instruct the model instead.
+		system = strings.TrimSpace(fmt.Sprintf(
+			"%s\n\nRespond with a single JSON object only, no other text. The JSON object must match this JSON schema:\n%s",
+			system, *params.ResponseFormat))
+	}
+
+	request := anthropicMessagesRequest{
+		Model:         modelId,
+		System:        system,
+		Messages:      aMessages,
+		MaxTokens:     params.MaxTokens,
+		StopSequences: params.StopSequencesAsSlice(),
+		Stream:        params.Stream,
+	}
+
+	if request.MaxTokens <= 0 {
+		// max_tokens is required by the Messages API
+		request.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	// Anthropic accepts a temperature between 0 and 1 and only a top_p that actually limits sampling.
+	// Presence and frequency penalties are not supported and are ignored.
+	temperature := min(max(params.Temperature, 0), 1)
+	request.Temperature = &temperature
+	if params.TopP > 0 && params.TopP < 1 {
+		request.TopP = &params.TopP
+	}
+
+	if params.Stream {
+		return a.generateChatResponseStream(ctx, request)
+	}
+
+	return a.generateChatResponseSingle(ctx, request)
+}
+
+func (a *anthropicProvider) generateChatResponseSingle(
+	ctx context.Context,
+	request anthropicMessagesRequest,
+) <-chan ChatGenerateResponse {
+	responseChannel := make(chan ChatGenerateResponse, 1)
+	go func() {
+		defer close(responseChannel)
+
+		var response anthropicMessagesResponse
+		if err := a.doJsonRequest(ctx, http.MethodPost, "/messages", request, &response); err != nil {
+			responseChannel <- ChatGenerateResponse{
+				Error: fmt.Errorf("anthropicProvider failed to create message: %w", err),
+			}
+			return
+		}
+
+		var content strings.Builder
+		for _, block := range response.Content {
+			if block.Type == "text" {
+				content.WriteString(block.Text)
+			}
+		}
+
+		responseChannel <- ChatGenerateResponse{
+			Content:          content.String(),
+			TotalTokens:      response.Usage.InputTokens + response.Usage.OutputTokens,
+			CompletionTokens: response.Usage.OutputTokens,
+		}
+	}()
+	return responseChannel
+}
+
+func (a *anthropicProvider) generateChatResponseStream(
+	ctx context.Context,
+	request anthropicMessagesRequest,
+) <-chan ChatGenerateResponse {
+	responseChannel := make(chan ChatGenerateResponse)
+
+	go func() {
+		defer close(responseChannel)
+
+		response, err := a.doRequest(ctx, http.MethodPost, "/messages", request)
+		if err != nil {
+			if ctx.Err() == nil {
+				responseChannel <- ChatGenerateResponse{
+					Error: fmt.Errorf("anthropicProvider failed to create message stream: %w", err),
+				}
+			}
+			return
+		}
+		defer response.Body.Close()
+
+		var inputTokens int
+		err = readServerSentEvents(response.Body, func(data []byte) bool {
+			var event anthropicStreamEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				responseChannel <- ChatGenerateResponse{
+					Error: fmt.Errorf("anthropicProvider received invalid stream event: %w", err),
+				}
+				return false
+			}
+
+			switch event.Type {
+			case "message_start":
+				inputTokens = event.Message.Usage.InputTokens
+			case "content_block_delta":
+				if event.Delta.Type == "text_delta" {
+					responseChannel <- ChatGenerateResponse{
+						Content: event.Delta.Text,
+					}
+				}
+			case "message_delta":
+				responseChannel <- ChatGenerateResponse{
+					TotalTokens:      inputTokens + event.Usage.OutputTokens,
+					CompletionTokens: event.Usage.OutputTokens,
+				}
+			case "message_stop":
+				return false
+			case "error":
+				message := "unknown error"
+				if event.Error != nil {
+					message = fmt.Sprintf("%s: %s", event.Error.Type, event.Error.Message)
+				}
+				responseChannel <- ChatGenerateResponse{
+					Error: fmt.Errorf("anthropicProvider error during message stream: %s", message),
+				}
+				return false
+			}
+
+			return ctx.Err() == nil
+		})
+
+		if err != nil && ctx.Err() == nil {
+			responseChannel <- ChatGenerateResponse{
+				Error: fmt.Errorf("anthropicProvider error during message stream: %w", err),
+			}
+		}
+	}()
+
+	return responseChannel
+}
+
+// doRequest executes a request against the Anthropic API and returns the response if it was successful.
+// The caller is responsible for closing the response body.
+func (a *anthropicProvider) doRequest(ctx context.Context, method string, path string, body any) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal request body")
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, a.baseUrl+path, bodyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	request.Header.Set("x-api-key", a.apiKey)
+	request.Header.Set("anthropic-version", anthropicApiVersion)
+	request.Header.Set("content-type", "application/json")
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+
+		var errorBody struct {
+			Error anthropicError `json:"error"`
+		}
+		responseBytes, _ := io.ReadAll(response.Body)
+		if json.Unmarshal(responseBytes, &errorBody) == nil && errorBody.Error.Message != "" {
+			return nil, newStatusError(response, fmt.Sprintf("request failed with status %d (%s): %s",
+				response.StatusCode, errorBody.Error.Type, errorBody.Error.Message))
+		}
+		return nil, newStatusError(response,
+			fmt.Sprintf("request failed with status %d: %s", response.StatusCode, string(responseBytes)))
+	}
+
+	return response, nil
+}
+
+// doJsonRequest executes a request against the Anthropic API and decodes the JSON response into dest.
+func (a *anthropicProvider) doJsonRequest(ctx context.Context, method string, path string, body any, dest any) error {
+	response, err := a.doRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err = json.NewDecoder(response.Body).Decode(dest); err != nil {
+		return errors.Wrap(err, "failed to decode response body")
+	}
+
+	return nil
+}
+
+// toAnthropicMessages converts the request messages to the Messages API format, which has no system role and
+// requires roles to alternate, starting with a user message:
+//   - Leading system messages become the system prompt.
+//   - System messages further on in the conversation (like post-history instructions) become user messages.
+//   - Consecutive messages of the same role are merged and empty messages are left out.
+//   - When the conversation does not start with a user message, anthropicLeadingUserMessage is inserted before it.
+//   - A trailing assistant message is sent as prefill, without trailing whitespace as the API rejects it.
+func toAnthropicMessages(messages []ChatRequestMessage) (string, []anthropicMessage) {
+	var systemParts []string
+	var aMessages []anthropicMessage
+
+	inLeadingSystem := true
+	for _, msg := range messages {
+		var role string
+		switch msg.Role {
+		case RoleSystem:
+			if inLeadingSystem {
+				systemParts = append(systemParts, msg.Content)
+				continue
+			}
+			role = "user"
+		case RoleUser:
+			role = "user"
+		case RoleAssistant:
+			role = "assistant"
+		default:
+			// Dev error, missing branch?
+			panic(fmt.Errorf("developer error, invalid role '%s'", msg.Role))
+		}
+
+		inLeadingSystem = false
+		if strings.TrimSpace(msg.Content) == "" {
+			// Empty content is rejected by the API
+			continue
+		}
+
+		if n := len(aMessages); n > 0 && aMessages[n-1].Role == role {
+			aMessages[n-1].Content += "\n\n" + msg.Content
+		} else {
+			aMessages = append(aMessages, anthropicMessage{Role: role, Content: msg.Content})
+		}
+	}
+
+	if len(aMessages) == 0 || aMessages[0].Role != "user" {
+		aMessages = append([]anthropicMessage{{Role: "user", Content: anthropicLeadingUserMessage}}, aMessages...)
+	}
+
+	// A trailing assistant message is a partial response (prefill)
+	if n := len(aMessages); aMessages[n-1].Role == "assistant" {
+		aMessages[n-1].Content = strings.TrimRightFunc(aMessages[n-1].Content, unicode.IsSpace)
+	}
+
+	return strings.Join(systemParts, "\n\n"), aMessages
+}
+
+// readServerSentEvents reads a text/event-stream from reader and calls onData with the data of each event.
+// Reading stops when onData returns false or the stream ends.
+func readServerSentEvents(reader io.Reader, onData func(data []byte) bool) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		if len(line) == 0 {
+			// Empty line dispatches the event
+			if data.Len() > 0 {
+				if !onData(data.Bytes()) {
+					return nil
+				}
+				data.Reset()
+			}
+			continue
+		}
+
+		if field, value, found := bytes.Cut(line, []byte(":")); found && bytes.Equal(field, []byte("data")) {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(value, []byte(" ")))
+		}
+		// Other fields (event, id, retry) and comments are not used, the data carries the event type.
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if data.Len() > 0 {
+		onData(data.Bytes())
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// anthropicTestServer serves the given SSE events on /messages and captures the request it received.
+func anthropicTestServer(t *testing.T, events []string, captured *anthropicMessagesRequest) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != anthropicApiVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(captured); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			_, _ = fmt.Fprint(w, event)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func collectChatResponses(t *testing.T, responses <-chan ChatGenerateResponse) (string, []ChatGenerateResponse) {
+	t.Helper()
+
+	var content strings.Builder
+	var all []ChatGenerateResponse
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case response, ok := <-responses:
+			if !ok {
+				return content.String(), all
+			}
+			content.WriteString(response.Content)
+			all = append(all, response)
+		case <-timeout:
+			t.Fatal("timed out waiting for chat responses")
+		}
+	}
+}
+
+func TestAnthropicStreamsChatResponse(t *testing.T) {
+	events := []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0}\n\n",
+		": keep-alive comment\n\n",
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n",
+		// Data split over multiple data lines is joined with a newline
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\n" +
+			"data: \"delta\":{\"type\":\"text_delta\",\"text\":\", world\"}}\n\n",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":5}}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+		// Events after message_stop are not read
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"!\"}}\n\n",
+	}
+
+	var request anthropicMessagesRequest
+	server := anthropicTestServer(t, events, &request)
+	provider := newAnthropicProvider(server.URL+"/", "test-key")
+
+	messages := []ChatRequestMessage{
+		{Role: RoleSystem, Content: "You are a narrator."},
+		{Role: RoleSystem, Content: "Keep it short."},
+		{Role: RoleUser, Content: "World setup"},
+		{Role: RoleUser, Content: "Hi!"},
+		{Role: RoleAssistant, Content: "Well, "},
+	}
+	params := LlmParameters{Temperature: 1.5, TopP: 1, Stream: true}
+
+	content, responses := collectChatResponses(t, provider.generateChatResponse(
+		context.Background(), messages, "claude-test", params))
+
+	for _, response := range responses {
+		if response.Error != nil {
+			t.Fatalf("unexpected error: %v", response.Error)
+		}
+	}
+	if content != "Hello, world" {
+		t.Errorf("expected content 'Hello, world', got '%s'", content)
+	}
+	last := responses[len(responses)-1]
+	if last.TotalTokens != 17 || last.CompletionTokens != 5 {
+		t.Errorf("expected 17 total and 5 completion tokens, got %d and %d", last.TotalTokens, last.CompletionTokens)
+	}
+
+	if request.Model != "claude-test" || !request.Stream {
+		t.Errorf("expected a streaming request for claude-test, got model '%s' (stream %t)", request.Model, request.Stream)
+	}
+	if request.System != "You are a narrator.\n\nKeep it short." {
+		t.Errorf("unexpected system prompt '%s'", request.System)
+	}
+	if request.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("expected default max tokens %d, got %d", anthropicDefaultMaxTokens, request.MaxTokens)
+	}
+	if request.Temperature == nil || *request.Temperature != 1 || request.TopP != nil {
+		t.Errorf("expected temperature clamped to 1 and no top_p, got %v and %v", request.Temperature, request.TopP)
+	}
+
+	expectedMessages := []anthropicMessage{
+		{Role: "user", Content: "World setup\n\nHi!"},
+		{Role: "assistant", Content: "Well,"},
+	}
+	if !slices.Equal(request.Messages, expectedMessages) {
+		t.Errorf("expected messages %v, got %v", expectedMessages, request.Messages)
+	}
+}
+
+func TestAnthropicStreamErrorEvent(t *testing.T) {
+	events := []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":3}}}\n\n",
+		"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n",
+	}
+
+	var request anthropicMessagesRequest
+	server := anthropicTestServer(t, events, &request)
+	provider := newAnthropicProvider(server.URL, "test-key")
+
+	_, responses := collectChatResponses(t, provider.generateChatResponse(
+		context.Background(), []ChatRequestMessage{{Role: RoleUser, Content: "Hi"}}, "claude-test",
+		LlmParameters{Stream: true}))
+
+	if len(responses) != 1 || responses[0].Error == nil ||
+		!strings.Contains(responses[0].Error.Error(), "overloaded_error: Overloaded") {
+		t.Errorf("expected a single overloaded error response, got %v", responses)
+	}
+}
+
+func TestAnthropicRequestErrorStatus(t *testing.T) {
+	var request anthropicMessagesRequest
+	server := anthropicTestServer(t, nil, &request)
+	provider := newAnthropicProvider(server.URL, "wrong-key")
+
+	_, responses := collectChatResponses(t, provider.generateChatResponse(
+		context.Background(), []ChatRequestMessage{{Role: RoleUser, Content: "Hi"}}, "claude-test",
+		LlmParameters{Stream: true}))
+
+	var statusErr *StatusError
+	if len(responses) != 1 || !errors.As(responses[0].Error, &statusErr) {
+		t.Fatalf("expected a single status error response, got %v", responses)
+	}
+	if statusErr.StatusCode != http.StatusUnauthorized ||
+		!strings.Contains(statusErr.Error(), "(authentication_error): invalid x-api-key") {
+		t.Errorf("unexpected status error: %v", statusErr)
+	}
+}
+
+func TestToAnthropicMessages(t *testing.T) {
+	tests := []struct {
+		name             string
+		messages         []ChatRequestMessage
+		expectedSystem   string
+		expectedMessages []anthropicMessage
+	}{
+		{
+			name: "leading system messages become the system prompt",
+			messages: []ChatRequestMessage{
+				{Role: RoleSystem, Content: "System 1"},
+				{Role: RoleSystem, Content: "System 2"},
+				{Role: RoleUser, Content: "Hello"},
+			},
+			expectedSystem:   "System 1\n\nSystem 2",
+			expectedMessages: []anthropicMessage{{Role: "user", Content: "Hello"}},
+		},
+		{
+			name: "later system messages are merged into user messages",
+			messages: []ChatRequestMessage{
+				{Role: RoleUser, Content: "Hello"},
+				{Role: RoleAssistant, Content: "Hi there"},
+				{Role: RoleSystem, Content: "Note"},
+				{Role: RoleUser, Content: "Go on"},
+			},
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "Hi there"},
+				{Role: "user", Content: "Note\n\nGo on"},
+			},
+		},
+		{
+			name: "same-role messages are merged and empty messages skipped",
+			messages: []ChatRequestMessage{
+				{Role: RoleUser, Content: "One"},
+				{Role: RoleAssistant, Content: "Two"},
+				{Role: RoleAssistant, Content: "  "},
+				{Role: RoleAssistant, Content: "Three"},
+				{Role: RoleUser, Content: "Four"},
+			},
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: "One"},
+				{Role: "assistant", Content: "Two\n\nThree"},
+				{Role: "user", Content: "Four"},
+			},
+		},
+		{
+			name: "a user message is inserted before a leading assistant message",
+			messages: []ChatRequestMessage{
+				{Role: RoleSystem, Content: "System"},
+				{Role: RoleAssistant, Content: "Greetings"},
+				{Role: RoleUser, Content: "Hello"},
+			},
+			expectedSystem: "System",
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: anthropicLeadingUserMessage},
+				{Role: "assistant", Content: "Greetings"},
+				{Role: "user", Content: "Hello"},
+			},
+		},
+		{
+			name: "a user message is inserted when there are only system messages",
+			messages: []ChatRequestMessage{
+				{Role: RoleSystem, Content: "System"},
+			},
+			expectedSystem:   "System",
+			expectedMessages: []anthropicMessage{{Role: "user", Content: anthropicLeadingUserMessage}},
+		},
+		{
+			name: "a user message is inserted before a prefill without history",
+			messages: []ChatRequestMessage{
+				{Role: RoleSystem, Content: "System"},
+				{Role: RoleUser, Content: " "},
+				{Role: RoleAssistant, Content: "Once upon a time "},
+			},
+			expectedSystem: "System",
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: anthropicLeadingUserMessage},
+				{Role: "assistant", Content: "Once upon a time"},
+			},
+		},
+		{
+			name: "a system message after the greeting becomes the first user message",
+			messages: []ChatRequestMessage{
+				{Role: RoleAssistant, Content: "Greetings"},
+				{Role: RoleSystem, Content: "Instruction"},
+			},
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: anthropicLeadingUserMessage},
+				{Role: "assistant", Content: "Greetings"},
+				{Role: "user", Content: "Instruction"},
+			},
+		},
+		{
+			name: "system messages between assistant messages become user messages",
+			messages: []ChatRequestMessage{
+				{Role: RoleSystem, Content: "System"},
+				{Role: RoleUser, Content: "Hello"},
+				{Role: RoleAssistant, Content: "Hi there"},
+				{Role: RoleSystem, Content: "Note"},
+				{Role: RoleAssistant, Content: "Well,"},
+			},
+			expectedSystem: "System",
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "Hi there"},
+				{Role: "user", Content: "Note"},
+				{Role: "assistant", Content: "Well,"},
+			},
+		},
+		{
+			name: "a trailing assistant message is a prefill without trailing whitespace",
+			messages: []ChatRequestMessage{
+				{Role: RoleUser, Content: "Hello"},
+				{Role: RoleAssistant, Content: "Once upon a time \n"},
+			},
+			expectedMessages: []anthropicMessage{
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "Once upon a time"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			system, messages := toAnthropicMessages(test.messages)
+			if system != test.expectedSystem {
+				t.Errorf("expected system '%s', got '%s'", test.expectedSystem, system)
+			}
+			if !slices.Equal(messages, test.expectedMessages) {
+				t.Errorf("expected messages %v, got %v", test.expectedMessages, messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ollamaNumCtxPattern matches the num_ctx parameter in Modelfile parameters.
+var ollamaNumCtxPattern = regexp.MustCompile(`(?m)^num_ctx\s+(\d+)\s*$`)
+
+type ollamaProvider struct {
+	baseUrl string
+	apiKey  string
+	client  *http.Client
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	NumCtx           *int     `json:"num_ctx,omitempty"`
+	NumPredict       int      `json:"num_predict,omitempty"`
+	Temperature      float32  `json:"temperature"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	PresencePenalty  float32  `json:"presence_penalty"`
+	FrequencyPenalty float32  `json:"frequency_penalty"`
+	Stop             []string `json:"stop,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`
+	MinP             *float32 `json:"min_p,omitempty"`
+	RepeatPenalty    *float32 `json:"repeat_penalty,omitempty"`
+	Mirostat         *int     `json:"mirostat,omitempty"`
+	MirostatTau      *float32 `json:"mirostat_tau,omitempty"`
+	MirostatEta      *float32 `json:"mirostat_eta,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+type ollamaShowResponse struct {
+	Parameters   string         `json:"parameters"`
+	ModelInfo    map[string]any `json:"model_info"`
+	Capabilities []string       `json:"capabilities"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+func newOllamaProvider(baseUrl string, apiKey string) *ollamaProvider {
+	return &ollamaProvider{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{},
+	}
+}
+
+func (o *ollamaProvider) getAvailableModelIds(ctx context.Context) ([]*LlmModel, error) {
+	var tags ollamaTagsResponse
+	if err := o.doJsonRequest(ctx, http.MethodGet, "/api/tags", nil, &tags); err != nil {
+		return nil, fmt.Errorf("ollamaProvider failed to list models: %w", err)
+	}
+
+	var llmModels []*LlmModel
+	for _, model := range tags.Models {
+		var details ollamaShowResponse
+		body := map[string]string{"model": model.Name}
+		if err := o.doJsonRequest(ctx, http.MethodPost, "/api/show", body, &details); err != nil {
+			return nil, fmt.Errorf("ollamaProvider failed to get details for model %s: %w", model.Name, err)
+		}
+
+		llmModels = append(llmModels, &LlmModel{
+			ModelId:       model.Name,
+			ModelType:     details.modelType(),
+			ContextLength: details.contextLength(),
+		})
+	}
+
+	return llmModels, nil
+}
+
+func (o *ollamaProvider) generateEmbeddings(ctx context.Context, inputs []string, modelId string) ([]Embedding, error) {
+
+	body := map[string]any{"model": modelId, "input": inputs}
+	var response ollamaEmbedResponse
+	if err := o.doJsonRequest(ctx, http.MethodPost, "/api/embed", body, &response); err != nil {
+		return nil, fmt.Errorf("ollamaProvider failed to create embeddings: %w", err)
+	}
+	if len(response.Embeddings) != len(inputs) {
+		return nil, fmt.Errorf("ollamaProvider returned %d embeddings for %d inputs", len(response.Embeddings), len(inputs))
+	}
+
+	embeddings := make([]Embedding, len(response.Embeddings))
+	for i, embedding := range response.Embeddings {
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+func (o *ollamaProvider) generateChatResponse(
+	ctx context.Context,
+	messages []ChatRequestMessage,
+	modelId string,
+	params LlmParameters,
+) <-chan ChatGenerateResponse {
+	oMessages := make([]ollamaMessage, len(messages))
+	for i, msg := range messages {
+		switch msg.Role {
+		case RoleSystem:
+			oMessages[i] = ollamaMessage{Role: "system", Content: msg.Content}
+		case RoleUser:
+			oMessages[i] = ollamaMessage{Role: "user", Content: msg.Content}
+		case RoleAssistant:
+			oMessages[i] = ollamaMessage{Role: "assistant", Content: msg.Content}
+		default:
+			// Dev error, missing branch?
+			panic(fmt.Errorf("developer error, invalid role '%s'", msg.Role))
+		}
+	}
+
+	request := ollamaChatRequest{
+		Model:    modelId,
+		Messages: oMessages,
+		Stream:   params.Stream,
+		Options: ollamaOptions{
+			// Ollama runs models with its own default context size otherwise, silently truncating larger prompts
+			NumCtx:           params.ContextLength,
+			NumPredict:       params.MaxTokens,
+			Temperature:      params.Temperature,
+			PresencePenalty:  params.PresencePenalty,
+			FrequencyPenalty: params.FrequencyPenalty,
+			Stop:             params.StopSequencesAsSlice(),
+			TopK:             params.TopK,
+			MinP:             params.MinP,
+			RepeatPenalty:    params.RepeatPenalty,
+			Mirostat:         params.Mirostat,
+			MirostatTau:      params.MirostatTau,
+			MirostatEta:      params.MirostatEta,
+		},
+	}
+
+	if params.TopP > 0 {
+		request.Options.TopP = &params.TopP
+	}
+
+	if params.ResponseFormat != nil {
+		// Ollama accepts the JSON schema as format as-is
+		request.Format = json.RawMessage(*params.ResponseFormat)
+	}
+
+	responseChannel := make(chan ChatGenerateResponse)
+
+	go func() {
+		defer close(responseChannel)
+
+		response, err := o.doRequest(ctx, http.MethodPost, "/api/chat", request)
+		if err != nil {
+			if ctx.Err() == nil {
+				responseChannel <- ChatGenerateResponse{
+					Error: fmt.Errorf("ollamaProvider failed to create chat completion: %w", err),
+				}
+			}
+			return
+		}
+		defer response.Body.Close()
+
+		// Both streamed and single responses are newline delimited JSON objects
+		scanner := bufio.NewScanner(response.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				responseChannel <- ChatGenerateResponse{
+					Error: fmt.Errorf("ollamaProvider received invalid chat completion chunk: %w", err),
+				}
+				return
+			}
+			if chunk.Error != "" {
+				responseChannel <- ChatGenerateResponse{
+					Error: fmt.Errorf("ollamaProvider error during chat completion: %s", chunk.Error),
+				}
+				return
+			}
+
+			result := ChatGenerateResponse{Content: chunk.Message.Content}
+			if chunk.Done {
+				result.TotalTokens = chunk.PromptEvalCount + chunk.EvalCount
+				result.CompletionTokens = chunk.EvalCount
+			}
+			responseChannel <- result
+
+			if chunk.Done || ctx.Err() != nil {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			responseChannel <- ChatGenerateResponse{
+				Error: fmt.Errorf("ollamaProvider error during chat completion stream: %w", err),
+			}
+		}
+	}()
+
+	return responseChannel
+}
+
+// doRequest executes a request against the Ollama API and returns the response if it was successful.
+// The caller is responsible for closing the response body.
+func (o *ollamaProvider) doRequest(ctx context.Context, method string, path string, body any) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal request body")
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, o.baseUrl+path, bodyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	request.Header.Set("content-type", "application/json")
+	if o.apiKey != "" {
+		// Ollama itself does not use keys, but it is often behind an authenticating proxy.
+		request.Header.Set("authorization", "Bearer "+o.apiKey)
+	}
+
+	response, err := o.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+
+		var errorBody struct {
+			Error string `json:"error"`
+		}
+		responseBytes, _ := io.ReadAll(response.Body)
+		if json.Unmarshal(responseBytes, &errorBody) == nil && errorBody.Error != "" {
+			return nil, newStatusError(response,
+				fmt.Sprintf("request failed with status %d: %s", response.StatusCode, errorBody.Error))
+		}
+		return nil, newStatusError(response,
+			fmt.Sprintf("request failed with status %d: %s", response.StatusCode, string(responseBytes)))
+	}
+
+	return response, nil
+}
+
+// doJsonRequest executes a request against the Ollama API and decodes the JSON response into dest.
+func (o *ollamaProvider) doJsonRequest(ctx context.Context, method string, path string, body any, dest any) error {
+	response, err := o.doRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err = json.NewDecoder(response.Body).Decode(dest); err != nil {
+		return errors.Wrap(err, "failed to decode response body")
+	}
+
+	return nil
+}
+
+// modelType derives the model type from the reported capabilities.
+// Older Ollama versions do not report capabilities, in which case the type is unknown.
+func (s *ollamaShowResponse) modelType() LlmModelType {
+	switch {
+	case slices.Contains(s.Capabilities, "completion"):
+		return ChatModel
+	case slices.Contains(s.Capabilities, "embedding"):
+		return EmbeddingModel
+	default:
+		return UnknownModel
+	}
+}
+
+// contextLength returns the context length to run the model with, sent as num_ctx on chat requests.
+// This is the num_ctx parameter when set for the model, else the context length the model was trained with.
+func (s *ollamaShowResponse) contextLength() *int {
+	if match := ollamaNumCtxPattern.FindStringSubmatch(s.Parameters); match != nil {
+		if numCtx, err := strconv.Atoi(match[1]); err == nil {
+			return &numCtx
+		}
+	}
+
+	architecture, ok := s.ModelInfo["general.architecture"].(string)
+	if !ok {
+		return nil
+	}
+	if contextLength, ok := s.ModelInfo[architecture+".context_length"].(float64); ok {
+		return new(int(contextLength))
+	}
+
+	return nil
+}
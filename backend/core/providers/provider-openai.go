@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	"sync"
 
 	"github.com/openai/openai-go/v2"
 	"github.com/openai/openai-go/v2/option"
@@ -14,7 +13,6 @@ import (
 
 type openAIProvider struct {
 	client openai.Client
-	lock   *sync.Mutex
 }
 
 func newOpenAiProvider(baseUrl string, apiKey string) *openAIProvider {
@@ -22,8 +20,9 @@ func newOpenAiProvider(baseUrl string, apiKey string) *openAIProvider {
 		client: openai.NewClient(
 			option.WithBaseURL(baseUrl),
 			option.WithAPIKey(apiKey),
+			// Retries are done by the retry policy of the connection profile
+			option.WithMaxRetries(0),
 		),
-		lock: &sync.Mutex{},
 	}
 }
 
@@ -59,13 +58,11 @@ func (o *openAIProvider) getAvailableModelIds(ctx context.Context) ([]*LlmModel,
 	return llmModels, nil
 }
 
-func (o *openAIProvider) generateEmbeddings(ctx context.Context, input, modelID string) (Embedding, error) {
-	o.lock.Lock()
-	defer o.lock.Unlock()
+func (o *openAIProvider) generateEmbeddings(ctx context.Context, inputs []string, modelID string) ([]Embedding, error) {
 
 	response, err := o.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
 		Input: openai.EmbeddingNewParamsInputUnion{
-			OfString: openai.String(input),
+			OfArrayOfStrings: inputs,
 		},
 		Model:          modelID,
 		EncodingFormat: openai.EmbeddingNewParamsEncodingFormatFloat,
@@ -73,11 +70,20 @@ func (o *openAIProvider) generateEmbeddings(ctx context.Context, input, modelID
 	if err != nil {
 		return nil, fmt.Errorf("openAIProvider failed to create embeddings: %w", err)
 	}
-	if len(response.Data) == 0 {
-		return nil, errors.New("openAIProvider no embeddings returned")
+	if len(response.Data) != len(inputs) {
+		return nil, fmt.Errorf("openAIProvider returned %d embeddings for %d inputs", len(response.Data), len(inputs))
 	}
 
-	return response.Data[0].Embedding, nil
+	// Data is not guaranteed to be in input order
+	embeddings := make([]Embedding, len(inputs))
+	for _, data := range response.Data {
+		if data.Index < 0 || int(data.Index) >= len(inputs) {
+			return nil, fmt.Errorf("openAIProvider returned embedding for unknown input %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return embeddings, nil
 }
 
 func (o *openAIProvider) generateChatResponse(ctx context.Context, messages []ChatRequestMessage, modelId string, params LlmParameters) <-chan ChatGenerateResponse {
@@ -147,8 +153,6 @@ func (o *openAIProvider) generateChatResponseSingle(
 ) <-chan ChatGenerateResponse {
 	responseChannel := make(chan ChatGenerateResponse, 1)
 	go func() {
-		o.lock.Lock()
-		defer o.lock.Unlock()
 		defer close(responseChannel)
 
 		completion, err := o.client.Chat.Completions.New(ctx, params)
@@ -181,8 +185,6 @@ func (o *openAIProvider) generateChatResponseStream(
 	responseChannel := make(chan ChatGenerateResponse)
 
 	go func() {
-		o.lock.Lock()
-		defer o.lock.Unlock()
 		defer close(responseChannel)
 
 		stream := o.client.Chat.Completions.NewStreaming(ctx, params)
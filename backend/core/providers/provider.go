@@ -4,58 +4,119 @@ import (
 	"context"
 	"fmt"
 	"sync"
+
+	"go.uber.org/zap"
 )
 
 var (
 	providerInstanceMapLock sync.Mutex
-	providerInstances       = make(map[int]Provider)
+	providerInstances       = make(map[int]*providerInstance)
+	// requestSchedulers outlive the provider instances, so requests in flight keep counting towards the limits
+	// after a profile is updated.
+	requestSchedulers = make(map[int]*requestScheduler)
 )
 
+// providerInstance is the provider for a connection profile, with the scheduler that limits the requests to it.
+type providerInstance struct {
+	provider  Provider
+	scheduler *requestScheduler
+}
+
 // Provider defines an interface for interacting with different AI model providers.
 // Implementations should handle their own specific API calls while maintaining
-// consistent behavior in terms of locking, error handling, and response formats.
+// consistent behavior in terms of error handling and response formats.
+// Requests are limited by the scheduler of the connection profile, so implementations should not serialize calls.
 type Provider interface {
 	// getAvailableModelIds returns a list of available model IDs that can be used with this provider.
 	// The returned models are provider-specific identifiers for different AI models.
 	// Returns an empty slice if no models are available or an error occurred.
 	getAvailableModelIds(ctx context.Context) ([]*LlmModel, error)
 
-	// generateEmbeddings creates vector embeddings from the given input text using the specified model.
-	// The function should be thread-safe and handle its own locking internally if needed.
-	// Returns the generated embeddings as a slice of floats or an error if generation failed.
-	generateEmbeddings(ctx context.Context, input string, modelId string) (Embedding, error)
+	// generateEmbeddings creates vector embeddings for each of the given input texts using the specified model.
+	// The function should be thread-safe.
+	// Returns the generated embeddings in the order of the inputs or an error if generation failed.
+	generateEmbeddings(ctx context.Context, inputs []string, modelId string) ([]Embedding, error)
 
 	// generateChatResponse creates a channel that will stream chat responses based on the provided request.
-	// The function should be thread-safe and handle its own locking internally if needed.
+	// The function should be thread-safe.
 	// Returns a receive-only channel (<-chan) that will yield ChatGenerateResponse objects as they become available.
 	generateChatResponse(ctx context.Context, messages []ChatRequestMessage, modelId string, params LlmParameters) <-chan ChatGenerateResponse
 }
 
-// getProviderLock retrieves or creates a new instance of the specified provider type.
-// This ensures thread-safe access to provider instances by preventing concurrent execution.
-func getProvider(providerId int, providerType ProviderType, baseUrl string, apiKey string) Provider {
+func init() {
+	// Provider instances are configured by their profile, so they need to be recreated when it changes.
+	ConnectionProfileUpdatedSignal.AddListener("EvictProviderInstance", func(_ context.Context, profile *ConnectionProfile) error {
+		evictProvider(profile)
+		return nil
+	})
+	ConnectionProfileDeletedSignal.AddListener("EvictProviderInstance", func(_ context.Context, profileId int) error {
+		deleteProvider(profileId)
+		return nil
+	})
+}
+
+// getProvider retrieves or creates the provider instance for the connection profile.
+// Instances are cached by profile ID, so requests for the same profile share their limits.
+func getProvider(profile *ConnectionProfile) *providerInstance {
 	providerInstanceMapLock.Lock()
 	defer providerInstanceMapLock.Unlock()
 
-	p, exists := providerInstances[providerId]
+	instance, exists := providerInstances[profile.ID]
 	if !exists {
-		switch providerType {
+		var p Provider
+		switch profile.ProviderType {
 		case ProviderOpenAi:
-			p = newOpenAiProvider(baseUrl, apiKey)
+			p = newOpenAiProvider(profile.BaseUrl, profile.ApiKey)
+		case ProviderAnthropic:
+			p = newAnthropicProvider(profile.BaseUrl, profile.ApiKey)
+		case ProviderOllama:
+			p = newOllamaProvider(profile.BaseUrl, profile.ApiKey)
 		default:
-			panic(fmt.Sprintf("unknown provider type: %s", providerType))
+			panic(fmt.Sprintf("unknown provider type: %s", profile.ProviderType))
 		}
 
-		providerInstances[providerId] = p
+		scheduler, exists := requestSchedulers[profile.ID]
+		if !exists {
+			scheduler = newRequestScheduler(profile.MaxConcurrentRequests, profile.RequestsPerMinute)
+			requestSchedulers[profile.ID] = scheduler
+		}
+
+		instance = &providerInstance{
+			provider:  p,
+			scheduler: scheduler,
+		}
+		providerInstances[profile.ID] = instance
 	}
-	return p
+	return instance
+}
+
+// evictProvider removes the cached provider instance for the updated profile, if any.
+// The scheduler of the profile is kept, with its limits updated to those of the profile.
+func evictProvider(profile *ConnectionProfile) {
+	providerInstanceMapLock.Lock()
+	defer providerInstanceMapLock.Unlock()
+
+	delete(providerInstances, profile.ID)
+	if scheduler, exists := requestSchedulers[profile.ID]; exists {
+		scheduler.setLimits(profile.MaxConcurrentRequests, profile.RequestsPerMinute)
+	}
+}
+
+// deleteProvider removes the cached provider instance and scheduler for the deleted profile, if any.
+func deleteProvider(profileId int) {
+	providerInstanceMapLock.Lock()
+	defer providerInstanceMapLock.Unlock()
+
+	delete(providerInstances, profileId)
+	delete(requestSchedulers, profileId)
 }
 
 // GetAvailableModels retrieves the list of available models for a given connection profile.
+// Listing models is not subject to the request limits of the profile.
 func GetAvailableModels(profile *ConnectionProfile) ([]*LlmModel, error) {
 	ctx := context.Background()
-	provider := getProvider(profile.ID, profile.ProviderType, profile.BaseUrl, profile.ApiKey)
-	models, err := provider.getAvailableModelIds(ctx)
+	instance := getProvider(profile)
+	models, err := instance.provider.getAvailableModelIds(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get models for profile %s (id %d): %w", profile.Name, profile.ID, err)
 	}
@@ -64,25 +125,202 @@ func GetAvailableModels(profile *ConnectionProfile) ([]*LlmModel, error) {
 }
 
 // GenerateEmbeddings creates vector embeddings from the given input text using a specified LLM model.
-func GenerateEmbeddings(llm *LlmModelInstance, input string) (Embedding, error) {
-	ctx := context.Background()
+func GenerateEmbeddings(ctx context.Context, llm *LlmModelInstance, input string) (Embedding, error) {
+	embeddings, err := GenerateEmbeddingsBatch(ctx, llm, []string{input})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
+}
+
+// GenerateEmbeddingsBatch creates vector embeddings for each of the given input texts in a single request, using a
+// specified LLM model. The embeddings are returned in the order of the inputs.
+// The request waits for its turn by the priority set with WithRequestPriority, and is retried by the retry policy of
+// the connection profile.
+func GenerateEmbeddingsBatch(ctx context.Context, llm *LlmModelInstance, inputs []string) ([]Embedding, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	logger := llm.logger()
+	instance := getProvider(llm.connectionProfile())
+	policy := llm.retryPolicy()
+
+	for attempt := 1; ; attempt++ {
+		logger.Debug("Generating embeddings",
+			zap.Int("attempt", attempt), zap.Int("maxAttempts", policy.MaxRetries+1), zap.Int("inputs", len(inputs)))
+
+		embeddings, err := generateEmbeddingsAttempt(ctx, instance, llm, inputs)
+		if err == nil {
+			for i, embedding := range embeddings {
+				embeddings[i] = embedding.Normalize()
+			}
+			return embeddings, nil
+		}
+
+		delay, retry := policy.retryDelay(err, attempt)
+		if !retry {
+			logger.Warn("Generating embeddings failed",
+				zap.Int("attempt", attempt), zap.Int("maxAttempts", policy.MaxRetries+1), zap.Error(err))
+			return nil, fmt.Errorf("failed to generate embeddings for %s (%s): %w", llm.ModelId, llm.ProviderType, err)
+		}
+
+		logger.Warn("Generating embeddings failed, retrying",
+			zap.Int("attempt", attempt), zap.Int("maxAttempts", policy.MaxRetries+1),
+			zap.Duration("retryIn", delay), zap.Error(err))
+		if !sleepContext(ctx, delay) {
+			return nil, fmt.Errorf("cancelled while retrying to generate embeddings for %s (%s): %w",
+				llm.ModelId, llm.ProviderType, ctx.Err())
+		}
+	}
+}
 
-	provider := getProvider(llm.ProviderId, llm.ProviderType, llm.BaseUrl, llm.ApiKey)
-	embedding, err := provider.generateEmbeddings(ctx, input, llm.ModelId)
+func generateEmbeddingsAttempt(
+	ctx context.Context,
+	instance *providerInstance,
+	llm *LlmModelInstance,
+	inputs []string,
+) ([]Embedding, error) {
+	release, err := instance.scheduler.acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate embeddings for %s (%s): %w", llm.ModelId, llm.ProviderType, err)
+		return nil, err
 	}
+	defer release()
 
-	return embedding.Normalize(), nil
+	return instance.provider.generateEmbeddings(ctx, inputs, llm.ModelId)
 }
 
 // GenerateChatResponse creates a channel that will stream chat responses based on the provided messages and model configuration.
+// The request waits for its turn by the priority set with WithRequestPriority, and holds it until the response is complete.
+// Requests that fail before the response started are retried by the retry policy of the connection profile.
 func GenerateChatResponse(
 	ctx context.Context,
 	llm *LlmModelInstance,
 	messages []ChatRequestMessage,
 	params LlmParameters,
 ) <-chan ChatGenerateResponse {
-	provider := getProvider(llm.ProviderId, llm.ProviderType, llm.BaseUrl, llm.ApiKey)
-	return provider.generateChatResponse(ctx, messages, llm.ModelId, params)
+	return GenerateChatResponseWithFallbacks(ctx, []*LlmModelInstance{llm}, messages, params)
+}
+
+// GenerateChatResponseWithFallbacks is GenerateChatResponse with fallback models: when a model keeps failing before
+// its response started, the next model is tried. The error of the last model is returned when all models fail.
+// The messages are expected to fit the context of the first model, fallback models with a smaller (or unknown)
+// context are skipped.
+func GenerateChatResponseWithFallbacks(
+	ctx context.Context,
+	llms []*LlmModelInstance,
+	messages []ChatRequestMessage,
+	params LlmParameters,
+) <-chan ChatGenerateResponse {
+	responseChannel := make(chan ChatGenerateResponse)
+
+	go func() {
+		defer close(responseChannel)
+
+		var err error
+		var failedModelId string
+		for idx, llm := range llms {
+			if idx > 0 {
+				if !fitsContextOf(llm, llms[0]) {
+					llm.logger().Warn("Skipping fallback model with a smaller context than the primary model",
+						zap.String("primaryModelId", llms[0].ModelId), zap.Int("fallback", idx))
+					continue
+				}
+				llm.logger().Warn("Falling back to next model",
+					zap.String("failedModelId", failedModelId), zap.Int("fallback", idx))
+			}
+
+			failedModelId = llm.ModelId
+			err = streamChatResponseWithRetries(ctx, llm, messages, params, responseChannel)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			responseChannel <- ChatGenerateResponse{Error: err}
+		}
+	}()
+
+	return responseChannel
+}
+
+// fitsContextOf reports whether the context of llm is at least as large as that of primary.
+// Any context fits a primary with an unknown context, as its messages are not budgeted by tokens.
+func fitsContextOf(llm *LlmModelInstance, primary *LlmModelInstance) bool {
+	if primary.ContextLength == nil {
+		return true
+	}
+	return llm.ContextLength != nil && *llm.ContextLength >= *primary.ContextLength
+}
+
+// streamChatResponseWithRetries sends the response of the model to responseChannel, retrying by the retry policy
+// of the connection profile. Returns an error when the model failed before its response started, errors after that
+// are sent to responseChannel, as the response can not be retried anymore.
+func streamChatResponseWithRetries(
+	ctx context.Context,
+	llm *LlmModelInstance,
+	messages []ChatRequestMessage,
+	params LlmParameters,
+	responseChannel chan<- ChatGenerateResponse,
+) error {
+	logger := llm.logger()
+	instance := getProvider(llm.connectionProfile())
+	policy := llm.retryPolicy()
+
+	for attempt := 1; ; attempt++ {
+		logger.Info("Generating chat response",
+			zap.Int("attempt", attempt), zap.Int("maxAttempts", policy.MaxRetries+1))
+
+		err := streamChatResponseAttempt(ctx, instance, llm, messages, params, responseChannel)
+		if err == nil {
+			return nil
+		}
+
+		delay, retry := policy.retryDelay(err, attempt)
+		if !retry {
+			logger.Warn("Generating chat response failed",
+				zap.Int("attempt", attempt), zap.Int("maxAttempts", policy.MaxRetries+1), zap.Error(err))
+			return fmt.Errorf("failed to generate chat response with %s (%s): %w", llm.ModelId, llm.ProviderType, err)
+		}
+
+		logger.Warn("Generating chat response failed, retrying",
+			zap.Int("attempt", attempt), zap.Int("maxAttempts", policy.MaxRetries+1),
+			zap.Duration("retryIn", delay), zap.Error(err))
+		if !sleepContext(ctx, delay) {
+			return fmt.Errorf("cancelled while retrying to generate chat response with %s (%s): %w",
+				llm.ModelId, llm.ProviderType, ctx.Err())
+		}
+	}
+}
+
+func streamChatResponseAttempt(
+	ctx context.Context,
+	instance *providerInstance,
+	llm *LlmModelInstance,
+	messages []ChatRequestMessage,
+	params LlmParameters,
+	responseChannel chan<- ChatGenerateResponse,
+) error {
+	release, err := instance.scheduler.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	params.ContextLength = llm.ContextLength
+	started := false
+	for response := range instance.provider.generateChatResponse(ctx, messages, llm.ModelId, params) {
+		if response.Error != nil && !started {
+			// Keep draining, so the provider finishes
+			err = response.Error
+			continue
+		}
+
+		started = true
+		responseChannel <- response
+	}
+
+	return err
 }
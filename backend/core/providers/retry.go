@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxRetriesLimit is the highest number of retries a connection profile can be configured with.
+	MaxRetriesLimit = 10
+	// retryMaxBackoff caps the exponential backoff between attempts.
+	retryMaxBackoff = time.Minute
+	// retryMaxRetryAfter is the longest Retry-After we wait for, beyond it the request fails (and falls back).
+	retryMaxRetryAfter = 5 * time.Minute
+)
+
+// RetryPolicy decides how often and how long apart failed requests to a provider are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// Backoff is the wait before the first retry, it doubles for every next retry.
+	Backoff time.Duration
+}
+
+// StatusError is returned by providers for responses with a non-success HTTP status.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the wait requested by the provider in the Retry-After header, 0 when not given.
+	RetryAfter time.Duration
+	message    string
+}
+
+func newStatusError(response *http.Response, message string) *StatusError {
+	return &StatusError{
+		StatusCode: response.StatusCode,
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		message:    message,
+	}
+}
+
+func (e *StatusError) Error() string {
+	return e.message
+}
+
+// parseRetryAfter reads a Retry-After header value, in seconds or as HTTP date. Returns 0 when not set or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// retryDelay returns how long to wait before the given retry (1 for the first retry) after err.
+// Returns false when err is not worth retrying, or the retries have run out.
+func (r RetryPolicy) retryDelay(err error, retry int) (time.Duration, bool) {
+	if retry > r.MaxRetries {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	var statusErr *StatusError
+	var openAiErr *openai.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return 0, false
+	case errors.As(err, &statusErr):
+		if !isRetryableStatus(statusErr.StatusCode) {
+			return 0, false
+		}
+		retryAfter = statusErr.RetryAfter
+	case errors.As(err, &openAiErr):
+		if !isRetryableStatus(openAiErr.StatusCode) {
+			return 0, false
+		}
+		if openAiErr.Response != nil {
+			retryAfter = parseRetryAfter(openAiErr.Response.Header.Get("Retry-After"))
+		}
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		// Connection problems are usually temporary
+	default:
+		return 0, false
+	}
+
+	if retryAfter > 0 {
+		return retryAfter, retryAfter <= retryMaxRetryAfter
+	}
+
+	// Exponential backoff, with jitter so requests that failed together are not retried together
+	// The backoff is doubled step by step, as shifting by the retry count overflows for large counts.
+	backoff := min(r.Backoff, retryMaxBackoff)
+	for i := 1; i < retry && backoff < retryMaxBackoff; i++ {
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
+	if backoff <= 0 {
+		return 0, true
+	}
+	return backoff/2 + rand.N(backoff/2+1), true
+}
+
+// isRetryableStatus returns true for statuses that indicate a temporary problem: timeouts, rate limits and
+// server errors.
+func isRetryableStatus(statusCode int) bool {
+	switch {
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooManyRequests:
+		return true
+	case statusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepContext waits for d, returns false when ctx was done before that.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
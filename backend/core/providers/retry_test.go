@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "not set", value: "", expected: 0},
+		{name: "seconds", value: "30", expected: 30 * time.Second},
+		{name: "negative seconds", value: "-5", expected: 0},
+		{name: "date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT", expected: 0},
+		{name: "invalid", value: "soon", expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := parseRetryAfter(test.value); result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("date in the future", func(t *testing.T) {
+		value := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+		if result := parseRetryAfter(value); result <= 50*time.Second || result > time.Minute {
+			t.Errorf("expected about a minute, got %v", result)
+		}
+	})
+}
+
+func TestRetryPolicyRetryDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, Backoff: 2 * time.Second}
+	statusErr := func(statusCode int, retryAfter time.Duration) error {
+		return errors.Wrap(&StatusError{StatusCode: statusCode, RetryAfter: retryAfter}, "request failed")
+	}
+
+	tests := []struct {
+		name          string
+		policy        RetryPolicy
+		err           error
+		retry         int
+		expectedRetry bool
+		minDelay      time.Duration
+		maxDelay      time.Duration
+	}{
+		{
+			name: "first retry waits half to full backoff", policy: policy,
+			err: statusErr(http.StatusServiceUnavailable, 0), retry: 1,
+			expectedRetry: true, minDelay: time.Second, maxDelay: 2 * time.Second,
+		},
+		{
+			name: "backoff doubles for every retry", policy: policy,
+			err: statusErr(http.StatusTooManyRequests, 0), retry: 3,
+			expectedRetry: true, minDelay: 4 * time.Second, maxDelay: 8 * time.Second,
+		},
+		{
+			name: "backoff is capped", policy: RetryPolicy{MaxRetries: MaxRetriesLimit, Backoff: 40 * time.Second},
+			err: statusErr(http.StatusBadGateway, 0), retry: MaxRetriesLimit,
+			expectedRetry: true, minDelay: retryMaxBackoff / 2, maxDelay: retryMaxBackoff,
+		},
+		{
+			name: "retry after overrides the backoff", policy: policy,
+			err: statusErr(http.StatusTooManyRequests, 45*time.Second), retry: 1,
+			expectedRetry: true, minDelay: 45 * time.Second, maxDelay: 45 * time.Second,
+		},
+		{
+			name: "too long retry after is not waited for", policy: policy,
+			err: statusErr(http.StatusTooManyRequests, retryMaxRetryAfter+time.Second), retry: 1,
+		},
+		{
+			name: "retries run out", policy: policy,
+			err: statusErr(http.StatusServiceUnavailable, 0), retry: 4,
+		},
+		{
+			name: "client errors are not retried", policy: policy,
+			err: statusErr(http.StatusBadRequest, 0), retry: 1,
+		},
+		{
+			name: "connection errors are retried", policy: policy,
+			err: errors.Wrap(io.ErrUnexpectedEOF, "reading response"), retry: 1,
+			expectedRetry: true, minDelay: time.Second, maxDelay: 2 * time.Second,
+		},
+		{
+			name: "cancellation is not retried", policy: policy,
+			err: errors.Wrap(context.Canceled, "request failed"), retry: 1,
+		},
+		{
+			name: "unknown errors are not retried", policy: policy,
+			err: errors.New("invalid model"), retry: 1,
+		},
+		{
+			name: "zero backoff retries immediately", policy: RetryPolicy{MaxRetries: 1},
+			err: statusErr(http.StatusInternalServerError, 0), retry: 1,
+			expectedRetry: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay, retry := test.policy.retryDelay(test.err, test.retry)
+			if retry != test.expectedRetry {
+				t.Fatalf("expected retry %t, got %t", test.expectedRetry, retry)
+			}
+			if retry && (delay < test.minDelay || delay > test.maxDelay) {
+				t.Errorf("expected a delay between %v and %v, got %v", test.minDelay, test.maxDelay, delay)
+			}
+		})
+	}
+}
+
+func TestFitsContextOf(t *testing.T) {
+	contextLength := func(length int) *int { return &length }
+
+	tests := []struct {
+		name     string
+		llm      *int
+		primary  *int
+		expected bool
+	}{
+		{name: "unknown primary context", llm: nil, primary: nil, expected: true},
+		{name: "unknown fallback context", llm: nil, primary: contextLength(8192), expected: false},
+		{name: "smaller fallback context", llm: contextLength(4096), primary: contextLength(8192), expected: false},
+		{name: "equal fallback context", llm: contextLength(8192), primary: contextLength(8192), expected: true},
+		{name: "larger fallback context", llm: contextLength(32768), primary: contextLength(8192), expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			llm := &LlmModelInstance{ContextLength: test.llm}
+			primary := &LlmModelInstance{ContextLength: test.primary}
+			if result := fitsContextOf(llm, primary); result != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
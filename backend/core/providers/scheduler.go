@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestPriority decides the order in which requests waiting for a provider are started.
+type RequestPriority int
+
+const (
+	// PriorityBackground is for work the user is not waiting on, like memories, titles and embeddings.
+	PriorityBackground RequestPriority = iota
+	// PriorityInteractive is for responses the user is waiting on, these go ahead of background requests.
+	PriorityInteractive
+)
+
+type requestPriorityContextKey struct{}
+
+// WithRequestPriority returns a context for provider requests with the given priority.
+// Requests without priority are background requests.
+func WithRequestPriority(ctx context.Context, priority RequestPriority) context.Context {
+	return context.WithValue(ctx, requestPriorityContextKey{}, priority)
+}
+
+func requestPriorityFromContext(ctx context.Context) RequestPriority {
+	if priority, ok := ctx.Value(requestPriorityContextKey{}).(RequestPriority); ok {
+		return priority
+	}
+	return PriorityBackground
+}
+
+// requestScheduler limits the requests to a provider to a maximum number running at the same time and a maximum
+// number started per minute. Waiting requests are started by priority, then in order of arrival.
+type requestScheduler struct {
+	maxConcurrent     int
+	requestsPerMinute int
+
+	mu      sync.Mutex
+	running int
+	waiting ticketQueue
+	seq     uint64
+	// startTimes are the times requests were started within the last minute, oldest first.
+	startTimes []time.Time
+	// rateTimer wakes the scheduler when the rate limit allows the next request.
+	rateTimer *time.Timer
+}
+
+type schedulerTicket struct {
+	priority RequestPriority
+	seq      uint64
+	index    int
+	granted  chan struct{}
+}
+
+func newRequestScheduler(maxConcurrent int, requestsPerMinute int) *requestScheduler {
+	return &requestScheduler{
+		maxConcurrent:     max(maxConcurrent, 1),
+		requestsPerMinute: max(requestsPerMinute, 0),
+	}
+}
+
+// setLimits updates the limits, requests already started keep counting towards them.
+func (s *requestScheduler) setLimits(maxConcurrent int, requestsPerMinute int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxConcurrent = max(maxConcurrent, 1)
+	s.requestsPerMinute = max(requestsPerMinute, 0)
+	s.dispatchLocked()
+}
+
+// acquire waits for a turn to send a request with the priority set in ctx.
+// Call the returned release function when the request is done.
+// Returns the context error when ctx is done before it was our turn.
+func (s *requestScheduler) acquire(ctx context.Context) (func(), error) {
+	s.mu.Lock()
+	s.seq++
+	ticket := &schedulerTicket{
+		priority: requestPriorityFromContext(ctx),
+		seq:      s.seq,
+		granted:  make(chan struct{}),
+	}
+	heap.Push(&s.waiting, ticket)
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	select {
+	case <-ticket.granted:
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		select {
+		case <-ticket.granted:
+			// Granted while we were cancelled, pass the turn on
+			s.running--
+			s.dispatchLocked()
+		default:
+			heap.Remove(&s.waiting, ticket.index)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *requestScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.dispatchLocked()
+}
+
+// dispatchLocked starts as many waiting requests as the limits allow.
+func (s *requestScheduler) dispatchLocked() {
+	for s.running < s.maxConcurrent && s.waiting.Len() > 0 {
+		if s.requestsPerMinute > 0 {
+			now := time.Now()
+			cutoff := now.Add(-time.Minute)
+			expired := 0
+			for expired < len(s.startTimes) && !s.startTimes[expired].After(cutoff) {
+				expired++
+			}
+			s.startTimes = s.startTimes[expired:]
+
+			if len(s.startTimes) >= s.requestsPerMinute {
+				s.scheduleDispatchLocked(s.startTimes[0].Add(time.Minute).Sub(now))
+				return
+			}
+			s.startTimes = append(s.startTimes, now)
+		}
+
+		ticket := heap.Pop(&s.waiting).(*schedulerTicket)
+		s.running++
+		close(ticket.granted)
+	}
+}
+
+func (s *requestScheduler) scheduleDispatchLocked(delay time.Duration) {
+	if s.rateTimer != nil {
+		s.rateTimer.Stop()
+	}
+	s.rateTimer = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.dispatchLocked()
+	})
+}
+
+// ticketQueue pops the ticket with the highest priority first, the oldest ticket on equal priority.
+type ticketQueue []*schedulerTicket
+
+func (q ticketQueue) Len() int { return len(q) }
+func (q ticketQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q ticketQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *ticketQueue) Push(x any) {
+	ticket := x.(*schedulerTicket)
+	ticket.index = len(*q)
+	*q = append(*q, ticket)
+}
+func (q *ticketQueue) Pop() any {
+	old := *q
+	ticket := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return ticket
+}
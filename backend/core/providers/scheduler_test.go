@@ -0,0 +1,180 @@
+package providers
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// acquireInBackground acquires a turn with the given priority, sending the request name to started when granted.
+func acquireInBackground(
+	t *testing.T,
+	scheduler *requestScheduler,
+	priority RequestPriority,
+	name string,
+	started chan<- string,
+) {
+	t.Helper()
+
+	go func() {
+		release, err := scheduler.acquire(WithRequestPriority(context.Background(), priority))
+		if err != nil {
+			t.Errorf("unexpected error acquiring %s: %v", name, err)
+			return
+		}
+		started <- name
+		release()
+	}()
+}
+
+// waitForWaiting waits until the given number of requests are waiting for the scheduler.
+func waitForWaiting(t *testing.T, scheduler *requestScheduler, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		scheduler.mu.Lock()
+		waiting := scheduler.waiting.Len()
+		scheduler.mu.Unlock()
+		if waiting == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d waiting requests", count)
+}
+
+func receiveStarted(t *testing.T, started <-chan string, count int) []string {
+	t.Helper()
+
+	var names []string
+	timeout := time.After(5 * time.Second)
+	for len(names) < count {
+		select {
+		case name := <-started:
+			names = append(names, name)
+		case <-timeout:
+			t.Fatalf("timed out waiting for started requests, got %v", names)
+		}
+	}
+	return names
+}
+
+func TestSchedulerStartsByPriorityThenArrival(t *testing.T) {
+	scheduler := newRequestScheduler(1, 0)
+
+	// Hold the only turn, so the others queue up
+	release, err := scheduler.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	started := make(chan string)
+	requests := []struct {
+		name     string
+		priority RequestPriority
+	}{
+		{"background 1", PriorityBackground},
+		{"interactive 1", PriorityInteractive},
+		{"background 2", PriorityBackground},
+		{"interactive 2", PriorityInteractive},
+	}
+	for idx, request := range requests {
+		acquireInBackground(t, scheduler, request.priority, request.name, started)
+		waitForWaiting(t, scheduler, idx+1)
+	}
+
+	release()
+
+	expected := []string{"interactive 1", "interactive 2", "background 1", "background 2"}
+	if names := receiveStarted(t, started, len(expected)); !slices.Equal(names, expected) {
+		t.Errorf("expected start order %v, got %v", expected, names)
+	}
+}
+
+func TestSchedulerLimitsConcurrentRequests(t *testing.T) {
+	const maxConcurrent = 2
+	scheduler := newRequestScheduler(maxConcurrent, 0)
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			release, err := scheduler.acquire(context.Background())
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	if maxRunning != maxConcurrent {
+		t.Errorf("expected at most %d running requests, got %d", maxConcurrent, maxRunning)
+	}
+}
+
+func TestSchedulerLimitsRequestsPerMinute(t *testing.T) {
+	scheduler := newRequestScheduler(10, 2)
+
+	for range 2 {
+		release, err := scheduler.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		release()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := scheduler.acquire(ctx); err == nil {
+		t.Fatal("expected the third request within a minute to wait")
+	}
+
+	scheduler.mu.Lock()
+	waiting := scheduler.waiting.Len()
+	scheduler.mu.Unlock()
+	if waiting != 0 {
+		t.Errorf("expected the cancelled request to stop waiting, got %d waiting", waiting)
+	}
+}
+
+func TestSchedulerSetLimits(t *testing.T) {
+	scheduler := newRequestScheduler(1, 0)
+
+	release, err := scheduler.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	started := make(chan string)
+	acquireInBackground(t, scheduler, PriorityBackground, "second", started)
+	waitForWaiting(t, scheduler, 1)
+
+	// Raising the limit starts waiting requests, while the running request keeps counting
+	scheduler.setLimits(2, 0)
+	receiveStarted(t, started, 1)
+
+	scheduler.setLimits(1, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = scheduler.acquire(ctx); err == nil {
+		t.Error("expected a request to wait while the running request holds the lowered limit")
+	}
+}
@@ -1,15 +1,40 @@
 package providers
 
 import (
+	"sync"
+
 	"github.com/tiktoken-go/tokenizer"
 )
 
+// cl100kBase is created once, as building the codec vocabulary is expensive and counting is done per message.
+var cl100kBase = sync.OnceValues(func() (tokenizer.Codec, error) {
+	return tokenizer.Get(tokenizer.Cl100kBase)
+})
+
 // TokenCount calculates the number of tokens in the given text using the GPT-4o tokenizer.
 func TokenCount(text string) (int, error) {
-	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	enc, err := cl100kBase()
 	if err != nil {
 		return 0, err
 	}
 
 	return enc.Count(text)
 }
+
+// TruncateToTokens truncates the given text to at most maxTokens tokens.
+func TruncateToTokens(text string, maxTokens int) (string, error) {
+	enc, err := cl100kBase()
+	if err != nil {
+		return "", err
+	}
+
+	ids, _, err := enc.Encode(text)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) <= maxTokens {
+		return text, nil
+	}
+
+	return enc.Decode(ids[:max(maxTokens, 0)])
+}
@@ -0,0 +1,364 @@
+package vectors
+
+import (
+	"cmp"
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+const (
+	// DefaultM is the number of neighbours a node links to on each layer (twice as many on layer 0).
+	DefaultM = 16
+	// DefaultEfConstruction is the size of the candidate list while inserting.
+	DefaultEfConstruction = 100
+)
+
+// Graph is a Hierarchical Navigable Small World graph for approximate nearest neighbour search by cosine similarity.
+// Vectors are normalized on insert, so the similarity of two vectors is their dot product.
+// Removed nodes are marked as removed: they still route searches, but are never returned. Compact rebuilds the graph
+// without them.
+// Graph is not safe for concurrent use, fields are exported for encoding only.
+type Graph struct {
+	M              int
+	EfConstruction int
+	Nodes          []Node
+	// NodeIndices maps IDs to their index in Nodes.
+	NodeIndices map[int]int
+	// EntryPoint is the index of the node on the top layer, -1 when the graph is empty.
+	EntryPoint int
+	MaxLevel   int
+	Removed    int
+}
+
+type Node struct {
+	ID      int
+	Vector  []float64
+	Removed bool
+	// Neighbours are indices in Graph.Nodes, per layer.
+	Neighbours [][]int
+}
+
+// Neighbour is a search result.
+type Neighbour struct {
+	ID         int
+	Similarity float64
+}
+
+func NewGraph(m int, efConstruction int) *Graph {
+	return &Graph{
+		M:              m,
+		EfConstruction: efConstruction,
+		NodeIndices:    make(map[int]int),
+		EntryPoint:     -1,
+	}
+}
+
+// Len returns the number of nodes that are not removed.
+func (g *Graph) Len() int {
+	return len(g.NodeIndices)
+}
+
+// Contains returns whether the graph has a (not removed) node for id.
+func (g *Graph) Contains(id int) bool {
+	_, ok := g.NodeIndices[id]
+	return ok
+}
+
+// Add inserts the vector for id, replacing the existing vector for id, if any.
+func (g *Graph) Add(id int, vector []float64) {
+	g.Remove(id)
+
+	nodeIdx := len(g.Nodes)
+	level := g.randomLevel()
+	g.Nodes = append(g.Nodes, Node{
+		ID:         id,
+		Vector:     normalize(vector),
+		Neighbours: make([][]int, level+1),
+	})
+	g.NodeIndices[id] = nodeIdx
+
+	if g.EntryPoint == -1 {
+		g.EntryPoint = nodeIdx
+		g.MaxLevel = level
+		return
+	}
+
+	query := g.Nodes[nodeIdx].Vector
+	entryPoint := g.EntryPoint
+	for l := g.MaxLevel; l > level; l-- {
+		entryPoint = g.greedyClosest(query, entryPoint, l)
+	}
+
+	for l := min(level, g.MaxLevel); l >= 0; l-- {
+		candidates := g.searchLayer(query, entryPoint, g.EfConstruction, l)
+		neighbours := bestNodes(candidates, g.maxConnections(l))
+		g.Nodes[nodeIdx].Neighbours[l] = neighbours
+
+		for _, neighbourIdx := range neighbours {
+			g.link(neighbourIdx, nodeIdx, l)
+		}
+		entryPoint = candidates[0].node
+	}
+
+	if level > g.MaxLevel {
+		g.MaxLevel = level
+		g.EntryPoint = nodeIdx
+	}
+}
+
+// Remove marks the node for id as removed. Returns whether there was a node for id.
+func (g *Graph) Remove(id int) bool {
+	nodeIdx, ok := g.NodeIndices[id]
+	if !ok {
+		return false
+	}
+
+	g.Nodes[nodeIdx].Removed = true
+	delete(g.NodeIndices, id)
+	g.Removed++
+	return true
+}
+
+// NeedsCompaction returns whether more nodes are removed than there are left.
+func (g *Graph) NeedsCompaction() bool {
+	return g.Removed > 0 && g.Removed >= g.Len()
+}
+
+// Compact rebuilds the graph without removed nodes.
+func (g *Graph) Compact() {
+	nodes := g.Nodes
+	*g = *NewGraph(g.M, g.EfConstruction)
+
+	for _, node := range nodes {
+		if !node.Removed {
+			g.Add(node.ID, node.Vector)
+		}
+	}
+}
+
+// Search returns up to k nearest neighbours of query, most similar first. ef is the size of the candidate list,
+// higher values give better recall at the cost of speed, it is at least k.
+func (g *Graph) Search(query []float64, k int, ef int) []Neighbour {
+	if g.EntryPoint == -1 || k <= 0 {
+		return nil
+	}
+
+	query = normalize(query)
+	entryPoint := g.EntryPoint
+	for l := g.MaxLevel; l > 0; l-- {
+		entryPoint = g.greedyClosest(query, entryPoint, l)
+	}
+
+	// Removed nodes take up room in the candidate list
+	ef = max(ef, k) + min(g.Removed, max(ef, k))
+	candidates := g.searchLayer(query, entryPoint, ef, 0)
+
+	result := make([]Neighbour, 0, k)
+	for _, candidate := range candidates {
+		node := &g.Nodes[candidate.node]
+		if node.Removed {
+			continue
+		}
+		result = append(result, Neighbour{ID: node.ID, Similarity: candidate.similarity})
+		if len(result) == k {
+			break
+		}
+	}
+	return result
+}
+
+func (g *Graph) maxConnections(level int) int {
+	if level == 0 {
+		return 2 * g.M
+	}
+	return g.M
+}
+
+// randomLevel draws the top layer of a new node from an exponentially decaying distribution.
+func (g *Graph) randomLevel() int {
+	levelMultiplier := 1 / math.Log(float64(max(g.M, 2)))
+	return int(math.Floor(-math.Log(1-rand.Float64()) * levelMultiplier))
+}
+
+// link adds a connection from the node to the target on the layer, dropping its least similar connection when
+// it has too many.
+func (g *Graph) link(nodeIdx int, targetIdx int, level int) {
+	node := &g.Nodes[nodeIdx]
+	node.Neighbours[level] = append(node.Neighbours[level], targetIdx)
+
+	maxConnections := g.maxConnections(level)
+	if len(node.Neighbours[level]) <= maxConnections {
+		return
+	}
+
+	candidates := make([]candidate, len(node.Neighbours[level]))
+	for idx, neighbourIdx := range node.Neighbours[level] {
+		candidates[idx] = candidate{
+			node:       neighbourIdx,
+			similarity: dot(node.Vector, g.Nodes[neighbourIdx].Vector),
+		}
+	}
+	slices.SortFunc(candidates, compareCandidates)
+	node.Neighbours[level] = bestNodes(candidates, maxConnections)
+}
+
+// greedyClosest walks the layer from the entry point to the node most similar to the query.
+func (g *Graph) greedyClosest(query []float64, entryPoint int, level int) int {
+	closest := entryPoint
+	closestSimilarity := dot(query, g.Nodes[closest].Vector)
+
+	for changed := true; changed; {
+		changed = false
+		for _, neighbourIdx := range g.Nodes[closest].Neighbours[level] {
+			if similarity := dot(query, g.Nodes[neighbourIdx].Vector); similarity > closestSimilarity {
+				closest = neighbourIdx
+				closestSimilarity = similarity
+				changed = true
+			}
+		}
+	}
+
+	return closest
+}
+
+// searchLayer returns up to ef nodes on the layer nearest to the query, most similar first.
+func (g *Graph) searchLayer(query []float64, entryPoint int, ef int, level int) []candidate {
+	entry := candidate{node: entryPoint, similarity: dot(query, g.Nodes[entryPoint].Vector)}
+	visited := acquireVisitedSet(len(g.Nodes))
+	defer visitedSets.Put(visited)
+	visited.visit(entryPoint)
+	toVisit := &candidateHeap{bestFirst: true}
+	nearest := &candidateHeap{}
+	heap.Push(toVisit, entry)
+	heap.Push(nearest, entry)
+
+	for toVisit.Len() > 0 {
+		current := heap.Pop(toVisit).(candidate)
+		if nearest.Len() >= ef && current.similarity < nearest.peek().similarity {
+			break
+		}
+
+		for _, neighbourIdx := range g.Nodes[current.node].Neighbours[level] {
+			if !visited.visit(neighbourIdx) {
+				continue
+			}
+
+			similarity := dot(query, g.Nodes[neighbourIdx].Vector)
+			if nearest.Len() < ef || similarity > nearest.peek().similarity {
+				next := candidate{node: neighbourIdx, similarity: similarity}
+				heap.Push(toVisit, next)
+				heap.Push(nearest, next)
+				if nearest.Len() > ef {
+					heap.Pop(nearest)
+				}
+			}
+		}
+	}
+
+	result := nearest.items
+	slices.SortFunc(result, compareCandidates)
+	return result
+}
+
+// visitedSet tracks the nodes visited by a search. Sets are reused between searches by bumping the epoch, instead
+// of clearing the marks.
+type visitedSet struct {
+	marks []uint32
+	epoch uint32
+}
+
+var visitedSets = sync.Pool{New: func() any { return &visitedSet{} }}
+
+func acquireVisitedSet(size int) *visitedSet {
+	set := visitedSets.Get().(*visitedSet)
+	if len(set.marks) < size {
+		set.marks = make([]uint32, size+size/4)
+		set.epoch = 0
+	}
+
+	set.epoch++
+	if set.epoch == 0 {
+		// Wrapped around, old marks could match again
+		clear(set.marks)
+		set.epoch = 1
+	}
+	return set
+}
+
+// visit marks the node as visited, returns false when it already was.
+func (s *visitedSet) visit(node int) bool {
+	if s.marks[node] == s.epoch {
+		return false
+	}
+	s.marks[node] = s.epoch
+	return true
+}
+
+type candidate struct {
+	node       int
+	similarity float64
+}
+
+// compareCandidates orders candidates most similar first.
+func compareCandidates(a, b candidate) int {
+	return cmp.Compare(b.similarity, a.similarity)
+}
+
+func bestNodes(sorted []candidate, n int) []int {
+	nodes := make([]int, min(n, len(sorted)))
+	for idx := range nodes {
+		nodes[idx] = sorted[idx].node
+	}
+	return nodes
+}
+
+// candidateHeap pops the least similar candidate first, or the most similar when bestFirst is set.
+type candidateHeap struct {
+	items     []candidate
+	bestFirst bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.bestFirst {
+		return h.items[i].similarity > h.items[j].similarity
+	}
+	return h.items[i].similarity < h.items[j].similarity
+}
+func (h *candidateHeap) Swap(i, j int)   { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x any)      { h.items = append(h.items, x.(candidate)) }
+func (h *candidateHeap) peek() candidate { return h.items[0] }
+func (h *candidateHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func dot(a []float64, b []float64) float64 {
+	var sum float64
+	for i := range min(len(a), len(b)) {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func normalize(vector []float64) []float64 {
+	var sumSquares float64
+	for _, v := range vector {
+		sumSquares += v * v
+	}
+
+	normalized := make([]float64, len(vector))
+	if sumSquares == 0 {
+		return normalized
+	}
+
+	norm := math.Sqrt(sumSquares)
+	for i, v := range vector {
+		normalized[i] = v / norm
+	}
+	return normalized
+}
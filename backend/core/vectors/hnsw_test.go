@@ -0,0 +1,158 @@
+package vectors
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func randomVectors(rng *rand.Rand, count int, dimensions int) [][]float64 {
+	vectors := make([][]float64, count)
+	for i := range vectors {
+		vector := make([]float64, dimensions)
+		for j := range vector {
+			vector[j] = rng.NormFloat64()
+		}
+		vectors[i] = vector
+	}
+	return vectors
+}
+
+// bruteForceSearch returns the IDs (indices) of the k vectors most similar to the query.
+func bruteForceSearch(vectors [][]float64, query []float64, k int) []int {
+	normalizedQuery := normalize(query)
+	neighbours := make([]Neighbour, len(vectors))
+	for i, vector := range vectors {
+		neighbours[i] = Neighbour{ID: i, Similarity: dot(normalize(vector), normalizedQuery)}
+	}
+	slices.SortFunc(neighbours, func(a, b Neighbour) int {
+		return cmp.Compare(b.Similarity, a.Similarity)
+	})
+
+	ids := make([]int, k)
+	for i := range ids {
+		ids[i] = neighbours[i].ID
+	}
+	return ids
+}
+
+func TestGraphRecall(t *testing.T) {
+	const (
+		count      = 2000
+		dimensions = 32
+		queries    = 50
+		k          = 10
+		minRecall  = 0.9
+	)
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	vectors := randomVectors(rng, count, dimensions)
+
+	graph := NewGraph(DefaultM, DefaultEfConstruction)
+	for id, vector := range vectors {
+		graph.Add(id, vector)
+	}
+	if graph.Len() != count {
+		t.Fatalf("expected %d nodes, got %d", count, graph.Len())
+	}
+
+	found := 0
+	for _, query := range randomVectors(rng, queries, dimensions) {
+		expected := bruteForceSearch(vectors, query, k)
+		results := graph.Search(query, k, 100)
+		if len(results) != k {
+			t.Fatalf("expected %d results, got %d", k, len(results))
+		}
+		if !slices.IsSortedFunc(results, func(a, b Neighbour) int { return cmp.Compare(b.Similarity, a.Similarity) }) {
+			t.Fatalf("results are not sorted by similarity: %v", results)
+		}
+
+		for _, result := range results {
+			if slices.Contains(expected, result.ID) {
+				found++
+			}
+		}
+	}
+
+	recall := float64(found) / float64(queries*k)
+	t.Logf("recall@%d: %.3f", k, recall)
+	if recall < minRecall {
+		t.Errorf("expected recall of at least %.2f, got %.2f", minRecall, recall)
+	}
+}
+
+func TestGraphRemoveAndCompact(t *testing.T) {
+	const (
+		count      = 200
+		dimensions = 16
+	)
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	vectors := randomVectors(rng, count, dimensions)
+
+	graph := NewGraph(DefaultM, DefaultEfConstruction)
+	for id, vector := range vectors {
+		graph.Add(id, vector)
+	}
+
+	// Remove the even IDs
+	for id := 0; id < count; id += 2 {
+		if !graph.Remove(id) {
+			t.Fatalf("expected node %d to be removed", id)
+		}
+	}
+	if graph.Remove(0) {
+		t.Error("expected removing a removed node to return false")
+	}
+	if graph.Remove(count) {
+		t.Error("expected removing an unknown node to return false")
+	}
+
+	if graph.Len() != count/2 {
+		t.Errorf("expected %d nodes after removal, got %d", count/2, graph.Len())
+	}
+	if graph.Contains(0) || !graph.Contains(1) {
+		t.Error("expected removed nodes to be absent and others present")
+	}
+	if !graph.NeedsCompaction() {
+		t.Error("expected the graph to need compaction with half of its nodes removed")
+	}
+
+	assertNoRemovedResults := func(stage string) {
+		for id, vector := range vectors {
+			results := graph.Search(vector, 10, 100)
+			if len(results) != 10 {
+				t.Fatalf("%s: expected 10 results, got %d", stage, len(results))
+			}
+			for _, result := range results {
+				if result.ID%2 == 0 {
+					t.Fatalf("%s: search for %d returned removed node %d", stage, id, result.ID)
+				}
+			}
+			if id%2 == 1 && results[0].ID != id {
+				t.Errorf("%s: expected node %d to be its own nearest neighbour, got %d", stage, id, results[0].ID)
+			}
+		}
+	}
+	assertNoRemovedResults("before compaction")
+
+	graph.Compact()
+	if graph.Removed != 0 || len(graph.Nodes) != count/2 || graph.Len() != count/2 {
+		t.Errorf("expected %d nodes without removed nodes after compaction, got %d nodes (%d removed)",
+			count/2, len(graph.Nodes), graph.Removed)
+	}
+	if graph.NeedsCompaction() {
+		t.Error("expected the graph not to need compaction after compacting")
+	}
+	assertNoRemovedResults("after compaction")
+
+	// Removed IDs can be added again
+	graph.Add(0, vectors[0])
+	if !graph.Contains(0) {
+		t.Error("expected node 0 to be present after adding it again")
+	}
+	if results := graph.Search(vectors[0], 1, 100); len(results) != 1 || results[0].ID != 0 {
+		t.Errorf("expected node 0 to be found after adding it again, got %v", results)
+	}
+}
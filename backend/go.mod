@@ -13,6 +13,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/tiktoken-go/tokenizer v0.7.0
 	go.uber.org/zap v1.27.1
+	golang.org/x/image v0.25.0
 )
 
 require (
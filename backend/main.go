@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gin-contrib/cors"
@@ -8,7 +9,10 @@ import (
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/api"
 	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/assets"
+	"juraji.nl/chat-quest/core/backup"
 	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/jobs"
 	"juraji.nl/chat-quest/core/log"
 	"juraji.nl/chat-quest/core/ui"
 	"juraji.nl/chat-quest/processing"
@@ -41,6 +45,12 @@ func main() {
 	// Asynchronous processes (needs to be here, or it won't be compiled!)
 	mainLogger.Info("Setting up asynchronous processing...")
 	processing.SetupProcessing()
+	processing.FinalizeInterruptedGenerations()
+	jobs.StartWorkers(context.Background())
+	assets.StartSweeper(context.Background())
+	backup.StartScheduler(context.Background())
+	processing.StartMemoryConsolidationScheduler(context.Background())
+	processing.StartMemoryIndex(context.Background())
 
 	// New Router!
 	router := gin.New()
@@ -68,6 +78,11 @@ func main() {
 	api.WorldsRoutes(apiRouter)
 	api.ChatSessionsRoutes(apiRouter)
 	api.MemoriesRoutes(apiRouter)
+	api.LorebookRoutes(apiRouter)
+	api.JobsRoutes(apiRouter)
+	api.GenerationsRoutes(apiRouter)
+	api.AssetsRoutes(apiRouter)
+	api.SearchRoutes(apiRouter)
 	api.SseRoutes(apiRouter)
 
 	// Setup UI host (any non-api route)
@@ -0,0 +1,198 @@
+package character_cards
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SpecV1 = "chara_card_v1"
+	SpecV2 = "chara_card_v2"
+	SpecV3 = "chara_card_v3"
+)
+
+// CharacterCard is a character in the community Character Card format (https://github.com/malfoyslastname/character-card-spec-v2).
+// V3 cards (https://github.com/kwaroran/character-card-spec-v3) are a superset of V2, so both are represented by this type.
+type CharacterCard struct {
+	Spec        string   `json:"spec"`
+	SpecVersion string   `json:"spec_version"`
+	Data        CardData `json:"data"`
+}
+
+type CardData struct {
+	Name                    string         `json:"name"`
+	Description             string         `json:"description"`
+	Personality             string         `json:"personality"`
+	Scenario                string         `json:"scenario"`
+	FirstMes                string         `json:"first_mes"`
+	MesExample              string         `json:"mes_example"`
+	CreatorNotes            string         `json:"creator_notes"`
+	SystemPrompt            string         `json:"system_prompt"`
+	PostHistoryInstructions string         `json:"post_history_instructions"`
+	AlternateGreetings      []string       `json:"alternate_greetings"`
+	CharacterBook           *CharacterBook `json:"character_book,omitempty"`
+	Tags                    []string       `json:"tags"`
+	Creator                 string         `json:"creator"`
+	CharacterVersion        string         `json:"character_version"`
+	Extensions              map[string]any `json:"extensions"`
+
+	// V3 only
+	Nickname           string      `json:"nickname,omitempty"`
+	GroupOnlyGreetings []string    `json:"group_only_greetings,omitzero"`
+	Assets             []CardAsset `json:"assets,omitzero"`
+}
+
+type CardAsset struct {
+	Type string `json:"type"`
+	Uri  string `json:"uri"`
+	Name string `json:"name"`
+	Ext  string `json:"ext"`
+}
+
+type CharacterBook struct {
+	Name              string               `json:"name,omitempty"`
+	Description       string               `json:"description,omitempty"`
+	ScanDepth         *int                 `json:"scan_depth,omitempty"`
+	TokenBudget       *int                 `json:"token_budget,omitempty"`
+	RecursiveScanning *bool                `json:"recursive_scanning,omitempty"`
+	Extensions        map[string]any       `json:"extensions"`
+	Entries           []CharacterBookEntry `json:"entries"`
+}
+
+type CharacterBookEntry struct {
+	Keys           []string       `json:"keys"`
+	Content        string         `json:"content"`
+	Extensions     map[string]any `json:"extensions"`
+	Enabled        bool           `json:"enabled"`
+	InsertionOrder int            `json:"insertion_order"`
+	CaseSensitive  *bool          `json:"case_sensitive,omitempty"`
+	Name           string         `json:"name,omitempty"`
+	Priority       *int           `json:"priority,omitempty"`
+	ID             any            `json:"id,omitempty"`
+	Comment        string         `json:"comment,omitempty"`
+	Selective      bool           `json:"selective,omitempty"`
+	SecondaryKeys  []string       `json:"secondary_keys,omitempty"`
+	Constant       bool           `json:"constant,omitempty"`
+	Position       string         `json:"position,omitempty"`
+
+	// V3 only
+	UseRegex bool `json:"use_regex,omitempty"`
+}
+
+// NewCharacterCard creates a card of the given spec (SpecV2 or SpecV3) for writing.
+// Fields that are not part of the spec are cleared and required lists and objects are set to empty values,
+// as some readers reject nulls.
+func NewCharacterCard(spec string, data CardData) *CharacterCard {
+	card := &CharacterCard{Spec: spec, Data: data}
+
+	switch spec {
+	case SpecV3:
+		card.SpecVersion = "3.0"
+		card.Data.GroupOnlyGreetings = emptyIfNil(card.Data.GroupOnlyGreetings)
+		card.Data.Assets = emptyIfNil(card.Data.Assets)
+	default:
+		card.Spec = SpecV2
+		card.SpecVersion = "2.0"
+		card.Data.Nickname = ""
+		card.Data.GroupOnlyGreetings = nil
+		card.Data.Assets = nil
+	}
+
+	card.Data.AlternateGreetings = emptyIfNil(card.Data.AlternateGreetings)
+	card.Data.Tags = emptyIfNil(card.Data.Tags)
+	card.Data.Extensions = emptyMapIfNil(card.Data.Extensions)
+
+	if book := card.Data.CharacterBook; book != nil {
+		bookCopy := *book
+		bookCopy.Extensions = emptyMapIfNil(bookCopy.Extensions)
+		bookCopy.Entries = make([]CharacterBookEntry, len(book.Entries))
+		for i, entry := range book.Entries {
+			entry.Keys = emptyIfNil(entry.Keys)
+			entry.Extensions = emptyMapIfNil(entry.Extensions)
+			if spec != SpecV3 {
+				entry.UseRegex = false
+			}
+			bookCopy.Entries[i] = entry
+		}
+		card.Data.CharacterBook = &bookCopy
+	}
+
+	return card
+}
+
+// ParseCard parses a character card from either a PNG image with an embedded card or a JSON document.
+func ParseCard(data []byte) (*CharacterCard, error) {
+	if IsPNG(data) {
+		return ParseCardPNG(data)
+	}
+	return ParseCardJSON(data)
+}
+
+// ParseCardJSON parses a V2 or V3 card. Legacy V1 cards, which have no spec and store the fields at the
+// top level, are converted to V2 form.
+func ParseCardJSON(data []byte) (*CharacterCard, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var card CharacterCard
+	if err := json.Unmarshal(data, &card); err != nil {
+		return nil, errors.Wrap(err, "invalid character card JSON")
+	}
+
+	switch card.Spec {
+	case SpecV2, SpecV3:
+	case "":
+		if err := json.Unmarshal(data, &card.Data); err != nil {
+			return nil, errors.Wrap(err, "invalid character card JSON")
+		}
+		card.Spec = SpecV1
+		card.SpecVersion = "1.0"
+	default:
+		return nil, errors.Errorf("unsupported character card spec '%s'", card.Spec)
+	}
+
+	if card.Data.Name == "" {
+		return nil, errors.New("character card has no name")
+	}
+
+	return &card, nil
+}
+
+// ParseCardPNG extracts the card embedded in the tEXt chunks of a PNG image.
+// The V3 "ccv3" chunk takes precedence over the V2 "chara" chunk, as V3 writers include both.
+func ParseCardPNG(data []byte) (*CharacterCard, error) {
+	chunks, err := readTextChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, ok := chunks[pngKeywordV3]
+	if !ok {
+		encoded, ok = chunks[pngKeywordV2]
+	}
+	if !ok {
+		return nil, errors.New("PNG image does not contain a character card")
+	}
+
+	cardJson, err := decodeCardText(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCardJSON(cardJson)
+}
+
+func emptyIfNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func emptyMapIfNil(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
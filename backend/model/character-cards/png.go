@@ -0,0 +1,170 @@
+package character_cards
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	pngKeywordV2 = "chara"
+	pngKeywordV3 = "ccv3"
+)
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+type pngChunk struct {
+	Type string
+	Data []byte
+	// Raw is the full chunk, including length, type and CRC.
+	Raw []byte
+}
+
+func IsPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngSignature)
+}
+
+// EncodeCardPNG embeds the cards in the PNG image, replacing any card that was already embedded.
+// V2 cards are written to the "chara" chunk and V3 cards to the "ccv3" chunk, so writing both gives the best
+// compatibility with readers.
+func EncodeCardPNG(image []byte, cards ...*CharacterCard) ([]byte, error) {
+	stripped, err := StripCardChunks(image)
+	if err != nil {
+		return nil, err
+	}
+
+	iendOffset := bytes.LastIndex(stripped, []byte("IEND")) - 4
+	if iendOffset < len(pngSignature) {
+		return nil, errors.New("PNG image has no IEND chunk")
+	}
+
+	encoded := bytes.NewBuffer(make([]byte, 0, len(stripped)))
+	encoded.Write(stripped[:iendOffset])
+	for _, card := range cards {
+		keyword := pngKeywordV2
+		if card.Spec == SpecV3 {
+			keyword = pngKeywordV3
+		}
+
+		cardJson, err := json.Marshal(card)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode character card")
+		}
+
+		text := append([]byte(keyword+"\x00"), base64.StdEncoding.EncodeToString(cardJson)...)
+		writeChunk(encoded, "tEXt", text)
+	}
+	encoded.Write(stripped[iendOffset:])
+
+	return encoded.Bytes(), nil
+}
+
+// StripCardChunks returns the PNG image without any embedded character card chunks.
+func StripCardChunks(data []byte) ([]byte, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped := bytes.NewBuffer(make([]byte, 0, len(data)))
+	stripped.Write(pngSignature)
+	for _, chunk := range chunks {
+		if chunk.Type == "tEXt" {
+			if keyword, _, ok := bytes.Cut(chunk.Data, []byte{0}); ok && isCardKeyword(string(keyword)) {
+				continue
+			}
+		}
+		stripped.Write(chunk.Raw)
+	}
+
+	return stripped.Bytes(), nil
+}
+
+// readTextChunks returns the text of all tEXt chunks by keyword.
+func readTextChunks(data []byte) (map[string]string, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make(map[string]string)
+	for _, chunk := range chunks {
+		if chunk.Type != "tEXt" {
+			continue
+		}
+		if keyword, text, ok := bytes.Cut(chunk.Data, []byte{0}); ok {
+			texts[string(keyword)] = string(text)
+		}
+	}
+
+	return texts, nil
+}
+
+// readChunks splits a PNG image into its chunks, up to and including IEND.
+func readChunks(data []byte) ([]pngChunk, error) {
+	if !IsPNG(data) {
+		return nil, errors.New("not a PNG image")
+	}
+
+	var chunks []pngChunk
+	offset := len(pngSignature)
+	for offset < len(data) {
+		// Length (4) + type (4) + data (length) + CRC (4)
+		if offset+8 > len(data) {
+			return nil, errors.New("truncated PNG chunk header")
+		}
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		end := offset + 8 + length + 4
+		if length < 0 || end > len(data) || end < offset {
+			return nil, errors.New("truncated PNG chunk")
+		}
+
+		chunk := pngChunk{
+			Type: string(data[offset+4 : offset+8]),
+			Data: data[offset+8 : offset+8+length],
+			Raw:  data[offset:end],
+		}
+		chunks = append(chunks, chunk)
+		offset = end
+
+		if chunk.Type == "IEND" {
+			break
+		}
+	}
+
+	return chunks, nil
+}
+
+func writeChunk(buf *bytes.Buffer, chunkType string, data []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(chunkType)
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	_ = binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+func isCardKeyword(keyword string) bool {
+	return keyword == pngKeywordV2 || keyword == pngKeywordV3
+}
+
+// decodeCardText decodes the base64 encoded card JSON, as written by SillyTavern and other frontends.
+func decodeCardText(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		// Some writers omit the padding
+		decoded, err = base64.RawStdEncoding.DecodeString(text)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid character card encoding")
+	}
+	return decoded, nil
+}
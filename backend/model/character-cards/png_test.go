@@ -0,0 +1,215 @@
+package character_cards
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// testPNG encodes a small image, with the given tEXt chunks (keyword and text) inserted before IEND.
+func testPNG(t *testing.T, texts ...[2]string) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode test image: %v", err)
+	}
+	data := buf.Bytes()
+
+	iendOffset := bytes.LastIndex(data, []byte("IEND")) - 4
+	var withTexts bytes.Buffer
+	withTexts.Write(data[:iendOffset])
+	for _, text := range texts {
+		writeChunk(&withTexts, "tEXt", []byte(text[0]+"\x00"+text[1]))
+	}
+	withTexts.Write(data[iendOffset:])
+	return withTexts.Bytes()
+}
+
+func encodeCardText(cardJson string) string {
+	return base64.StdEncoding.EncodeToString([]byte(cardJson))
+}
+
+func TestParseCardPNG(t *testing.T) {
+	v2Card := `{"spec":"chara_card_v2","spec_version":"2.0","data":{"name":"Aria"}}`
+	v3Card := `{"spec":"chara_card_v3","spec_version":"3.0","data":{"name":"Aria V3"}}`
+
+	tests := []struct {
+		name         string
+		data         func(t *testing.T) []byte
+		expectedName string
+		expectedSpec string
+		expectError  bool
+	}{
+		{
+			name:         "v2 chunk",
+			data:         func(t *testing.T) []byte { return testPNG(t, [2]string{"chara", encodeCardText(v2Card)}) },
+			expectedName: "Aria",
+			expectedSpec: SpecV2,
+		},
+		{
+			name: "v3 chunk takes precedence",
+			data: func(t *testing.T) []byte {
+				return testPNG(t,
+					[2]string{"chara", encodeCardText(v2Card)},
+					[2]string{"ccv3", encodeCardText(v3Card)})
+			},
+			expectedName: "Aria V3",
+			expectedSpec: SpecV3,
+		},
+		{
+			name: "unpadded base64 and other text chunks",
+			data: func(t *testing.T) []byte {
+				return testPNG(t,
+					[2]string{"Software", "Some editor"},
+					[2]string{"chara", base64.RawStdEncoding.EncodeToString([]byte(`{"name":"Legacy"}`)) + "\n"})
+			},
+			expectedName: "Legacy",
+			expectedSpec: SpecV1,
+		},
+		{
+			name:        "no card chunk",
+			data:        func(t *testing.T) []byte { return testPNG(t, [2]string{"Software", "Some editor"}) },
+			expectError: true,
+		},
+		{
+			name:        "invalid card encoding",
+			data:        func(t *testing.T) []byte { return testPNG(t, [2]string{"chara", "not base64!"}) },
+			expectError: true,
+		},
+		{
+			name:        "not a PNG image",
+			data:        func(t *testing.T) []byte { return []byte(v2Card) },
+			expectError: true,
+		},
+		{
+			name: "truncated chunk",
+			data: func(t *testing.T) []byte {
+				data := testPNG(t, [2]string{"chara", encodeCardText(v2Card)})
+				return data[:len(pngSignature)+20]
+			},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card, err := ParseCardPNG(test.data(t))
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got card %v", card)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if card.Data.Name != test.expectedName || card.Spec != test.expectedSpec {
+				t.Errorf("expected %s card '%s', got %s card '%s'",
+					test.expectedSpec, test.expectedName, card.Spec, card.Data.Name)
+			}
+		})
+	}
+}
+
+func TestEncodeCardPNG(t *testing.T) {
+	v2 := NewCharacterCard(SpecV2, CardData{Name: "Aria", Description: "A bard"})
+	v3 := NewCharacterCard(SpecV3, CardData{Name: "Aria", Nickname: "Ari"})
+
+	tests := []struct {
+		name             string
+		image            func(t *testing.T) []byte
+		cards            []*CharacterCard
+		expectedKeywords []string
+		expectedSpec     string
+	}{
+		{
+			name:             "v2 card",
+			image:            func(t *testing.T) []byte { return testPNG(t) },
+			cards:            []*CharacterCard{v2},
+			expectedKeywords: []string{"chara"},
+			expectedSpec:     SpecV2,
+		},
+		{
+			name:             "v2 and v3 cards",
+			image:            func(t *testing.T) []byte { return testPNG(t) },
+			cards:            []*CharacterCard{v2, v3},
+			expectedKeywords: []string{"chara", "ccv3"},
+			expectedSpec:     SpecV3,
+		},
+		{
+			name: "existing cards are replaced and other text chunks kept",
+			image: func(t *testing.T) []byte {
+				return testPNG(t,
+					[2]string{"Software", "Some editor"},
+					[2]string{"chara", encodeCardText(`{"name":"Old"}`)},
+					[2]string{"ccv3", encodeCardText(`{"spec":"chara_card_v3","data":{"name":"Old"}}`)})
+			},
+			cards:            []*CharacterCard{v2},
+			expectedKeywords: []string{"Software", "chara"},
+			expectedSpec:     SpecV2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := EncodeCardPNG(test.image(t), test.cards...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The image must still be valid, which includes the chunk CRCs
+			if _, err = png.Decode(bytes.NewReader(encoded)); err != nil {
+				t.Fatalf("encoded image is not a valid PNG: %v", err)
+			}
+
+			chunks, err := readChunks(encoded)
+			if err != nil {
+				t.Fatalf("unexpected error reading chunks: %v", err)
+			}
+			var keywords []string
+			for _, chunk := range chunks {
+				if keyword, _, ok := bytes.Cut(chunk.Data, []byte{0}); ok && chunk.Type == "tEXt" {
+					keywords = append(keywords, string(keyword))
+				}
+			}
+			if !slices.Equal(keywords, test.expectedKeywords) {
+				t.Errorf("expected text chunks %v, got %v", test.expectedKeywords, keywords)
+			}
+			if chunks[len(chunks)-1].Type != "IEND" {
+				t.Errorf("expected IEND to be the last chunk, got %s", chunks[len(chunks)-1].Type)
+			}
+
+			card, err := ParseCardPNG(encoded)
+			if err != nil {
+				t.Fatalf("unexpected error parsing the encoded card: %v", err)
+			}
+			if card.Spec != test.expectedSpec || card.Data.Name != "Aria" {
+				t.Errorf("expected %s card 'Aria', got %s card '%s'", test.expectedSpec, card.Spec, card.Data.Name)
+			}
+		})
+	}
+}
+
+func TestStripCardChunks(t *testing.T) {
+	plain := testPNG(t)
+	withCard := testPNG(t, [2]string{"chara", encodeCardText(`{"name":"Aria"}`)})
+
+	stripped, err := StripCardChunks(withCard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(stripped, plain) {
+		t.Error("expected the stripped image to equal the image without card")
+	}
+
+	if _, err = StripCardChunks([]byte("GIF89a")); err == nil {
+		t.Error("expected an error for an image that is not a PNG")
+	}
+}
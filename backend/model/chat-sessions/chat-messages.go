@@ -1,6 +1,7 @@
 package chat_sessions
 
 import (
+	"errors"
 	"slices"
 	"time"
 
@@ -16,6 +17,16 @@ type ChatMessage struct {
 	CharacterID   *int       `json:"characterId"`
 	Content       string     `json:"content"`
 	Reasoning     string     `json:"reasoning"`
+
+	ActiveAlternativeID *int `json:"activeAlternativeId"`
+}
+
+type ChatMessageAlternative struct {
+	ID            int        `json:"id"`
+	ChatMessageID int        `json:"chatMessageId"`
+	CreatedAt     *time.Time `json:"createdAt"`
+	Content       string     `json:"content"`
+	Reasoning     string     `json:"reasoning"`
 }
 
 func ChatMessageScanner(scanner database.RowScanner, dest *ChatMessage) error {
@@ -28,6 +39,17 @@ func ChatMessageScanner(scanner database.RowScanner, dest *ChatMessage) error {
 		&dest.CharacterID,
 		&dest.Content,
 		&dest.Reasoning,
+		&dest.ActiveAlternativeID,
+	)
+}
+
+func chatMessageAlternativeScanner(scanner database.RowScanner, dest *ChatMessageAlternative) error {
+	return scanner.Scan(
+		&dest.ID,
+		&dest.ChatMessageID,
+		&dest.CreatedAt,
+		&dest.Content,
+		&dest.Reasoning,
 	)
 }
 
@@ -77,6 +99,16 @@ func GetMessageById(messageId int) (*ChatMessage, error) {
 	return database.QueryForRecord(query, args, ChatMessageScanner)
 }
 
+func GetChatSessionMessageCountBeforeId(sessionId int, messageId int) (int, error) {
+	query := "SELECT COUNT(*) FROM chat_messages WHERE chat_session_id=? AND id<?"
+	args := []any{sessionId, messageId}
+	res, err := database.QueryForRecord(query, args, database.IntScanner)
+	if err != nil {
+		return 0, err
+	}
+	return *res, nil
+}
+
 func GetMessagesInSessionBeforeId(sessionId int, messageId int, limit int) ([]ChatMessage, error) {
 	query := "SELECT * FROM chat_messages WHERE chat_session_id=? AND id<? ORDER BY id DESC LIMIT ?"
 	args := []any{sessionId, messageId, limit}
@@ -99,6 +131,13 @@ func GetMessagesInSessionAfterId(sessionId int, messageId int, limit int) ([]Cha
 	return database.QueryForList(query, args, ChatMessageScanner)
 }
 
+func GetMessagesInSessionBetweenIds(sessionId int, fromId int, toId int) ([]ChatMessage, error) {
+	query := "SELECT * FROM chat_messages WHERE chat_session_id=? AND id BETWEEN ? AND ? ORDER BY id"
+	args := []any{sessionId, fromId, toId}
+
+	return database.QueryForList(query, args, ChatMessageScanner)
+}
+
 func CreateChatMessage(sessionId int, chatMessage *ChatMessage) error {
 	chatMessage.ChatSessionID = sessionId
 	chatMessage.CreatedAt = nil
@@ -124,52 +163,298 @@ func CreateChatMessage(sessionId int, chatMessage *ChatMessage) error {
 	return err
 }
 
+// UpdateChatMessage updates the message, deleting the session summary when it covers the message.
 func UpdateChatMessage(sessionId int, id int, chatMessage *ChatMessage) error {
 	chatMessage.ChatSessionID = sessionId
 	chatMessage.IsUser = chatMessage.CharacterID == nil
 
-	query := `UPDATE chat_messages
-            SET is_user = ?,
-                is_generating = ?,
-                character_id = ?,
-                content = ?,
-                reasoning = ?
-            WHERE chat_session_id = ?
-              AND id = ?`
-	args := []any{
-		chatMessage.IsUser,
-		chatMessage.IsGenerating,
-		chatMessage.CharacterID,
-		chatMessage.Content,
-		chatMessage.Reasoning,
-		sessionId,
-		id}
-
-	err := database.UpdateRecord(query, args)
+	var summaryDeleted bool
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		var err error
+		if summaryDeleted, err = deleteChatSessionSummaryFrom(ctx, sessionId, id); err != nil {
+			return err
+		}
+
+		query := `UPDATE chat_messages
+              SET is_user = ?,
+                  is_generating = ?,
+                  character_id = ?,
+                  content = ?,
+                  reasoning = ?
+              WHERE chat_session_id = ?
+                AND id = ?
+              RETURNING active_alternative_id`
+		args := []any{
+			chatMessage.IsUser,
+			chatMessage.IsGenerating,
+			chatMessage.CharacterID,
+			chatMessage.Content,
+			chatMessage.Reasoning,
+			sessionId,
+			id}
+
+		return ctx.InsertRecord(query, args, &chatMessage.ActiveAlternativeID)
+	})
 
 	if err == nil {
+		if summaryDeleted {
+			ChatSessionSummaryDeletedSignal.EmitBG(sessionId)
+		}
 		ChatMessageUpdatedSignal.EmitBG(chatMessage)
 	}
 
 	return err
 }
 
+// ChatMessagesDeletedFromEvent signals that messages in the session were deleted, starting at FromMessageID.
+type ChatMessagesDeletedFromEvent struct {
+	ChatSessionID int   `json:"chatSessionId"`
+	FromMessageID int   `json:"fromMessageId"`
+	DeletedIDs    []int `json:"deletedIds"`
+}
+
 func DeleteChatMessagesFrom(sessionId int, id int) error {
-	//language=SQL
-	query := `DELETE
+	var deletedIds []int
+	var summaryDeleted bool
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		var err error
+		if summaryDeleted, err = deleteChatSessionSummaryFrom(ctx, sessionId, id); err != nil {
+			return err
+		}
+
+		//language=SQL
+		query := `DELETE
             FROM chat_messages
             WHERE chat_session_id = ?
               AND id >= ?
             RETURNING id`
-	args := []any{sessionId, id}
+		args := []any{sessionId, id}
 
-	deletedIds, err := database.QueryForList(query, args, func(scanner database.RowScanner, dest *int) error {
-		return scanner.Scan(dest)
+		deletedIds, err = ctx.DeleteRecord(query, args)
+		return err
 	})
 
 	if err == nil {
+		if summaryDeleted {
+			ChatSessionSummaryDeletedSignal.EmitBG(sessionId)
+		}
 		ChatMessageDeletedSignal.EmitAllBG(deletedIds)
+		if len(deletedIds) > 0 {
+			ChatMessagesDeletedFromSignal.EmitBG(&ChatMessagesDeletedFromEvent{
+				ChatSessionID: sessionId,
+				FromMessageID: id,
+				DeletedIDs:    deletedIds,
+			})
+		}
+	}
+
+	return err
+}
+
+func DeleteChatMessage(sessionId int, id int) error {
+	var summaryDeleted bool
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		var err error
+		if summaryDeleted, err = deleteChatSessionSummaryFrom(ctx, sessionId, id); err != nil {
+			return err
+		}
+
+		query := "DELETE FROM chat_messages WHERE chat_session_id = ? AND id = ?"
+		args := []any{sessionId, id}
+		_, err = ctx.DeleteRecord(query, args)
+		return err
+	})
+
+	if err == nil {
+		if summaryDeleted {
+			ChatSessionSummaryDeletedSignal.EmitBG(sessionId)
+		}
+		ChatMessageDeletedSignal.EmitBG(id)
 	}
 
 	return err
 }
+
+func GetChatMessageAlternatives(sessionId int, messageId int) ([]ChatMessageAlternative, error) {
+	query := `SELECT a.*
+            FROM chat_message_alternatives a
+                JOIN chat_messages m ON m.id = a.chat_message_id
+            WHERE m.chat_session_id = ?
+              AND a.chat_message_id = ?
+            ORDER BY a.id`
+	args := []any{sessionId, messageId}
+	return database.QueryForList(query, args, chatMessageAlternativeScanner)
+}
+
+// ErrChatMessageGenerating is returned when generation into a message is started while it is already being generated.
+var ErrChatMessageGenerating = errors.New("chat message is already being generated")
+
+// MarkChatMessageGenerating marks a finalized message as generating, so only one generation at a time writes into it.
+// Returns ErrChatMessageGenerating when the message is already being generated (or does not exist).
+func MarkChatMessageGenerating(sessionId int, id int) (*ChatMessage, error) {
+	query := `UPDATE chat_messages
+            SET is_generating = TRUE
+            WHERE chat_session_id = ?
+              AND id = ?
+              AND is_generating = FALSE
+            RETURNING *`
+	args := []any{sessionId, id}
+
+	message, err := database.QueryForRecord(query, args, ChatMessageScanner)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, ErrChatMessageGenerating
+	}
+
+	ChatMessageUpdatedSignal.EmitBG(message)
+	return message, nil
+}
+
+// CreateChatMessageAlternative adds a new, empty alternative to the given message and makes it the active one.
+// When the message has no alternatives yet, its current content is kept as the first alternative.
+// The message is cleared and marked as generating, ready to receive a new response. Returns
+// ErrChatMessageGenerating when the message is already being generated.
+func CreateChatMessageAlternative(sessionId int, messageId int) (*ChatMessage, error) {
+	message, err := MarkChatMessageGenerating(sessionId, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	txErr := database.Transactional(func(ctx *database.TxContext) error {
+		if message.ActiveAlternativeID == nil {
+			// Keep the original response as the first alternative
+			query := `INSERT INTO chat_message_alternatives (chat_message_id, created_at, content, reasoning)
+                VALUES (?, ?, ?, ?)`
+			args := []any{message.ID, message.CreatedAt, message.Content, message.Reasoning}
+			if err := ctx.InsertRecord(query, args); err != nil {
+				return err
+			}
+		}
+
+		query := `INSERT INTO chat_message_alternatives (chat_message_id, content, reasoning)
+              VALUES (?, '', '') RETURNING id`
+		args := []any{message.ID}
+		if err := ctx.InsertRecord(query, args, &message.ActiveAlternativeID); err != nil {
+			return err
+		}
+
+		query = `UPDATE chat_messages
+             SET active_alternative_id = ?,
+                 content = '',
+                 reasoning = ''
+             WHERE id = ?`
+		args = []any{message.ActiveAlternativeID, message.ID}
+		return ctx.UpdateRecord(query, args)
+	})
+
+	if txErr != nil {
+		// Release the message again
+		query := "UPDATE chat_messages SET is_generating = FALSE WHERE id = ?"
+		if err = database.UpdateRecord(query, []any{messageId}); err == nil {
+			if released, err := GetMessageById(messageId); err == nil && released != nil {
+				ChatMessageUpdatedSignal.EmitBG(released)
+			}
+		}
+		return nil, txErr
+	}
+
+	message.Content = ""
+	message.Reasoning = ""
+
+	ChatMessageUpdatedSignal.EmitBG(message)
+	return message, nil
+}
+
+// DiscardChatMessageAlternative deletes an alternative of a message and makes the latest remaining alternative the
+// active one again. The message is finalized. Used when nothing was generated into a new alternative.
+func DiscardChatMessageAlternative(sessionId int, messageId int, alternativeId int) (*ChatMessage, error) {
+	txErr := database.Transactional(func(ctx *database.TxContext) error {
+		query := `DELETE FROM chat_message_alternatives
+              WHERE id = ? AND chat_message_id = ?
+              RETURNING id`
+		args := []any{alternativeId, messageId}
+		if _, err := ctx.DeleteRecord(query, args); err != nil {
+			return err
+		}
+
+		query = `UPDATE chat_messages
+             SET active_alternative_id = a.id,
+                 content = a.content,
+                 reasoning = a.reasoning
+             FROM (SELECT id, content, reasoning
+                   FROM chat_message_alternatives
+                   WHERE chat_message_id = ?
+                   ORDER BY id DESC
+                   LIMIT 1) AS a
+             WHERE chat_messages.chat_session_id = ?
+               AND chat_messages.id = ?`
+		args = []any{messageId, sessionId, messageId}
+		if err := ctx.Exec(query, args); err != nil {
+			return err
+		}
+
+		query = `UPDATE chat_messages SET is_generating = FALSE WHERE chat_session_id = ? AND id = ?`
+		args = []any{sessionId, messageId}
+		return ctx.UpdateRecord(query, args)
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	message, err := GetMessageById(messageId)
+	if err == nil && message != nil {
+		ChatMessageUpdatedSignal.EmitBG(message)
+	}
+
+	return message, err
+}
+
+// GetGeneratingChatMessages returns the messages that are marked as being generated, in all sessions.
+func GetGeneratingChatMessages() ([]ChatMessage, error) {
+	query := "SELECT * FROM chat_messages WHERE is_generating = TRUE ORDER BY id"
+	return database.QueryForList(query, nil, ChatMessageScanner)
+}
+
+// SetActiveChatMessageAlternative makes the given alternative the active one for its message,
+// replacing the message content and reasoning with those of the alternative.
+// The session summary is deleted when it covers the message.
+func SetActiveChatMessageAlternative(sessionId int, messageId int, alternativeId int) (*ChatMessage, error) {
+	var message *ChatMessage
+	var summaryDeleted bool
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		query := `UPDATE chat_messages
+              SET active_alternative_id = a.id,
+                  content = a.content,
+                  reasoning = a.reasoning
+              FROM (SELECT id, content, reasoning
+                    FROM chat_message_alternatives
+                    WHERE id = ? AND chat_message_id = ?) AS a
+              WHERE chat_messages.chat_session_id = ?
+                AND chat_messages.id = ?
+                AND chat_messages.is_generating = FALSE
+              RETURNING *`
+		args := []any{alternativeId, messageId, sessionId, messageId}
+
+		var err error
+		if message, err = database.QueryForRecordTx(ctx, query, args, ChatMessageScanner); err != nil || message == nil {
+			return err
+		}
+
+		summaryDeleted, err = deleteChatSessionSummaryFrom(ctx, sessionId, messageId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if message != nil {
+		if summaryDeleted {
+			ChatSessionSummaryDeletedSignal.EmitBG(sessionId)
+		}
+		ChatMessageUpdatedSignal.EmitBG(message)
+	}
+
+	return message, nil
+}
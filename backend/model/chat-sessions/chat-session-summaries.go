@@ -0,0 +1,91 @@
+package chat_sessions
+
+import (
+	"time"
+
+	"juraji.nl/chat-quest/core/database"
+)
+
+type ChatSessionSummary struct {
+	ChatSessionID int        `json:"chatSessionId"`
+	UpToMessageID int        `json:"upToMessageId"`
+	UpdatedAt     *time.Time `json:"updatedAt"`
+	Content       string     `json:"content"`
+}
+
+func chatSessionSummaryScanner(scanner database.RowScanner, dest *ChatSessionSummary) error {
+	return scanner.Scan(
+		&dest.ChatSessionID,
+		&dest.UpToMessageID,
+		&dest.UpdatedAt,
+		&dest.Content,
+	)
+}
+
+func GetChatSessionSummary(sessionId int) (*ChatSessionSummary, error) {
+	query := "SELECT * FROM chat_session_summaries WHERE chat_session_id = ?"
+	args := []any{sessionId}
+	return database.QueryForRecord(query, args, chatSessionSummaryScanner)
+}
+
+// SaveChatSessionSummary creates or replaces the summary of a session, covering all messages up to upToMessageId.
+func SaveChatSessionSummary(sessionId int, upToMessageId int, content string) (*ChatSessionSummary, error) {
+	query := `INSERT INTO chat_session_summaries (chat_session_id, up_to_message_id, content)
+            VALUES (?, ?, ?)
+            ON CONFLICT (chat_session_id) DO UPDATE
+                SET up_to_message_id = excluded.up_to_message_id,
+                    updated_at       = CURRENT_TIMESTAMP,
+                    content          = excluded.content
+            RETURNING *`
+	args := []any{sessionId, upToMessageId, content}
+
+	summary, err := database.QueryForRecord(query, args, chatSessionSummaryScanner)
+	if err == nil && summary != nil {
+		ChatSessionSummaryUpdatedSignal.EmitBG(summary)
+	}
+
+	return summary, err
+}
+
+// UpdateChatSessionSummaryContent replaces the contents of an existing summary, for manual edits.
+func UpdateChatSessionSummaryContent(sessionId int, content string) (*ChatSessionSummary, error) {
+	query := `UPDATE chat_session_summaries
+            SET content    = ?,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE chat_session_id = ?
+            RETURNING *`
+	args := []any{content, sessionId}
+
+	summary, err := database.QueryForRecord(query, args, chatSessionSummaryScanner)
+	if err == nil && summary != nil {
+		ChatSessionSummaryUpdatedSignal.EmitBG(summary)
+	}
+
+	return summary, err
+}
+
+func DeleteChatSessionSummary(sessionId int) error {
+	query := "DELETE FROM chat_session_summaries WHERE chat_session_id = ?"
+	args := []any{sessionId}
+
+	_, err := database.DeleteRecord(query, args)
+
+	if err == nil {
+		ChatSessionSummaryDeletedSignal.EmitBG(sessionId)
+	}
+
+	return err
+}
+
+// deleteChatSessionSummaryFrom deletes the summary of the session when it covers messages from fromMessageId on,
+// as deleting or changing any message it covers invalidates it. Returns whether the summary was deleted.
+func deleteChatSessionSummaryFrom(ctx *database.TxContext, sessionId int, fromMessageId int) (bool, error) {
+	query := `DELETE FROM chat_session_summaries
+            WHERE chat_session_id = ?
+              AND up_to_message_id >= ?
+            RETURNING chat_session_id`
+	args := []any{sessionId, fromMessageId}
+
+	deletedIds, err := ctx.DeleteRecord(query, args)
+	return len(deletedIds) > 0, err
+}
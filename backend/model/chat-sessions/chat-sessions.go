@@ -6,6 +6,7 @@ import (
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core/database"
 	"juraji.nl/chat-quest/core/log"
+	p "juraji.nl/chat-quest/core/providers"
 	"juraji.nl/chat-quest/core/util"
 )
 
@@ -24,6 +25,8 @@ type ChatSession struct {
 	PersonaID         *int `json:"personaId"`
 	ChatModelId       *int `json:"chatModelId"`
 	ChatInstructionId *int `json:"chatInstructionId"`
+	// Empty to use the chat fallback models from the preferences
+	ChatFallbackModelIds p.LlmModelIds `json:"chatFallbackModelIds"`
 
 	LastTotalTokens      int `json:"lastTotalTokens"`
 	LastCompletionTokens int `json:"lastCompletionTokens"`
@@ -56,6 +59,7 @@ func chatSessionScanner(scanner database.RowScanner, dest *ChatSession) error {
 		&dest.ChatInstructionId,
 		&dest.LastTotalTokens,
 		&dest.LastCompletionTokens,
+		&dest.ChatFallbackModelIds,
 	)
 }
 
@@ -87,12 +91,13 @@ func Create(worldId int, session *ChatSession, characterIds []int) error {
 	err := database.Transactional(func(ctx *database.TxContext) error {
 		query := `INSERT INTO chat_sessions (world_id, name, scenario_id, generate_memories, use_memories,
                            pause_automatic_responses, current_time_of_day, chat_notes,
-                           persona_id, chat_model_id, chat_instruction_id)
+                           persona_id, chat_model_id, chat_instruction_id, chat_fallback_model_ids)
 				  VALUES (
 					  ?, ?, ?, ?, ?, ?, ?, ?,
 					  COALESCE(?, (SELECT w.persona_id FROM worlds w WHERE w.id = ?)), -- persona_id with fallback to default
 					  COALESCE(?, (SELECT p.chat_model_id FROM preferences p WHERE p.id = 0)), -- chat_model_id with fallback to default
-					  COALESCE(?, (SELECT p.chat_instruction_id FROM preferences p WHERE p.id = 0)) -- chat_instruction_id with fallback to default
+					  COALESCE(?, (SELECT p.chat_instruction_id FROM preferences p WHERE p.id = 0)), -- chat_instruction_id with fallback to default
+					  ?
 				  )
 				  RETURNING id, created_at;`
 		args := []any{
@@ -108,6 +113,7 @@ func Create(worldId int, session *ChatSession, characterIds []int) error {
 			session.WorldID, // Matches to world sub-select
 			session.ChatModelId,
 			session.ChatInstructionId,
+			session.ChatFallbackModelIds,
 		}
 
 		err := ctx.InsertRecord(query, args, &session.ID, &session.CreatedAt)
@@ -177,7 +183,8 @@ func Update(worldId int, id int, session *ChatSession) error {
                 chat_notes = ?,
                 persona_id = ?,
                 chat_model_id = ?,
-                chat_instruction_id = ?
+                chat_instruction_id = ?,
+                chat_fallback_model_ids = ?
             WHERE world_id = ?
               AND id = ?`
 	args := []any{
@@ -191,6 +198,7 @@ func Update(worldId int, id int, session *ChatSession) error {
 		session.PersonaID,
 		session.ChatModelId,
 		session.ChatInstructionId,
+		session.ChatFallbackModelIds,
 		worldId,
 		id,
 	}
@@ -263,7 +271,7 @@ func ForkChatSession(sessionId int, messageId int) (*ChatSession, error) {
 		var err error
 		query := `INSERT INTO chat_sessions (world_id, name, scenario_id, generate_memories, use_memories,
                            pause_automatic_responses, current_time_of_day, chat_notes,
-                           persona_id, chat_model_id, chat_instruction_id)
+                           persona_id, chat_model_id, chat_instruction_id, chat_fallback_model_ids)
 				  SELECT world_id,
 				         name || ' (forked)',
 				         scenario_id,
@@ -274,12 +282,14 @@ func ForkChatSession(sessionId int, messageId int) (*ChatSession, error) {
 				         chat_notes,
 				         persona_id,
 				         chat_model_id,
-				         chat_instruction_id
+				         chat_instruction_id,
+				         chat_fallback_model_ids
 				  FROM chat_sessions
 				  WHERE id = ?
 				  RETURNING id, world_id, created_at, name, scenario_id, generate_memories, use_memories,
 				      pause_automatic_responses, current_time_of_day, chat_notes,
-				      persona_id, chat_model_id, chat_instruction_id, last_total_tokens, last_completion_tokens;`
+				      persona_id, chat_model_id, chat_instruction_id, last_total_tokens, last_completion_tokens,
+				      chat_fallback_model_ids;`
 		args := []any{sessionId}
 		if newSession, err = database.QueryForRecord(query, args, chatSessionScanner); err != nil {
 			return err
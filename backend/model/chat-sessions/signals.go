@@ -17,6 +17,10 @@ var ChatSessionDeletedSignal = signals.New[int]()
 var ChatMessageCreatedSignal = signals.New[*ChatMessage]()
 var ChatMessageUpdatedSignal = signals.New[*ChatMessage]()
 var ChatMessageDeletedSignal = signals.New[int]()
+var ChatMessagesDeletedFromSignal = signals.New[*ChatMessagesDeletedFromEvent]()
+
+var ChatSessionSummaryUpdatedSignal = signals.New[*ChatSessionSummary]()
+var ChatSessionSummaryDeletedSignal = signals.New[int]()
 
 var ChatParticipantAddedSignal = signals.New[*ChatParticipant]()
 var ChatParticipantRemovedSignal = signals.New[*ChatParticipant]()
@@ -28,6 +32,8 @@ func init() {
 	sse.RegisterOnSSE("ChatMessageCreated", ChatMessageCreatedSignal)
 	sse.RegisterOnSSE("ChatMessageUpdated", ChatMessageUpdatedSignal)
 	sse.RegisterOnSSE("ChatMessageDeleted", ChatMessageDeletedSignal)
+	sse.RegisterOnSSE("ChatSessionSummaryUpdated", ChatSessionSummaryUpdatedSignal)
+	sse.RegisterOnSSE("ChatSessionSummaryDeleted", ChatSessionSummaryDeletedSignal)
 	sse.RegisterOnSSE("ChatParticipantAdded", ChatParticipantAddedSignal)
 	sse.RegisterOnSSE("ChatParticipantRemoved", ChatParticipantRemovedSignal)
 }
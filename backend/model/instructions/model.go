@@ -18,6 +18,9 @@ const (
 	TitleGeneration     InstructionType = "TITLE_GENERATION"
 	CharacterExport     InstructionType = "CHARACTER_EXPORT"
 	CharacterBuilder    InstructionType = "CHARACTER_BUILDER"
+	SummaryInstruction  InstructionType = "SUMMARY"
+
+	MemoryConsolidationInstruction InstructionType = "MEMORY_CONSOLIDATION"
 )
 
 func (i InstructionType) IsValid() bool {
@@ -26,7 +29,9 @@ func (i InstructionType) IsValid() bool {
 		MemoriesInstruction,
 		TitleGeneration,
 		CharacterExport,
-		CharacterBuilder:
+		CharacterBuilder,
+		SummaryInstruction,
+		MemoryConsolidationInstruction:
 		return true
 	default:
 		return false
@@ -48,6 +53,14 @@ type Instruction struct {
 	StopSequences    *string `json:"stopSequences"`
 	IncludeReasoning bool    `json:"includeReasoning"`
 
+	// Extended Model Settings (Not supported by all providers)
+	TopK          *int     `json:"topK"`
+	MinP          *float32 `json:"minP"`
+	RepeatPenalty *float32 `json:"repeatPenalty"`
+	Mirostat      *int     `json:"mirostat"`
+	MirostatTau   *float32 `json:"mirostatTau"`
+	MirostatEta   *float32 `json:"mirostatEta"`
+
 	// Parsing
 	AllowMultiCharacterResponses bool   `json:"allowMultiCharacterResponses"`
 	EnableReasoningParsing       bool   `json:"enableReasoningParsing"`
@@ -73,6 +86,12 @@ func (i *Instruction) AsLlmParameters() p.LlmParameters {
 		FrequencyPenalty: i.FrequencyPenalty,
 		Stream:           i.Stream,
 		StopSequences:    i.StopSequences,
+		TopK:             i.TopK,
+		MinP:             i.MinP,
+		RepeatPenalty:    i.RepeatPenalty,
+		Mirostat:         i.Mirostat,
+		MirostatTau:      i.MirostatTau,
+		MirostatEta:      i.MirostatEta,
 	}
 }
 
@@ -147,6 +166,12 @@ func instructionPromptScanner(scanner database.RowScanner, dest *Instruction) er
 		&dest.SystemPrompt,
 		&dest.WorldSetup,
 		&dest.Instruction,
+		&dest.TopK,
+		&dest.MinP,
+		&dest.RepeatPenalty,
+		&dest.Mirostat,
+		&dest.MirostatTau,
+		&dest.MirostatEta,
 	)
 }
 
@@ -175,6 +200,12 @@ func CreateInstruction(inst *Instruction) error {
                           stream,
                           stop_sequences,
                           include_reasoning,
+                          top_k,
+                          min_p,
+                          repeat_penalty,
+                          mirostat,
+                          mirostat_tau,
+                          mirostat_eta,
                           allow_multi_character_responses,
                           enable_reasoning_parsing,
                           reasoning_prefix,
@@ -185,7 +216,7 @@ func CreateInstruction(inst *Instruction) error {
                           system_prompt,
                           world_setup,
                           instruction)
-            VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) RETURNING id`
+            VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) RETURNING id`
 	args := []any{
 		inst.Name,
 		inst.Type,
@@ -197,6 +228,12 @@ func CreateInstruction(inst *Instruction) error {
 		inst.Stream,
 		es(inst.StopSequences),
 		inst.IncludeReasoning,
+		inst.TopK,
+		inst.MinP,
+		inst.RepeatPenalty,
+		inst.Mirostat,
+		inst.MirostatTau,
+		inst.MirostatEta,
 		inst.AllowMultiCharacterResponses,
 		inst.EnableReasoningParsing,
 		inst.ReasoningPrefix,
@@ -232,6 +269,12 @@ func UpdateInstruction(id int, inst *Instruction) error {
                 stream = ?,
                 stop_sequences = ?,
                 include_reasoning = ?,
+                top_k = ?,
+                min_p = ?,
+                repeat_penalty = ?,
+                mirostat = ?,
+                mirostat_tau = ?,
+                mirostat_eta = ?,
                 allow_multi_character_responses = ?,
                 enable_reasoning_parsing = ?,
                 reasoning_prefix = ?,
@@ -254,6 +297,12 @@ func UpdateInstruction(id int, inst *Instruction) error {
 		inst.Stream,
 		es(inst.StopSequences),
 		inst.IncludeReasoning,
+		inst.TopK,
+		inst.MinP,
+		inst.RepeatPenalty,
+		inst.Mirostat,
+		inst.MirostatTau,
+		inst.MirostatEta,
 		inst.AllowMultiCharacterResponses,
 		inst.EnableReasoningParsing,
 		inst.ReasoningPrefix,
@@ -0,0 +1,203 @@
+package lorebook
+
+import (
+	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/util"
+)
+
+type SecondaryLogic string
+
+const (
+	// AndAny requires at least one of the secondary keywords to match.
+	AndAny SecondaryLogic = "AND_ANY"
+	// AndAll requires all secondary keywords to match.
+	AndAll SecondaryLogic = "AND_ALL"
+	// NotAny requires none of the secondary keywords to match.
+	NotAny SecondaryLogic = "NOT_ANY"
+	// NotAll requires at least one of the secondary keywords to not match.
+	NotAll SecondaryLogic = "NOT_ALL"
+)
+
+func (l SecondaryLogic) IsValid() bool {
+	switch l {
+	case AndAny, AndAll, NotAny, NotAll:
+		return true
+	default:
+		return false
+	}
+}
+
+type Position string
+
+const (
+	// WorldInfo inserts the entry with the world description.
+	WorldInfo Position = "WORLD_INFO"
+	// AfterCharacters inserts the entry after the characters and persona, closer to the conversation.
+	AfterCharacters Position = "AFTER_CHARACTERS"
+)
+
+func (p Position) IsValid() bool {
+	switch p {
+	case WorldInfo, AfterCharacters:
+		return true
+	default:
+		return false
+	}
+}
+
+type LorebookEntry struct {
+	ID                int            `json:"id"`
+	WorldId           int            `json:"worldId"`
+	CharacterId       *int           `json:"characterId"`
+	Name              string         `json:"name"`
+	Content           string         `json:"content"`
+	Keywords          string         `json:"keywords"`
+	SecondaryKeywords *string        `json:"secondaryKeywords"`
+	SecondaryLogic    SecondaryLogic `json:"secondaryLogic"`
+	CaseSensitive     bool           `json:"caseSensitive"`
+	AlwaysInclude     bool           `json:"alwaysInclude"`
+	Enabled           bool           `json:"enabled"`
+	Priority          int            `json:"priority"`
+	Position          Position       `json:"position"`
+	TokenBudget       *int           `json:"tokenBudget"`
+}
+
+func lorebookEntryScanner(scanner database.RowScanner, dest *LorebookEntry) error {
+	return scanner.Scan(
+		&dest.ID,
+		&dest.WorldId,
+		&dest.CharacterId,
+		&dest.Name,
+		&dest.Content,
+		&dest.Keywords,
+		&dest.SecondaryKeywords,
+		&dest.SecondaryLogic,
+		&dest.CaseSensitive,
+		&dest.AlwaysInclude,
+		&dest.Enabled,
+		&dest.Priority,
+		&dest.Position,
+		&dest.TokenBudget,
+	)
+}
+
+func GetLorebookEntriesByWorldId(worldId int) ([]LorebookEntry, error) {
+	query := `SELECT * FROM lorebook_entries WHERE world_id = ? ORDER BY priority DESC, id`
+	args := []any{worldId}
+	return database.QueryForList(query, args, lorebookEntryScanner)
+}
+
+// GetLorebookEntriesByCharacterId returns the entries bound to the character, in all worlds.
+func GetLorebookEntriesByCharacterId(characterId int) ([]LorebookEntry, error) {
+	query := `SELECT * FROM lorebook_entries WHERE character_id = ? ORDER BY priority DESC, id`
+	args := []any{characterId}
+	return database.QueryForList(query, args, lorebookEntryScanner)
+}
+
+// GetEnabledLorebookEntriesForCharacter returns the enabled entries in the world, that are either not bound to a
+// character or bound to the given character. Entries are ordered by priority (highest first).
+func GetEnabledLorebookEntriesForCharacter(worldId int, characterId int) ([]LorebookEntry, error) {
+	query := `SELECT *
+              FROM lorebook_entries
+              WHERE world_id = ?
+                AND enabled = 1
+                AND (character_id IS NULL OR character_id = ?)
+              ORDER BY priority DESC, id`
+	args := []any{worldId, characterId}
+	return database.QueryForList(query, args, lorebookEntryScanner)
+}
+
+func LorebookEntryById(id int) (*LorebookEntry, error) {
+	query := `SELECT * FROM lorebook_entries WHERE id = ?`
+	args := []any{id}
+	return database.QueryForRecord(query, args, lorebookEntryScanner)
+}
+
+func CreateLorebookEntry(worldId int, entry *LorebookEntry) error {
+	entry.WorldId = worldId
+	entry.SecondaryKeywords = util.EmptyStrToNil(entry.SecondaryKeywords)
+
+	query := `INSERT INTO lorebook_entries (world_id, character_id, name, content, keywords, secondary_keywords,
+                              secondary_logic, case_sensitive, always_include, enabled, priority, position,
+                              token_budget)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	args := []any{
+		entry.WorldId,
+		entry.CharacterId,
+		entry.Name,
+		entry.Content,
+		entry.Keywords,
+		entry.SecondaryKeywords,
+		entry.SecondaryLogic,
+		entry.CaseSensitive,
+		entry.AlwaysInclude,
+		entry.Enabled,
+		entry.Priority,
+		entry.Position,
+		entry.TokenBudget,
+	}
+
+	err := database.InsertRecord(query, args, &entry.ID)
+
+	if err == nil {
+		LorebookEntryCreatedSignal.EmitBG(entry)
+	}
+
+	return err
+}
+
+func UpdateLorebookEntry(id int, entry *LorebookEntry) error {
+	entry.SecondaryKeywords = util.EmptyStrToNil(entry.SecondaryKeywords)
+
+	query := `UPDATE lorebook_entries
+			  SET character_id = ?,
+			      name = ?,
+			      content = ?,
+			      keywords = ?,
+			      secondary_keywords = ?,
+			      secondary_logic = ?,
+			      case_sensitive = ?,
+			      always_include = ?,
+			      enabled = ?,
+			      priority = ?,
+			      position = ?,
+			      token_budget = ?
+			  WHERE id = ?`
+	args := []any{
+		entry.CharacterId,
+		entry.Name,
+		entry.Content,
+		entry.Keywords,
+		entry.SecondaryKeywords,
+		entry.SecondaryLogic,
+		entry.CaseSensitive,
+		entry.AlwaysInclude,
+		entry.Enabled,
+		entry.Priority,
+		entry.Position,
+		entry.TokenBudget,
+		id,
+	}
+
+	err := database.UpdateRecord(query, args)
+
+	if err == nil {
+		entry.ID = id
+		LorebookEntryUpdatedSignal.EmitBG(entry)
+	}
+
+	return err
+}
+
+func DeleteLorebookEntry(id int) error {
+	query := `DELETE FROM lorebook_entries WHERE id = ?`
+	args := []any{id}
+
+	_, err := database.DeleteRecord(query, args)
+
+	if err == nil {
+		LorebookEntryDeletedSignal.EmitBG(id)
+	}
+
+	return err
+}
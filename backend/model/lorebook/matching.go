@@ -0,0 +1,196 @@
+package lorebook
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// keywordMatcher matches a single keyword against scanned text.
+type keywordMatcher func(text string) bool
+
+// Validate checks whether the keywords are set and all regex keywords compile.
+func (e *LorebookEntry) Validate() error {
+	if !e.SecondaryLogic.IsValid() {
+		return errors.Errorf("invalid secondary logic '%s'", e.SecondaryLogic)
+	}
+	if !e.Position.IsValid() {
+		return errors.Errorf("invalid position '%s'", e.Position)
+	}
+
+	primary, err := compileKeywords(e.Keywords, e.CaseSensitive)
+	if err != nil {
+		return err
+	}
+	if len(primary) == 0 && !e.AlwaysInclude {
+		return errors.New("at least one keyword is required, unless the entry is always included")
+	}
+
+	if e.SecondaryKeywords != nil {
+		if _, err = compileKeywords(*e.SecondaryKeywords, e.CaseSensitive); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// KeywordMatcher matches text against the keywords of an entry, which are compiled once on creation.
+type KeywordMatcher struct {
+	primary   []keywordMatcher
+	secondary []keywordMatcher
+	logic     SecondaryLogic
+	invalid   bool
+}
+
+// Matcher compiles the keywords of the entry into a KeywordMatcher, which can be reused for multiple texts.
+func (e *LorebookEntry) Matcher() *KeywordMatcher {
+	matcher := &KeywordMatcher{logic: e.SecondaryLogic}
+
+	var err error
+	if matcher.primary, err = compileKeywords(e.Keywords, e.CaseSensitive); err != nil {
+		matcher.invalid = true
+		return matcher
+	}
+	if e.SecondaryKeywords != nil {
+		if matcher.secondary, err = compileKeywords(*e.SecondaryKeywords, e.CaseSensitive); err != nil {
+			matcher.invalid = true
+		}
+	}
+
+	return matcher
+}
+
+// Matches reports whether the entry is activated by the given text.
+// At least one primary keyword must match, after which the secondary keywords (if any) are
+// evaluated using the entry's SecondaryLogic. Entries with invalid keywords never match.
+func (m *KeywordMatcher) Matches(text string) bool {
+	if m.invalid || !anyMatch(m.primary, text) {
+		return false
+	}
+	if len(m.secondary) == 0 {
+		return true
+	}
+
+	switch m.logic {
+	case AndAll:
+		return allMatch(m.secondary, text)
+	case NotAny:
+		return !anyMatch(m.secondary, text)
+	case NotAll:
+		return !allMatch(m.secondary, text)
+	default:
+		return anyMatch(m.secondary, text)
+	}
+}
+
+// compileKeywords parses a comma separated list of keywords.
+// Keywords formatted as /pattern/ or /pattern/i are compiled as regular expressions,
+// other keywords are matched as plain text.
+func compileKeywords(keywords string, caseSensitive bool) ([]keywordMatcher, error) {
+	var matchers []keywordMatcher
+
+	for _, keyword := range SplitKeywords(keywords) {
+
+		if pattern, flags, ok := parseRegexKeyword(keyword); ok {
+			if !caseSensitive || strings.Contains(flags, "i") {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid regex keyword '%s'", keyword)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+
+		if caseSensitive {
+			matchers = append(matchers, func(text string) bool {
+				return strings.Contains(text, keyword)
+			})
+		} else {
+			lowerKeyword := strings.ToLower(keyword)
+			matchers = append(matchers, func(text string) bool {
+				return strings.Contains(strings.ToLower(text), lowerKeyword)
+			})
+		}
+	}
+
+	return matchers, nil
+}
+
+// SplitKeywords splits a comma separated list of keywords, without splitting on commas within regex keywords.
+func SplitKeywords(keywords string) []string {
+	var result []string
+
+	for rest := strings.TrimSpace(keywords); rest != ""; rest = strings.TrimSpace(rest) {
+		end := -1
+		if rest[0] == '/' {
+			// Find the closing slash, followed by optional flags and a separator
+			for i := 1; i < len(rest) && end == -1; i++ {
+				if rest[i] != '/' {
+					continue
+				}
+				tail := strings.TrimLeft(rest[i+1:], "i")
+				tail = strings.TrimSpace(tail)
+				if tail == "" {
+					end = len(rest)
+				} else if tail[0] == ',' {
+					end = len(rest) - len(tail)
+				}
+			}
+		}
+		if end == -1 {
+			end = strings.Index(rest, ",")
+			if end == -1 {
+				end = len(rest)
+			}
+		}
+
+		if keyword := strings.TrimSpace(rest[:end]); keyword != "" {
+			result = append(result, keyword)
+		}
+		rest = strings.TrimPrefix(rest[end:], ",")
+	}
+
+	return result
+}
+
+// parseRegexKeyword splits a keyword formatted as /pattern/flags in its pattern and flags.
+func parseRegexKeyword(keyword string) (string, string, bool) {
+	if len(keyword) < 3 || keyword[0] != '/' {
+		return "", "", false
+	}
+
+	end := strings.LastIndex(keyword, "/")
+	if end <= 0 {
+		return "", "", false
+	}
+
+	flags := keyword[end+1:]
+	if strings.Trim(flags, "i") != "" {
+		// Not a regex, but a keyword starting with a slash.
+		return "", "", false
+	}
+
+	return keyword[1:end], flags, true
+}
+
+func anyMatch(matchers []keywordMatcher, text string) bool {
+	for _, match := range matchers {
+		if match(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func allMatch(matchers []keywordMatcher, text string) bool {
+	for _, match := range matchers {
+		if !match(text) {
+			return false
+		}
+	}
+	return true
+}
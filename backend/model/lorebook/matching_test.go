@@ -0,0 +1,109 @@
+package lorebook
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		keywords string
+		expected []string
+	}{
+		{name: "empty", keywords: "  ", expected: nil},
+		{name: "plain keywords are trimmed", keywords: " dragon, castle ,,king ", expected: []string{"dragon", "castle", "king"}},
+		{name: "commas within regex keywords", keywords: "/a,b/, c", expected: []string{"/a,b/", "c"}},
+		{name: "regex keywords with flags", keywords: "/dragons?/i , /x{1,2}/", expected: []string{"/dragons?/i", "/x{1,2}/"}},
+		{name: "slashes within regex keywords", keywords: "/a/b/i,c", expected: []string{"/a/b/i", "c"}},
+		{name: "keyword starting with a slash", keywords: "/usr, bin", expected: []string{"/usr", "bin"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := SplitKeywords(test.keywords); !slices.Equal(result, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestKeywordMatcherMatches(t *testing.T) {
+	secondary := func(keywords string) *string { return &keywords }
+
+	tests := []struct {
+		name     string
+		entry    LorebookEntry
+		text     string
+		expected bool
+	}{
+		{
+			name:     "plain keyword ignores case",
+			entry:    LorebookEntry{Keywords: "Dragon"},
+			text:     "A DRAGON appears",
+			expected: true,
+		},
+		{
+			name:     "case sensitive plain keyword",
+			entry:    LorebookEntry{Keywords: "Dragon", CaseSensitive: true},
+			text:     "A dragon appears",
+			expected: false,
+		},
+		{
+			name:     "case sensitive regex keyword with i flag",
+			entry:    LorebookEntry{Keywords: "/drag(on|ons)/i", CaseSensitive: true},
+			text:     "Two DRAGONS appear",
+			expected: true,
+		},
+		{
+			name:     "no primary keyword matches",
+			entry:    LorebookEntry{Keywords: "castle, king"},
+			text:     "A dragon appears",
+			expected: false,
+		},
+		{
+			name:     "invalid regex never matches",
+			entry:    LorebookEntry{Keywords: "/drag(on/, dragon"},
+			text:     "A dragon appears",
+			expected: false,
+		},
+		{
+			name:     "and any",
+			entry:    LorebookEntry{Keywords: "dragon", SecondaryKeywords: secondary("fire, ice"), SecondaryLogic: AndAny},
+			text:     "A dragon breathes ice",
+			expected: true,
+		},
+		{
+			name:     "and all",
+			entry:    LorebookEntry{Keywords: "dragon", SecondaryKeywords: secondary("fire, ice"), SecondaryLogic: AndAll},
+			text:     "A dragon breathes ice",
+			expected: false,
+		},
+		{
+			name:     "not any",
+			entry:    LorebookEntry{Keywords: "dragon", SecondaryKeywords: secondary("fire, ice"), SecondaryLogic: NotAny},
+			text:     "A dragon breathes ice",
+			expected: false,
+		},
+		{
+			name:     "not all",
+			entry:    LorebookEntry{Keywords: "dragon", SecondaryKeywords: secondary("fire, ice"), SecondaryLogic: NotAll},
+			text:     "A dragon breathes ice",
+			expected: true,
+		},
+		{
+			name:     "empty secondary keywords are ignored",
+			entry:    LorebookEntry{Keywords: "dragon", SecondaryKeywords: secondary(" "), SecondaryLogic: AndAll},
+			text:     "A dragon appears",
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.entry.Matcher().Matches(test.text); result != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
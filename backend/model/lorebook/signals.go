@@ -0,0 +1,16 @@
+package lorebook
+
+import (
+	"juraji.nl/chat-quest/core/sse"
+	"juraji.nl/chat-quest/core/util/signals"
+)
+
+var LorebookEntryCreatedSignal = signals.New[*LorebookEntry]()
+var LorebookEntryUpdatedSignal = signals.New[*LorebookEntry]()
+var LorebookEntryDeletedSignal = signals.New[int]()
+
+func init() {
+	sse.RegisterOnSSE("LorebookEntryCreated", LorebookEntryCreatedSignal)
+	sse.RegisterOnSSE("LorebookEntryUpdated", LorebookEntryUpdatedSignal)
+	sse.RegisterOnSSE("LorebookEntryDeleted", LorebookEntryDeletedSignal)
+}
@@ -0,0 +1,265 @@
+package memories
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"juraji.nl/chat-quest/core/database"
+)
+
+type ProposedMemory struct {
+	Content    string  `json:"content"`
+	Importance float64 `json:"importance"`
+}
+
+// ConsolidationProposal proposes to replace similar memories of a character (or world memories when CharacterId is
+// nil) by one or more canonical memories.
+type ConsolidationProposal struct {
+	ID              int              `json:"id"`
+	WorldId         int              `json:"worldId"`
+	CharacterId     *int             `json:"characterId"`
+	CreatedAt       *time.Time       `json:"createdAt"`
+	SourceMemoryIds []int            `json:"sourceMemoryIds"`
+	Memories        []ProposedMemory `json:"memories"`
+}
+
+// MergeSource is a memory that was merged into a consolidated memory.
+type MergeSource struct {
+	ID             int        `json:"id"`
+	MemoryId       int        `json:"memoryId"`
+	SourceMemoryId int        `json:"sourceMemoryId"`
+	Content        string     `json:"content"`
+	CreatedAt      *time.Time `json:"createdAt"`
+	MergedAt       *time.Time `json:"mergedAt"`
+}
+
+func consolidationProposalScanner(scanner database.RowScanner, dest *ConsolidationProposal) error {
+	var sourceMemoryIds, memories string
+	err := scanner.Scan(
+		&dest.ID,
+		&dest.WorldId,
+		&dest.CharacterId,
+		&dest.CreatedAt,
+		&sourceMemoryIds,
+		&memories,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal([]byte(sourceMemoryIds), &dest.SourceMemoryIds); err != nil {
+		return errors.Wrap(err, "failed to unmarshal proposal source memory IDs")
+	}
+	if err = json.Unmarshal([]byte(memories), &dest.Memories); err != nil {
+		return errors.Wrap(err, "failed to unmarshal proposed memories")
+	}
+	return nil
+}
+
+func mergeSourceScanner(scanner database.RowScanner, dest *MergeSource) error {
+	return scanner.Scan(
+		&dest.ID,
+		&dest.MemoryId,
+		&dest.SourceMemoryId,
+		&dest.Content,
+		&dest.CreatedAt,
+		&dest.MergedAt,
+	)
+}
+
+func GetConsolidationProposals(worldId int) ([]ConsolidationProposal, error) {
+	query := `SELECT * FROM memory_consolidation_proposals WHERE world_id = ? ORDER BY id`
+	args := []any{worldId}
+	return database.QueryForList(query, args, consolidationProposalScanner)
+}
+
+func ConsolidationProposalById(id int) (*ConsolidationProposal, error) {
+	query := `SELECT * FROM memory_consolidation_proposals WHERE id = ?`
+	args := []any{id}
+	return database.QueryForRecord(query, args, consolidationProposalScanner)
+}
+
+// ReplaceConsolidationProposals replaces all proposals for the world by the given proposals.
+func ReplaceConsolidationProposals(worldId int, proposals []ConsolidationProposal) error {
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		query := `DELETE FROM memory_consolidation_proposals WHERE world_id = ?`
+		if _, err := ctx.DeleteRecord(query, []any{worldId}); err != nil {
+			return err
+		}
+
+		for idx := range proposals {
+			proposal := &proposals[idx]
+			proposal.WorldId = worldId
+
+			sourceMemoryIds, err := json.Marshal(proposal.SourceMemoryIds)
+			if err != nil {
+				return err
+			}
+			memories, err := json.Marshal(proposal.Memories)
+			if err != nil {
+				return err
+			}
+
+			query = `INSERT INTO memory_consolidation_proposals (world_id, character_id, source_memory_ids, memories)
+                     VALUES (?, ?, ?, ?) RETURNING id, created_at`
+			args := []any{worldId, proposal.CharacterId, string(sourceMemoryIds), string(memories)}
+			if err = ctx.InsertRecord(query, args, &proposal.ID, &proposal.CreatedAt); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		ConsolidationProposalsUpdatedSignal.EmitBG(worldId)
+	}
+
+	return err
+}
+
+func DeleteConsolidationProposal(id int) error {
+	query := `DELETE FROM memory_consolidation_proposals WHERE id = ? RETURNING world_id`
+	args := []any{id}
+
+	worldIds, err := database.DeleteRecord(query, args)
+
+	if err == nil && len(worldIds) > 0 {
+		ConsolidationProposalsUpdatedSignal.EmitBG(worldIds[0])
+	}
+
+	return err
+}
+
+// ApplyConsolidationProposal replaces the source memories of the proposal by the proposed memories and removes the
+// proposal. The source memories, including the memories they were merged from, are kept as merge sources of each
+// new memory. Returns the created memories.
+func ApplyConsolidationProposal(proposal *ConsolidationProposal, sources []Memory) ([]*Memory, error) {
+	if len(sources) != len(proposal.SourceMemoryIds) {
+		return nil, errors.New("not all memories to consolidate exist anymore")
+	}
+
+	alwaysInclude := false
+	for _, source := range sources {
+		alwaysInclude = alwaysInclude || source.AlwaysInclude
+	}
+	sourceSessionId, sourceFromId, sourceToId := mergedMessageSource(sources)
+
+	var created []*Memory
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		for _, proposed := range proposal.Memories {
+			memory := &Memory{
+				WorldId:       proposal.WorldId,
+				CharacterId:   proposal.CharacterId,
+				Content:       proposed.Content,
+				AlwaysInclude: alwaysInclude,
+				Importance:    proposed.Importance,
+
+				SourceChatSessionId: sourceSessionId,
+				SourceFromMessageId: sourceFromId,
+				SourceToMessageId:   sourceToId,
+			}
+
+			query := `INSERT INTO memories (world_id, character_id, content, always_include, importance,
+                                            source_chat_session_id, source_from_message_id, source_to_message_id)
+                      VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at`
+			args := []any{memory.WorldId, memory.CharacterId, memory.Content, memory.AlwaysInclude, memory.Importance,
+				memory.SourceChatSessionId, memory.SourceFromMessageId, memory.SourceToMessageId}
+			if err := ctx.InsertRecord(query, args, &memory.ID, &memory.CreatedAt); err != nil {
+				return err
+			}
+
+			for _, source := range sources {
+				// Carry over the sources of memories that were consolidated before
+				query = `INSERT INTO memory_merge_sources (memory_id, source_memory_id, content, created_at, merged_at)
+                         SELECT ?, source_memory_id, content, created_at, merged_at
+                         FROM memory_merge_sources
+                         WHERE memory_id = ?`
+				if err := ctx.Exec(query, []any{memory.ID, source.ID}); err != nil {
+					return err
+				}
+
+				query = `INSERT INTO memory_merge_sources (memory_id, source_memory_id, content, created_at)
+                         VALUES (?, ?, ?, ?)`
+				args = []any{memory.ID, source.ID, source.Content, source.CreatedAt}
+				if err := ctx.UpdateRecord(query, args); err != nil {
+					return err
+				}
+			}
+
+			created = append(created, memory)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(sources)), ",")
+		args := make([]any, len(sources))
+		for idx, source := range sources {
+			args[idx] = source.ID
+		}
+		query := `DELETE FROM memories WHERE id IN (` + placeholders + `)`
+		if _, err := ctx.DeleteRecord(query, args); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM memory_consolidation_proposals WHERE id = ?`
+		_, err := ctx.DeleteRecord(query, []any{proposal.ID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, memory := range created {
+		MemoryCreatedSignal.EmitBG(memory)
+	}
+	for _, source := range sources {
+		MemoryDeletedSignal.EmitBG(source.ID)
+	}
+	ConsolidationProposalsUpdatedSignal.EmitBG(proposal.WorldId)
+
+	return created, nil
+}
+
+// mergedMessageSource returns the message range spanning the sources of all memories, when they were all generated
+// from the same chat session.
+func mergedMessageSource(memories []Memory) (sessionId *int, fromId *int, toId *int) {
+	for _, memory := range memories {
+		if memory.SourceChatSessionId == nil || memory.SourceFromMessageId == nil || memory.SourceToMessageId == nil {
+			return nil, nil, nil
+		}
+		if sessionId == nil {
+			sessionId, fromId, toId = memory.SourceChatSessionId, memory.SourceFromMessageId, memory.SourceToMessageId
+			continue
+		}
+		if *sessionId != *memory.SourceChatSessionId {
+			return nil, nil, nil
+		}
+		fromId = new(min(*fromId, *memory.SourceFromMessageId))
+		toId = new(max(*toId, *memory.SourceToMessageId))
+	}
+	return sessionId, fromId, toId
+}
+
+func GetMemoryMergeSources(memoryId int) ([]MergeSource, error) {
+	query := `SELECT * FROM memory_merge_sources WHERE memory_id = ? ORDER BY created_at, source_memory_id`
+	args := []any{memoryId}
+	return database.QueryForList(query, args, mergeSourceScanner)
+}
+
+// GetWorldIdsDueForConsolidation returns the IDs of worlds that were not consolidated in the last interval.
+func GetWorldIdsDueForConsolidation(interval time.Duration) ([]int, error) {
+	query := `SELECT w.id
+              FROM worlds w
+                LEFT JOIN memory_consolidation_runs r ON r.world_id = w.id
+              WHERE r.last_run_at IS NULL
+                 OR r.last_run_at < DATETIME('now', '-' || ? || ' seconds')`
+	args := []any{int(interval.Seconds())}
+	return database.QueryForList(query, args, database.IntScanner)
+}
+
+func SetConsolidationRun(worldId int) error {
+	query := `INSERT OR REPLACE INTO memory_consolidation_runs (world_id, last_run_at) VALUES (?, CURRENT_TIMESTAMP)`
+	args := []any{worldId}
+	return database.UpdateRecord(query, args)
+}
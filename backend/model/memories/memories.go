@@ -1,6 +1,7 @@
 package memories
 
 import (
+	"strings"
 	"time"
 
 	"juraji.nl/chat-quest/core/database"
@@ -14,10 +15,19 @@ type Memory struct {
 	CreatedAt        *time.Time          `json:"createdAt"`
 	Content          string              `json:"content"`
 	AlwaysInclude    bool                `json:"alwaysInclude"`
+	Importance       float64             `json:"importance"`
 	Embedding        providers.Embedding `json:"-"`
 	EmbeddingModelId *int                `json:"-"`
+
+	// The chat session and range of messages the memory was generated from, nil for memories added manually.
+	SourceChatSessionId *int `json:"sourceChatSessionId"`
+	SourceFromMessageId *int `json:"sourceFromMessageId"`
+	SourceToMessageId   *int `json:"sourceToMessageId"`
 }
 
+// DefaultImportance is the importance of memories for which no importance was given.
+const DefaultImportance = 0.5
+
 type MemoryBookmark struct {
 	ChatSessionID int `json:"chatSessionId"`
 	MessageID     int `json:"messageId"`
@@ -31,6 +41,10 @@ func memoryScanner(scanner database.RowScanner, dest *Memory) error {
 		&dest.CreatedAt,
 		&dest.Content,
 		&dest.AlwaysInclude,
+		&dest.Importance,
+		&dest.SourceChatSessionId,
+		&dest.SourceFromMessageId,
+		&dest.SourceToMessageId,
 	)
 }
 
@@ -42,24 +56,49 @@ func memoryWithEmbeddingsScanner(scanner database.RowScanner, dest *Memory) erro
 		&dest.CreatedAt,
 		&dest.Content,
 		&dest.AlwaysInclude,
+		&dest.Importance,
+		&dest.SourceChatSessionId,
+		&dest.SourceFromMessageId,
+		&dest.SourceToMessageId,
 		&dest.Embedding,
 		&dest.EmbeddingModelId,
 	)
 }
 
 func GetMemoriesByWorldId(worldId int) ([]Memory, error) {
-	query := `SELECT id, world_id, character_id, created_at, content, always_include
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
             FROM memories
             WHERE world_id = ?`
 	args := []any{worldId}
 	return database.QueryForList(query, args, memoryScanner)
 }
 
+func MemoryById(id int) (*Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
+              FROM memories
+              WHERE id = ?`
+	args := []any{id}
+	return database.QueryForRecord(query, args, memoryScanner)
+}
+
+func MemoryByIdWithEmbedding(id int) (*Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id,
+                     embedding, embedding_model_id
+              FROM memories
+              WHERE id = ?`
+	args := []any{id}
+	return database.QueryForRecord(query, args, memoryWithEmbeddingsScanner)
+}
+
 func GetMemoriesByWorldAndCharacterId(
 	worldId int,
 	characterId int,
 ) ([]Memory, error) {
-	query := `SELECT id, world_id, character_id, created_at, content, always_include
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
 				FROM memories
             	WHERE world_id = ? AND character_id = ?`
 	args := []any{worldId, characterId}
@@ -67,13 +106,25 @@ func GetMemoriesByWorldAndCharacterId(
 	return database.QueryForList(query, args, memoryScanner)
 }
 
+func GetMemoriesByCharacterId(characterId int) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
+				FROM memories
+            	WHERE character_id = ?`
+	args := []any{characterId}
+
+	return database.QueryForList(query, args, memoryScanner)
+}
+
 func GetMemoriesByWorldAndCharacterIdWithEmbeddings(
 	worldId int,
 	characterId int,
 	modelId int,
 ) ([]Memory, error) {
-	query := `SELECT *
-              FROM memories m
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id,
+                     embedding, embedding_model_id
+              FROM memories
               WHERE world_id = ?
                 AND embedding IS NOT NULL
                 AND embedding_model_id = ?
@@ -83,25 +134,217 @@ func GetMemoriesByWorldAndCharacterIdWithEmbeddings(
 	return database.QueryForList(query, args, memoryWithEmbeddingsScanner)
 }
 
-func GetMemoriesNotMatchingEmbeddingModelId(modelId int) ([]Memory, error) {
-	query := `SELECT id, world_id, character_id, created_at, content, always_include
+func GetMemoriesByWorldIdWithEmbeddings(worldId int, modelId int) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id,
+                     embedding, embedding_model_id
+              FROM memories
+              WHERE world_id = ?
+                AND embedding IS NOT NULL
+                AND embedding_model_id = ?
+              ORDER BY id`
+	args := []any{worldId, modelId}
+
+	return database.QueryForList(query, args, memoryWithEmbeddingsScanner)
+}
+
+func GetMemoriesByIds(ids []int) ([]Memory, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
+              FROM memories
+              WHERE id IN (` + placeholders + `)
+              ORDER BY id`
+	args := make([]any, len(ids))
+	for idx, id := range ids {
+		args[idx] = id
+	}
+
+	return database.QueryForList(query, args, memoryScanner)
+}
+
+// GetMemoriesByIdsWithEmbeddings returns the memories with the given IDs that have an embedding generated by the model.
+func GetMemoriesByIdsWithEmbeddings(ids []int, modelId int) ([]Memory, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id,
+                     embedding, embedding_model_id
+              FROM memories
+              WHERE id IN (` + placeholders + `)
+                AND embedding IS NOT NULL
+                AND embedding_model_id = ?
+              ORDER BY id`
+	args := make([]any, 0, len(ids)+1)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, modelId)
+
+	return database.QueryForList(query, args, memoryWithEmbeddingsScanner)
+}
+
+// GetMemoriesWithEmbeddingsAfterId returns a page of memories with an embedding generated by the model, ordered by ID,
+// starting after afterId.
+func GetMemoriesWithEmbeddingsAfterId(modelId int, afterId int, limit int) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id,
+                     embedding, embedding_model_id
+              FROM memories
+              WHERE embedding IS NOT NULL
+                AND embedding_model_id = ?
+                AND id > ?
+              ORDER BY id
+              LIMIT ?`
+	args := []any{modelId, afterId, limit}
+	return database.QueryForList(query, args, memoryWithEmbeddingsScanner)
+}
+
+func CountMemoriesWithEmbeddings(modelId int) (int, error) {
+	query := `SELECT COUNT(*) FROM memories WHERE embedding IS NOT NULL AND embedding_model_id = ?`
+	args := []any{modelId}
+	count, err := database.QueryForRecord(query, args, database.IntScanner)
+	if err != nil {
+		return 0, err
+	}
+	return *count, nil
+}
+
+// GetAlwaysIncludedMemoryIds returns the IDs of the memories of the world and character (including world memories)
+// that are always included.
+func GetAlwaysIncludedMemoryIds(worldId int, characterId int) ([]int, error) {
+	query := `SELECT id
+              FROM memories
+              WHERE world_id = ?
+                AND always_include = TRUE
+                AND (character_id IS NULL OR character_id = ?)`
+	args := []any{worldId, characterId}
+	return database.QueryForList(query, args, database.IntScanner)
+}
+
+// GetMemoriesByWorldAndCharacterIdWithoutEmbeddings returns the memories of the world and character (including
+// world memories) that have no embedding generated by the model (yet).
+func GetMemoriesByWorldAndCharacterIdWithoutEmbeddings(
+	worldId int,
+	characterId int,
+	modelId int,
+) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
+              FROM memories
+              WHERE world_id = ?
+                AND (embedding IS NULL OR embedding_model_id IS NULL OR embedding_model_id != ?)
+                AND (character_id IS NULL OR character_id = ?)`
+	args := []any{worldId, modelId, characterId}
+
+	return database.QueryForList(query, args, memoryScanner)
+}
+
+// GetMemoryKeywordScores returns the BM25 scores of the memories of the world and character (including world
+// memories) matching the FTS5 match expression, by memory ID. Lower scores are better matches, as in SQLite.
+func GetMemoryKeywordScores(worldId int, characterId int, matchExpr string) (map[int]float64, error) {
+	type keywordScore struct {
+		id    int
+		score float64
+	}
+
+	query := `SELECT m.id, bm25(memories_fts)
+              FROM memories_fts
+                JOIN memories m ON m.id = memories_fts.rowid
+              WHERE memories_fts MATCH ?
+                AND m.world_id = ?
+                AND (m.character_id IS NULL OR m.character_id = ?)`
+	args := []any{matchExpr, worldId, characterId}
+
+	scores, err := database.QueryForList(query, args, func(scanner database.RowScanner, dest *keywordScore) error {
+		return scanner.Scan(&dest.id, &dest.score)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]float64, len(scores))
+	for _, s := range scores {
+		result[s.id] = s.score
+	}
+	return result, nil
+}
+
+// GetMemoriesNotMatchingEmbeddingModelIdAfterId returns up to limit memories with an ID above afterId, that have
+// no embedding generated by the given model, ordered by ID.
+func GetMemoriesNotMatchingEmbeddingModelIdAfterId(modelId int, afterId int, limit int) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
 			  FROM memories
+			  WHERE (embedding_model_id IS NULL OR embedding_model_id != ?)
+			    AND id > ?
+			  ORDER BY id
+			  LIMIT ?`
+	args := []any{modelId, afterId, limit}
+	return database.QueryForList(query, args, memoryScanner)
+}
+
+// CountMemoriesNotMatchingEmbeddingModelId returns the number of memories that have no embedding generated by the
+// given model.
+func CountMemoriesNotMatchingEmbeddingModelId(modelId int) (int, error) {
+	query := `SELECT COUNT(*) FROM memories
 			  WHERE embedding_model_id IS NULL
 			     OR embedding_model_id != ?`
 	args := []any{modelId}
+	count, err := database.QueryForRecord(query, args, database.IntScanner)
+	if err != nil {
+		return 0, err
+	}
+	return *count, nil
+}
+
+// GetMemoriesForExport returns the memories of the world, including their embeddings (if any), ordered by creation.
+// When characterId is given, only the memories of that character are returned.
+func GetMemoriesForExport(worldId int, characterId *int) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id,
+                     embedding, embedding_model_id
+              FROM memories
+              WHERE world_id = ?
+                AND (? IS NULL OR character_id = ?)
+              ORDER BY created_at, id`
+	args := []any{worldId, characterId, characterId}
+	return database.QueryForList(query, args, memoryWithEmbeddingsScanner)
+}
+
+// GetMemoriesDerivedFromMessages returns the memories generated from messages in the session, starting at fromMessageId.
+func GetMemoriesDerivedFromMessages(chatSessionId int, fromMessageId int) ([]Memory, error) {
+	query := `SELECT id, world_id, character_id, created_at, content, always_include, importance,
+                     source_chat_session_id, source_from_message_id, source_to_message_id
+              FROM memories
+              WHERE source_chat_session_id = ?
+                AND source_to_message_id >= ?`
+	args := []any{chatSessionId, fromMessageId}
 	return database.QueryForList(query, args, memoryScanner)
 }
 
 func CreateMemory(worldId int, memory *Memory) error {
 	memory.WorldId = worldId
 
-	query := `INSERT INTO memories (world_id, character_id, content, always_include)
-            VALUES (?, ?, ?, ?) RETURNING id, created_at`
+	query := `INSERT INTO memories (world_id, character_id, content, always_include, importance,
+                                  source_chat_session_id, source_from_message_id, source_to_message_id)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at`
 	args := []any{
 		memory.WorldId,
 		memory.CharacterId,
 		memory.Content,
 		memory.AlwaysInclude,
+		memory.Importance,
+		memory.SourceChatSessionId,
+		memory.SourceFromMessageId,
+		memory.SourceToMessageId,
 	}
 
 	err := database.InsertRecord(query, args, &memory.ID, &memory.CreatedAt)
@@ -113,13 +356,76 @@ func CreateMemory(worldId int, memory *Memory) error {
 	return err
 }
 
+// ImportMemories deletes the memories by replacedIds and creates the given memories as is, keeping their creation
+// time and embedding (if any). Everything is done in a single transaction, so a failed import changes nothing.
+func ImportMemories(worldId int, replacedIds []int, memories []*Memory) error {
+	var deletedIds []int
+	err := database.Transactional(func(ctx *database.TxContext) error {
+		for _, id := range replacedIds {
+			query := `DELETE FROM memories WHERE id = ? RETURNING id`
+			ids, err := ctx.DeleteRecord(query, []any{id})
+			if err != nil {
+				return err
+			}
+			deletedIds = append(deletedIds, ids...)
+		}
+
+		for _, memory := range memories {
+			memory.WorldId = worldId
+
+			query := `INSERT INTO memories (world_id, character_id, created_at, content, always_include, importance,
+                                      embedding, embedding_model_id)
+                VALUES (?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?, ?, ?, ?, ?) RETURNING id, created_at`
+			args := []any{
+				memory.WorldId,
+				memory.CharacterId,
+				memory.CreatedAt,
+				memory.Content,
+				memory.AlwaysInclude,
+				memory.Importance,
+				memory.Embedding,
+				memory.EmbeddingModelId,
+			}
+			if err := ctx.InsertRecord(query, args, &memory.ID, &memory.CreatedAt); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		MemoryDeletedSignal.EmitAllBG(deletedIds)
+		MemoryCreatedSignal.EmitAllBG(memories)
+	}
+
+	return err
+}
+
+// GetEmbeddingDimension returns the length of the embeddings generated by the model, 0 when there are none yet.
+func GetEmbeddingDimension(modelId int) (int, error) {
+	query := `SELECT embedding FROM memories WHERE embedding_model_id = ? AND embedding IS NOT NULL LIMIT 1`
+	args := []any{modelId}
+
+	embedding, err := database.QueryForRecord(query, args,
+		func(scanner database.RowScanner, dest *providers.Embedding) error {
+			return scanner.Scan(dest)
+		})
+	if err != nil || embedding == nil {
+		return 0, err
+	}
+
+	return len(*embedding), nil
+}
+
 func UpdateMemory(id int, memory *Memory) error {
 	query := `UPDATE memories
 			  SET content = ?,
 			      character_id = ?,
-			      always_include = ?
+			      always_include = ?,
+			      importance = ?
 			  WHERE id = ?`
-	args := []any{memory.Content, memory.CharacterId, memory.AlwaysInclude, id}
+	args := []any{memory.Content, memory.CharacterId, memory.AlwaysInclude, memory.Importance, id}
 
 	err := database.UpdateRecord(query, args)
 
@@ -133,7 +439,14 @@ func UpdateMemory(id int, memory *Memory) error {
 func SetMemoryEmbedding(id int, embeddings providers.Embedding, embeddingModelId int) error {
 	query := `UPDATE memories SET embedding = ?, embedding_model_id = ? WHERE id = ?`
 	args := []any{embeddings, embeddingModelId, id}
-	return database.UpdateRecord(query, args)
+
+	err := database.UpdateRecord(query, args)
+
+	if err == nil {
+		MemoryEmbeddingUpdatedSignal.EmitBG(id)
+	}
+
+	return err
 }
 
 func DeleteMemory(id int) error {
@@ -149,6 +462,27 @@ func DeleteMemory(id int) error {
 	return err
 }
 
+func DeleteMemories(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	query := `DELETE FROM memories WHERE id IN (` + placeholders + `) RETURNING id`
+	args := make([]any, len(ids))
+	for idx, id := range ids {
+		args[idx] = id
+	}
+
+	deletedIds, err := database.DeleteRecord(query, args)
+
+	if err == nil {
+		MemoryDeletedSignal.EmitAllBG(deletedIds)
+	}
+
+	return err
+}
+
 func GetMemoryBookmark(chatSessionId int) (*int, error) {
 	query := `SELECT message_id FROM memory_bookmarks WHERE chat_session_id = ?`
 	args := []any{chatSessionId}
@@ -0,0 +1,103 @@
+package memories
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/database"
+	"juraji.nl/chat-quest/core/log"
+	"juraji.nl/chat-quest/core/providers"
+)
+
+// embeddingEncodingVersion is the migration version from which embeddings are stored in the versioned encoding,
+// before that they were stored as float64.
+const embeddingEncodingVersion = 21
+
+const embeddingRewritePageSize = 500
+
+type storedEmbedding struct {
+	memoryId int
+	data     []byte
+}
+
+func init() {
+	const key = "RewriteMemoryEmbeddings"
+
+	database.MigrationsVersionUpgradeCompletedSignal.AddListener(key, func(ctx context.Context, event database.MigratedEvent) error {
+		switch {
+		case event.ToVersion >= embeddingEncodingVersion:
+			// Runs on every startup, finishing a rewrite that was interrupted before
+			return rewriteMemoryEmbeddings(true)
+		case event.FromVersion >= embeddingEncodingVersion:
+			return rewriteMemoryEmbeddings(false)
+		default:
+			return nil
+		}
+	})
+}
+
+// rewriteMemoryEmbeddings re-encodes the memory embeddings still stored as float64 to the versioned encoding, or
+// the other way around when toVersioned is false, a page per transaction.
+// Both encodings are told apart by their byte length, so only the embeddings not rewritten yet are selected and an
+// interrupted rewrite continues where it left off.
+func rewriteMemoryEmbeddings(toVersioned bool) error {
+	logger := log.Get()
+
+	query := `SELECT id, embedding FROM memories
+            WHERE embedding IS NOT NULL AND (length(embedding) % 8 = 0) = ? AND id > ?
+            ORDER BY id
+            LIMIT ?`
+	encode := providers.EncodeFloat64Embedding
+	if toVersioned {
+		encode = func(e providers.Embedding) []byte {
+			return providers.EncodeEmbedding(e, core.Env().QuantizeEmbeddings)
+		}
+	}
+
+	rewritten := 0
+	afterId := 0
+	for {
+		page, err := database.QueryForList(query, []any{toVersioned, afterId, embeddingRewritePageSize},
+			func(scanner database.RowScanner, dest *storedEmbedding) error {
+				return scanner.Scan(&dest.memoryId, &dest.data)
+			})
+		if err != nil {
+			return errors.Wrap(err, "error fetching memory embeddings")
+		}
+		if len(page) == 0 {
+			break
+		}
+		if rewritten == 0 {
+			logger.Info("Rewriting memory embeddings...", zap.Bool("toVersioned", toVersioned))
+		}
+
+		err = database.Transactional(func(ctx *database.TxContext) error {
+			for _, stored := range page {
+				embedding, err := providers.DecodeEmbedding(stored.data)
+				if err != nil {
+					return errors.Wrapf(err, "error decoding embedding of memory %d", stored.memoryId)
+				}
+
+				err = ctx.UpdateRecord("UPDATE memories SET embedding = ? WHERE id = ?",
+					[]any{encode(embedding), stored.memoryId})
+				if err != nil {
+					return errors.Wrapf(err, "error updating embedding of memory %d", stored.memoryId)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		rewritten += len(page)
+		afterId = page[len(page)-1].memoryId
+	}
+
+	if rewritten > 0 {
+		logger.Info("Memory embeddings rewritten", zap.Int("count", rewritten))
+	}
+	return nil
+}
@@ -8,11 +8,14 @@ import (
 var MemoryCreatedSignal = signals.New[*Memory]()
 var MemoryUpdatedSignal = signals.New[*Memory]()
 var MemoryDeletedSignal = signals.New[int]()
+var MemoryEmbeddingUpdatedSignal = signals.New[int]()
 var MemoryBookmarkUpdatedSignal = signals.New[*MemoryBookmark]()
+var ConsolidationProposalsUpdatedSignal = signals.New[int]()
 
 func init() {
 	sse.RegisterOnSSE("MemoryCreated", MemoryCreatedSignal)
 	sse.RegisterOnSSE("MemoryUpdated", MemoryUpdatedSignal)
 	sse.RegisterOnSSE("MemoryDeleted", MemoryDeletedSignal)
 	sse.RegisterOnSSE("MemoryBookmarkUpdated", MemoryBookmarkUpdatedSignal)
+	sse.RegisterOnSSE("MemoryConsolidationProposalsUpdated", ConsolidationProposalsUpdatedSignal)
 }
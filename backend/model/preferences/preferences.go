@@ -3,13 +3,34 @@ package preferences
 import (
 	"github.com/pkg/errors"
 	"juraji.nl/chat-quest/core/database"
+	p "juraji.nl/chat-quest/core/providers"
 )
 
+// MemoryMessageDeletePolicy defines what happens to memories generated from chat messages that are deleted.
+type MemoryMessageDeletePolicy string
+
+const (
+	KeepMemories       MemoryMessageDeletePolicy = "KEEP"
+	DeleteMemories     MemoryMessageDeletePolicy = "DELETE"
+	RegenerateMemories MemoryMessageDeletePolicy = "REGENERATE"
+)
+
+func (p MemoryMessageDeletePolicy) IsValid() bool {
+	switch p {
+	case KeepMemories, DeleteMemories, RegenerateMemories:
+		return true
+	default:
+		return false
+	}
+}
+
 type Preferences struct {
 	// Chat
 	ChatModelId          *int `json:"chatModelId"`
 	ChatInstructionId    *int `json:"chatInstructionId"`
 	MaxMessagesInContext int  `json:"maxMessagesInContext"`
+	// Models tried in order when the chat model keeps failing
+	ChatFallbackModelIds p.LlmModelIds `json:"chatFallbackModelIds"`
 	// Embedding
 	EmbeddingModelId *int `json:"embeddingModelId"`
 	// Memories
@@ -20,10 +41,45 @@ type Preferences struct {
 	MemoryWindowSize       int     `json:"memoryWindowSize"`
 	MemoryIncludeChatSize  int     `json:"memoryIncludeChatSize"`
 	MemoryIncludeChatNotes bool    `json:"memoryIncludeChatNotes"`
+	// Memory relevance is MemoryVectorWeight * embedding similarity + MemoryKeywordWeight * keyword score
+	MemoryVectorWeight  float64 `json:"memoryVectorWeight"`
+	MemoryKeywordWeight float64 `json:"memoryKeywordWeight"`
+	// Memory selection, MemoryTopK and MemoryTokenBudget of 0 are unlimited
+	MemoryTopK                int     `json:"memoryTopK"`
+	MemoryTokenBudget         int     `json:"memoryTokenBudget"`
+	MemoryRecencyWeight       float64 `json:"memoryRecencyWeight"`
+	MemoryRecencyHalfLifeDays float64 `json:"memoryRecencyHalfLifeDays"`
+	MemoryImportanceWeight    float64 `json:"memoryImportanceWeight"`
+	MemoryMmrLambda           float64 `json:"memoryMmrLambda"`
+	// Memory consolidation (Optional, disabled when no model is set)
+	MemoryConsolidationModelId       *int    `json:"memoryConsolidationModelId"`
+	MemoryConsolidationInstructionId *int    `json:"memoryConsolidationInstructionId"`
+	MemoryConsolidationThreshold     float64 `json:"memoryConsolidationThreshold"`
+	MemoryConsolidationIntervalHours int     `json:"memoryConsolidationIntervalHours"`
+	MemoryConsolidationAutoApply     bool    `json:"memoryConsolidationAutoApply"`
+	// Memories generated from deleted messages
+	MemoryOnMessagesDeleted MemoryMessageDeletePolicy `json:"memoryOnMessagesDeleted"`
 	// Title Generation
 	TitleGenerationModelId       *int `json:"titleGenerationModelId"`
 	TitleGenerationInstructionId *int `json:"titleGenerationInstructionId"`
 	TitleGenerationMessageWindow int  `json:"titleGenerationMessageWindow"`
+	// Summaries (Optional, disabled when no model is set)
+	SummaryModelId       *int `json:"summaryModelId"`
+	SummaryInstructionId *int `json:"summaryInstructionId"`
+	SummaryTriggerAfter  int  `json:"summaryTriggerAfter"`
+	// Lorebook
+	LorebookScanDepth   int `json:"lorebookScanDepth"`
+	LorebookTokenBudget int `json:"lorebookTokenBudget"`
+}
+
+// SummariesEnabled returns true when both a model and instruction are set for session summaries.
+func (p *Preferences) SummariesEnabled() bool {
+	return p.SummaryModelId != nil && p.SummaryInstructionId != nil
+}
+
+// MemoryConsolidationEnabled returns true when both a model and instruction are set for memory consolidation.
+func (p *Preferences) MemoryConsolidationEnabled() bool {
+	return p.MemoryConsolidationModelId != nil && p.MemoryConsolidationInstructionId != nil
 }
 
 func (p *Preferences) Validate() []string {
@@ -49,6 +105,30 @@ func (p *Preferences) Validate() []string {
 	if p.MemoriesInstructionId == nil {
 		errs = append(errs, "memories instruction not set")
 	}
+	if p.MemoryVectorWeight < 0 || p.MemoryKeywordWeight < 0 {
+		errs = append(errs, "memory retrieval weights must not be negative")
+	}
+	if p.MemoryRecencyWeight < 0 || p.MemoryImportanceWeight < 0 {
+		errs = append(errs, "memory ranking weights must not be negative")
+	}
+	if p.MemoryTopK < 0 || p.MemoryTokenBudget < 0 {
+		errs = append(errs, "memory top K and token budget must not be negative")
+	}
+	if p.MemoryRecencyHalfLifeDays <= 0 {
+		errs = append(errs, "memory recency half-life must be positive")
+	}
+	if p.MemoryMmrLambda < 0 || p.MemoryMmrLambda > 1 {
+		errs = append(errs, "memory MMR lambda must be between 0 and 1")
+	}
+	if p.MemoryConsolidationThreshold <= 0 || p.MemoryConsolidationThreshold > 1 {
+		errs = append(errs, "memory consolidation threshold must be between 0 and 1")
+	}
+	if p.MemoryConsolidationIntervalHours < 0 {
+		errs = append(errs, "memory consolidation interval must not be negative")
+	}
+	if !p.MemoryOnMessagesDeleted.IsValid() {
+		errs = append(errs, "invalid memory policy for deleted messages")
+	}
 
 	if p.TitleGenerationModelId == nil {
 		errs = append(errs, "title generation model not set")
@@ -86,6 +166,26 @@ func preferencesScanner(scanner database.RowScanner, dest *Preferences) error {
 		&dest.TitleGenerationModelId,
 		&dest.TitleGenerationInstructionId,
 		&dest.TitleGenerationMessageWindow,
+		&dest.SummaryModelId,
+		&dest.SummaryInstructionId,
+		&dest.SummaryTriggerAfter,
+		&dest.LorebookScanDepth,
+		&dest.LorebookTokenBudget,
+		&dest.MemoryVectorWeight,
+		&dest.MemoryKeywordWeight,
+		&dest.MemoryTopK,
+		&dest.MemoryTokenBudget,
+		&dest.MemoryRecencyWeight,
+		&dest.MemoryRecencyHalfLifeDays,
+		&dest.MemoryImportanceWeight,
+		&dest.MemoryMmrLambda,
+		&dest.MemoryConsolidationModelId,
+		&dest.MemoryConsolidationInstructionId,
+		&dest.MemoryConsolidationThreshold,
+		&dest.MemoryConsolidationIntervalHours,
+		&dest.MemoryConsolidationAutoApply,
+		&dest.MemoryOnMessagesDeleted,
+		&dest.ChatFallbackModelIds,
 	)
 }
 
@@ -124,7 +224,27 @@ func UpdatePreferences(prefs *Preferences) error {
                  memory_include_chat_notes = ?,
                  title_generation_model_id = ?,
                  title_generation_instruction_id = ?,
-                 title_generation_message_window = ?
+                 title_generation_message_window = ?,
+                 summary_model_id = ?,
+                 summary_instruction_id = ?,
+                 summary_trigger_after = ?,
+                 lorebook_scan_depth = ?,
+                 lorebook_token_budget = ?,
+                 memory_vector_weight = ?,
+                 memory_keyword_weight = ?,
+                 memory_top_k = ?,
+                 memory_token_budget = ?,
+                 memory_recency_weight = ?,
+                 memory_recency_half_life_days = ?,
+                 memory_importance_weight = ?,
+                 memory_mmr_lambda = ?,
+                 memory_consolidation_model_id = ?,
+                 memory_consolidation_instruction_id = ?,
+                 memory_consolidation_threshold = ?,
+                 memory_consolidation_interval_hours = ?,
+                 memory_consolidation_auto_apply = ?,
+                 memory_on_messages_deleted = ?,
+                 chat_fallback_model_ids = ?
              WHERE id = 0`
 	args := []any{
 		prefs.ChatModelId,
@@ -141,6 +261,26 @@ func UpdatePreferences(prefs *Preferences) error {
 		prefs.TitleGenerationModelId,
 		prefs.TitleGenerationInstructionId,
 		prefs.TitleGenerationMessageWindow,
+		prefs.SummaryModelId,
+		prefs.SummaryInstructionId,
+		prefs.SummaryTriggerAfter,
+		prefs.LorebookScanDepth,
+		prefs.LorebookTokenBudget,
+		prefs.MemoryVectorWeight,
+		prefs.MemoryKeywordWeight,
+		prefs.MemoryTopK,
+		prefs.MemoryTokenBudget,
+		prefs.MemoryRecencyWeight,
+		prefs.MemoryRecencyHalfLifeDays,
+		prefs.MemoryImportanceWeight,
+		prefs.MemoryMmrLambda,
+		prefs.MemoryConsolidationModelId,
+		prefs.MemoryConsolidationInstructionId,
+		prefs.MemoryConsolidationThreshold,
+		prefs.MemoryConsolidationIntervalHours,
+		prefs.MemoryConsolidationAutoApply,
+		prefs.MemoryOnMessagesDeleted,
+		prefs.ChatFallbackModelIds,
 	}
 
 	if err := database.UpdateRecord(query, args); err != nil {
@@ -34,6 +34,12 @@ func ScenarioById(id int) (*Scenario, error) {
 	return database.QueryForRecord(query, args, scenarioScanner)
 }
 
+func ScenariosByLinkedCharacterId(characterId int) ([]Scenario, error) {
+	query := "SELECT * FROM scenarios WHERE linked_character_id=?"
+	args := []any{characterId}
+	return database.QueryForList(query, args, scenarioScanner)
+}
+
 func CreateScenario(scenario *Scenario) error {
 	scenario.AvatarUrl = util.EmptyStrToNil(scenario.AvatarUrl)
 
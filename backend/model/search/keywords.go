@@ -0,0 +1,48 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"juraji.nl/chat-quest/core/util"
+)
+
+const minKeywordLength = 3
+
+// stopWords are common English words, which carry no meaning as search keywords.
+var stopWords = util.NewSetFrom(strings.Fields(`
+	about above after again against all and any are because been before being below between both but can
+	could did does doing down during each few for from further had has have having her here hers herself
+	him himself his how into its itself just let more most myself nor not now off once only other ought our
+	ours ourselves out over own same she should some such than that the their theirs them themselves then
+	there these they this those through too under until very was were what when where which while who whom
+	why will with would yes yet you your yours yourself yourselves`), func(w string) string { return w })
+
+// KeywordsMatchExpression extracts up to maxTerms distinct keywords from text, and combines them into an FTS5
+// match expression matching documents containing any of them. Stop words and short words are left out, as
+// BM25 already weighs rare words over common ones. Returns false if the text has no keywords.
+func KeywordsMatchExpression(text string, maxTerms int) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := util.NewSet[string](len(words))
+	var terms []string
+	for _, word := range words {
+		if len([]rune(word)) < minKeywordLength || stopWords.Contains(word) || seen.Contains(word) {
+			continue
+		}
+
+		seen.Add(word)
+		terms = append(terms, `"`+word+`"`)
+		if len(terms) == maxTerms {
+			break
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", false
+	}
+
+	return strings.Join(terms, " OR "), true
+}
@@ -0,0 +1,275 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"juraji.nl/chat-quest/core/database"
+)
+
+type ResultType string
+
+const (
+	MessageResult   ResultType = "MESSAGE"
+	MemoryResult    ResultType = "MEMORY"
+	CharacterResult ResultType = "CHARACTER"
+
+	// HighlightStart and HighlightEnd surround the matched terms in result snippets, the rest of the snippet is HTML-escaped.
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+
+	snippetEllipsis = "…"
+	snippetTokens   = 24
+
+	// Snippets are marked with private-use characters by SQLite, which are replaced by the highlight tags
+	// after the snippet text has been HTML-escaped.
+	snippetMarkStart = "\uE000"
+	snippetMarkEnd   = "\uE001"
+)
+
+var AllResultTypes = []ResultType{MessageResult, MemoryResult, CharacterResult}
+
+// ErrEmptyQuery is returned when the query text contains no searchable terms, e.g. only operators.
+var ErrEmptyQuery = errors.New("search query is empty")
+
+func (t ResultType) IsValid() bool {
+	return slices.Contains(AllResultTypes, t)
+}
+
+type Query struct {
+	Text          string
+	Types         []ResultType
+	WorldID       *int
+	ChatSessionID *int
+	CharacterID   *int
+	Limit         int
+	Offset        int
+}
+
+type Result struct {
+	Type          ResultType `json:"type"`
+	ID            int        `json:"id"`
+	WorldID       *int       `json:"worldId"`
+	ChatSessionID *int       `json:"chatSessionId"`
+	CharacterID   *int       `json:"characterId"`
+	// Title is the name of the session (messages), world (memories) or character (characters) the result belongs to.
+	Title     string     `json:"title"`
+	Snippet   string     `json:"snippet"`
+	CreatedAt *time.Time `json:"createdAt"`
+}
+
+type ResultPage struct {
+	Results []Result `json:"results"`
+	Total   int      `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+func resultScanner(scanner database.RowScanner, dest *Result) error {
+	return scanner.Scan(
+		&dest.Type,
+		&dest.ID,
+		&dest.WorldID,
+		&dest.ChatSessionID,
+		&dest.CharacterID,
+		&dest.Title,
+		&dest.Snippet,
+		&dest.CreatedAt,
+	)
+}
+
+// Search finds chat messages, memories and characters matching the query text, best matches first.
+// Types that cannot match the filters are left out, e.g. memories when filtering by session.
+func Search(query Query) (*ResultPage, error) {
+	matchExpr, err := ftsMatchExpression(query.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	types := query.Types
+	if len(types) == 0 {
+		types = AllResultTypes
+	}
+
+	var selects []string
+	var args []any
+	for _, resultType := range types {
+		var sel string
+		var selArgs []any
+
+		switch resultType {
+		case MessageResult:
+			sel, selArgs = messagesSelect(matchExpr, query)
+		case MemoryResult:
+			sel, selArgs = memoriesSelect(matchExpr, query)
+		case CharacterResult:
+			sel, selArgs = charactersSelect(matchExpr, query)
+		default:
+			return nil, errors.Errorf("unknown search result type '%s'", resultType)
+		}
+
+		if sel != "" {
+			selects = append(selects, sel)
+			args = append(args, selArgs...)
+		}
+	}
+
+	page := &ResultPage{Results: []Result{}, Limit: query.Limit, Offset: query.Offset}
+	if len(selects) == 0 {
+		return page, nil
+	}
+
+	union := strings.Join(selects, " UNION ALL ")
+
+	total, err := database.QueryForRecord("SELECT COUNT(*) FROM ("+union+")", args, database.IntScanner)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count search results")
+	}
+	page.Total = *total
+
+	pageQuery := `SELECT type, id, world_id, chat_session_id, character_id, title, snippet, created_at
+                FROM (` + union + `)
+                ORDER BY rank, created_at DESC
+                LIMIT ? OFFSET ?`
+	pageArgs := append(args, query.Limit, query.Offset)
+
+	page.Results, err = database.QueryForList(pageQuery, pageArgs, resultScanner)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search")
+	}
+	for i := range page.Results {
+		page.Results[i].Snippet = highlightSnippet(page.Results[i].Snippet)
+	}
+
+	return page, nil
+}
+
+func messagesSelect(matchExpr string, query Query) (string, []any) {
+	sel := `SELECT 'MESSAGE' AS type, m.id AS id, s.world_id AS world_id, m.chat_session_id AS chat_session_id,
+                 m.character_id AS character_id, s.name AS title,
+                 ` + snippetExpr("chat_messages_fts", 0) + ` AS snippet,
+                 m.created_at AS created_at, bm25(chat_messages_fts) AS rank
+          FROM chat_messages_fts
+            JOIN chat_messages m ON m.id = chat_messages_fts.rowid
+            JOIN chat_sessions s ON s.id = m.chat_session_id
+          WHERE chat_messages_fts MATCH ?`
+	args := []any{matchExpr}
+
+	if query.WorldID != nil {
+		sel += " AND s.world_id = ?"
+		args = append(args, *query.WorldID)
+	}
+	if query.ChatSessionID != nil {
+		sel += " AND m.chat_session_id = ?"
+		args = append(args, *query.ChatSessionID)
+	}
+	if query.CharacterID != nil {
+		sel += " AND m.character_id = ?"
+		args = append(args, *query.CharacterID)
+	}
+
+	return sel, args
+}
+
+func memoriesSelect(matchExpr string, query Query) (string, []any) {
+	// Memories are not bound to sessions
+	if query.ChatSessionID != nil {
+		return "", nil
+	}
+
+	sel := `SELECT 'MEMORY' AS type, m.id AS id, m.world_id AS world_id, NULL AS chat_session_id,
+                 m.character_id AS character_id, w.name AS title,
+                 ` + snippetExpr("memories_fts", 0) + ` AS snippet,
+                 m.created_at AS created_at, bm25(memories_fts) AS rank
+          FROM memories_fts
+            JOIN memories m ON m.id = memories_fts.rowid
+            JOIN worlds w ON w.id = m.world_id
+          WHERE memories_fts MATCH ?`
+	args := []any{matchExpr}
+
+	if query.WorldID != nil {
+		sel += " AND m.world_id = ?"
+		args = append(args, *query.WorldID)
+	}
+	if query.CharacterID != nil {
+		sel += " AND m.character_id = ?"
+		args = append(args, *query.CharacterID)
+	}
+
+	return sel, args
+}
+
+func charactersSelect(matchExpr string, query Query) (string, []any) {
+	// Snippet column -1 selects the best matching column
+	sel := `SELECT 'CHARACTER' AS type, c.id AS id, NULL AS world_id, NULL AS chat_session_id,
+                 c.id AS character_id, c.name AS title,
+                 ` + snippetExpr("characters_fts", -1) + ` AS snippet,
+                 c.created_at AS created_at, bm25(characters_fts) AS rank
+          FROM characters_fts
+            JOIN characters c ON c.id = characters_fts.rowid
+          WHERE characters_fts MATCH ?`
+	args := []any{matchExpr}
+
+	// Characters are filtered on world and session by their participation in sessions
+	if query.WorldID != nil {
+		sel += ` AND EXISTS (SELECT 1 FROM chat_participants p
+                          JOIN chat_sessions s ON s.id = p.chat_session_id
+                        WHERE p.character_id = c.id AND s.world_id = ?)`
+		args = append(args, *query.WorldID)
+	}
+	if query.ChatSessionID != nil {
+		sel += ` AND EXISTS (SELECT 1 FROM chat_participants p
+                        WHERE p.character_id = c.id AND p.chat_session_id = ?)`
+		args = append(args, *query.ChatSessionID)
+	}
+	if query.CharacterID != nil {
+		sel += " AND c.id = ?"
+		args = append(args, *query.CharacterID)
+	}
+
+	return sel, args
+}
+
+// snippetExpr selects a snippet of the matched text in column (-1 for the best matching column) of the FTS table.
+func snippetExpr(table string, column int) string {
+	return fmt.Sprintf("snippet(%s, %d, '%s', '%s', '%s', %d)",
+		table, column, snippetMarkStart, snippetMarkEnd, snippetEllipsis, snippetTokens)
+}
+
+// highlightSnippet HTML-escapes the snippet text and replaces the snippet marks with the highlight tags.
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(
+		snippetMarkStart, HighlightStart,
+		snippetMarkEnd, HighlightEnd,
+	).Replace(html.EscapeString(snippet))
+}
+
+// ftsMatchExpression converts free text into an FTS5 match expression, matching documents containing all terms.
+// Terms are quoted, so FTS5 operators in the text are matched literally. A trailing '*' makes a term a prefix.
+// Returns ErrEmptyQuery when no terms remain.
+func ftsMatchExpression(text string) (string, error) {
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		isPrefix := strings.HasSuffix(term, "*")
+		term = strings.Trim(strings.ReplaceAll(term, `"`, ""), "*")
+		if term == "" {
+			continue
+		}
+
+		term = `"` + term + `"`
+		if isPrefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	if len(terms) == 0 {
+		return "", ErrEmptyQuery
+	}
+
+	return strings.Join(terms, " "), nil
+}
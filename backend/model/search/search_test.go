@@ -0,0 +1,75 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFtsMatchExpression(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "terms are quoted", text: "red  dragon", expected: `"red" "dragon"`},
+		{name: "trailing star makes a prefix", text: "drag* castle", expected: `"drag"* "castle"`},
+		{name: "operators are matched literally", text: "red OR dragon NEAR(x)", expected: `"red" "OR" "dragon" "NEAR(x)"`},
+		{name: "quotes are removed", text: `"red dragon"`, expected: `"red" "dragon"`},
+		{name: "leading and inner stars are kept as text", text: "*drag*on", expected: `"drag*on"`},
+		{name: "terms without text are skipped", text: `red * "" dragon`, expected: `"red" "dragon"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ftsMatchExpression(test.text)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestFtsMatchExpressionEmpty(t *testing.T) {
+	for _, text := range []string{"", "   ", "***", `"`, `"" * "*"`} {
+		if _, err := ftsMatchExpression(text); !errors.Is(err, ErrEmptyQuery) {
+			t.Errorf("expected ErrEmptyQuery for '%s', got %v", text, err)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name     string
+		snippet  string
+		expected string
+	}{
+		{name: "plain text", snippet: "a red dragon", expected: "a red dragon"},
+		{
+			name:     "marks become highlight tags",
+			snippet:  "a " + snippetMarkStart + "red" + snippetMarkEnd + " " + snippetMarkStart + "dragon" + snippetMarkEnd + snippetEllipsis,
+			expected: "a <mark>red</mark> <mark>dragon</mark>" + snippetEllipsis,
+		},
+		{
+			name:     "html is escaped",
+			snippet:  "<b>" + snippetMarkStart + "red" + snippetMarkEnd + "</b> & \"dragon\"",
+			expected: "&lt;b&gt;<mark>red</mark>&lt;/b&gt; &amp; &#34;dragon&#34;",
+		},
+		{
+			name:     "highlight tags in the text are escaped",
+			snippet:  "<mark>" + snippetMarkStart + "red" + snippetMarkEnd + "</mark>",
+			expected: "&lt;mark&gt;<mark>red</mark>&lt;/mark&gt;",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := highlightSnippet(test.snippet); result != test.expected {
+				t.Errorf("expected '%s', got '%s'", test.expected, result)
+			}
+		})
+	}
+}
@@ -47,7 +47,7 @@ func BuildCharacter(
 	logger := log.Get()
 
 	// Cancellation
-	ctx, cleanup := setupCancelBySystem(ctx, logger, "GenerateMemories")
+	ctx, cleanup := registerGeneration(ctx, logger, "BuildCharacter", 0)
 	defer cleanup()
 
 	var err error
@@ -85,6 +85,8 @@ func BuildCharacter(
 	llmParameters := instruction.AsLlmParameters()
 	llmParameters.ResponseFormat = new(charactersResponseFormat)
 
+	// The user is waiting on the result
+	ctx = p.WithRequestPriority(ctx, p.PriorityInteractive)
 	chatResponseChan := p.GenerateChatResponse(ctx, modelInstance, requestMessages, llmParameters)
 	var rawResponse string
 
@@ -0,0 +1,343 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/assets"
+	"juraji.nl/chat-quest/core/log"
+	"juraji.nl/chat-quest/core/util"
+	cc "juraji.nl/chat-quest/model/character-cards"
+	c "juraji.nl/chat-quest/model/characters"
+	lb "juraji.nl/chat-quest/model/lorebook"
+	m "juraji.nl/chat-quest/model/memories"
+	s "juraji.nl/chat-quest/model/scenarios"
+	sp "juraji.nl/chat-quest/model/species"
+)
+
+const (
+	// cardPlaceholderWidth and cardPlaceholderHeight are the dimensions of the image used for PNG cards
+	// of characters without a (decodable) avatar, in the common 2:3 card ratio.
+	cardPlaceholderWidth  = 400
+	cardPlaceholderHeight = 600
+)
+
+var (
+	cardCharacterNameVarPattern = regexp.MustCompile(`{{-?\s*\.CharacterName\s*-?}}`)
+	cardPersonaNameVarPattern   = regexp.MustCompile(`{{-?\s*\.PersonaName\s*-?}}`)
+	cardPlaceholderColor        = color.RGBA{R: 0x33, G: 0x33, B: 0x3d, A: 0xff}
+)
+
+// ExportCharacterAsCard exports the character as Character Card of the given spec (cc.SpecV2 or cc.SpecV3).
+// The avatar is included as V3 icon asset. Returns nil if the character does not exist.
+func ExportCharacterAsCard(characterID int, spec string) (*cc.CharacterCard, error) {
+	logger := log.Get().With(
+		zap.Int("characterID", characterID),
+		zap.String("spec", spec))
+
+	logger.Info("Exporting character as card...")
+	character, cardData, err := characterCardData(characterID)
+	if err != nil {
+		logger.Error("Failed to export character as card", zap.Error(err))
+		return nil, err
+	}
+	if character == nil {
+		return nil, nil
+	}
+
+	if icon := cardIconAsset(character.AvatarUrl); icon != nil {
+		cardData.Assets = []cc.CardAsset{*icon}
+	}
+
+	logger.Info("Character card export completed")
+	return cc.NewCharacterCard(spec, *cardData), nil
+}
+
+// ExportCharacterAsCardPNG exports the character as PNG image with both the V2 and V3 card embedded.
+// The image is the character's avatar converted to PNG, or a placeholder if the character has no usable avatar.
+// Returns nil if the character does not exist.
+func ExportCharacterAsCardPNG(characterID int) ([]byte, error) {
+	logger := log.Get().With(zap.Int("characterID", characterID))
+
+	logger.Info("Exporting character as PNG card...")
+	character, cardData, err := characterCardData(characterID)
+	if err != nil {
+		logger.Error("Failed to export character as PNG card", zap.Error(err))
+		return nil, err
+	}
+	if character == nil {
+		return nil, nil
+	}
+
+	avatar, err := cardAvatarPNG(character.AvatarUrl)
+	if err != nil {
+		logger.Error("Failed to create card image", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to create card image")
+	}
+
+	// The V3 spec refers to the image itself as the main icon
+	v3Data := *cardData
+	v3Data.Assets = []cc.CardAsset{{Type: "icon", Uri: "ccdefault:", Name: "main", Ext: "png"}}
+
+	cardPng, err := cc.EncodeCardPNG(avatar,
+		cc.NewCharacterCard(cc.SpecV2, *cardData),
+		cc.NewCharacterCard(cc.SpecV3, v3Data))
+	if err != nil {
+		logger.Error("Failed to encode PNG card", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to encode PNG card")
+	}
+
+	logger.Info("Character PNG card export completed")
+	return cardPng, nil
+}
+
+// characterCardData collects the card data for the character. Returns nil values if the character does not exist.
+func characterCardData(characterID int) (*c.Character, *cc.CardData, error) {
+	character, err := c.CharacterById(characterID)
+	if err != nil || character == nil {
+		return nil, nil, errors.Wrap(err, "failed to fetch character")
+	}
+
+	var species *sp.Species
+	if character.SpeciesID != nil {
+		if species, err = sp.SpeciesByID(*character.SpeciesID); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to fetch species")
+		}
+	}
+
+	greetings, err := c.CharacterGreetingsByCharacterId(characterID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to fetch greetings")
+	}
+
+	dialogueExamples, err := c.DialogueExamplesByCharacterId(characterID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to fetch dialogue examples")
+	}
+
+	scenarios, err := s.ScenariosByLinkedCharacterId(characterID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to fetch scenarios")
+	}
+
+	book, err := characterCardBook(character, species)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cardData := &cc.CardData{
+		Name:          character.Name,
+		Description:   characterCardDescription(character, species),
+		Personality:   util.StrPtrOrDefault(character.Personality, ""),
+		CharacterBook: book,
+	}
+
+	if len(scenarios) > 0 {
+		cardData.Scenario = scenarios[0].Description
+	}
+
+	for idx, greeting := range greetings {
+		greeting = cardCharacterNameVarPattern.ReplaceAllLiteralString(greeting, "{{char}}")
+		greeting = cardPersonaNameVarPattern.ReplaceAllLiteralString(greeting, "{{user}}")
+		if idx == 0 {
+			cardData.FirstMes = greeting
+		} else {
+			cardData.AlternateGreetings = append(cardData.AlternateGreetings, greeting)
+		}
+	}
+
+	var mesExample strings.Builder
+	for _, example := range dialogueExamples {
+		mesExample.WriteString("<START>\n")
+		mesExample.WriteString(strings.TrimSpace(example))
+		mesExample.WriteString("\n")
+	}
+	cardData.MesExample = strings.TrimSpace(mesExample.String())
+
+	return character, cardData, nil
+}
+
+// characterCardDescription combines the character's attributes, appearance and history,
+// as cards only have a single free-form description.
+func characterCardDescription(character *c.Character, species *sp.Species) string {
+	var attributes []string
+	if character.Age != nil {
+		attributes = append(attributes, fmt.Sprintf("Age: %d", *character.Age))
+	}
+	if species != nil {
+		attributes = append(attributes, "Species: "+species.Name)
+	}
+	if character.Pronouns != nil {
+		attributes = append(attributes, "Pronouns: "+*character.Pronouns)
+	}
+
+	var parts []string
+	if len(attributes) > 0 {
+		parts = append(parts, strings.Join(attributes, "\n"))
+	}
+	if character.Appearance != nil {
+		parts = append(parts, strings.TrimSpace(*character.Appearance))
+	}
+	if character.History != nil {
+		parts = append(parts, strings.TrimSpace(*character.History))
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// characterCardBook creates the character book from the character's species, lorebook entries bound to the
+// character and the character's memories. Returns nil if there is nothing to include.
+func characterCardBook(character *c.Character, species *sp.Species) (*cc.CharacterBook, error) {
+	var entries []cc.CharacterBookEntry
+
+	if species != nil && species.Description != "" {
+		entries = append(entries, cc.CharacterBookEntry{
+			Keys:     []string{species.Name},
+			Content:  species.Description,
+			Enabled:  true,
+			Name:     species.Name,
+			Comment:  "Species",
+			Constant: true,
+			Position: "before_char",
+		})
+	}
+
+	lorebookEntries, err := lb.GetLorebookEntriesByCharacterId(character.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch lorebook entries")
+	}
+	for _, entry := range lorebookEntries {
+		entries = append(entries, lorebookEntryToCardBookEntry(&entry))
+	}
+
+	// Memories are recalled by similarity, which other frontends do not support.
+	// They are keyed on the character's name instead, so they activate when the character is mentioned.
+	memories, err := m.GetMemoriesByCharacterId(character.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch memories")
+	}
+	for _, memory := range memories {
+		entries = append(entries, cc.CharacterBookEntry{
+			Keys:     []string{character.Name},
+			Content:  memory.Content,
+			Enabled:  true,
+			Comment:  "Memory",
+			Constant: memory.AlwaysInclude,
+			Position: "after_char",
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	for idx := range entries {
+		entries[idx].ID = idx + 1
+	}
+
+	return &cc.CharacterBook{
+		Name:    character.Name,
+		Entries: entries,
+	}, nil
+}
+
+func lorebookEntryToCardBookEntry(entry *lb.LorebookEntry) cc.CharacterBookEntry {
+	bookEntry := cc.CharacterBookEntry{
+		Keys:           lb.SplitKeywords(entry.Keywords),
+		Content:        entry.Content,
+		Enabled:        entry.Enabled,
+		InsertionOrder: entry.Priority,
+		CaseSensitive:  &entry.CaseSensitive,
+		Name:           entry.Name,
+		Comment:        entry.Name,
+		Constant:       entry.AlwaysInclude,
+		Position:       "before_char",
+	}
+
+	if entry.Position == lb.AfterCharacters {
+		bookEntry.Position = "after_char"
+	}
+
+	if entry.SecondaryKeywords != nil {
+		bookEntry.Selective = true
+		bookEntry.SecondaryKeys = lb.SplitKeywords(*entry.SecondaryKeywords)
+
+		// SillyTavern stores the secondary logic as an index in its extensions
+		for idx, logic := range cardSelectiveLogicEnum {
+			if logic == entry.SecondaryLogic {
+				bookEntry.Extensions = map[string]any{"selectiveLogic": idx}
+			}
+		}
+	}
+
+	return bookEntry
+}
+
+// cardIconAsset returns the avatar as V3 icon asset. Avatars in asset storage are embedded as data URL,
+// as their urls are only meaningful to this application.
+func cardIconAsset(avatarUrl *string) *cc.CardAsset {
+	if avatarUrl == nil {
+		return nil
+	}
+
+	mimeType, data, err := readAvatar(*avatarUrl)
+	if err != nil {
+		// External url
+		return &cc.CardAsset{Type: "icon", Uri: *avatarUrl, Name: "main", Ext: "png"}
+	}
+
+	return &cc.CardAsset{
+		Type: "icon",
+		Uri:  "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data),
+		Name: "main",
+		Ext:  strings.TrimPrefix(mimeType, "image/"),
+	}
+}
+
+// cardAvatarPNG converts the avatar to a PNG image. Only avatars in asset storage and data URLs can be converted,
+// for other avatars a placeholder image is created.
+func cardAvatarPNG(avatarUrl *string) ([]byte, error) {
+	if avatarUrl != nil {
+		if mimeType, data, err := readAvatar(*avatarUrl); err == nil {
+			if mimeType == "image/png" {
+				return data, nil
+			}
+			if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+				return encodePNG(img)
+			}
+			log.Get().Warn("Unsupported avatar image type, using placeholder", zap.String("mimeType", mimeType))
+		}
+	}
+
+	placeholder := image.NewRGBA(image.Rect(0, 0, cardPlaceholderWidth, cardPlaceholderHeight))
+	draw.Draw(placeholder, placeholder.Bounds(), &image.Uniform{C: cardPlaceholderColor}, image.Point{}, draw.Src)
+	return encodePNG(placeholder)
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readAvatar reads an avatar from asset storage or a data URL.
+func readAvatar(avatarUrl string) (string, []byte, error) {
+	if assets.IsAssetUrl(avatarUrl) {
+		return assets.ReadAssetByUrl(avatarUrl)
+	}
+	if mimeType, data, ok := assets.DecodeDataUrl(avatarUrl); ok {
+		return mimeType, data, nil
+	}
+	return "", nil, errors.New("avatar is not stored locally")
+}
@@ -0,0 +1,247 @@
+package processing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/assets"
+	"juraji.nl/chat-quest/core/log"
+	cc "juraji.nl/chat-quest/model/character-cards"
+	c "juraji.nl/chat-quest/model/characters"
+	lb "juraji.nl/chat-quest/model/lorebook"
+	s "juraji.nl/chat-quest/model/scenarios"
+)
+
+var (
+	cardCharMacroPattern   = regexp.MustCompile(`(?i){{char}}|<BOT>`)
+	cardUserMacroPattern   = regexp.MustCompile(`(?i){{user}}|<USER>`)
+	cardExampleSeparator   = regexp.MustCompile(`(?i)<START>`)
+	cardSelectiveLogicEnum = []lb.SecondaryLogic{lb.AndAny, lb.NotAll, lb.NotAny, lb.AndAll}
+)
+
+// ImportCharacterCard creates a character from a parsed Character Card, data being the JSON document or PNG image
+// the card was parsed from.
+//   - The description (which is free-form in cards) becomes the character's history.
+//   - first_mes, alternate_greetings and group_only_greetings become greetings.
+//   - mes_example is split on <START> into dialogue examples.
+//   - The scenario becomes a scenario linked to the character.
+//   - The character_book becomes lorebook entries bound to the character, which requires a world.
+//     When worldId is nil the book is skipped.
+//   - The PNG image, or the V3 icon asset, is stored as asset and becomes the avatar.
+func ImportCharacterCard(card *cc.CharacterCard, data []byte, worldId *int) (*c.Character, error) {
+	logger := log.Get().With(
+		zap.String("spec", card.Spec),
+		zap.String("name", card.Data.Name))
+	logger.Info("Importing character card...")
+
+	cardData := &card.Data
+	charName := cardData.Name
+	if cardData.Nickname != "" {
+		charName = cardData.Nickname
+	}
+
+	avatarUrl, err := cardAvatarUrl(data, cardData)
+	if err != nil {
+		logger.Error("Failed to extract avatar from character card", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to extract avatar")
+	}
+
+	character := &c.Character{
+		Name:               cardData.Name,
+		AvatarUrl:          avatarUrl,
+		Personality:        new(convertCardMacros(cardData.Personality, charName, "User")),
+		History:            new(convertCardMacros(cardData.Description, charName, "User")),
+		GroupTalkativeness: 0.5,
+	}
+
+	if err = c.CreateCharacter(character); err != nil {
+		logger.Error("Failed to create character", zap.Error(err))
+		return nil, errors.Wrap(err, "failed to create character")
+	}
+
+	logger = logger.With(zap.Int("characterId", character.ID))
+
+	if err = importCardDetails(character, cardData, charName, worldId); err != nil {
+		logger.Error("Failed to import character card details, removing character", zap.Error(err))
+		if delErr := c.DeleteCharacterById(character.ID); delErr != nil {
+			logger.Error("Failed to remove partially imported character", zap.Error(delErr))
+		}
+		return nil, err
+	}
+
+	logger.Info("Character card imported")
+	return character, nil
+}
+
+func importCardDetails(character *c.Character, cardData *cc.CardData, charName string, worldId *int) error {
+	// Greetings are rendered as templates when posted
+	var greetings []string
+	allGreetings := append([]string{cardData.FirstMes}, cardData.AlternateGreetings...)
+	for _, greeting := range append(allGreetings, cardData.GroupOnlyGreetings...) {
+		greeting = strings.TrimSpace(greeting)
+		if greeting != "" {
+			greetings = append(greetings, convertCardMacros(greeting, "{{.CharacterName}}", "{{.PersonaName}}"))
+		}
+	}
+	if err := c.SetGreetingsByCharacterId(character.ID, greetings); err != nil {
+		return errors.Wrap(err, "failed to save greetings")
+	}
+
+	var examples []string
+	for _, example := range cardExampleSeparator.Split(cardData.MesExample, -1) {
+		example = strings.TrimSpace(example)
+		if example != "" {
+			examples = append(examples, convertCardMacros(example, charName, "User"))
+		}
+	}
+	if err := c.SetDialogueExamplesByCharacterId(character.ID, examples); err != nil {
+		return errors.Wrap(err, "failed to save dialogue examples")
+	}
+
+	if scenarioText := strings.TrimSpace(cardData.Scenario); scenarioText != "" {
+		scenario := &s.Scenario{
+			Name:              character.Name,
+			Description:       convertCardMacros(scenarioText, charName, "User"),
+			AvatarUrl:         character.AvatarUrl,
+			LinkedCharacterId: &character.ID,
+		}
+		if err := s.CreateScenario(scenario); err != nil {
+			return errors.Wrap(err, "failed to create scenario")
+		}
+	}
+
+	if cardData.CharacterBook != nil && len(cardData.CharacterBook.Entries) > 0 {
+		if worldId == nil {
+			log.Get().Warn("Character card contains a character book, but no world was given to import it into",
+				zap.Int("characterId", character.ID))
+			return nil
+		}
+
+		for idx, bookEntry := range cardData.CharacterBook.Entries {
+			entry := cardBookEntryToLorebookEntry(idx, &bookEntry, character.ID, charName)
+			if err := entry.Validate(); err != nil {
+				log.Get().Warn("Skipping invalid character book entry",
+					zap.Int("characterId", character.ID),
+					zap.String("entry", entry.Name),
+					zap.Error(err))
+				continue
+			}
+
+			if err := lb.CreateLorebookEntry(*worldId, entry); err != nil {
+				return errors.Wrap(err, "failed to create lorebook entry")
+			}
+		}
+	}
+
+	return nil
+}
+
+func cardBookEntryToLorebookEntry(
+	idx int,
+	bookEntry *cc.CharacterBookEntry,
+	characterId int,
+	charName string,
+) *lb.LorebookEntry {
+	name := bookEntry.Name
+	if name == "" {
+		name = bookEntry.Comment
+	}
+	if name == "" && len(bookEntry.Keys) > 0 {
+		name = bookEntry.Keys[0]
+	}
+	if name == "" {
+		name = fmt.Sprintf("Entry %d", idx+1)
+	}
+
+	priority := bookEntry.InsertionOrder
+	if bookEntry.Priority != nil {
+		priority = *bookEntry.Priority
+	}
+
+	position := lb.WorldInfo
+	if bookEntry.Position == "after_char" {
+		position = lb.AfterCharacters
+	}
+
+	entry := &lb.LorebookEntry{
+		CharacterId:    &characterId,
+		Name:           name,
+		Content:        convertCardMacros(bookEntry.Content, charName, "User"),
+		Keywords:       cardBookKeywords(bookEntry.Keys, bookEntry.UseRegex),
+		SecondaryLogic: lb.AndAny,
+		CaseSensitive:  bookEntry.CaseSensitive != nil && *bookEntry.CaseSensitive,
+		AlwaysInclude:  bookEntry.Constant,
+		Enabled:        bookEntry.Enabled,
+		Priority:       priority,
+		Position:       position,
+	}
+
+	if bookEntry.Selective && len(bookEntry.SecondaryKeys) > 0 {
+		entry.SecondaryKeywords = new(cardBookKeywords(bookEntry.SecondaryKeys, bookEntry.UseRegex))
+
+		// SillyTavern stores the secondary logic as an index in its extensions
+		if logic, ok := bookEntry.Extensions["selectiveLogic"].(float64); ok &&
+			int(logic) >= 0 && int(logic) < len(cardSelectiveLogicEnum) {
+			entry.SecondaryLogic = cardSelectiveLogicEnum[int(logic)]
+		}
+	}
+
+	return entry
+}
+
+// cardBookKeywords joins card keys into a keyword list. Keys that are regular expressions are wrapped
+// in slashes, unless they already are (SillyTavern stores regex keys as /pattern/flags).
+func cardBookKeywords(keys []string, useRegex bool) string {
+	var keywords []string
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if useRegex && !strings.HasPrefix(key, "/") {
+			key = "/" + key + "/"
+		}
+		keywords = append(keywords, key)
+	}
+	return strings.Join(keywords, ", ")
+}
+
+// cardAvatarUrl stores the avatar for the card as asset and returns its url. For PNG cards this is the image itself,
+// without the embedded card. For JSON cards this is the V3 main icon asset, if it is embedded as data URL.
+func cardAvatarUrl(data []byte, cardData *cc.CardData) (*string, error) {
+	var image []byte
+	if cc.IsPNG(data) {
+		stripped, err := cc.StripCardChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		image = stripped
+	} else {
+		for _, asset := range cardData.Assets {
+			if _, decoded, ok := assets.DecodeDataUrl(asset.Uri); ok && asset.Type == "icon" {
+				image = decoded
+				break
+			}
+		}
+	}
+
+	if image == nil {
+		return nil, nil
+	}
+
+	asset, err := assets.StoreAsset(image)
+	if err != nil {
+		return nil, err
+	}
+	return &asset.Url, nil
+}
+
+// convertCardMacros replaces the {{char}} and {{user}} macros used by cards.
+func convertCardMacros(text string, charReplacement string, userReplacement string) string {
+	text = cardCharMacroPattern.ReplaceAllLiteralString(text, charReplacement)
+	text = cardUserMacroPattern.ReplaceAllLiteralString(text, userReplacement)
+	return text
+}
@@ -0,0 +1,187 @@
+package processing
+
+import (
+	"github.com/pkg/errors"
+	prov "juraji.nl/chat-quest/core/providers"
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+	inst "juraji.nl/chat-quest/model/instructions"
+)
+
+// messageTokenOverhead is an estimate of the tokens used by the chat template per message (role, delimiters).
+const messageTokenOverhead = 4
+
+// contextSafetyMargin is the fraction of the context length that is left unused. Tokens are counted with the cl100k
+// tokenizer for all models, so counts are estimates that can be lower than those of the model's own tokenizer.
+const contextSafetyMargin = 0.1
+
+// contextHistoryPageSize is the number of messages fetched at a time while filling the context with history.
+const contextHistoryPageSize = 50
+
+// ChatContextTrimmed describes the chat history that was left out because it did not fit the model's context window.
+type ChatContextTrimmed struct {
+	ChatSessionID    int `json:"chatSessionId"`
+	ContextLength    int `json:"contextLength"`
+	UsedTokens       int `json:"usedTokens"`
+	IncludedMessages int `json:"includedMessages"`
+	DroppedMessages  int `json:"droppedMessages"`
+}
+
+// fetchHistoryForContext fetches the chat history (in ASC order) to include in the request, optionally only the
+// messages before beforeMessageId. At most maxMessages messages are included.
+// When the context length of the model is known, history is paged back from the newest message until the context
+// length (minus contextSafetyMargin) is used up, while reserving the instruction's MaxTokens for the response.
+// The system prompt, world setup, instruction and any additional messages (like a prefill) are always included,
+// an error is returned when these, or the newest message, do not fit the context on their own.
+// Returns the included history and a non-nil ChatContextTrimmed if older messages were left out to fit the context.
+func fetchHistoryForContext(
+	sessionId int,
+	beforeMessageId *int,
+	contextLength *int,
+	maxMessages int,
+	instruction *inst.Instruction,
+	additionalMessages []prov.ChatRequestMessage,
+) ([]cs.ChatMessage, *ChatContextTrimmed, error) {
+	fetchMessages := func(beforeId *int, limit int) ([]cs.ChatMessage, error) {
+		if beforeId != nil {
+			return cs.GetMessagesInSessionBeforeId(sessionId, *beforeId, limit)
+		}
+		return cs.GetTailChatMessages(sessionId, limit)
+	}
+
+	if contextLength == nil || *contextLength <= 0 {
+		history, err := fetchMessages(beforeMessageId, maxMessages)
+		return history, nil, err
+	}
+
+	// Tokens always used: system prompt, world setup, instruction, additional messages and the response.
+	fixedMessages := append(createChatRequestMessages(nil, instruction), additionalMessages...)
+	fixedTokens, err := countRequestMessageTokens(fixedMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+	fixedTokens += instruction.MaxTokens
+
+	budget := contextTokenBudget(*contextLength)
+	if fixedTokens > budget {
+		return nil, nil, errors.Errorf(
+			"instruction and response tokens (%d) exceed the usable context length of the model (%d of %d)",
+			fixedTokens, budget, *contextLength)
+	}
+
+	countTokens := func(message cs.ChatMessage) (int, error) {
+		return countHistoryMessageTokens(message, instruction)
+	}
+	history, historyTokens, budgetExhausted, err := fitHistoryToBudget(
+		fetchMessages, beforeMessageId, budget-fixedTokens, maxMessages, countTokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !budgetExhausted {
+		return history, nil, nil
+	}
+	if len(history) == 0 {
+		return nil, nil, errors.Errorf(
+			"the newest message does not fit the usable context length of the model (%d of %d) next to the "+
+				"instruction and response", budget, *contextLength)
+	}
+
+	var messageCount int
+	if beforeMessageId != nil {
+		messageCount, err = cs.GetChatSessionMessageCountBeforeId(sessionId, *beforeMessageId)
+	} else {
+		messageCount, err = cs.GetChatSessionMessageCount(sessionId)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trimmed := &ChatContextTrimmed{
+		ChatSessionID:    sessionId,
+		ContextLength:    *contextLength,
+		UsedTokens:       fixedTokens + historyTokens,
+		IncludedMessages: len(history),
+		DroppedMessages:  messageCount - len(history),
+	}
+
+	return history, trimmed, nil
+}
+
+// contextTokenBudget returns the number of tokens of the context length that can be used, leaving the
+// contextSafetyMargin unused.
+func contextTokenBudget(contextLength int) int {
+	return contextLength - int(float64(contextLength)*contextSafetyMargin)
+}
+
+// fitHistoryToBudget pages back through the history from the newest message (before beforeMessageId), fetching
+// contextHistoryPageSize messages at a time, until the next message does not fit the token budget or maxMessages
+// messages are included (when positive).
+// Returns the included history (in ASC order), the tokens it uses and whether messages were left out because
+// they did not fit the budget.
+func fitHistoryToBudget(
+	fetchMessages func(beforeId *int, limit int) ([]cs.ChatMessage, error),
+	beforeMessageId *int,
+	budget int,
+	maxMessages int,
+	countTokens func(message cs.ChatMessage) (int, error),
+) ([]cs.ChatMessage, int, bool, error) {
+	var history []cs.ChatMessage
+	usedTokens := 0
+	cursor := beforeMessageId
+	for {
+		limit := contextHistoryPageSize
+		if maxMessages > 0 {
+			limit = min(limit, maxMessages-len(history))
+		}
+		if limit <= 0 {
+			return history, usedTokens, false, nil
+		}
+
+		page, err := fetchMessages(cursor, limit)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		firstIncluded := len(page)
+		budgetExhausted := false
+		for i := len(page) - 1; i >= 0; i-- {
+			msgTokens, err := countTokens(page[i])
+			if err != nil {
+				return nil, 0, false, err
+			}
+
+			if usedTokens+msgTokens > budget {
+				budgetExhausted = true
+				break
+			}
+
+			usedTokens += msgTokens
+			firstIncluded = i
+		}
+
+		history = append(page[firstIncluded:], history...)
+		if budgetExhausted || len(page) < limit {
+			return history, usedTokens, budgetExhausted, nil
+		}
+		cursor = &page[0].ID
+	}
+}
+
+func countHistoryMessageTokens(message cs.ChatMessage, instruction *inst.Instruction) (int, error) {
+	if message.IsUser {
+		return countRequestMessageTokens([]prov.ChatRequestMessage{{Role: prov.RoleUser, Content: message.Content}})
+	}
+	return countRequestMessageTokens(createAssistantRequestMessages(message, instruction))
+}
+
+func countRequestMessageTokens(messages []prov.ChatRequestMessage) (int, error) {
+	total := 0
+	for _, msg := range messages {
+		count, err := prov.TokenCount(msg.Content)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to count message tokens")
+		}
+		total += count + messageTokenOverhead
+	}
+	return total, nil
+}
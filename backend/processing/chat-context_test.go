@@ -0,0 +1,157 @@
+package processing
+
+import (
+	"slices"
+	"testing"
+
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+)
+
+// testHistory creates count messages with IDs 1 to count, each using tokens as counted by testMessageTokens.
+func testHistory(count int) []cs.ChatMessage {
+	messages := make([]cs.ChatMessage, count)
+	for i := range messages {
+		messages[i] = cs.ChatMessage{ID: i + 1, Content: "0123456789"}
+	}
+	return messages
+}
+
+func testMessageTokens(message cs.ChatMessage) (int, error) {
+	return len(message.Content), nil
+}
+
+// testFetchMessages fetches the newest messages before beforeId from history, like GetMessagesInSessionBeforeId.
+// The requested limits are recorded in limits.
+func testFetchMessages(history []cs.ChatMessage, limits *[]int) func(beforeId *int, limit int) ([]cs.ChatMessage, error) {
+	return func(beforeId *int, limit int) ([]cs.ChatMessage, error) {
+		*limits = append(*limits, limit)
+
+		end := len(history)
+		if beforeId != nil {
+			end = slices.IndexFunc(history, func(m cs.ChatMessage) bool { return m.ID == *beforeId })
+		}
+		return history[max(end-limit, 0):end], nil
+	}
+}
+
+func messageIds(messages []cs.ChatMessage) []int {
+	ids := make([]int, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	return ids
+}
+
+func idRange(from int, to int) []int {
+	var ids []int
+	for id := from; id <= to; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestFitHistoryToBudget(t *testing.T) {
+	beforeId := func(id int) *int { return &id }
+
+	tests := []struct {
+		name            string
+		messages        int
+		beforeMessageId *int
+		budget          int
+		maxMessages     int
+		expectedIds     []int
+		expectedTokens  int
+		expectedTrimmed bool
+		expectedLimits  []int
+	}{
+		{
+			name:     "all messages fit",
+			messages: 5, budget: 1000, maxMessages: 10,
+			expectedIds: idRange(1, 5), expectedTokens: 50,
+			expectedLimits: []int{10},
+		},
+		{
+			name:     "budget leaves out older messages",
+			messages: 5, budget: 35, maxMessages: 10,
+			expectedIds: idRange(3, 5), expectedTokens: 30, expectedTrimmed: true,
+			expectedLimits: []int{10},
+		},
+		{
+			name:     "max messages leave out older messages",
+			messages: 20, budget: 1000, maxMessages: 4,
+			expectedIds: idRange(17, 20), expectedTokens: 40,
+			expectedLimits: []int{4},
+		},
+		{
+			name:     "budget is smaller than max messages",
+			messages: 20, budget: 50, maxMessages: 8,
+			expectedIds: idRange(16, 20), expectedTokens: 50, expectedTrimmed: true,
+			expectedLimits: []int{8},
+		},
+		{
+			name:     "history is paged back",
+			messages: 120, budget: 100_000, maxMessages: 0,
+			expectedIds: idRange(1, 120), expectedTokens: 1200,
+			expectedLimits: []int{contextHistoryPageSize, contextHistoryPageSize, contextHistoryPageSize},
+		},
+		{
+			name:     "max messages limit the last page",
+			messages: 120, budget: 100_000, maxMessages: 70,
+			expectedIds: idRange(51, 120), expectedTokens: 700,
+			expectedLimits: []int{contextHistoryPageSize, 20},
+		},
+		{
+			name:     "budget exhausted in a later page",
+			messages: 120, budget: 600, maxMessages: 0,
+			expectedIds: idRange(61, 120), expectedTokens: 600, expectedTrimmed: true,
+			expectedLimits: []int{contextHistoryPageSize, contextHistoryPageSize},
+		},
+		{
+			name:     "only messages before the target",
+			messages: 10, beforeMessageId: beforeId(8), budget: 1000, maxMessages: 3,
+			expectedIds: idRange(5, 7), expectedTokens: 30,
+			expectedLimits: []int{3},
+		},
+		{
+			name:     "newest message does not fit",
+			messages: 5, budget: 5, maxMessages: 10,
+			expectedIds: []int{}, expectedTokens: 0, expectedTrimmed: true,
+			expectedLimits: []int{10},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var limits []int
+			fetchMessages := testFetchMessages(testHistory(test.messages), &limits)
+
+			history, usedTokens, trimmed, err := fitHistoryToBudget(
+				fetchMessages, test.beforeMessageId, test.budget, test.maxMessages, testMessageTokens)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ids := messageIds(history); !slices.Equal(ids, test.expectedIds) {
+				t.Errorf("expected messages %v, got %v", test.expectedIds, ids)
+			}
+			if usedTokens != test.expectedTokens {
+				t.Errorf("expected %d used tokens, got %d", test.expectedTokens, usedTokens)
+			}
+			if trimmed != test.expectedTrimmed {
+				t.Errorf("expected trimmed %t, got %t", test.expectedTrimmed, trimmed)
+			}
+			if !slices.Equal(limits, test.expectedLimits) {
+				t.Errorf("expected fetch limits %v, got %v", test.expectedLimits, limits)
+			}
+		})
+	}
+}
+
+func TestContextTokenBudget(t *testing.T) {
+	if budget := contextTokenBudget(8192); budget != 7373 {
+		t.Errorf("expected a budget of 7373 tokens for a context of 8192, got %d", budget)
+	}
+	if budget := contextTokenBudget(0); budget != 0 {
+		t.Errorf("expected a budget of 0 tokens for an empty context, got %d", budget)
+	}
+}
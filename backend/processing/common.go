@@ -8,11 +8,9 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core"
 	p "juraji.nl/chat-quest/core/providers"
-	"juraji.nl/chat-quest/core/system"
 	"juraji.nl/chat-quest/core/util"
 	cs "juraji.nl/chat-quest/model/chat-sessions"
 	inst "juraji.nl/chat-quest/model/instructions"
@@ -110,33 +108,7 @@ func createChatRequestMessages(
 				Content: msg.Content,
 			})
 		} else {
-			// Add character ID marker message
-			if instruction.EnableCharacterMarkers {
-				messages = append(messages, p.ChatRequestMessage{
-					Role:    p.RoleSystem,
-					Content: fmt.Sprintf("Character %d responded:", msg.CharacterID),
-				})
-			}
-
-			// Build message
-			var msgBuffer strings.Builder
-
-			// Add reasoning if enabled and available
-			if instruction.IncludeReasoning &&
-				len(msg.Reasoning) > 0 {
-				msgBuffer.WriteString(instruction.ReasoningPrefix)
-				msgBuffer.WriteString(msg.Reasoning)
-				msgBuffer.WriteString(instruction.ReasoningSuffix)
-				msgBuffer.WriteRune('\n')
-			}
-
-			// Add the main content
-			msgBuffer.WriteString(msg.Content)
-
-			messages = append(messages, p.ChatRequestMessage{
-				Role:    p.RoleAssistant,
-				Content: msgBuffer.String(),
-			})
+			messages = append(messages, createAssistantRequestMessages(msg, instruction)...)
 		}
 	}
 
@@ -149,21 +121,38 @@ func createChatRequestMessages(
 	return messages
 }
 
-// setupCancelBySystem returns a new context that will be cancelled upon emit of system.StopCurrentGeneration.
-// It returns the new context and a cleanup function, to be called when the cancellation is not longer needed.
-func setupCancelBySystem(ctx context.Context, logger *zap.Logger, name string) (context.Context, func()) {
-	newCtx, ctxCancelFunc := context.WithCancel(ctx)
-	ctxCancelKey := fmt.Sprintf("%s::%s", name, uuid.New())
-	system.StopCurrentGeneration.AddListener(ctxCancelKey, func(_ context.Context, _ any) error {
-		logger.Info("Canceled by system", zap.String("cancelKey", ctxCancelKey))
-		ctxCancelFunc()
-		return nil
-	})
-	cleanup := func() {
-		system.StopCurrentGeneration.RemoveListener(ctxCancelKey)
+// createAssistantRequestMessages creates the request messages for a character message,
+// including the character marker and reasoning when enabled by the instruction.
+func createAssistantRequestMessages(msg cs.ChatMessage, instruction *inst.Instruction) []p.ChatRequestMessage {
+	messages := make([]p.ChatRequestMessage, 0, 2)
+
+	// Add character ID marker message
+	if instruction.EnableCharacterMarkers {
+		messages = append(messages, p.ChatRequestMessage{
+			Role:    p.RoleSystem,
+			Content: fmt.Sprintf("Character %d responded:", msg.CharacterID),
+		})
+	}
+
+	// Build message
+	var msgBuffer strings.Builder
+
+	// Add reasoning if enabled and available
+	if instruction.IncludeReasoning &&
+		len(msg.Reasoning) > 0 {
+		msgBuffer.WriteString(instruction.ReasoningPrefix)
+		msgBuffer.WriteString(msg.Reasoning)
+		msgBuffer.WriteString(instruction.ReasoningSuffix)
+		msgBuffer.WriteRune('\n')
 	}
 
-	return newCtx, cleanup
+	// Add the main content
+	msgBuffer.WriteString(msg.Content)
+
+	return append(messages, p.ChatRequestMessage{
+		Role:    p.RoleAssistant,
+		Content: msgBuffer.String(),
+	})
 }
 
 // logInstructionsToFile writes instruction details to a text file (per type) in the data directory.
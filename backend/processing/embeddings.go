@@ -2,50 +2,168 @@ package processing
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/jobs"
 	"juraji.nl/chat-quest/core/log"
 	p "juraji.nl/chat-quest/core/providers"
 	m "juraji.nl/chat-quest/model/memories"
 	"juraji.nl/chat-quest/model/preferences"
 )
 
-func RegenerateEmbeddingsOnPrefsUpdate(ctx context.Context, prefs *preferences.Preferences) error {
-	logger := log.Get().With(zap.Intp("embeddingModelId", prefs.EmbeddingModelId))
+// embeddingsBatchSize is the number of memories embedded per provider request when regenerating embeddings.
+const embeddingsBatchSize = 32
+
+// EmbeddingsProgress is emitted while regenerating memory embeddings.
+type EmbeddingsProgress struct {
+	EmbeddingModelId int  `json:"embeddingModelId"`
+	Done             int  `json:"done"`
+	Total            int  `json:"total"`
+	Errors           int  `json:"errors"`
+	Finished         bool `json:"finished"`
+}
+
+// RegenerateEmbeddingsOnPrefsUpdate generates embeddings, in batches, for all memories that have no embedding from
+// the currently configured embedding model. Every batch is stored as it completes, so when the job is retried or
+// restarted it continues with the memories that are left.
+// Memories in batches that fail are retried one by one, those that still fail are counted as errors and fail the job,
+// so they are retried with the next attempt.
+func RegenerateEmbeddingsOnPrefsUpdate(ctx context.Context, _ *preferences.Preferences) error {
+	// Use the current preferences, they may have changed since this job was queued
+	prefs, err := preferences.GetPreferences(true)
+	if err != nil {
+		return errors.Wrap(err, "error getting preferences")
+	}
+	if prefs.EmbeddingModelId == nil {
+		return nil
+	}
+
+	modelId := *prefs.EmbeddingModelId
+	logger := log.Get().With(zap.Int("embeddingModelId", modelId))
 
 	logger.Info("Preferences updated, checking memory embeddings...")
 
-	memories, err := m.GetMemoriesNotMatchingEmbeddingModelId(*prefs.EmbeddingModelId)
+	total, err := m.CountMemoriesNotMatchingEmbeddingModelId(modelId)
 	if err != nil {
-		logger.Error("Error fetching memories to regenerate", zap.Error(err))
-		return errors.Wrap(err, "error fetching memories to regenerate")
+		logger.Error("Error counting memories to regenerate", zap.Error(err))
+		return errors.Wrap(err, "error counting memories to regenerate")
 	}
-	if len(memories) == 0 {
+	if total == 0 {
 		logger.Info("No memories to regenerate")
 		return nil
 	}
 
-	logger.Info("Updating memories...", zap.Int("memoryCount", len(memories)))
-
-	if contextCheckPoint(ctx, logger) {
+	modelInstance, err := p.GetLlmModelInstanceById(modelId)
+	if err != nil {
+		logger.Warn("Error getting embedding model instance", zap.Error(err))
+		return errors.Wrap(err, "error getting embedding model instance")
+	}
+	if modelInstance == nil {
+		logger.Warn("Embedding model does not exist")
 		return nil
 	}
 
-	for _, memory := range memories {
-		err := GenerateEmbeddings(ctx, &memory)
-		if err != nil {
-			return err
-		}
+	logger.Info("Updating memories...", zap.Int("memoryCount", total))
+
+	progress := &EmbeddingsProgress{EmbeddingModelId: modelId, Total: total}
+	EmbeddingsProgressSignal.EmitBG(progress)
+
+	afterId := 0
+	for {
 		if contextCheckPoint(ctx, logger) {
 			return nil
 		}
+
+		batch, err := m.GetMemoriesNotMatchingEmbeddingModelIdAfterId(modelId, afterId, embeddingsBatchSize)
+		if err != nil {
+			logger.Error("Error fetching memories to regenerate", zap.Error(err))
+			return errors.Wrap(err, "error fetching memories to regenerate")
+		}
+		if len(batch) == 0 {
+			break
+		}
+		afterId = batch[len(batch)-1].ID
+
+		embedded, failed := generateEmbeddingsBatch(ctx, logger, modelId, modelInstance, batch)
+		progress = &EmbeddingsProgress{
+			EmbeddingModelId: modelId,
+			Done:             progress.Done + embedded,
+			Total:            max(total, progress.Done+embedded+progress.Errors+failed),
+			Errors:           progress.Errors + failed,
+		}
+		EmbeddingsProgressSignal.EmitBG(progress)
+		jobs.ReportProgress(ctx, float64(progress.Done+progress.Errors)/float64(progress.Total),
+			fmt.Sprintf("Updated embeddings for %d of %d memories (%d errors)",
+				progress.Done, progress.Total, progress.Errors))
+	}
+
+	progress = &EmbeddingsProgress{
+		EmbeddingModelId: modelId,
+		Done:             progress.Done,
+		Total:            progress.Total,
+		Errors:           progress.Errors,
+		Finished:         true,
 	}
+	EmbeddingsProgressSignal.EmitBG(progress)
 
-	logger.Info("Embedding updated")
+	if progress.Errors > 0 {
+		logger.Warn("Embeddings updated with errors",
+			zap.Int("done", progress.Done), zap.Int("errors", progress.Errors))
+		return errors.Errorf("failed to generate embeddings for %d of %d memories", progress.Errors, progress.Total)
+	}
+
+	logger.Info("Embeddings updated", zap.Int("done", progress.Done))
 	return nil
 }
 
+// generateEmbeddingsBatch generates and stores the embeddings of the memories in a single request. When the request
+// fails, each memory is tried on its own. Returns the number of memories embedded and the number that failed.
+func generateEmbeddingsBatch(
+	ctx context.Context,
+	logger *zap.Logger,
+	modelId int,
+	modelInstance *p.LlmModelInstance,
+	memories []m.Memory,
+) (int, int) {
+	inputs := make([]string, len(memories))
+	for idx, memory := range memories {
+		inputs[idx] = memory.Content
+	}
+
+	embeddings, err := p.GenerateEmbeddingsBatch(ctx, modelInstance, inputs)
+	if err != nil {
+		if len(memories) == 1 {
+			logger.Error("Error generating embeddings",
+				zap.Int("memoryId", memories[0].ID), zap.Error(err))
+			return 0, 1
+		}
+
+		logger.Warn("Error generating embeddings for batch, retrying memories one by one",
+			zap.Int("batchSize", len(memories)), zap.Error(err))
+		var embedded, failed int
+		for _, memory := range memories {
+			e, f := generateEmbeddingsBatch(ctx, logger, modelId, modelInstance, []m.Memory{memory})
+			embedded += e
+			failed += f
+		}
+		return embedded, failed
+	}
+
+	var embedded, failed int
+	for idx, memory := range memories {
+		err = m.SetMemoryEmbedding(memory.ID, embeddings[idx], modelId)
+		if err != nil {
+			logger.Error("Error setting memory embeddings", zap.Int("memoryId", memory.ID), zap.Error(err))
+			failed++
+		} else {
+			embedded++
+		}
+	}
+	return embedded, failed
+}
+
 func GenerateEmbeddings(ctx context.Context, memory *m.Memory) error {
 	if memory == nil {
 		return nil
@@ -75,7 +193,7 @@ func GenerateEmbeddings(ctx context.Context, memory *m.Memory) error {
 		return errors.Wrap(err, "error getting embedding model instance")
 	}
 
-	embeddings, err := p.GenerateEmbeddings(modelInstance, memoryContent)
+	embeddings, err := p.GenerateEmbeddings(ctx, modelInstance, memoryContent)
 	if err != nil {
 		logger.Error("Error generating embeddings", zap.Error(err))
 		return errors.Wrap(err, "error generating embeddings")
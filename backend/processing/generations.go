@@ -0,0 +1,195 @@
+package processing
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/system"
+)
+
+// Generation describes an in-flight LLM generation, which can be canceled individually.
+type Generation struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// ChatSessionID is the session this generation is running for, nil for generations outside sessions.
+	ChatSessionID *int `json:"chatSessionId"`
+	// MessageID is the message currently being written by this generation (if any).
+	MessageID *int      `json:"messageId"`
+	StartedAt time.Time `json:"startedAt"`
+
+	cancel context.CancelFunc
+}
+
+type generationContextKey struct{}
+
+var (
+	activeGenerations   = make(map[string]*Generation)
+	activeGenerationsMu sync.Mutex
+)
+
+func init() {
+	// The global stop cancels all generations
+	system.StopCurrentGeneration.AddListener("CancelAllGenerations", func(_ context.Context, _ any) error {
+		CancelAllGenerations()
+		return nil
+	})
+}
+
+// registerGeneration returns a new context that is canceled when the generation is canceled by ID, by session or by
+// the global stop. Use a sessionId of 0 for generations not bound to a chat session.
+// It returns the new context and a cleanup function, to be called when the generation has ended.
+func registerGeneration(
+	ctx context.Context,
+	logger *zap.Logger,
+	name string,
+	sessionId int,
+) (context.Context, func()) {
+	generation := &Generation{
+		ID:        uuid.New().String(),
+		Name:      name,
+		StartedAt: time.Now(),
+	}
+	if sessionId != 0 {
+		generation.ChatSessionID = &sessionId
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, generationContextKey{}, generation.ID))
+	generation.cancel = func() {
+		logger.Info("Generation canceled", zap.String("generationId", generation.ID))
+		cancel()
+	}
+
+	activeGenerationsMu.Lock()
+	activeGenerations[generation.ID] = generation
+	snapshot := *generation
+	activeGenerationsMu.Unlock()
+
+	GenerationStartedSignal.EmitBG(&snapshot)
+
+	cleanup := func() {
+		activeGenerationsMu.Lock()
+		delete(activeGenerations, generation.ID)
+		activeGenerationsMu.Unlock()
+
+		cancel()
+		GenerationEndedSignal.EmitBG(generation.ID)
+	}
+
+	return ctx, cleanup
+}
+
+// setGenerationMessage records the message the generation in ctx is currently writing.
+func setGenerationMessage(ctx context.Context, messageId int) {
+	generationId, ok := ctx.Value(generationContextKey{}).(string)
+	if !ok {
+		return
+	}
+
+	activeGenerationsMu.Lock()
+	generation, exists := activeGenerations[generationId]
+	if !exists {
+		activeGenerationsMu.Unlock()
+		return
+	}
+	generation.MessageID = &messageId
+	snapshot := *generation
+	activeGenerationsMu.Unlock()
+
+	GenerationUpdatedSignal.EmitBG(&snapshot)
+}
+
+// GetActiveGenerations returns all in-flight generations, ordered by start time.
+// When sessionId is not 0, only generations for that session are returned.
+func GetActiveGenerations(sessionId int) []Generation {
+	activeGenerationsMu.Lock()
+	defer activeGenerationsMu.Unlock()
+
+	generations := make([]Generation, 0, len(activeGenerations))
+	for _, generation := range activeGenerations {
+		if sessionId == 0 || (generation.ChatSessionID != nil && *generation.ChatSessionID == sessionId) {
+			generations = append(generations, *generation)
+		}
+	}
+
+	slices.SortFunc(generations, func(a, b Generation) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return generations
+}
+
+// CancelGeneration cancels a single generation, returns false if no generation with the given ID is running.
+func CancelGeneration(generationId string) bool {
+	activeGenerationsMu.Lock()
+	generation, exists := activeGenerations[generationId]
+	activeGenerationsMu.Unlock()
+
+	if exists {
+		generation.cancel()
+	}
+
+	return exists
+}
+
+// CancelSessionGenerations cancels all generations in the given session and returns the number of canceled
+// generations.
+func CancelSessionGenerations(sessionId int) int {
+	return cancelGenerationsWhere(func(g *Generation) bool {
+		return g.ChatSessionID != nil && *g.ChatSessionID == sessionId
+	})
+}
+
+// CancelAllGenerations cancels all in-flight generations and returns the number of canceled generations.
+func CancelAllGenerations() int {
+	return cancelGenerationsWhere(func(_ *Generation) bool {
+		return true
+	})
+}
+
+// CancelAllGenerationsAndWait cancels all in-flight generations and waits for them to end, or until ctx is done.
+func CancelAllGenerationsAndWait(ctx context.Context) error {
+	CancelAllGenerations()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		activeGenerationsMu.Lock()
+		active := len(activeGenerations)
+		activeGenerationsMu.Unlock()
+		if active == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "generations are still running")
+		case <-ticker.C:
+		}
+	}
+}
+
+func cancelGenerationsWhere(predicate func(g *Generation) bool) int {
+	activeGenerationsMu.Lock()
+	var toCancel []*Generation
+	for _, generation := range activeGenerations {
+		if predicate(generation) {
+			toCancel = append(toCancel, generation)
+		}
+	}
+	activeGenerationsMu.Unlock()
+
+	for _, generation := range toCancel {
+		generation.cancel()
+	}
+
+	return len(toCancel)
+}
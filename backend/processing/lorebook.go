@@ -0,0 +1,94 @@
+package processing
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	prov "juraji.nl/chat-quest/core/providers"
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+	lb "juraji.nl/chat-quest/model/lorebook"
+)
+
+// lorebookMaxRecursion limits how many times activated entries are scanned for keywords of other entries.
+const lorebookMaxRecursion = 3
+
+// activateLorebookEntries selects the entries activated by the given messages.
+// Entries are activated when their keywords match the message contents, after which the contents of activated entries
+// are scanned for other entries (up to lorebookMaxRecursion levels deep). Always included entries are scanned along
+// with the messages.
+// Activated entries are included in order of priority until tokenBudget is used up, where each entry's content is
+// truncated to its own token budget. A tokenBudget of 0 (or less) means unlimited.
+func activateLorebookEntries(
+	entries []lb.LorebookEntry,
+	messages []cs.ChatMessage,
+	tokenBudget int,
+) ([]lb.LorebookEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	scanTexts := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		scanTexts = append(scanTexts, msg.Content)
+	}
+
+	activated := make([]bool, len(entries))
+	matchers := make([]*lb.KeywordMatcher, len(entries))
+	for i := range entries {
+		if entries[i].AlwaysInclude {
+			activated[i] = true
+			scanTexts = append(scanTexts, entries[i].Content)
+		} else {
+			matchers[i] = entries[i].Matcher()
+		}
+	}
+
+	for depth := 0; depth <= lorebookMaxRecursion && len(scanTexts) > 0; depth++ {
+		scanText := strings.Join(scanTexts, "\n")
+		scanTexts = nil
+
+		for i := range entries {
+			if !activated[i] && matchers[i].Matches(scanText) {
+				activated[i] = true
+				scanTexts = append(scanTexts, entries[i].Content)
+			}
+		}
+	}
+
+	var result []lb.LorebookEntry
+	for i := range entries {
+		if activated[i] {
+			result = append(result, entries[i])
+		}
+	}
+	slices.SortStableFunc(result, func(a, b lb.LorebookEntry) int {
+		return b.Priority - a.Priority
+	})
+
+	usedTokens := 0
+	included := result[:0]
+	for _, entry := range result {
+		if entry.TokenBudget != nil && *entry.TokenBudget > 0 {
+			content, err := prov.TruncateToTokens(entry.Content, *entry.TokenBudget)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to truncate lorebook entry")
+			}
+			entry.Content = content
+		}
+
+		entryTokens, err := prov.TokenCount(entry.Content)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to count lorebook entry tokens")
+		}
+		if tokenBudget > 0 && usedTokens+entryTokens > tokenBudget {
+			// Skip, a lower priority entry might still fit
+			continue
+		}
+
+		usedTokens += entryTokens
+		included = append(included, entry)
+	}
+
+	return included, nil
+}
@@ -27,7 +27,8 @@ const memoriesResponseFormat = `{
         "required": ["characterId","content"],
         "properties": {
           "characterId": {"type": "number"},
-          "content": {"type": "string"}
+          "content": {"type": "string"},
+          "importance": {"type": "number", "minimum": 0, "maximum": 1}
         }
       }
     }
@@ -78,6 +79,83 @@ func UpdateBookmarkOnMemoryGenEnable(_ context.Context, e *cs.ChatSessionUpdated
 	return nil
 }
 
+// UpdateMemoriesOnMessagesDeleted deletes the memories generated from deleted messages, when set in the preferences.
+// To regenerate them, the memory bookmark is moved back to before the first message they were generated from.
+func UpdateMemoriesOnMessagesDeleted(ctx context.Context, e *cs.ChatMessagesDeletedFromEvent) error {
+	logger := log.Get().With(
+		zap.Int("chatSessionId", e.ChatSessionID),
+		zap.Int("fromMessageId", e.FromMessageID))
+
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		logger.Error("Error getting preferences", zap.Error(err))
+		return errors.Wrap(err, "error getting preferences")
+	}
+	if prefs.MemoryOnMessagesDeleted == pf.KeepMemories {
+		return nil
+	}
+
+	unlock := memoryGenLocks.Lock(e.ChatSessionID)
+	defer unlock()
+
+	memories, err := m.GetMemoriesDerivedFromMessages(e.ChatSessionID, e.FromMessageID)
+	if err != nil {
+		logger.Error("Error fetching memories of deleted messages", zap.Error(err))
+		return errors.Wrap(err, "error fetching memories of deleted messages")
+	}
+	if len(memories) == 0 {
+		return nil
+	}
+
+	firstSourceId := e.FromMessageID
+	memoryIds := make([]int, len(memories))
+	for idx, memory := range memories {
+		memoryIds[idx] = memory.ID
+		if memory.SourceFromMessageId != nil {
+			firstSourceId = min(firstSourceId, *memory.SourceFromMessageId)
+		}
+	}
+
+	if err = m.DeleteMemories(memoryIds); err != nil {
+		logger.Error("Error deleting memories of deleted messages", zap.Error(err))
+		return errors.Wrap(err, "error deleting memories of deleted messages")
+	}
+
+	logger.Info("Deleted memories of deleted messages", zap.Int("memoryCount", len(memoryIds)))
+
+	if prefs.MemoryOnMessagesDeleted != pf.RegenerateMemories {
+		return nil
+	}
+
+	bookmark, err := m.GetMemoryBookmark(e.ChatSessionID)
+	if err != nil {
+		logger.Error("Error getting message bookmark", zap.Error(err))
+		return errors.Wrap(err, "error getting message bookmark")
+	}
+	if bookmark == nil || *bookmark < firstSourceId {
+		// Memories were generated manually, or the remaining messages are not processed yet anyway
+		return nil
+	}
+
+	// Messages after the bookmark are picked up by the next memory generation
+	if err = m.SetMemoryBookmark(e.ChatSessionID, firstSourceId-1); err != nil {
+		logger.Error("Error setting message bookmark", zap.Error(err))
+		return errors.Wrap(err, "error setting message bookmark")
+	}
+
+	tail, err := cs.GetTailChatMessages(e.ChatSessionID, 1)
+	if err != nil {
+		logger.Error("Error getting last chat message", zap.Error(err))
+		return errors.Wrap(err, "error getting last chat message")
+	}
+	if len(tail) == 0 {
+		return nil
+	}
+
+	logger.Info("Regenerating memories from remaining messages", zap.Int("afterMessageId", firstSourceId-1))
+	return memoriesJob.Enqueue(&tail[0], memoriesJobKey(e.ChatSessionID))
+}
+
 func GenerateMemoriesForMessageID(
 	ctx context.Context,
 	messageId int,
@@ -99,7 +177,7 @@ func GenerateMemoriesForMessageID(
 	logger.Info("Generating memories for specific message...")
 
 	// Cancellation
-	ctx, cleanup := setupCancelBySystem(ctx, logger, "GenerateMemories")
+	ctx, cleanup := registerGeneration(ctx, logger, "GenerateMemories", message.ChatSessionID)
 	defer cleanup()
 
 	sessionID := message.ChatSessionID
@@ -188,7 +266,7 @@ func GenerateMemories(
 	}
 
 	// Cancellation
-	ctx, cleanup := setupCancelBySystem(ctx, logger, "GenerateMemories")
+	ctx, cleanup := registerGeneration(ctx, logger, "GenerateMemories", sessionID)
 	defer cleanup()
 
 	var messageWindow []cs.ChatMessage
@@ -322,6 +400,9 @@ responseLoop:
 		return nil, errors.Wrap(err, "could not unmarshal memory response")
 	}
 
+	sourceFromId := messageWindow[0].ID
+	sourceToId := messageWindow[len(messageWindow)-1].ID
+
 	var memories []*m.Memory
 	for _, memory := range container.Memories {
 		memory.Content = strings.TrimSpace(memory.Content)
@@ -330,6 +411,14 @@ responseLoop:
 		if len(memory.Content) == 0 {
 			continue
 		}
+		if memory.Importance <= 0 || memory.Importance > 1 {
+			// Not given or out of range
+			memory.Importance = m.DefaultImportance
+		}
+
+		memory.SourceChatSessionId = &session.ID
+		memory.SourceFromMessageId = &sourceFromId
+		memory.SourceToMessageId = &sourceToId
 
 		memories = append(memories, memory)
 	}
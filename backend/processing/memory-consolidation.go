@@ -0,0 +1,375 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/jobs"
+	"juraji.nl/chat-quest/core/log"
+	p "juraji.nl/chat-quest/core/providers"
+	c "juraji.nl/chat-quest/model/characters"
+	i "juraji.nl/chat-quest/model/instructions"
+	m "juraji.nl/chat-quest/model/memories"
+	pf "juraji.nl/chat-quest/model/preferences"
+	w "juraji.nl/chat-quest/model/worlds"
+)
+
+const memoryConsolidationResponseFormat = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["memories"],
+  "properties": {
+    "memories": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["content"],
+        "properties": {
+          "content": {"type": "string"},
+          "importance": {"type": "number", "minimum": 0, "maximum": 1}
+        }
+      }
+    }
+  }
+}`
+
+const (
+	// consolidationMaxClusterSize limits the memories merged by a single LLM call.
+	consolidationMaxClusterSize = 8
+	// consolidationMaxClustersPerRun limits the LLM calls per run, the remaining clusters are picked up by the next run.
+	consolidationMaxClustersPerRun = 20
+	// consolidationSchedulerInterval is the interval at which worlds due for consolidation are checked.
+	consolidationSchedulerInterval = 15 * time.Minute
+)
+
+type MemoryConsolidationRequest struct {
+	WorldID int `json:"worldId"`
+}
+
+// OpenAI requires an object type root.
+type consolidatedMemoriesContainer struct {
+	Memories []m.ProposedMemory
+}
+
+// EnqueueMemoryConsolidation schedules a consolidation run for the world.
+func EnqueueMemoryConsolidation(worldId int) error {
+	request := &MemoryConsolidationRequest{WorldID: worldId}
+	return memoryConsolidationJob.Enqueue(request, fmt.Sprintf("memory-consolidation:%d", worldId))
+}
+
+// ConsolidateWorldMemories clusters similar memories of each character (and the world memories) in the world and
+// asks the LLM to merge each cluster into canonical memories. The results replace the pending proposals of the world,
+// or are applied directly when auto apply is enabled.
+func ConsolidateWorldMemories(ctx context.Context, request *MemoryConsolidationRequest) error {
+	logger := log.Get().With(zap.Int("worldId", request.WorldID))
+
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		logger.Error("Error getting preferences", zap.Error(err))
+		return errors.Wrap(err, "error getting preferences")
+	}
+	if !prefs.MemoryConsolidationEnabled() || prefs.EmbeddingModelId == nil {
+		logger.Debug("Memory consolidation is not configured, skipping")
+		return nil
+	}
+
+	// Cancellation
+	ctx, cleanup := registerGeneration(ctx, logger, "ConsolidateWorldMemories", 0)
+	defer cleanup()
+
+	world, err := w.WorldById(request.WorldID)
+	if err != nil {
+		logger.Error("Error fetching world", zap.Error(err))
+		return errors.Wrap(err, "error fetching world")
+	}
+	if world == nil {
+		// World was deleted in the meantime
+		return nil
+	}
+
+	if err = m.SetConsolidationRun(world.ID); err != nil {
+		logger.Error("Error registering consolidation run", zap.Error(err))
+		return errors.Wrap(err, "error registering consolidation run")
+	}
+
+	memories, err := m.GetMemoriesByWorldIdWithEmbeddings(world.ID, *prefs.EmbeddingModelId)
+	if err != nil {
+		logger.Error("Error fetching memories", zap.Error(err))
+		return errors.Wrap(err, "error fetching memories")
+	}
+
+	clusters := clusterMemories(memories, prefs.MemoryConsolidationThreshold)
+	if len(clusters) == 0 {
+		logger.Info("No similar memories to consolidate")
+		return m.ReplaceConsolidationProposals(world.ID, nil)
+	}
+	if len(clusters) > consolidationMaxClustersPerRun {
+		clusters = clusters[:consolidationMaxClustersPerRun]
+	}
+
+	logger.Info("Consolidating memories...", zap.Int("clusters", len(clusters)))
+
+	var proposals []m.ConsolidationProposal
+	for idx, cluster := range clusters {
+		if contextCheckPoint(ctx, logger) {
+			return nil
+		}
+
+		consolidated, err := consolidateMemoryCluster(ctx, logger, world, prefs, cluster)
+		if err != nil {
+			return err
+		}
+
+		if len(consolidated) > 0 {
+			proposal := m.ConsolidationProposal{
+				WorldId:     world.ID,
+				CharacterId: cluster[0].CharacterId,
+				Memories:    consolidated,
+			}
+			for _, memory := range cluster {
+				proposal.SourceMemoryIds = append(proposal.SourceMemoryIds, memory.ID)
+			}
+			proposals = append(proposals, proposal)
+		}
+
+		jobs.ReportProgress(ctx, float64(idx+1)/float64(len(clusters)),
+			fmt.Sprintf("Consolidated %d of %d memory clusters", idx+1, len(clusters)))
+	}
+
+	if contextCheckPoint(ctx, logger) {
+		return nil
+	}
+
+	if err = m.ReplaceConsolidationProposals(world.ID, proposals); err != nil {
+		logger.Error("Error saving consolidation proposals", zap.Error(err))
+		return errors.Wrap(err, "error saving consolidation proposals")
+	}
+
+	if !prefs.MemoryConsolidationAutoApply {
+		logger.Info("Memory consolidation proposals created", zap.Int("proposals", len(proposals)))
+		return nil
+	}
+
+	for _, proposal := range proposals {
+		if _, err = ApplyConsolidationProposal(&proposal); err != nil {
+			// Sources might have been changed in the meantime, keep the proposal for review
+			logger.Warn("Could not apply consolidation proposal",
+				zap.Int("proposalId", proposal.ID), zap.Error(err))
+		}
+	}
+
+	logger.Info("Memory consolidation applied", zap.Int("proposals", len(proposals)))
+	return nil
+}
+
+// ApplyConsolidationProposal replaces the source memories of the proposal by its consolidated memories.
+func ApplyConsolidationProposal(proposal *m.ConsolidationProposal) ([]*m.Memory, error) {
+	sources, err := m.GetMemoriesByIds(proposal.SourceMemoryIds)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching source memories")
+	}
+
+	return m.ApplyConsolidationProposal(proposal, sources)
+}
+
+// clusterMemories groups memories of the same character by similarity. Each memory that is not part of a cluster yet
+// starts a new cluster, collecting the following memories whose similarity to it is at least threshold.
+// Only clusters of two or more memories are returned.
+func clusterMemories(memories []m.Memory, threshold float64) [][]m.Memory {
+	var clusters [][]m.Memory
+	clustered := make([]bool, len(memories))
+
+	// Quantized embeddings are cheaper to compare. Quantizing embeddings stored as int8 gives back the stored values, so
+	// there is no loss of precision, embeddings still stored as float32 lose a little.
+	similarity := func(a int, b int) float64 {
+		return memories[a].Embedding.CosineSimilarity(memories[b].Embedding)
+	}
+	if core.Env().QuantizeEmbeddings {
+		quantized := make([]p.QuantizedEmbedding, len(memories))
+		for idx, memory := range memories {
+			quantized[idx] = memory.Embedding.Quantize()
+		}
+		similarity = func(a int, b int) float64 {
+			return quantized[a].CosineSimilarity(quantized[b])
+		}
+	}
+
+	for leaderIdx, leader := range memories {
+		if clustered[leaderIdx] {
+			continue
+		}
+
+		cluster := []m.Memory{leader}
+		for idx := leaderIdx + 1; idx < len(memories) && len(cluster) < consolidationMaxClusterSize; idx++ {
+			candidate := memories[idx]
+			if clustered[idx] || !sameCharacter(leader.CharacterId, candidate.CharacterId) {
+				continue
+			}
+			if similarity(leaderIdx, idx) >= threshold {
+				cluster = append(cluster, candidate)
+				clustered[idx] = true
+			}
+		}
+
+		if len(cluster) > 1 {
+			clustered[leaderIdx] = true
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	return clusters
+}
+
+func sameCharacter(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func consolidateMemoryCluster(
+	ctx context.Context,
+	logger *zap.Logger,
+	world *w.World,
+	prefs *pf.Preferences,
+	cluster []m.Memory,
+) ([]m.ProposedMemory, error) {
+	var character *c.Character
+	if characterId := cluster[0].CharacterId; characterId != nil {
+		var err error
+		if character, err = c.CharacterById(*characterId); err != nil {
+			logger.Error("Error fetching character", zap.Error(err))
+			return nil, errors.Wrap(err, "error fetching character")
+		}
+	}
+
+	instruction, err := i.InstructionById(*prefs.MemoryConsolidationInstructionId)
+	if err != nil {
+		logger.Error("Could not fetch memory consolidation instruction", zap.Error(err))
+		return nil, errors.Wrap(err, "could not fetch memory consolidation instruction")
+	}
+	modelInstance, err := p.GetLlmModelInstanceById(*prefs.MemoryConsolidationModelId)
+	if err != nil {
+		logger.Error("Could not fetch memory consolidation model", zap.Error(err))
+		return nil, errors.Wrap(err, "could not fetch memory consolidation model")
+	}
+
+	contents := make([]string, len(cluster))
+	maxImportance := 0.0
+	for idx, memory := range cluster {
+		contents[idx] = memory.Content
+		maxImportance = max(maxImportance, memory.Importance)
+	}
+
+	templateVars := NewMemoryConsolidationVars(world, character, contents)
+	if err = instruction.ApplyTemplates(templateVars); err != nil {
+		logger.Error("Error applying instruction templates", zap.Error(err))
+		return nil, errors.Wrap(err, "error applying instruction templates")
+	}
+
+	logInstructionsToFile(logger, instruction, nil)
+
+	requestMessages := createChatRequestMessages(nil, instruction)
+	llmParameters := instruction.AsLlmParameters()
+	llmParameters.ResponseFormat = new(memoryConsolidationResponseFormat)
+
+	chatResponseChan := p.GenerateChatResponse(ctx, modelInstance, requestMessages, llmParameters)
+	var rawResponse strings.Builder
+
+responseLoop:
+	for {
+		select {
+		case r, hasNext := <-chatResponseChan:
+			if r.Error != nil {
+				logger.Error("Error in response",
+					zap.String("generated", rawResponse.String()),
+					zap.Error(r.Error))
+				return nil, errors.Wrap(r.Error, "error in response")
+			}
+
+			rawResponse.WriteString(r.Content)
+			if !hasNext {
+				break responseLoop
+			}
+		case <-ctx.Done():
+			logger.Debug("Canceled by context")
+			return nil, nil
+		}
+	}
+
+	var container consolidatedMemoriesContainer
+	if err = json.Unmarshal([]byte(rawResponse.String()), &container); err != nil {
+		logger.Error("Could not unmarshal memory consolidation response",
+			zap.String("response", rawResponse.String()),
+			zap.Error(err))
+		return nil, errors.Wrap(err, "could not unmarshal memory consolidation response")
+	}
+
+	var consolidated []m.ProposedMemory
+	for _, memory := range container.Memories {
+		memory.Content = strings.TrimSpace(strings.ReplaceAll(memory.Content, "*", ""))
+		if len(memory.Content) == 0 {
+			continue
+		}
+		if memory.Importance <= 0 || memory.Importance > 1 {
+			// Not given or out of range
+			memory.Importance = maxImportance
+		}
+		consolidated = append(consolidated, memory)
+	}
+
+	if len(consolidated) >= len(cluster) {
+		// Nothing was merged
+		logger.Debug("Memory cluster could not be consolidated", zap.Int("clusterSize", len(cluster)))
+		return nil, nil
+	}
+
+	return consolidated, nil
+}
+
+// StartMemoryConsolidationScheduler periodically enqueues consolidation runs for worlds that were not consolidated
+// within the interval set in the preferences.
+func StartMemoryConsolidationScheduler(ctx context.Context) {
+	logger := log.Get().With(zap.String("source", "MemoryConsolidation"))
+
+	go func() {
+		ticker := time.NewTicker(consolidationSchedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			prefs, err := pf.GetPreferences(false)
+			if err != nil {
+				logger.Error("Error getting preferences", zap.Error(err))
+				continue
+			}
+			if !prefs.MemoryConsolidationEnabled() || prefs.MemoryConsolidationIntervalHours <= 0 {
+				continue
+			}
+
+			interval := time.Duration(prefs.MemoryConsolidationIntervalHours) * time.Hour
+			worldIds, err := m.GetWorldIdsDueForConsolidation(interval)
+			if err != nil {
+				logger.Error("Error fetching worlds due for consolidation", zap.Error(err))
+				continue
+			}
+
+			for _, worldId := range worldIds {
+				if err = EnqueueMemoryConsolidation(worldId); err != nil {
+					logger.Error("Error enqueueing memory consolidation", zap.Int("worldId", worldId), zap.Error(err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,132 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	p "juraji.nl/chat-quest/core/providers"
+	c "juraji.nl/chat-quest/model/characters"
+	m "juraji.nl/chat-quest/model/memories"
+)
+
+type MemoryTransferFormat string
+
+const (
+	MemoryFormatJSON  MemoryTransferFormat = "json"
+	MemoryFormatJSONL MemoryTransferFormat = "jsonl"
+)
+
+func (f MemoryTransferFormat) IsValid() bool {
+	return f == MemoryFormatJSON || f == MemoryFormatJSONL
+}
+
+func (f MemoryTransferFormat) ContentType() string {
+	if f == MemoryFormatJSONL {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// MemoryRecord is the portable form of a memory. Characters are referred to by name, as IDs differ between
+// installations. Embeddings are only usable when generated by a model with the same EmbeddingModel identifier.
+type MemoryRecord struct {
+	CharacterName  *string     `json:"characterName"`
+	CreatedAt      *time.Time  `json:"createdAt"`
+	Content        string      `json:"content"`
+	AlwaysInclude  bool        `json:"alwaysInclude"`
+	Importance     float64     `json:"importance"`
+	Embedding      p.Embedding `json:"embedding,omitempty"`
+	EmbeddingModel *string     `json:"embeddingModel,omitempty"`
+}
+
+// ExportMemories writes the memories of the world, or only those of the character when characterId is given,
+// as a JSON array or as JSON lines.
+func ExportMemories(
+	worldId int,
+	characterId *int,
+	format MemoryTransferFormat,
+	includeEmbeddings bool,
+) ([]byte, error) {
+	memories, err := m.GetMemoriesForExport(worldId, characterId)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching memories")
+	}
+
+	characterNames, err := characterNamesById()
+	if err != nil {
+		return nil, err
+	}
+
+	// Embedding model identifiers by LLM model ID
+	embeddingModels := make(map[int]*string)
+
+	records := make([]MemoryRecord, len(memories))
+	for idx, memory := range memories {
+		record := MemoryRecord{
+			CreatedAt:     memory.CreatedAt,
+			Content:       memory.Content,
+			AlwaysInclude: memory.AlwaysInclude,
+			Importance:    memory.Importance,
+		}
+		if memory.CharacterId != nil {
+			record.CharacterName = new(characterNames[*memory.CharacterId])
+		}
+
+		if includeEmbeddings && len(memory.Embedding) > 0 && memory.EmbeddingModelId != nil {
+			modelName, ok := embeddingModels[*memory.EmbeddingModelId]
+			if !ok {
+				instance, err := p.GetLlmModelInstanceById(*memory.EmbeddingModelId)
+				if err != nil {
+					return nil, errors.Wrap(err, "error fetching embedding model")
+				}
+				if instance != nil {
+					modelName = &instance.ModelId
+				}
+				embeddingModels[*memory.EmbeddingModelId] = modelName
+			}
+
+			if modelName != nil {
+				record.Embedding = memory.Embedding
+				record.EmbeddingModel = modelName
+			}
+		}
+
+		records[idx] = record
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	switch format {
+	case MemoryFormatJSON:
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(records)
+	case MemoryFormatJSONL:
+		for _, record := range records {
+			if err = encoder.Encode(record); err != nil {
+				break
+			}
+		}
+	default:
+		err = errors.Errorf("unknown memory format '%s'", format)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error writing memories")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func characterNamesById() (map[int]string, error) {
+	characters, err := c.AllCharacters()
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching characters")
+	}
+
+	names := make(map[int]string, len(characters))
+	for _, character := range characters {
+		names[character.ID] = character.Name
+	}
+	return names, nil
+}
@@ -0,0 +1,266 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/log"
+	p "juraji.nl/chat-quest/core/providers"
+	c "juraji.nl/chat-quest/model/characters"
+	m "juraji.nl/chat-quest/model/memories"
+	pf "juraji.nl/chat-quest/model/preferences"
+)
+
+// MemoryImportConflict decides what happens to an imported memory when the world already has a memory with the same
+// content for the same character.
+type MemoryImportConflict string
+
+const (
+	MemoryConflictSkip      MemoryImportConflict = "SKIP"
+	MemoryConflictReplace   MemoryImportConflict = "REPLACE"
+	MemoryConflictDuplicate MemoryImportConflict = "DUPLICATE"
+)
+
+func (mc MemoryImportConflict) IsValid() bool {
+	switch mc {
+	case MemoryConflictSkip, MemoryConflictReplace, MemoryConflictDuplicate:
+		return true
+	default:
+		return false
+	}
+}
+
+type MemoryImportResult struct {
+	Imported         int `json:"imported"`
+	Replaced         int `json:"replaced"`
+	Skipped          int `json:"skipped"`
+	EmbeddingsQueued int `json:"embeddingsQueued"`
+}
+
+// ParseMemoryRecords reads memory records from a JSON array or JSON lines. When format is empty, it is detected from
+// the data.
+func ParseMemoryRecords(data []byte, format MemoryTransferFormat) ([]MemoryRecord, error) {
+	data = bytes.TrimSpace(data)
+	if format == "" {
+		if bytes.HasPrefix(data, []byte("[")) {
+			format = MemoryFormatJSON
+		} else {
+			format = MemoryFormatJSONL
+		}
+	}
+
+	var records []MemoryRecord
+	switch format {
+	case MemoryFormatJSON:
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, errors.Wrap(err, "invalid memories JSON")
+		}
+	case MemoryFormatJSONL:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		// Lines with embeddings easily exceed the default token size
+		scanner.Buffer(nil, len(data)+1)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var record MemoryRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return nil, errors.Wrapf(err, "invalid memory on line %d", lineNo)
+			}
+			records = append(records, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err, "error reading memory lines")
+		}
+	default:
+		return nil, errors.Errorf("unknown memory format '%s'", format)
+	}
+
+	return records, nil
+}
+
+// ImportMemories adds the records to the world.
+//   - Characters are matched by name. When characterId is given, all records are assigned to that character instead.
+//     Records for characters that do not exist are skipped.
+//   - A record conflicts with an existing memory of the same character with the same content, conflict decides
+//     whether it is skipped, replaces the existing memory or is added as duplicate.
+//   - Embeddings are kept when they were generated by the currently configured embedding model and match the
+//     dimension of its other embeddings. Otherwise, the memory is queued for embedding generation.
+//   - The import is applied as a whole, or not at all when it fails.
+func ImportMemories(
+	worldId int,
+	records []MemoryRecord,
+	conflict MemoryImportConflict,
+	characterId *int,
+) (*MemoryImportResult, error) {
+	logger := log.Get().With(zap.Int("worldId", worldId))
+	logger.Info("Importing memories...", zap.Int("records", len(records)))
+
+	characterIds, err := characterIdsByName()
+	if err != nil {
+		return nil, err
+	}
+
+	embeddingModelId, embeddingModelName, err := currentEmbeddingModel()
+	if err != nil {
+		return nil, err
+	}
+	var embeddingDimension int
+	if embeddingModelId != nil {
+		embeddingDimension, err = m.GetEmbeddingDimension(*embeddingModelId)
+		if err != nil {
+			return nil, errors.Wrap(err, "error fetching embedding dimension")
+		}
+	}
+
+	existing, err := m.GetMemoriesByWorldId(worldId)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching existing memories")
+	}
+	existingIds := make(map[string]int, len(existing))
+	for _, memory := range existing {
+		existingIds[memoryConflictKey(memory.CharacterId, memory.Content)] = memory.ID
+	}
+
+	result := &MemoryImportResult{}
+	var imported []*m.Memory
+	var replacedIds []int
+	// Index in imported by conflict key, records in the same file conflict with each other too
+	importedIdx := make(map[string]int)
+	for _, record := range records {
+		memory := &m.Memory{
+			CreatedAt:     record.CreatedAt,
+			Content:       strings.TrimSpace(record.Content),
+			AlwaysInclude: record.AlwaysInclude,
+			Importance:    record.Importance,
+		}
+		if len(memory.Content) == 0 {
+			result.Skipped++
+			continue
+		}
+
+		switch {
+		case characterId != nil:
+			memory.CharacterId = characterId
+		case record.CharacterName != nil:
+			id, ok := characterIds[strings.ToLower(*record.CharacterName)]
+			if !ok {
+				logger.Debug("Skipping memory for unknown character", zap.String("characterName", *record.CharacterName))
+				result.Skipped++
+				continue
+			}
+			memory.CharacterId = &id
+		}
+
+		key := memoryConflictKey(memory.CharacterId, memory.Content)
+		existingId, conflictsExisting := existingIds[key]
+		idx, conflictsImported := importedIdx[key]
+		if (conflictsExisting || conflictsImported) && conflict == MemoryConflictSkip {
+			result.Skipped++
+			continue
+		}
+
+		fromEmbeddingModel := len(record.Embedding) > 0 && record.EmbeddingModel != nil &&
+			*record.EmbeddingModel == embeddingModelName
+		switch {
+		case embeddingModelId == nil:
+			// Nothing to generate embeddings with
+		case fromEmbeddingModel && (embeddingDimension == 0 || len(record.Embedding) == embeddingDimension):
+			// The first kept embedding sets the dimension when the model has no embeddings yet
+			embeddingDimension = len(record.Embedding)
+			memory.Embedding = record.Embedding.Normalize()
+			memory.EmbeddingModelId = embeddingModelId
+		default:
+			if fromEmbeddingModel {
+				logger.Warn("Imported embedding does not match the dimension of the embedding model, regenerating",
+					zap.Int("dimension", len(record.Embedding)), zap.Int("expectedDimension", embeddingDimension))
+			}
+			// Picked up by the embeddings listener on creation
+			result.EmbeddingsQueued++
+		}
+
+		switch {
+		case conflictsImported && conflict == MemoryConflictReplace:
+			if imported[idx].EmbeddingModelId == nil && embeddingModelId != nil {
+				result.EmbeddingsQueued--
+			}
+			imported[idx] = memory
+			result.Replaced++
+			continue
+		case conflictsExisting && conflict == MemoryConflictReplace:
+			replacedIds = append(replacedIds, existingId)
+			delete(existingIds, key)
+			result.Replaced++
+		default:
+			result.Imported++
+		}
+
+		importedIdx[key] = len(imported)
+		imported = append(imported, memory)
+	}
+
+	if err = m.ImportMemories(worldId, replacedIds, imported); err != nil {
+		return nil, errors.Wrap(err, "error importing memories")
+	}
+
+	logger.Info("Memories imported",
+		zap.Int("imported", result.Imported),
+		zap.Int("replaced", result.Replaced),
+		zap.Int("skipped", result.Skipped),
+		zap.Int("embeddingsQueued", result.EmbeddingsQueued))
+	return result, nil
+}
+
+func memoryConflictKey(characterId *int, content string) string {
+	if characterId == nil {
+		return "-:" + strings.TrimSpace(content)
+	}
+	return fmt.Sprintf("%d:%s", *characterId, strings.TrimSpace(content))
+}
+
+func characterIdsByName() (map[string]int, error) {
+	characters, err := c.AllCharacters()
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching characters")
+	}
+
+	ids := make(map[string]int, len(characters))
+	for _, character := range characters {
+		// The first character wins when names are ambiguous
+		name := strings.ToLower(character.Name)
+		if _, exists := ids[name]; !exists {
+			ids[name] = character.ID
+		}
+	}
+	return ids, nil
+}
+
+// currentEmbeddingModel returns the ID and identifier of the embedding model set in the preferences, if any.
+func currentEmbeddingModel() (*int, string, error) {
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error getting preferences")
+	}
+	if prefs.EmbeddingModelId == nil {
+		return nil, "", nil
+	}
+
+	instance, err := p.GetLlmModelInstanceById(*prefs.EmbeddingModelId)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error fetching embedding model")
+	}
+	if instance == nil {
+		return nil, "", nil
+	}
+
+	return prefs.EmbeddingModelId, instance.ModelId, nil
+}
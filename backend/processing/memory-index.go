@@ -0,0 +1,508 @@
+package processing
+
+import (
+	"cmp"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core"
+	"juraji.nl/chat-quest/core/jobs"
+	"juraji.nl/chat-quest/core/log"
+	"juraji.nl/chat-quest/core/vectors"
+	m "juraji.nl/chat-quest/model/memories"
+	pf "juraji.nl/chat-quest/model/preferences"
+)
+
+const (
+	// memoryIndexMinSize is the number of memories of a character (including world memories) from which retrieval uses
+	// the index. Smaller sets are scored exhaustively, which is cheap and exact.
+	memoryIndexMinSize = 1000
+	// memoryIndexMinCandidates is the minimum number of nearest neighbours retrieved from the index for scoring.
+	memoryIndexMinCandidates = 200
+	// memoryIndexSearchEf is the candidate list size of index searches.
+	memoryIndexSearchEf = 256
+	// memoryIndexRebuildPageSize is the number of memories read at once when building the index.
+	memoryIndexRebuildPageSize = 500
+	// memoryIndexSaveInterval is the interval at which index changes are written to disk.
+	memoryIndexSaveInterval = time.Minute
+	memoryIndexDir          = "memory-index"
+)
+
+// memoryPartition groups the memories searched together: those of a character in a world, CharacterId being 0 for
+// world memories.
+type memoryPartition struct {
+	WorldId     int
+	CharacterId int
+}
+
+func memoryPartitionOf(memory *m.Memory) memoryPartition {
+	partition := memoryPartition{WorldId: memory.WorldId}
+	if memory.CharacterId != nil {
+		partition.CharacterId = *memory.CharacterId
+	}
+	return partition
+}
+
+// memoryIndex is an approximate nearest neighbour index of the memory embeddings generated by one embedding model,
+// with an HNSW graph per memory partition.
+// The index is kept up to date by the memory signals. It can still go stale when memories are removed with their
+// world or character, these are removed when retrieval finds them missing. Candidates from the index are scored
+// with the embeddings from the database, so a stale vector only affects which memories are considered.
+type memoryIndex struct {
+	mu         sync.RWMutex
+	modelId    int
+	ready      bool
+	partitions map[memoryPartition]*vectors.Graph
+	// version counts the changes, savedVersion is the version last written to disk, guarded by saveMu.
+	version      int
+	savedVersion int
+	saveMu       sync.Mutex
+	// memoryPartitions are the partitions of the indexed memories by memory ID.
+	memoryPartitions map[int]memoryPartition
+}
+
+// memoryIndexFile is the persisted form of memoryIndex.
+type memoryIndexFile struct {
+	ModelId    int
+	Partitions map[memoryPartition]*vectors.Graph
+}
+
+type MemoryIndexRequest struct {
+	EmbeddingModelId int `json:"embeddingModelId"`
+}
+
+// currentMemoryIndex is the index for the embedding model in the preferences, nil when there is no embedding model.
+var currentMemoryIndex atomic.Pointer[memoryIndex]
+
+func newMemoryIndex(modelId int) *memoryIndex {
+	return &memoryIndex{
+		modelId:          modelId,
+		partitions:       make(map[memoryPartition]*vectors.Graph),
+		memoryPartitions: make(map[int]memoryPartition),
+	}
+}
+
+// readyMemoryIndex returns the current index when it is built for the model, nil otherwise.
+func readyMemoryIndex(modelId int) *memoryIndex {
+	index := currentMemoryIndex.Load()
+	if index == nil || index.modelId != modelId {
+		return nil
+	}
+
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	if !index.ready {
+		return nil
+	}
+	return index
+}
+
+func (idx *memoryIndex) add(memory *m.Memory) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	partition := memoryPartitionOf(memory)
+	if previous, ok := idx.memoryPartitions[memory.ID]; ok && previous != partition {
+		// Moved to another character
+		idx.removeLocked(memory.ID)
+	}
+
+	graph, ok := idx.partitions[partition]
+	if !ok {
+		graph = vectors.NewGraph(vectors.DefaultM, vectors.DefaultEfConstruction)
+		idx.partitions[partition] = graph
+	}
+
+	graph.Add(memory.ID, memory.Embedding)
+	idx.memoryPartitions[memory.ID] = partition
+	idx.version++
+}
+
+func (idx *memoryIndex) remove(memoryIds ...int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, memoryId := range memoryIds {
+		idx.removeLocked(memoryId)
+	}
+}
+
+func (idx *memoryIndex) removeLocked(memoryId int) {
+	partition, ok := idx.memoryPartitions[memoryId]
+	if !ok {
+		return
+	}
+	delete(idx.memoryPartitions, memoryId)
+
+	graph := idx.partitions[partition]
+	graph.Remove(memoryId)
+	switch {
+	case graph.Len() == 0:
+		delete(idx.partitions, partition)
+	case graph.NeedsCompaction():
+		graph.Compact()
+	}
+	idx.version++
+}
+
+// size returns the number of indexed memories of the character, including world memories.
+func (idx *memoryIndex) size(worldId int, characterId int) int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	size := 0
+	for _, partition := range characterPartitions(worldId, characterId) {
+		if graph, ok := idx.partitions[partition]; ok {
+			size += graph.Len()
+		}
+	}
+	return size
+}
+
+// search returns the IDs of the k memories of the character (including world memories) nearest to the query.
+func (idx *memoryIndex) search(worldId int, characterId int, query []float64, k int) []int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var neighbours []vectors.Neighbour
+	for _, partition := range characterPartitions(worldId, characterId) {
+		if graph, ok := idx.partitions[partition]; ok {
+			neighbours = append(neighbours, graph.Search(query, k, max(k, memoryIndexSearchEf))...)
+		}
+	}
+
+	slices.SortFunc(neighbours, func(a, b vectors.Neighbour) int {
+		return cmp.Compare(b.Similarity, a.Similarity)
+	})
+
+	ids := make([]int, min(k, len(neighbours)))
+	for i := range ids {
+		ids[i] = neighbours[i].ID
+	}
+	return ids
+}
+
+func characterPartitions(worldId int, characterId int) []memoryPartition {
+	return []memoryPartition{
+		{WorldId: worldId},
+		{WorldId: worldId, CharacterId: characterId},
+	}
+}
+
+func (idx *memoryIndex) count() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.memoryPartitions)
+}
+
+func memoryIndexPath(modelId int) string {
+	return core.Env().MkDataDir(memoryIndexDir, fmt.Sprintf("model-%d.gob", modelId))
+}
+
+// save writes the index to disk, when it is ready and has changes.
+func (idx *memoryIndex) save() error {
+	idx.saveMu.Lock()
+	defer idx.saveMu.Unlock()
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.ready || idx.version == idx.savedVersion {
+		return nil
+	}
+
+	path := memoryIndexPath(idx.modelId)
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, core.Env().DefaultFSPerm)
+	if err != nil {
+		return errors.Wrap(err, "failed to create memory index file")
+	}
+
+	err = gob.NewEncoder(file).Encode(&memoryIndexFile{ModelId: idx.modelId, Partitions: idx.partitions})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to write memory index")
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "failed to replace memory index file")
+	}
+
+	idx.savedVersion = idx.version
+	return nil
+}
+
+// loadMemoryIndex reads the index for the model from disk. Returns nil when there is no index for the model.
+func loadMemoryIndex(modelId int) (*memoryIndex, error) {
+	file, err := os.Open(memoryIndexPath(modelId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open memory index file")
+	}
+	defer file.Close()
+
+	var indexFile memoryIndexFile
+	if err = gob.NewDecoder(file).Decode(&indexFile); err != nil {
+		return nil, errors.Wrap(err, "failed to read memory index")
+	}
+	if indexFile.ModelId != modelId {
+		return nil, nil
+	}
+
+	index := newMemoryIndex(modelId)
+	index.ready = true
+	for partition, graph := range indexFile.Partitions {
+		index.partitions[partition] = graph
+		for memoryId := range graph.NodeIndices {
+			index.memoryPartitions[memoryId] = partition
+		}
+	}
+	return index, nil
+}
+
+// removeMemoryIndexFiles removes the indexes of other embedding models than keepModelId.
+func removeMemoryIndexFiles(keepModelId int) error {
+	dir := core.Env().MkDataDir(memoryIndexDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to list memory index files")
+	}
+
+	keep := filepath.Base(memoryIndexPath(keepModelId))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), keep) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return errors.Wrap(err, "failed to remove memory index file")
+		}
+	}
+	return nil
+}
+
+// EnqueueMemoryIndexRebuild schedules a rebuild of the memory index for the embedding model in the preferences.
+func EnqueueMemoryIndexRebuild() error {
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		return errors.Wrap(err, "error getting preferences")
+	}
+	if prefs.EmbeddingModelId == nil {
+		return nil
+	}
+	return enqueueMemoryIndexRebuild(*prefs.EmbeddingModelId)
+}
+
+func enqueueMemoryIndexRebuild(modelId int) error {
+	// Swap in the new index right away, so memory changes during the rebuild end up in it
+	currentMemoryIndex.Store(newMemoryIndex(modelId))
+	return memoryIndexJob.Enqueue(&MemoryIndexRequest{EmbeddingModelId: modelId}, "memory-index")
+}
+
+// RebuildMemoryIndex builds the memory index from the embeddings in the database.
+func RebuildMemoryIndex(ctx context.Context, request *MemoryIndexRequest) error {
+	logger := log.Get().With(zap.Int("embeddingModelId", request.EmbeddingModelId))
+
+	index := currentMemoryIndex.Load()
+	if index == nil || index.modelId != request.EmbeddingModelId {
+		// Preferences changed in the meantime, a rebuild for the new model follows
+		logger.Debug("Embedding model changed, skipping memory index rebuild")
+		return nil
+	}
+
+	total, err := m.CountMemoriesWithEmbeddings(request.EmbeddingModelId)
+	if err != nil {
+		logger.Error("Error counting memories", zap.Error(err))
+		return errors.Wrap(err, "error counting memories")
+	}
+
+	logger.Info("Building memory index...", zap.Int("memoryCount", total))
+
+	afterId := 0
+	indexed := 0
+	for {
+		if contextCheckPoint(ctx, logger) {
+			return nil
+		}
+
+		memories, err := m.GetMemoriesWithEmbeddingsAfterId(
+			request.EmbeddingModelId, afterId, memoryIndexRebuildPageSize)
+		if err != nil {
+			logger.Error("Error fetching memories", zap.Error(err))
+			return errors.Wrap(err, "error fetching memories")
+		}
+		if len(memories) == 0 {
+			break
+		}
+
+		for _, memory := range memories {
+			index.add(&memory)
+		}
+		afterId = memories[len(memories)-1].ID
+		indexed += len(memories)
+
+		jobs.ReportProgress(ctx, float64(indexed)/float64(max(total, indexed)),
+			fmt.Sprintf("Indexed %d of %d memories", indexed, max(total, indexed)))
+	}
+
+	index.mu.Lock()
+	index.ready = true
+	index.version++
+	index.mu.Unlock()
+
+	if err = index.save(); err != nil {
+		logger.Error("Error saving memory index", zap.Error(err))
+		return err
+	}
+	if err = removeMemoryIndexFiles(index.modelId); err != nil {
+		logger.Warn("Error removing memory indexes of previous embedding models", zap.Error(err))
+	}
+
+	logger.Info("Memory index built", zap.Int("memoryCount", indexed))
+	return nil
+}
+
+// StartMemoryIndex loads the memory index for the embedding model in the preferences, or schedules a rebuild when
+// it is missing or out of date, and periodically saves changes to disk.
+func StartMemoryIndex(ctx context.Context) {
+	logger := log.Get().With(zap.String("source", "MemoryIndex"))
+
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		logger.Error("Error getting preferences", zap.Error(err))
+	} else if prefs.EmbeddingModelId != nil {
+		if err = loadOrRebuildMemoryIndex(*prefs.EmbeddingModelId); err != nil {
+			logger.Error("Error loading memory index", zap.Error(err))
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(memoryIndexSaveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			SaveMemoryIndex()
+		}
+	}()
+}
+
+func loadOrRebuildMemoryIndex(modelId int) error {
+	logger := log.Get().With(zap.Int("embeddingModelId", modelId))
+
+	index, err := loadMemoryIndex(modelId)
+	if err != nil {
+		logger.Warn("Could not read memory index, rebuilding", zap.Error(err))
+		return enqueueMemoryIndexRebuild(modelId)
+	}
+	if index == nil {
+		logger.Info("No memory index yet, building")
+		return enqueueMemoryIndexRebuild(modelId)
+	}
+
+	// Changes made after the last save are lost when the application did not stop cleanly
+	count, err := m.CountMemoriesWithEmbeddings(modelId)
+	if err != nil {
+		return errors.Wrap(err, "error counting memories")
+	}
+	if count != index.count() {
+		logger.Info("Memory index is out of date, rebuilding",
+			zap.Int("indexed", index.count()), zap.Int("memoryCount", count))
+		return enqueueMemoryIndexRebuild(modelId)
+	}
+
+	currentMemoryIndex.Store(index)
+	logger.Info("Memory index loaded", zap.Int("memoryCount", count))
+	return nil
+}
+
+// ResetMemoryIndex discards the memory index, including the copy on disk, and rebuilds it for the embedding model in
+// the preferences. The index refers to memories by ID, so it must be reset when the database is replaced by a backup.
+func ResetMemoryIndex() error {
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		return errors.Wrap(err, "error getting preferences")
+	}
+
+	// Dropped before removing the file, so periodic saves do not write the stale index back
+	currentMemoryIndex.Store(nil)
+	if prefs.EmbeddingModelId == nil {
+		return nil
+	}
+
+	modelId := *prefs.EmbeddingModelId
+	if err = os.Remove(memoryIndexPath(modelId)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove memory index file")
+	}
+
+	log.Get().Info("Database restored, rebuilding memory index", zap.Int("embeddingModelId", modelId))
+	return enqueueMemoryIndexRebuild(modelId)
+}
+
+// SaveMemoryIndex writes pending changes of the memory index to disk.
+func SaveMemoryIndex() {
+	if index := currentMemoryIndex.Load(); index != nil {
+		if err := index.save(); err != nil {
+			log.Get().Error("Error saving memory index", zap.Error(err))
+		}
+	}
+}
+
+// UpdateMemoryIndex adds, replaces or removes the memory in the index, according to its current embedding.
+func UpdateMemoryIndex(memoryId int) error {
+	index := currentMemoryIndex.Load()
+	if index == nil {
+		return nil
+	}
+
+	memory, err := m.MemoryByIdWithEmbedding(memoryId)
+	if err != nil {
+		return errors.Wrap(err, "error fetching memory")
+	}
+
+	if memory == nil || memory.EmbeddingModelId == nil || *memory.EmbeddingModelId != index.modelId ||
+		len(memory.Embedding) == 0 {
+		index.remove(memoryId)
+	} else {
+		index.add(memory)
+	}
+	return nil
+}
+
+// RemoveFromMemoryIndex removes the memory from the index.
+func RemoveFromMemoryIndex(memoryId int) {
+	if index := currentMemoryIndex.Load(); index != nil {
+		index.remove(memoryId)
+	}
+}
+
+// SwitchMemoryIndexModel rebuilds the memory index when the embedding model in the preferences changed.
+func SwitchMemoryIndexModel(prefs *pf.Preferences) error {
+	index := currentMemoryIndex.Load()
+	switch {
+	case prefs.EmbeddingModelId == nil:
+		currentMemoryIndex.Store(nil)
+		return nil
+	case index != nil && index.modelId == *prefs.EmbeddingModelId:
+		return nil
+	default:
+		return loadOrRebuildMemoryIndex(*prefs.EmbeddingModelId)
+	}
+}
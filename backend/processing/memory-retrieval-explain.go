@@ -0,0 +1,90 @@
+package processing
+
+import (
+	"slices"
+
+	"github.com/pkg/errors"
+	c "juraji.nl/chat-quest/model/characters"
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+	m "juraji.nl/chat-quest/model/memories"
+	p "juraji.nl/chat-quest/model/preferences"
+)
+
+// MemoryRetrievalExplanation lists all memories of a character with how they scored for the current chat in a
+// session and whether they were included in the prompt or why not.
+type MemoryRetrievalExplanation struct {
+	ChatSessionID int `json:"chatSessionId"`
+	CharacterID   int `json:"characterId"`
+	// UseMemories tells whether memories are enabled for the session, none are included if not.
+	UseMemories  bool    `json:"useMemories"`
+	Subject      string  `json:"subject"`
+	KeywordQuery string  `json:"keywordQuery"`
+	MinP         float64 `json:"minP"`
+	TopK         int     `json:"topK"`
+	TokenBudget  int     `json:"tokenBudget"`
+	UsedTokens   int     `json:"usedTokens"`
+	// Indexed tells whether the memories were narrowed down using the memory index, in which case only the
+	// candidates taken from the index are listed.
+	Indexed bool `json:"indexed"`
+	// Memories are the included memories in order of inclusion, followed by the excluded memories, best first.
+	Memories []ScoredMemory `json:"memories"`
+}
+
+// ExplainMemoryRetrieval retrieves the memories of the character for the session, like when generating a response,
+// without generating one. Returns nil if the session or character does not exist.
+func ExplainMemoryRetrieval(sessionID int, characterID int) (*MemoryRetrievalExplanation, error) {
+	session, err := cs.GetById(sessionID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	character, err := c.CharacterById(characterID)
+	if err != nil || character == nil {
+		return nil, err
+	}
+	prefs, err := p.GetPreferences(true)
+	if err != nil {
+		return nil, err
+	}
+
+	retrieval, err := retrieveMemories(session, character.ID, prefs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to retrieve memories for character ID %d", character.ID)
+	}
+
+	explanation := &MemoryRetrievalExplanation{
+		ChatSessionID: session.ID,
+		CharacterID:   character.ID,
+		UseMemories:   session.UseMemories,
+		Subject:       retrieval.Subject,
+		KeywordQuery:  retrieval.KeywordQuery,
+		MinP:          prefs.MemoryMinP,
+		TopK:          prefs.MemoryTopK,
+		TokenBudget:   prefs.MemoryTokenBudget,
+		Indexed:       retrieval.Indexed,
+		Memories:      slices.Clone(retrieval.Selected),
+	}
+	for _, memory := range retrieval.Selected {
+		explanation.UsedTokens += memory.Tokens
+	}
+
+	var excluded []ScoredMemory
+	for _, memory := range retrieval.Memories {
+		if !memory.Included {
+			excluded = append(excluded, memory)
+		}
+	}
+	slices.SortFunc(excluded, compareScoredMemories)
+	explanation.Memories = append(explanation.Memories, excluded...)
+
+	// Memories without embeddings are never retrieved, these are listed to tell why
+	withoutEmbeddings, err := m.GetMemoriesByWorldAndCharacterIdWithoutEmbeddings(
+		session.WorldID, character.ID, *prefs.EmbeddingModelId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get memories without embeddings for character ID %d", character.ID)
+	}
+	for _, memory := range withoutEmbeddings {
+		explanation.Memories = append(explanation.Memories, ScoredMemory{Memory: memory, Reason: MissingEmbeddingReason})
+	}
+
+	return explanation, nil
+}
@@ -0,0 +1,459 @@
+package processing
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	prov "juraji.nl/chat-quest/core/providers"
+	"juraji.nl/chat-quest/core/util"
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+	m "juraji.nl/chat-quest/model/memories"
+	p "juraji.nl/chat-quest/model/preferences"
+	"juraji.nl/chat-quest/model/search"
+)
+
+// memoryKeywordsLimit limits the amount of keywords taken from the subject for keyword scoring.
+const memoryKeywordsLimit = 64
+
+type MemorySelectionReason string
+
+const (
+	AlwaysIncludedReason      MemorySelectionReason = "ALWAYS_INCLUDED"
+	SelectedReason            MemorySelectionReason = "SELECTED"
+	BelowMinPReason           MemorySelectionReason = "BELOW_MIN_P"
+	TopKReachedReason         MemorySelectionReason = "TOP_K_REACHED"
+	TokenBudgetExceededReason MemorySelectionReason = "TOKEN_BUDGET_EXCEEDED"
+	NoChatHistoryReason       MemorySelectionReason = "NO_CHAT_HISTORY"
+	MissingEmbeddingReason    MemorySelectionReason = "MISSING_EMBEDDING"
+)
+
+// ScoredMemory is a memory with its relevance scores for the subject it was retrieved for.
+type ScoredMemory struct {
+	Memory m.Memory `json:"memory"`
+	// Similarity is the cosine similarity of the memory and subject embeddings.
+	Similarity float64 `json:"similarity"`
+	// KeywordScore is the BM25 score of the subject's keywords, relative to the best matching memory (0-1).
+	KeywordScore float64 `json:"keywordScore"`
+	// Relevance is the weighted sum of Similarity and KeywordScore, or 1 for memories that are always included.
+	Relevance float64 `json:"relevance"`
+	// Recency decays from 1 for new memories to 0, halving every Preferences.MemoryRecencyHalfLifeDays.
+	Recency float64 `json:"recency"`
+	// Score ranks memories, it is the Relevance boosted by the weighted Recency and Memory.Importance.
+	Score float64 `json:"score"`
+	// Tokens is the token count of the memory content, only counted for memories considered for selection.
+	Tokens   int                   `json:"tokens"`
+	Included bool                  `json:"included"`
+	Reason   MemorySelectionReason `json:"reason"`
+}
+
+// MemoryRetrieval is the outcome of retrieving the memories of a character in a chat session.
+type MemoryRetrieval struct {
+	Subject      string
+	KeywordQuery string
+	// Indexed tells whether the memories were narrowed down using the memory index.
+	Indexed bool
+	// Memories are all memories with embeddings of the character, or the candidates taken from the index when
+	// Indexed, in order of retrieval.
+	Memories []ScoredMemory
+	// Selected are the memories to include, best memories first.
+	Selected []ScoredMemory
+}
+
+// retrieveMemories retrieves the memories of the character relevant to the recent chat in the session.
+func retrieveMemories(session *cs.ChatSession, characterID int, prefs *p.Preferences) (*MemoryRetrieval, error) {
+	chatHistory, err := cs.GetTailChatMessages(session.ID, prefs.MemoryIncludeChatSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch chat messages for memory scan")
+	}
+	noChatHistory := len(chatHistory) == 0 && session.ChatNotes == nil
+
+	// Large sets of memories are narrowed down using the index, when it is available
+	index := readyMemoryIndex(*prefs.EmbeddingModelId)
+	if index != nil && index.size(session.WorldID, characterID) < memoryIndexMinSize {
+		index = nil
+	}
+
+	retrieval := &MemoryRetrieval{}
+
+	var memories []m.Memory
+	if index == nil || noChatHistory {
+		memories, err = m.GetMemoriesByWorldAndCharacterIdWithEmbeddings(
+			session.WorldID, characterID, *prefs.EmbeddingModelId)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get memories")
+		}
+
+		// Short circuit: Character has no memories
+		if len(memories) == 0 {
+			return retrieval, nil
+		}
+	}
+
+	// Short circuit: No chat history, just select "AlwaysInclude" memories.
+	if noChatHistory {
+		retrieval.Memories = make([]ScoredMemory, len(memories))
+		for idx, memory := range memories {
+			scored := ScoredMemory{Memory: memory, Reason: NoChatHistoryReason}
+			if memory.AlwaysInclude {
+				scored.Relevance = 1.0
+				scored.Included = true
+				scored.Reason = AlwaysIncludedReason
+				if err = countMemoryTokens(&scored); err != nil {
+					return nil, err
+				}
+				retrieval.Selected = append(retrieval.Selected, scored)
+			}
+			retrieval.Memories[idx] = scored
+		}
+
+		return retrieval, nil
+	}
+
+	retrieval.Subject, err = memoryRetrievalSubject(session, prefs, chatHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectEmbedding, err := embedMemorySubject(retrieval.Subject, prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	keywordScores, keywordQuery, err := memoryKeywordScores(retrieval.Subject, prefs, session.WorldID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	retrieval.KeywordQuery = keywordQuery
+
+	if index != nil {
+		retrieval.Indexed = true
+		memories, err = indexedMemoryCandidates(index, session.WorldID, characterID, subjectEmbedding, keywordScores, prefs)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get memory candidates")
+		}
+	}
+
+	retrieval.Memories = scoreMemories(memories, subjectEmbedding, keywordScores, prefs)
+
+	retrieval.Selected, err = selectMemories(retrieval.Memories, prefs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select memories")
+	}
+
+	return retrieval, nil
+}
+
+// indexedMemoryCandidates returns the memories of the character to score, being the nearest neighbours of the subject
+// in the index, the best keyword matches and the memories that are always included.
+func indexedMemoryCandidates(
+	index *memoryIndex,
+	worldID int,
+	characterID int,
+	subjectEmbedding prov.Embedding,
+	keywordScores map[int]float64,
+	prefs *p.Preferences,
+) ([]m.Memory, error) {
+	k := max(memoryIndexMinCandidates, 4*prefs.MemoryTopK)
+	candidateIds := index.search(worldID, characterID, subjectEmbedding, k)
+
+	keywordIds := slices.Collect(maps.Keys(keywordScores))
+	slices.SortFunc(keywordIds, func(a, b int) int {
+		return cmp.Or(cmp.Compare(keywordScores[b], keywordScores[a]), cmp.Compare(a, b))
+	})
+	candidateIds = append(candidateIds, keywordIds[:min(k, len(keywordIds))]...)
+
+	alwaysIncludedIds, err := m.GetAlwaysIncludedMemoryIds(worldID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	candidateIds = append(candidateIds, alwaysIncludedIds...)
+
+	slices.Sort(candidateIds)
+	candidateIds = slices.Compact(candidateIds)
+
+	memories, err := m.GetMemoriesByIdsWithEmbeddings(candidateIds, index.modelId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(memories) < len(candidateIds) {
+		// Memories deleted along with their world or character are still in the index
+		found := util.NewSetFrom(memories, func(memory m.Memory) int { return memory.ID })
+		var missingIds []int
+		for _, id := range candidateIds {
+			if found.NotContains(id) {
+				missingIds = append(missingIds, id)
+			}
+		}
+		index.remove(missingIds...)
+	}
+
+	return memories, nil
+}
+
+// memoryRetrievalSubject builds the text memories are matched against, which is made up of
+//   - Current participant names.
+//   - Optionally the Chat notes.
+//   - The messages to scan.
+func memoryRetrievalSubject(
+	session *cs.ChatSession,
+	prefs *p.Preferences,
+	chatHistory []cs.ChatMessage,
+) (string, error) {
+	var subjectBuffer strings.Builder
+
+	participants, err := cs.GetAllParticipantsAsCharacters(session.ID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get session participants")
+	}
+	for _, participant := range participants {
+		subjectBuffer.WriteString(participant.Name)
+		subjectBuffer.WriteRune('\n')
+	}
+
+	if prefs.MemoryIncludeChatNotes && session.ChatNotes != nil {
+		subjectBuffer.WriteString(*session.ChatNotes)
+		subjectBuffer.WriteRune('\n')
+	}
+
+	for _, msg := range chatHistory {
+		subjectBuffer.WriteString(msg.Content)
+		subjectBuffer.WriteRune('\n')
+	}
+
+	return subjectBuffer.String(), nil
+}
+
+func embedMemorySubject(subject string, prefs *p.Preferences) (prov.Embedding, error) {
+	embeddingModelInst, err := prov.GetLlmModelInstanceById(*prefs.EmbeddingModelId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get embedding model")
+	}
+
+	// Memories are retrieved while building a prompt, mostly for a reply the user is waiting on
+	ctx := prov.WithRequestPriority(context.Background(), prov.PriorityInteractive)
+	subjectEmbedding, err := prov.GenerateEmbeddings(ctx, embeddingModelInst, subject)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to embed subject")
+	}
+	return subjectEmbedding, nil
+}
+
+// scoreMemories scores the memories by fusing their embedding similarity to the subject with the keyword scores
+// of the subject's keywords, weighted by the preferences. Keyword scoring picks up names and rare words, which
+// get lost in the embedding of a long subject.
+// The resulting memories are in the same order as the given memories.
+func scoreMemories(
+	memories []m.Memory,
+	subjectEmbedding prov.Embedding,
+	keywordScores map[int]float64,
+	prefs *p.Preferences,
+) []ScoredMemory {
+	now := time.Now()
+	scored := make([]ScoredMemory, len(memories))
+
+	// Process memories in batches using goroutines
+	const workerCount = 8
+	const minChunkSize = 10
+	chunkSize := max((len(memories)+workerCount-1)/workerCount, minChunkSize)
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(memories); start += chunkSize {
+		end := min(start+chunkSize, len(memories))
+
+		wg.Go(func() {
+			for i := start; i < end; i++ {
+				memory := memories[i]
+				candidate := ScoredMemory{
+					Memory:       memory,
+					Similarity:   subjectEmbedding.CosineSimilarity(memory.Embedding),
+					KeywordScore: keywordScores[memory.ID],
+				}
+
+				if memory.AlwaysInclude {
+					candidate.Relevance = 1.0
+				} else {
+					candidate.Relevance = prefs.MemoryVectorWeight*candidate.Similarity +
+						prefs.MemoryKeywordWeight*candidate.KeywordScore
+				}
+				if memory.CreatedAt != nil {
+					ageInDays := max(now.Sub(*memory.CreatedAt).Hours()/24, 0)
+					candidate.Recency = math.Pow(0.5, ageInDays/prefs.MemoryRecencyHalfLifeDays)
+				}
+				candidate.Score = candidate.Relevance +
+					prefs.MemoryRecencyWeight*candidate.Recency +
+					prefs.MemoryImportanceWeight*memory.Importance
+
+				scored[i] = candidate
+			}
+		})
+	}
+	wg.Wait()
+
+	return scored
+}
+
+// memoryKeywordScores returns the keyword scores of memories matching the subject's keywords by memory ID,
+// normalized to the best match, so they weigh in on the same 0-1 scale as similarities. Also returns the
+// FTS5 query the scores were calculated with.
+func memoryKeywordScores(
+	subject string,
+	prefs *p.Preferences,
+	worldID int,
+	characterID int,
+) (map[int]float64, string, error) {
+	if prefs.MemoryKeywordWeight == 0 {
+		return nil, "", nil
+	}
+
+	matchExpr, ok := search.KeywordsMatchExpression(subject, memoryKeywordsLimit)
+	if !ok {
+		return nil, "", nil
+	}
+
+	bm25Scores, err := m.GetMemoryKeywordScores(worldID, characterID, matchExpr)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to get memory keyword scores")
+	}
+
+	// BM25 scores are negative, the lowest being the best match
+	best := 0.0
+	for _, score := range bm25Scores {
+		best = min(best, score)
+	}
+
+	normalized := make(map[int]float64, len(bm25Scores))
+	for id, score := range bm25Scores {
+		if best < 0 {
+			normalized[id] = score / best
+		}
+	}
+
+	return normalized, matchExpr, nil
+}
+
+// selectMemories selects the memories to include from the scored memories.
+// Memories that are always included are selected first, after which memories with a Relevance of at least
+// Preferences.MemoryMinP are selected by maximal marginal relevance: the next memory is the one with the best
+// Score, penalized by its similarity to the memories selected so far. This keeps near-duplicate memories from
+// crowding out others. Selection stops at Preferences.MemoryTopK memories and memories that do not fit in
+// Preferences.MemoryTokenBudget are skipped. The selection order is deterministic, best memories first.
+// The scored memories are updated with whether and why they were included.
+func selectMemories(scored []ScoredMemory, prefs *p.Preferences) ([]ScoredMemory, error) {
+	var selected []int
+	var candidates []int
+	for idx := range scored {
+		memory := &scored[idx]
+		switch {
+		case memory.Memory.AlwaysInclude:
+			memory.Included = true
+			memory.Reason = AlwaysIncludedReason
+			selected = append(selected, idx)
+		case memory.Relevance >= prefs.MemoryMinP:
+			candidates = append(candidates, idx)
+		default:
+			memory.Reason = BelowMinPReason
+		}
+	}
+
+	byScore := func(a, b int) int { return compareScoredMemories(scored[a], scored[b]) }
+	slices.SortFunc(selected, byScore)
+	slices.SortFunc(candidates, byScore)
+
+	usedTokens := 0
+	for _, idx := range selected {
+		if err := countMemoryTokens(&scored[idx]); err != nil {
+			return nil, err
+		}
+		usedTokens += scored[idx].Tokens
+	}
+
+	for len(candidates) > 0 {
+		if prefs.MemoryTopK > 0 && len(selected) >= prefs.MemoryTopK {
+			for _, idx := range candidates {
+				scored[idx].Reason = TopKReachedReason
+			}
+			break
+		}
+
+		next := nextMmrCandidate(scored, candidates, selected, prefs.MemoryMmrLambda)
+		memory := &scored[candidates[next]]
+		if err := countMemoryTokens(memory); err != nil {
+			return nil, err
+		}
+
+		if prefs.MemoryTokenBudget > 0 && usedTokens+memory.Tokens > prefs.MemoryTokenBudget {
+			// Skip, a shorter memory might still fit
+			memory.Reason = TokenBudgetExceededReason
+		} else {
+			usedTokens += memory.Tokens
+			memory.Included = true
+			memory.Reason = SelectedReason
+			selected = append(selected, candidates[next])
+		}
+
+		candidates = slices.Delete(candidates, next, next+1)
+	}
+
+	result := make([]ScoredMemory, len(selected))
+	for i, idx := range selected {
+		result[i] = scored[idx]
+	}
+	return result, nil
+}
+
+func countMemoryTokens(memory *ScoredMemory) error {
+	tokens, err := prov.TokenCount(memory.Memory.Content)
+	if err != nil {
+		return errors.Wrap(err, "failed to count memory tokens")
+	}
+	memory.Tokens = tokens
+	return nil
+}
+
+// nextMmrCandidate returns the index in candidates of the memory with the best marginal relevance to the selected
+// memories, being lambda * Score - (1 - lambda) * the highest similarity to any selected memory.
+// Candidates and selected are indices in scored. Candidates are expected to be sorted, so ties go to the best
+// ranked candidate.
+func nextMmrCandidate(scored []ScoredMemory, candidates []int, selected []int, lambda float64) int {
+	bestIdx := 0
+	bestMmr := math.Inf(-1)
+
+	for idx, candidate := range candidates {
+		maxSimilarity := 0.0
+		if lambda < 1 {
+			for _, sel := range selected {
+				maxSimilarity = max(maxSimilarity,
+					scored[candidate].Memory.Embedding.CosineSimilarity(scored[sel].Memory.Embedding))
+			}
+		}
+
+		mmr := lambda*scored[candidate].Score - (1-lambda)*maxSimilarity
+		if mmr > bestMmr {
+			bestIdx = idx
+			bestMmr = mmr
+		}
+	}
+
+	return bestIdx
+}
+
+// compareScoredMemories orders memories by Score (descending), newest first and by ID on ties.
+func compareScoredMemories(a, b ScoredMemory) int {
+	if c := cmp.Compare(b.Score, a.Score); c != 0 {
+		return c
+	}
+	if a.Memory.CreatedAt != nil && b.Memory.CreatedAt != nil {
+		if c := b.Memory.CreatedAt.Compare(*a.Memory.CreatedAt); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(a.Memory.ID, b.Memory.ID)
+}
@@ -31,7 +31,7 @@ func GenerateResponseByMessageCreated(ctx context.Context, triggerMessage *cs.Ch
 	var err error
 
 	// Cancellation
-	ctx, cleanup := setupCancelBySystem(ctx, logger, "GenerateResponseByMessageCreated")
+	ctx, cleanup := registerGeneration(ctx, logger, "GenerateResponseByMessageCreated", sessionId)
 	defer cleanup()
 
 	// Fetch Session
@@ -61,7 +61,7 @@ func GenerateResponseByMessageCreated(ctx context.Context, triggerMessage *cs.Ch
 
 	logger = logger.With(zap.Intp("responderId", responderId))
 
-	return generateResponse(ctx, logger, session, triggerMessage, *responderId)
+	return generateResponse(ctx, logger, session, triggerMessage, *responderId, nil, false)
 }
 
 func GenerateResponseByParticipantTrigger(ctx context.Context, participant *cs.ChatParticipant) error {
@@ -78,7 +78,7 @@ func GenerateResponseByParticipantTrigger(ctx context.Context, participant *cs.C
 		zap.Int("responderId", responderId))
 
 	// Cancellation
-	ctx, cleanup := setupCancelBySystem(ctx, logger, "GenerateResponseByParticipantTrigger")
+	ctx, cleanup := registerGeneration(ctx, logger, "GenerateResponseByParticipantTrigger", sessionId)
 	defer cleanup()
 
 	if contextCheckPoint(ctx, logger) {
@@ -92,16 +92,221 @@ func GenerateResponseByParticipantTrigger(ctx context.Context, participant *cs.C
 		return errors.Wrap(err, "error fetching session")
 	}
 
-	return generateResponse(ctx, logger, session, nil, responderId)
+	return generateResponse(ctx, logger, session, nil, responderId, nil, false)
 }
 
+// FinalizeInterruptedGenerations finalizes messages that were being generated when the application stopped, their
+// generations do not resume. Partial responses are kept, empty responses are removed like failed generations.
+func FinalizeInterruptedGenerations() {
+	logger := log.Get().With(zap.String("source", "FinalizeInterruptedGenerations"))
+
+	messages, err := cs.GetGeneratingChatMessages()
+	if err != nil {
+		logger.Error("Failed to fetch interrupted chat messages", zap.Error(err))
+		return
+	}
+
+	for _, message := range messages {
+		isEmpty := len(strings.TrimSpace(message.Content)) == 0 && len(strings.TrimSpace(message.Reasoning)) == 0
+
+		switch {
+		case isEmpty && message.ActiveAlternativeID != nil:
+			_, err = cs.DiscardChatMessageAlternative(message.ChatSessionID, message.ID, *message.ActiveAlternativeID)
+		case isEmpty:
+			err = cs.DeleteChatMessage(message.ChatSessionID, message.ID)
+		default:
+			message.IsGenerating = false
+			err = cs.UpdateChatMessage(message.ChatSessionID, message.ID, &message)
+		}
+		if err != nil {
+			logger.Error("Failed to finalize interrupted chat message", zap.Int("messageId", message.ID), zap.Error(err))
+		}
+	}
+
+	if len(messages) > 0 {
+		logger.Info("Finalized chat messages of interrupted generations", zap.Int("count", len(messages)))
+	}
+}
+
+// RegenerateResponse generates a new alternative for an existing character message.
+// The previous response is kept as an alternative, the new one becomes the active alternative.
+func RegenerateResponse(ctx context.Context, sessionId int, messageId int) error {
+	logger := log.Get().With(
+		zap.String("source", "Regenerate"),
+		zap.Int("chatSessionId", sessionId),
+		zap.Int("messageId", messageId))
+
+	// Cancellation
+	ctx, cleanup := registerGeneration(ctx, logger, "RegenerateResponse", sessionId)
+	defer cleanup()
+
+	message, triggerMessage, err := getCharacterMessageWithTrigger(logger, sessionId, messageId)
+	if err != nil {
+		return err
+	}
+
+	responderId := *message.CharacterID
+	logger = logger.With(zap.Int("responderId", responderId))
+
+	session, err := cs.GetById(sessionId)
+	if err != nil {
+		logger.Error("Error fetching session", zap.Error(err))
+		return errors.Wrap(err, "error fetching session")
+	}
+
+	if contextCheckPoint(ctx, logger) {
+		return nil
+	}
+
+	targetMessage, err := cs.CreateChatMessageAlternative(sessionId, messageId)
+	if err != nil {
+		logger.Error("Error creating message alternative", zap.Error(err))
+		return errors.Wrap(err, "error creating message alternative")
+	}
+
+	return generateResponse(ctx, logger, session, triggerMessage, responderId, targetMessage, false)
+}
+
+// ContinueResponse extends the last character message in a session, for instance when it was cut off by MaxTokens.
+// The current content is sent as a partial assistant message and newly generated tokens are appended to it.
+func ContinueResponse(ctx context.Context, sessionId int, messageId int) error {
+	logger := log.Get().With(
+		zap.String("source", "Continue"),
+		zap.Int("chatSessionId", sessionId),
+		zap.Int("messageId", messageId))
+
+	// Cancellation
+	ctx, cleanup := registerGeneration(ctx, logger, "ContinueResponse", sessionId)
+	defer cleanup()
+
+	message, triggerMessage, err := getCharacterMessageWithTrigger(logger, sessionId, messageId)
+	if err != nil {
+		return err
+	}
+
+	followingMessages, err := cs.GetMessagesInSessionAfterId(sessionId, messageId, 1)
+	if err != nil {
+		logger.Error("Error fetching following messages", zap.Error(err))
+		return errors.Wrap(err, "error fetching following messages")
+	}
+	if len(followingMessages) != 0 {
+		return ErrNotLastChatMessage
+	}
+
+	responderId := *message.CharacterID
+	logger = logger.With(zap.Int("responderId", responderId))
+
+	session, err := cs.GetById(sessionId)
+	if err != nil {
+		logger.Error("Error fetching session", zap.Error(err))
+		return errors.Wrap(err, "error fetching session")
+	}
+
+	if contextCheckPoint(ctx, logger) {
+		return nil
+	}
+
+	message, err = cs.MarkChatMessageGenerating(sessionId, messageId)
+	if err != nil {
+		logger.Error("Error marking message as generating", zap.Error(err))
+		return errors.Wrap(err, "error marking message as generating")
+	}
+
+	return generateResponse(ctx, logger, session, triggerMessage, responderId, message, true)
+}
+
+var (
+	// ErrChatMessageNotFound is returned when the message to generate into does not exist in the session.
+	ErrChatMessageNotFound = errors.New("message not found in session")
+	// ErrNotCharacterMessage is returned when the message to generate into is not a character message.
+	ErrNotCharacterMessage = errors.New("only character messages can be generated")
+	// ErrNotLastChatMessage is returned when continuing a message that is followed by other messages.
+	ErrNotLastChatMessage = errors.New("only the last message in a session can be continued")
+)
+
+// getCharacterMessageWithTrigger fetches a finalized character message in the given session,
+// along with the user message directly preceding it (if any), which acts as its trigger.
+func getCharacterMessageWithTrigger(
+	logger *zap.Logger,
+	sessionId int,
+	messageId int,
+) (*cs.ChatMessage, *cs.ChatMessage, error) {
+	message, err := cs.GetMessageById(messageId)
+	if err != nil {
+		logger.Error("Error fetching message", zap.Error(err))
+		return nil, nil, errors.Wrap(err, "error fetching message")
+	}
+	if message == nil || message.ChatSessionID != sessionId {
+		return nil, nil, ErrChatMessageNotFound
+	}
+	if message.IsUser || message.CharacterID == nil {
+		return nil, nil, ErrNotCharacterMessage
+	}
+	if message.IsGenerating {
+		return nil, nil, cs.ErrChatMessageGenerating
+	}
+
+	precedingMessages, err := cs.GetMessagesInSessionBeforeId(sessionId, messageId, 1)
+	if err != nil {
+		logger.Error("Error fetching preceding message", zap.Error(err))
+		return nil, nil, errors.Wrap(err, "error fetching preceding message")
+	}
+	if len(precedingMessages) == 1 && precedingMessages[0].IsUser {
+		return message, &precedingMessages[0], nil
+	}
+
+	return message, nil, nil
+}
+
+// generateResponse generates a response by responderId into the session.
+// When targetMessage is set, the response is written into that message instead of new ones and only messages
+// before it are used as history. When continueTarget is set, the target's content is sent to the LLM as partial
+// response and newly generated content is appended to it.
 func generateResponse(
 	ctx context.Context,
 	logger *zap.Logger,
 	session *cs.ChatSession,
 	triggerMessage *cs.ChatMessage,
 	responderId int,
+	targetMessage *cs.ChatMessage,
+	continueTarget bool,
 ) error {
+	// Messages written by this generation, finalized when done, failed or canceled.
+	// The target message is marked as generating by the caller, so it is included from the start.
+	var messageStack []*cs.ChatMessage
+	if targetMessage != nil {
+		messageStack = append(messageStack, targetMessage)
+	}
+	defer func() {
+		for _, message := range messageStack {
+			message.IsGenerating = false
+			message.Content = strings.TrimSpace(message.Content)
+			isEmpty := len(message.Content) == 0 && len(strings.TrimSpace(message.Reasoning)) == 0
+
+			if isEmpty && message != targetMessage {
+				// Nothing was generated into this message (e.g. the response failed), do not leave it behind empty
+				if err := cs.DeleteChatMessage(session.ID, message.ID); err != nil {
+					logger.Error("Failed to delete empty response chat message upon finalization",
+						zap.Int("messageId", message.ID), zap.Error(err))
+				}
+				continue
+			}
+			if isEmpty && !continueTarget && message.ActiveAlternativeID != nil {
+				// Nothing was generated into the new alternative, bring back the previous response
+				if _, err := cs.DiscardChatMessageAlternative(session.ID, message.ID, *message.ActiveAlternativeID); err != nil {
+					logger.Error("Failed to discard empty response alternative upon finalization",
+						zap.Int("messageId", message.ID), zap.Error(err))
+				}
+				continue
+			}
+
+			if err := cs.UpdateChatMessage(session.ID, message.ID, message); err != nil {
+				logger.Error("Failed to update response chat message upon finalization",
+					zap.Int("messageId", message.ID), zap.Error(err))
+			}
+		}
+	}()
+
 	if session.ChatModelId == nil {
 		logger.Error("Chat model id is required on session")
 		return errors.New("chat model id is required on session")
@@ -118,14 +323,19 @@ func generateResponse(
 		return errors.Wrap(err, "error fetching preferences")
 	}
 
-	sessionMessageCount, err := cs.GetChatSessionMessageCount(session.ID)
+	var sessionMessageCount int
+	if targetMessage != nil {
+		sessionMessageCount, err = cs.GetChatSessionMessageCountBeforeId(session.ID, targetMessage.ID)
+	} else {
+		sessionMessageCount, err = cs.GetChatSessionMessageCount(session.ID)
+	}
 	if err != nil {
 		logger.Error("Error fetching chat session messages count", zap.Error(err))
 		return errors.Wrap(err, "error fetching chat session messages count")
 	}
 
 	// Create instructions
-	instructionVars := NewChatInstructionVars(session, prefs, triggerMessage, sessionMessageCount, responderId)
+	instructionVars := NewChatInstructionVars(session, prefs, triggerMessage, targetMessage, sessionMessageCount, responderId)
 	instruction, err := inst.InstructionById(*session.ChatInstructionId)
 	if err != nil {
 		logger.Error("Error fetching chat instruction", zap.Error(err))
@@ -136,33 +346,66 @@ func generateResponse(
 		return errors.Wrap(err, "error applying instruction templates")
 	}
 
-	messagesToFetch := prefs.MaxMessagesInContext
+	// Get chat model instance
+	chatModelInst, err := prov.GetLlmModelInstanceById(*session.ChatModelId)
+	if err != nil {
+		logger.Error("Error fetching chat model instance", zap.Error(err))
+		return errors.Wrap(err, "error fetching chat model instance")
+	}
+	chatModelInstances := append([]*prov.LlmModelInstance{chatModelInst},
+		getChatFallbackModelInstances(logger, session, prefs)...)
+
+	// Partial response the LLM should continue on
+	var prefillMessages []prov.ChatRequestMessage
+	if continueTarget {
+		prefillMessages = createAssistantRequestMessages(*targetMessage, instruction)
+	}
+
+	// Fetch as much history as fits the model context
+	maxMessages := prefs.MaxMessagesInContext
 	if triggerMessage != nil {
-		messagesToFetch++
+		maxMessages++
 	}
-	includedHistory, err := cs.GetTailChatMessages(session.ID, messagesToFetch)
+	var beforeMessageId *int
+	if targetMessage != nil {
+		// Only messages up to the regenerated message are part of its context
+		beforeMessageId = &targetMessage.ID
+	}
+	includedHistory, contextTrimmed, err := fetchHistoryForContext(
+		session.ID, beforeMessageId, chatModelInst.ContextLength, maxMessages, instruction, prefillMessages)
 	if err != nil {
 		logger.Error("Failed to fetch messages for context", zap.Error(err))
 		return errors.Wrap(err, "failed to fetch messages for context")
 	}
+	if contextTrimmed != nil {
+		logger.Info("Left out older messages from history to fit model context",
+			zap.Int("contextLength", contextTrimmed.ContextLength),
+			zap.Int("usedTokens", contextTrimmed.UsedTokens),
+			zap.Int("includedMessages", contextTrimmed.IncludedMessages),
+			zap.Int("droppedMessages", contextTrimmed.DroppedMessages))
+		ChatContextTrimmedSignal.EmitBG(contextTrimmed)
+	}
+
+	if len(includedHistory) > 0 && len(includedHistory) < sessionMessageCount {
+		// Older messages are not part of the context (anymore).
+		// Signaled after the response is done, so follow-up work does not compete with it for the model.
+		defer ChatHistoryAgedOutSignal.EmitBG(&ChatHistoryAgedOut{
+			ChatSessionID:   session.ID,
+			BeforeMessageID: includedHistory[0].ID,
+		})
+	}
 
 	// Log instruction contents
 	logInstructionsToFile(logger, instruction, includedHistory)
 
 	// Build request messages
 	requestMessages := createChatRequestMessages(includedHistory, instruction)
+	requestMessages = append(requestMessages, prefillMessages...)
 
 	if contextCheckPoint(ctx, logger) {
 		return nil
 	}
 
-	// Get chat model instance
-	chatModelInst, err := prov.GetLlmModelInstanceById(*session.ChatModelId)
-	if err != nil {
-		logger.Error("Error fetching chat model instance", zap.Error(err))
-		return errors.Wrap(err, "error fetching chat model instance")
-	}
-
 	// Create message stack
 	const (
 		InContent = iota
@@ -173,11 +416,11 @@ func generateResponse(
 	)
 
 	var currentState = InContent
-	var charTransitionSeen = false
+	// A continued message already has its character, any transition should cancel the parser
+	var charTransitionSeen = continueTarget
 	var prefixBuffer strings.Builder
 	var contentBuffer strings.Builder
 	var reasoningBuffer strings.Builder
-	var messageStack []*cs.ChatMessage
 	var currentMessage *cs.ChatMessage
 
 	charInitial, charPrefix, charSuffix := instruction.CharacterMarkers()
@@ -190,25 +433,22 @@ func generateResponse(
 		} else {
 			currentMessage = newMessage
 			messageStack = append(messageStack, currentMessage)
+			setGenerationMessage(ctx, currentMessage.ID)
 		}
 	}
 
-	defer func() {
-		for _, message := range messageStack {
-			message.IsGenerating = false
-			message.Content = strings.TrimSpace(message.Content)
-			if err := cs.UpdateChatMessage(session.ID, message.ID, message); err != nil {
-				logger.Error("Failed to update response chat message upon finalization",
-					zap.Int("messageId", message.ID), zap.Error(err))
-			}
-		}
-	}()
-
-	// Create initial response message
-	addMessageToStack()
+	// Create initial response message, or continue on the target message
+	if targetMessage != nil {
+		currentMessage = targetMessage
+		setGenerationMessage(ctx, currentMessage.ID)
+	} else {
+		addMessageToStack()
+	}
 
-	ctx, cancelCtx := context.WithCancel(ctx)
-	chatResponseChan := prov.GenerateChatResponse(ctx, chatModelInst, requestMessages, instruction.AsLlmParameters())
+	// Responses go ahead of background work on the same provider
+	ctx, cancelCtx := context.WithCancel(prov.WithRequestPriority(ctx, prov.PriorityInteractive))
+	chatResponseChan := prov.GenerateChatResponseWithFallbacks(
+		ctx, chatModelInstances, requestMessages, instruction.AsLlmParameters())
 
 	for {
 		select {
@@ -219,6 +459,7 @@ func generateResponse(
 				return errors.Wrap(response.Error, "error generating response")
 			}
 
+		tokenLoop:
 			for _, token := range response.Content {
 				switch currentState {
 				case InContent:
@@ -283,7 +524,13 @@ func generateResponse(
 							continue
 						}
 
-						if charTransitionSeen {
+						if charTransitionSeen && targetMessage != nil {
+							// Responses into a specific message can not be split up, as new messages would end up at the end of the chat.
+							logger.Warn("LLM switched character while responding to a specific message. Parser canceled.",
+								zap.Int("characterId", characterId))
+							cancelCtx()
+							break tokenLoop
+						} else if charTransitionSeen {
 							// We have seen a transition before, this one should be a new message on the stack.
 							addMessageToStack()
 						} else {
@@ -356,6 +603,43 @@ func generateResponse(
 			}
 		case <-ctx.Done():
 			logger.Debug("Cancelled by context")
+			cancelCtx()
+			// Drain remaining responses, so the provider is not blocked on sending
+			go func() {
+				for range chatResponseChan {
+				}
+			}()
+			return nil
+		}
+	}
+}
+
+// getChatFallbackModelInstances returns the models to fall back on when the chat model of the session fails, in
+// order. These are the fallback models of the session, or those of the preferences when the session has none.
+func getChatFallbackModelInstances(
+	logger *zap.Logger,
+	session *cs.ChatSession,
+	prefs *p.Preferences,
+) []*prov.LlmModelInstance {
+	fallbackModelIds := session.ChatFallbackModelIds
+	if len(fallbackModelIds) == 0 {
+		fallbackModelIds = prefs.ChatFallbackModelIds
+	}
+
+	var instances []*prov.LlmModelInstance
+	for _, modelId := range fallbackModelIds {
+		if modelId == *session.ChatModelId {
+			continue
+		}
+
+		instance, err := prov.GetLlmModelInstanceById(modelId)
+		if err != nil || instance == nil {
+			logger.Warn("Skipping unavailable chat fallback model",
+				zap.Int("modelId", modelId), zap.Error(err))
+			continue
 		}
+		instances = append(instances, instance)
 	}
+
+	return instances
 }
@@ -1,31 +1,137 @@
 package processing
 
 import (
+	"context"
+	"fmt"
+
+	"juraji.nl/chat-quest/core/backup"
+	"juraji.nl/chat-quest/core/jobs"
 	cs "juraji.nl/chat-quest/model/chat-sessions"
 	m "juraji.nl/chat-quest/model/memories"
 	p "juraji.nl/chat-quest/model/preferences"
 )
 
+// Background jobs, payloads are stored with the job, so they survive restarts.
+// Response jobs are attempted once, as a failed attempt may leave a partial message behind.
+// Transient provider errors are already retried by the provider.
+var (
+	greetingJob             = jobs.NewJobType("Greeting", jobs.SingleAttempt, GreetOnParticipantAdded)
+	chatResponseJob         = jobs.NewJobType("ChatResponse", jobs.SingleAttempt, GenerateResponseByMessageCreated)
+	sessionSummaryJob       = jobs.NewJobType("SessionSummary", jobs.DefaultMaxAttempts, UpdateSessionSummary)
+	memoriesJob             = jobs.NewJobType("Memories", jobs.DefaultMaxAttempts, GenerateMemories)
+	memoryBookmarkJob       = jobs.NewJobType("MemoryBookmark", jobs.DefaultMaxAttempts, UpdateBookmarkOnMemoryGenEnable)
+	memoryEmbeddingsJob     = jobs.NewJobType("MemoryEmbeddings", jobs.DefaultMaxAttempts, GenerateEmbeddings)
+	regenerateEmbeddingsJob = jobs.NewJobType("RegenerateEmbeddings", jobs.DefaultMaxAttempts, RegenerateEmbeddingsOnPrefsUpdate)
+	memoryConsolidationJob  = jobs.NewJobType("MemoryConsolidation", jobs.DefaultMaxAttempts, ConsolidateWorldMemories)
+	deletedMessagesJob      = jobs.NewJobType("MemoriesOnMessagesDeleted", jobs.DefaultMaxAttempts, UpdateMemoriesOnMessagesDeleted)
+	memoryIndexJob          = jobs.NewJobType("MemoryIndex", jobs.DefaultMaxAttempts, RebuildMemoryIndex)
+)
+
 func SetupProcessing() {
 	// Chat greetings
 	cs.ChatParticipantAddedSignal.AddListener(
-		"GreetOnParticipantAdded", GreetOnParticipantAdded)
+		"GreetOnParticipantAdded", func(_ context.Context, participant *cs.ChatParticipant) error {
+			if participant == nil || !participant.NewlyAdded {
+				return nil
+			}
+			return greetingJob.Enqueue(participant, chatSessionJobKey(participant.ChatSessionID))
+		})
 
 	// Chat response
 	cs.ChatMessageCreatedSignal.AddListener(
-		"GenerateResponse", GenerateResponseByMessageCreated)
+		"GenerateResponse", func(_ context.Context, message *cs.ChatMessage) error {
+			if message == nil || !message.IsUser {
+				return nil
+			}
+			return chatResponseJob.Enqueue(message, chatSessionJobKey(message.ChatSessionID))
+		})
+
+	// Session summaries
+	ChatHistoryAgedOutSignal.AddListener(
+		"UpdateSessionSummary", func(_ context.Context, e *ChatHistoryAgedOut) error {
+			return sessionSummaryJob.Enqueue(e, fmt.Sprintf("summary:%d", e.ChatSessionID))
+		})
 
 	// Memory generation
+	enqueueGenerateMemories := func(_ context.Context, message *cs.ChatMessage) error {
+		if message == nil || message.IsGenerating {
+			// Skip messages that are still being generated
+			return nil
+		}
+		return memoriesJob.Enqueue(message, memoriesJobKey(message.ChatSessionID))
+	}
 	cs.ChatMessageCreatedSignal.AddListener(
-		"GenerateMemories", GenerateMemories)
+		"GenerateMemories", enqueueGenerateMemories)
 	cs.ChatMessageUpdatedSignal.AddListener(
-		"GenerateMemories", GenerateMemories)
+		"GenerateMemories", enqueueGenerateMemories)
 	cs.ChatSessionUpdatedBASignal.AddListener(
-		"UpdateBookmarkOnMemoryGenEnable", UpdateBookmarkOnMemoryGenEnable)
+		"UpdateBookmarkOnMemoryGenEnable", func(_ context.Context, e *cs.ChatSessionUpdatedBAEvent) error {
+			if !e.After.GenerateMemories || e.Before.GenerateMemories == e.After.GenerateMemories {
+				return nil
+			}
+			return memoryBookmarkJob.Enqueue(e, memoriesJobKey(e.SessionId))
+		})
+	cs.ChatMessagesDeletedFromSignal.AddListener(
+		"UpdateMemoriesOnMessagesDeleted", func(_ context.Context, e *cs.ChatMessagesDeletedFromEvent) error {
+			return deletedMessagesJob.Enqueue(e, memoriesJobKey(e.ChatSessionID))
+		})
+
+	enqueueGenerateEmbeddings := func(_ context.Context, memory *m.Memory) error {
+		if memory == nil || memory.EmbeddingModelId != nil {
+			// Imported memories can come with embeddings
+			return nil
+		}
+		return memoryEmbeddingsJob.Enqueue(memory, fmt.Sprintf("memory:%d", memory.ID))
+	}
 	m.MemoryCreatedSignal.AddListener(
-		"GenerateMemoryEmbeddings", GenerateEmbeddings)
+		"GenerateMemoryEmbeddings", enqueueGenerateEmbeddings)
 	m.MemoryUpdatedSignal.AddListener(
-		"GenerateMemoryEmbeddings", GenerateEmbeddings)
+		"GenerateMemoryEmbeddings", enqueueGenerateEmbeddings)
 	p.PreferencesUpdatedSignal.AddListener(
-		"RegenerateMemoryEmbeddings", RegenerateEmbeddingsOnPrefsUpdate)
+		"RegenerateMemoryEmbeddings", func(_ context.Context, prefs *p.Preferences) error {
+			return regenerateEmbeddingsJob.Enqueue(prefs, "embeddings")
+		})
+
+	// Memory index
+	updateMemoryIndex := func(_ context.Context, memory *m.Memory) error {
+		if memory == nil {
+			return nil
+		}
+		return UpdateMemoryIndex(memory.ID)
+	}
+	m.MemoryCreatedSignal.AddListener(
+		"UpdateMemoryIndex", updateMemoryIndex)
+	m.MemoryUpdatedSignal.AddListener(
+		"UpdateMemoryIndex", updateMemoryIndex)
+	m.MemoryEmbeddingUpdatedSignal.AddListener(
+		"UpdateMemoryIndex", func(_ context.Context, memoryId int) error {
+			return UpdateMemoryIndex(memoryId)
+		})
+	m.MemoryDeletedSignal.AddListener(
+		"UpdateMemoryIndex", func(_ context.Context, memoryId int) error {
+			RemoveFromMemoryIndex(memoryId)
+			return nil
+		})
+	p.PreferencesUpdatedSignal.AddListener(
+		"SwitchMemoryIndexModel", func(_ context.Context, prefs *p.Preferences) error {
+			return SwitchMemoryIndexModel(prefs)
+		})
+	backup.BackupRestoringSignal.AddListener(
+		"CancelAllGenerations", func(ctx context.Context, _ *backup.Manifest) error {
+			return CancelAllGenerationsAndWait(ctx)
+		})
+	backup.BackupRestoredSignal.AddListener(
+		"ResetMemoryIndex", func(_ context.Context, _ *backup.Manifest) error {
+			return ResetMemoryIndex()
+		})
+}
+
+// chatSessionJobKey orders jobs that write messages into a chat session, like greetings and responses.
+func chatSessionJobKey(sessionId int) string {
+	return fmt.Sprintf("chat-session:%d", sessionId)
+}
+
+// memoriesJobKey orders jobs that work on the memories (and bookmark) of a chat session.
+func memoriesJobKey(sessionId int) string {
+	return fmt.Sprintf("memories:%d", sessionId)
 }
@@ -0,0 +1,21 @@
+package processing
+
+import (
+	"juraji.nl/chat-quest/core/sse"
+	"juraji.nl/chat-quest/core/util/signals"
+)
+
+var ChatContextTrimmedSignal = signals.New[*ChatContextTrimmed]()
+var ChatHistoryAgedOutSignal = signals.New[*ChatHistoryAgedOut]()
+var GenerationStartedSignal = signals.New[*Generation]()
+var GenerationUpdatedSignal = signals.New[*Generation]()
+var GenerationEndedSignal = signals.New[string]()
+var EmbeddingsProgressSignal = signals.New[*EmbeddingsProgress]()
+
+func init() {
+	sse.RegisterOnSSE("ChatContextTrimmed", ChatContextTrimmedSignal)
+	sse.RegisterOnSSE("GenerationStarted", GenerationStartedSignal)
+	sse.RegisterOnSSE("GenerationUpdated", GenerationUpdatedSignal)
+	sse.RegisterOnSSE("GenerationEnded", GenerationEndedSignal)
+	sse.RegisterOnSSE("EmbeddingsProgress", EmbeddingsProgressSignal)
+}
@@ -0,0 +1,174 @@
+package processing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"juraji.nl/chat-quest/core/log"
+	p "juraji.nl/chat-quest/core/providers"
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+	i "juraji.nl/chat-quest/model/instructions"
+	pf "juraji.nl/chat-quest/model/preferences"
+)
+
+// summaryMaxMessagesPerRun limits the messages folded into the summary per LLM call,
+// so long sessions without a summary yet are caught up in multiple steps.
+const summaryMaxMessagesPerRun = 50
+
+// ChatHistoryAgedOut signals that messages before BeforeMessageID are no longer part of the chat context.
+type ChatHistoryAgedOut struct {
+	ChatSessionID   int
+	BeforeMessageID int
+}
+
+var summaryGenLocks = newSessionScopedLocks()
+
+// UpdateSessionSummary folds messages that aged out of the chat context into the running session summary.
+// Messages are collected until at least SummaryTriggerAfter messages are pending, to avoid summarizing on every response.
+func UpdateSessionSummary(ctx context.Context, e *ChatHistoryAgedOut) error {
+	logger := log.Get().With(
+		zap.Int("chatSessionId", e.ChatSessionID),
+		zap.Int("beforeMessageId", e.BeforeMessageID))
+
+	prefs, err := pf.GetPreferences(false)
+	if err != nil {
+		logger.Error("Error getting preferences", zap.Error(err))
+		return errors.Wrap(err, "error getting preferences")
+	}
+	if !prefs.SummariesEnabled() {
+		return nil
+	}
+
+	// Lock while processing to avoid multiple responses invoking simultaneous generation.
+	// If the lock is already active we cancel this invocation, the next one will pick up the remaining messages.
+	if lockOk, unlock := summaryGenLocks.CheckLock(e.ChatSessionID); lockOk {
+		defer unlock()
+	} else {
+		logger.Debug("Summary generation already in progress for this session, skipping attempt")
+		return nil
+	}
+
+	// Cancellation
+	ctx, cleanup := registerGeneration(ctx, logger, "UpdateSessionSummary", e.ChatSessionID)
+	defer cleanup()
+
+	session, err := cs.GetById(e.ChatSessionID)
+	if err != nil {
+		logger.Error("Error getting session", zap.Error(err))
+		return errors.Wrap(err, "error getting session")
+	}
+
+	triggerAfter := max(prefs.SummaryTriggerAfter, 1)
+
+	for {
+		if contextCheckPoint(ctx, logger) {
+			return nil
+		}
+
+		summary, err := cs.GetChatSessionSummary(session.ID)
+		if err != nil {
+			logger.Error("Error getting session summary", zap.Error(err))
+			return errors.Wrap(err, "error getting session summary")
+		}
+
+		afterId := 0
+		if summary != nil {
+			afterId = summary.UpToMessageID
+		}
+
+		messages, err := cs.GetMessagesInSessionAfterId(session.ID, afterId, summaryMaxMessagesPerRun)
+		if err != nil {
+			logger.Error("Error getting chat messages", zap.Error(err))
+			return errors.Wrap(err, "error getting chat messages")
+		}
+
+		// Only messages that aged out of the context
+		agedOutCount := 0
+		for agedOutCount < len(messages) && messages[agedOutCount].ID < e.BeforeMessageID {
+			agedOutCount++
+		}
+		messages = messages[:agedOutCount]
+
+		if len(messages) < triggerAfter {
+			logger.Debug("Not enough aged out messages to update summary",
+				zap.Int("pending", len(messages)),
+				zap.Int("triggerAfter", triggerAfter))
+			return nil
+		}
+
+		logger.Info("Updating session summary...", zap.Int("messages", len(messages)))
+		content, err := generateSummary(ctx, logger, session, prefs, summary, messages)
+		if err != nil {
+			return err
+		}
+		if content == "" {
+			// Canceled or empty response, keep the current summary
+			return nil
+		}
+
+		lastMessageId := messages[len(messages)-1].ID
+		if _, err = cs.SaveChatSessionSummary(session.ID, lastMessageId, content); err != nil {
+			logger.Error("Error saving session summary", zap.Error(err))
+			return errors.Wrap(err, "error saving session summary")
+		}
+
+		logger.Info("Session summary updated", zap.Int("upToMessageId", lastMessageId))
+	}
+}
+
+func generateSummary(
+	ctx context.Context,
+	logger *zap.Logger,
+	session *cs.ChatSession,
+	prefs *pf.Preferences,
+	previousSummary *cs.ChatSessionSummary,
+	messages []cs.ChatMessage,
+) (string, error) {
+	modelInstance, err := p.GetLlmModelInstanceById(*prefs.SummaryModelId)
+	if err != nil {
+		logger.Error("Could not fetch summary model", zap.Error(err))
+		return "", errors.Wrap(err, "could not fetch summary model")
+	}
+
+	instruction, err := i.InstructionById(*prefs.SummaryInstructionId)
+	if err != nil {
+		logger.Error("Could not fetch summary instruction", zap.Error(err))
+		return "", errors.Wrap(err, "could not fetch summary instruction")
+	}
+
+	lastMessage := messages[len(messages)-1]
+	templateVars := NewSummaryInstructionVars(session, *lastMessage.CreatedAt, previousSummary)
+	if err = instruction.ApplyTemplates(templateVars); err != nil {
+		logger.Error("Error applying instruction templates", zap.Error(err))
+		return "", errors.Wrap(err, "error applying instruction templates")
+	}
+
+	logInstructionsToFile(logger, instruction, messages)
+
+	// Call model
+	requestMessages := createChatRequestMessages(messages, instruction)
+	chatResponseChan := p.GenerateChatResponse(ctx, modelInstance, requestMessages, instruction.AsLlmParameters())
+	var summaryResponse strings.Builder
+
+	for {
+		select {
+		case r, hasNext := <-chatResponseChan:
+			if r.Error != nil {
+				logger.Error("Error in response",
+					zap.String("generated", summaryResponse.String()),
+					zap.Error(r.Error))
+				return "", errors.Wrap(r.Error, "error in response")
+			}
+
+			summaryResponse.WriteString(r.Content)
+			if !hasNext {
+				return strings.TrimSpace(summaryResponse.String()), nil
+			}
+		case <-ctx.Done():
+			logger.Debug("Canceled by context")
+			return "", nil
+		}
+	}
+}
@@ -41,7 +41,7 @@ func GenerateTitle(
 	}
 
 	// Cancellation
-	ctx, cleanup := setupCancelBySystem(ctx, logger, "GenerateTitle")
+	ctx, cleanup := registerGeneration(ctx, logger, "GenerateTitle", sessionID)
 	defer cleanup()
 
 	if contextCheckPoint(ctx, logger) {
@@ -88,7 +88,7 @@ func GenerateTitle(
 	}
 
 	// Build instruction
-	templateVars := NewChatInstructionVars(session, prefs, nil, sessionMessageCount, 0)
+	templateVars := NewChatInstructionVars(session, prefs, nil, nil, sessionMessageCount, 0)
 	instruction, err := i.InstructionById(*prefs.TitleGenerationInstructionId)
 	if err != nil {
 		logger.Error("Could not fetch memory instruction", zap.Error(err))
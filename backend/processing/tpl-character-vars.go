@@ -2,17 +2,14 @@ package processing
 
 import (
 	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"juraji.nl/chat-quest/core/log"
-	prov "juraji.nl/chat-quest/core/providers"
 	"juraji.nl/chat-quest/core/util"
 	c "juraji.nl/chat-quest/model/characters"
 	cs "juraji.nl/chat-quest/model/chat-sessions"
-	m "juraji.nl/chat-quest/model/memories"
 	p "juraji.nl/chat-quest/model/preferences"
 	sp "juraji.nl/chat-quest/model/species"
 )
@@ -180,133 +177,22 @@ func NewTemplateCharacter(
 				return nil, nil
 			}
 
-			chatHistory, err := cs.GetTailChatMessages(session.ID, prefs.MemoryIncludeChatSize)
+			retrieval, err := retrieveMemories(session, char.ID, prefs)
 			if err != nil {
-				return nil, errors.Wrap(err, "failed to fetch chat messages for memory scan")
+				return nil, errors.Wrapf(err, "failed to retrieve memories for character ID %d", char.ID)
 			}
 
-			memories, err := m.GetMemoriesByWorldAndCharacterIdWithEmbeddings(
-				session.WorldID, char.ID, *prefs.EmbeddingModelId)
-			if err != nil {
-				return nil, errors.Wrapf(err, "failed to get memories for character ID %d", char.ID)
-			}
-
-			// Short circuit: Character has no memories
-			if len(memories) == 0 {
-				return nil, nil
-			}
-
-			// Short circuit: No chat history, just get "AlwaysInclude" memories and return.
-			if len(chatHistory) == 0 && session.ChatNotes == nil {
-				var staticMemories []string
-				for _, mem := range memories {
-					if mem.AlwaysInclude {
-						staticMemories = append(staticMemories, mem.Content)
-					}
-				}
-
-				return staticMemories, nil
-			}
-
-			// The subject is made up of
-			// - Current participant names.
-			// - Optionally the Chat notes.
-			// - The messages to scan.
-			var subjectBuffer strings.Builder
-			{
-				participants, perr := cs.GetAllParticipantsAsCharacters(session.ID)
-				if perr != nil {
-					return nil, errors.Wrap(perr, "failed to get session participants")
-				}
-				for _, participant := range participants {
-					subjectBuffer.WriteString(participant.Name)
-					subjectBuffer.WriteRune('\n')
-				}
-
-				if prefs.MemoryIncludeChatNotes && session.ChatNotes != nil {
-					subjectBuffer.WriteString(*session.ChatNotes)
-					subjectBuffer.WriteRune('\n')
-				}
-
-				if len(chatHistory) > 0 {
-					for _, msg := range chatHistory {
-						subjectBuffer.WriteString(msg.Content)
-						subjectBuffer.WriteRune('\n')
-					}
-				}
-			}
-
-			// Embed subject text
-			var subjectEmbeddings prov.Embedding
-			{
-				embeddingModelInst, err := prov.GetLlmModelInstanceById(*prefs.EmbeddingModelId)
-				if err != nil {
-					return nil, errors.Wrapf(err, "failed to get embedding model while processing memories for character ID %d", char.ID)
-				}
-
-				subjectEmbeddings, err = prov.GenerateEmbeddings(embeddingModelInst, subjectBuffer.String())
-				if err != nil {
-					return nil, errors.Wrapf(err, "failed to embed subject while processing memories for character ID %d", char.ID)
-				}
-			}
-
-			// Process memories in batches using goroutines
 			var relevantMemories []string
-			{
-				const workerCount = 8
-				const minChunkSize = 10
-				minP := prefs.MemoryMinP
-
-				chunkSize := (len(memories) + workerCount - 1) / workerCount
-				if chunkSize < minChunkSize {
-					chunkSize = minChunkSize
-				}
-
-				relevantMemoriesChan := make(chan string, len(memories))
-				var wg sync.WaitGroup
-
-				for start := 0; start < len(memories); start = start + chunkSize {
-					end := start + chunkSize
-					if end > len(memories) {
-						end = len(memories)
-					}
-
-					wg.Add(1)
-					go func(start, end int) {
-						defer wg.Done()
-
-						for _, memory := range memories[start:end] {
-							//if memory.AlwaysInclude {
-							//	relevantMemoriesChan <- memory.Content
-							//	continue
-							//}
-
-							var similarity float64
-							if memory.AlwaysInclude {
-								similarity = 1.0
-							} else {
-								similarity = subjectEmbeddings.CosineSimilarity(memory.Embedding)
-							}
-
-							if similarity >= minP {
-								logger.Debug("Including memory",
-									zap.Float64("similarity", similarity),
-									zap.String("memory", memory.Content))
-								relevantMemoriesChan <- fmt.Sprintf("(Relevance score: %0.3f) %s", similarity, memory.Content)
-							}
-						}
-					}(start, end)
-				}
-
-				// Wait for all workers to finish
-				go func() {
-					wg.Wait()
-					close(relevantMemoriesChan)
-				}()
-
-				for memory := range relevantMemoriesChan {
-					relevantMemories = append(relevantMemories, memory)
-				}
+			for _, memory := range retrieval.Selected {
+				logger.Debug("Including memory",
+					zap.Float64("score", memory.Score),
+					zap.Float64("relevance", memory.Relevance),
+					zap.Float64("similarity", memory.Similarity),
+					zap.Float64("keywordScore", memory.KeywordScore),
+					zap.Float64("recency", memory.Recency),
+					zap.String("memory", memory.Memory.Content))
+				relevantMemories = append(relevantMemories,
+					fmt.Sprintf("(Relevance score: %0.3f) %s", memory.Relevance, memory.Memory.Content))
 			}
 
 			return relevantMemories, nil
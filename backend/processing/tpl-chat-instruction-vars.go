@@ -5,6 +5,7 @@ import (
 
 	c "juraji.nl/chat-quest/model/characters"
 	cs "juraji.nl/chat-quest/model/chat-sessions"
+	lb "juraji.nl/chat-quest/model/lorebook"
 	p "juraji.nl/chat-quest/model/preferences"
 	sc "juraji.nl/chat-quest/model/scenarios"
 	sp "juraji.nl/chat-quest/model/species"
@@ -28,6 +29,8 @@ type ChatInstructionVars interface {
 	CurrentTimeOfDay() *cs.TimeOfDay
 	CurrentTimeOfDayFmtEN() string
 	ChatNotes() string
+	Summary() (string, error)
+	Lorebook() (TemplateLorebook, error)
 }
 
 type chatInstructionVarsImpl struct {
@@ -41,6 +44,8 @@ type chatInstructionVarsImpl struct {
 	world               func() (string, error)
 	scenario            func() (string, error)
 	presentSpecies      func() ([]TemplateSpecies, error)
+	summary             func() (string, error)
+	lorebook            func() (TemplateLorebook, error)
 }
 
 func (c *chatInstructionVarsImpl) IsTriggeredByMessage() bool {
@@ -87,10 +92,19 @@ func (c *chatInstructionVarsImpl) ChatNotes() string {
 	return *c.chatNotes
 }
 
+func (c *chatInstructionVarsImpl) Summary() (string, error) {
+	return c.summary()
+}
+
+func (c *chatInstructionVarsImpl) Lorebook() (TemplateLorebook, error) {
+	return c.lorebook()
+}
+
 func NewChatInstructionVars(
 	session *cs.ChatSession,
 	prefs *p.Preferences,
 	triggerMessage *cs.ChatMessage,
+	targetMessage *cs.ChatMessage,
 	sessionMessageCount int,
 	currentCharacterId int,
 ) ChatInstructionVars {
@@ -164,5 +178,46 @@ func NewChatInstructionVars(
 
 			return templateSpecies, nil
 		}),
+		summary: sync.OnceValues(func() (string, error) {
+			summary, err := cs.GetChatSessionSummary(session.ID)
+			if err != nil || summary == nil {
+				return "", err
+			}
+			if targetMessage != nil && summary.UpToMessageID >= targetMessage.ID {
+				// When regenerating, the summary may only cover messages before the target message
+				return "", nil
+			}
+
+			return summary.Content, nil
+		}),
+		lorebook: sync.OnceValues(func() (TemplateLorebook, error) {
+			entries, err := lb.GetEnabledLorebookEntriesForCharacter(session.WorldID, currentCharacterId)
+			if err != nil {
+				return nil, err
+			}
+			if len(entries) == 0 {
+				return NewTemplateLorebook(nil), nil
+			}
+
+			// Scan the recent messages, when regenerating only those before the target message
+			var scannedMessages []cs.ChatMessage
+			if prefs.LorebookScanDepth > 0 {
+				if targetMessage != nil {
+					scannedMessages, err = cs.GetMessagesInSessionBeforeId(session.ID, targetMessage.ID, prefs.LorebookScanDepth)
+				} else {
+					scannedMessages, err = cs.GetTailChatMessages(session.ID, prefs.LorebookScanDepth)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			activated, err := activateLorebookEntries(entries, scannedMessages, prefs.LorebookTokenBudget)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewTemplateLorebook(activated), nil
+		}),
 	}
 }
@@ -0,0 +1,33 @@
+package processing
+
+import (
+	lb "juraji.nl/chat-quest/model/lorebook"
+)
+
+type TemplateLorebook interface {
+	// WorldInfo contains the activated entries to be inserted with the world description.
+	WorldInfo() []string
+	// AfterCharacters contains the activated entries to be inserted after the characters and persona.
+	AfterCharacters() []string
+}
+
+type templateLorebookImpl struct {
+	worldInfo       []string
+	afterCharacters []string
+}
+
+func (t *templateLorebookImpl) WorldInfo() []string       { return t.worldInfo }
+func (t *templateLorebookImpl) AfterCharacters() []string { return t.afterCharacters }
+
+func NewTemplateLorebook(entries []lb.LorebookEntry) TemplateLorebook {
+	lorebook := &templateLorebookImpl{}
+	for _, entry := range entries {
+		switch entry.Position {
+		case lb.AfterCharacters:
+			lorebook.afterCharacters = append(lorebook.afterCharacters, entry.Content)
+		default:
+			lorebook.worldInfo = append(lorebook.worldInfo, entry.Content)
+		}
+	}
+	return lorebook
+}
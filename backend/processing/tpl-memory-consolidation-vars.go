@@ -0,0 +1,39 @@
+package processing
+
+import (
+	c "juraji.nl/chat-quest/model/characters"
+	w "juraji.nl/chat-quest/model/worlds"
+)
+
+type MemoryConsolidationVars interface {
+	World() string
+	// Character is nil when consolidating world memories.
+	Character() SparseTemplateCharacter
+	Memories() []string
+}
+
+type memoryConsolidationVarsImpl struct {
+	world     *w.World
+	character SparseTemplateCharacter
+	memories  []string
+}
+
+func (m memoryConsolidationVarsImpl) World() string {
+	if m.world == nil || m.world.Description == nil {
+		return ""
+	}
+	return *m.world.Description
+}
+func (m memoryConsolidationVarsImpl) Character() SparseTemplateCharacter { return m.character }
+func (m memoryConsolidationVarsImpl) Memories() []string                 { return m.memories }
+
+func NewMemoryConsolidationVars(world *w.World, character *c.Character, memories []string) MemoryConsolidationVars {
+	vars := &memoryConsolidationVarsImpl{
+		world:    world,
+		memories: memories,
+	}
+	if character != nil {
+		vars.character = NewSparseTemplateCharacter(character)
+	}
+	return vars
+}
@@ -0,0 +1,35 @@
+package processing
+
+import (
+	"time"
+
+	cs "juraji.nl/chat-quest/model/chat-sessions"
+)
+
+type SummaryInstructionVars interface {
+	MemoryInstructionVars
+	PreviousSummary() string
+}
+
+type summaryInstructionVarsImpl struct {
+	MemoryInstructionVars
+	previousSummary *cs.ChatSessionSummary
+}
+
+func (s summaryInstructionVarsImpl) PreviousSummary() string {
+	if s.previousSummary == nil {
+		return ""
+	}
+	return s.previousSummary.Content
+}
+
+func NewSummaryInstructionVars(
+	session *cs.ChatSession,
+	before time.Time,
+	previousSummary *cs.ChatSessionSummary,
+) SummaryInstructionVars {
+	return &summaryInstructionVarsImpl{
+		MemoryInstructionVars: NewMemoryInstructionVars(session, before),
+		previousSummary:       previousSummary,
+	}
+}
@@ -37,6 +37,7 @@ if [[ "$DO_BUILD_GO_BACKEND" == "true" ]]; then
       GOOS=$os
       GOARCH=$arch
       go build \
+        -tags sqlite_fts5 \
         -ldflags="-X main.ChatQuestUIDir=$GO_RUNTIME_UI_DIR -X main.GinMode=$GO_RUNTIME_GIN_MODE" \
         -a -o "$target"
   done
@@ -0,0 +1,10 @@
+export type ThumbnailSize = 128 | 256 | 512
+
+export interface Asset {
+  name: string
+  url: string
+  mimeType: string
+  size: number
+  width: number
+  height: number
+}
@@ -0,0 +1,34 @@
+import {inject, Injectable} from '@angular/core';
+import {HttpClient} from '@angular/common/http';
+import {Observable} from 'rxjs';
+import {ChatQuestUIConfig} from '@config/config';
+import {Asset, ThumbnailSize} from './assets.model';
+
+const ASSET_URL_PREFIX = 'assets/'
+
+@Injectable({
+  providedIn: 'root'
+})
+export class Assets {
+  private http: HttpClient = inject(HttpClient)
+  private config: ChatQuestUIConfig = inject(ChatQuestUIConfig)
+
+  upload(image: Blob): Observable<Asset> {
+    const formData = new FormData()
+    formData.append('file', image)
+    return this.http.post<Asset>(`/assets`, formData)
+  }
+
+  /**
+   * Resolves asset urls (relative to the API) to absolute urls, optionally of a thumbnail.
+   * Other urls, like data urls and external urls, are returned as-is.
+   */
+  resolveUrl(url: string, size: Nullable<ThumbnailSize> = null): string
+  resolveUrl(url: Nullable<string>, size?: Nullable<ThumbnailSize>): Nullable<string>
+  resolveUrl(url: Nullable<string>, size: Nullable<ThumbnailSize> = null): Nullable<string> {
+    if (!url || !url.startsWith(ASSET_URL_PREFIX)) return url
+
+    const resolved = `${this.config.apiBaseUrl}/${url}`
+    return !!size ? `${resolved}?size=${size}` : resolved
+  }
+}
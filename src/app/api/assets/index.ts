@@ -0,0 +1,2 @@
+export * from "./assets.model"
+export * from "./assets.service"
@@ -26,3 +26,5 @@ export interface CharacterBuilderRequest {
 export const CharacterCreated: SseEvent<Character> = 'CharacterCreated'
 export const CharacterUpdated: SseEvent<Character> = 'CharacterUpdated'
 export const CharacterDeleted: SseEvent<number> = 'CharacterDeleted'
+
+export type CharacterCardSpec = 'v2' | 'v3'
@@ -4,6 +4,7 @@ import {Observable} from 'rxjs';
 import {
   Character,
   CharacterBuilderRequest,
+  CharacterCardSpec,
   CharacterCreated,
   CharacterDeleted,
   CharacterUpdated
@@ -84,6 +85,25 @@ export class Characters {
     return this.http.post<Blob>(`/characters/${characterId}/export/text`, null, {params, responseType: "blob" as any})
   }
 
+  exportAsCard(characterId: number, spec: CharacterCardSpec = 'v3'): Observable<Blob> {
+    const params = new HttpParams()
+      .append('spec', spec)
+    return this.http.post<Blob>(`/characters/${characterId}/export/card`, null, {params, responseType: "blob" as any})
+  }
+
+  exportAsPng(characterId: number): Observable<Blob> {
+    return this.http.post<Blob>(`/characters/${characterId}/export/png`, null, {responseType: "blob" as any})
+  }
+
+  importCard(file: File, worldId?: number): Observable<Character> {
+    let params = new HttpParams()
+    if (!!worldId) params = params.append('worldId', worldId)
+
+    const formData = new FormData()
+    formData.append('file', file)
+    return this.http.post<Character>(`/characters/import`, formData, {params})
+  }
+
   buildCharacter(request: CharacterBuilderRequest): Observable<Character> {
     return this.http.post<Character>(`/characters/build`, request)
   }
@@ -27,6 +27,7 @@ export interface ChatSession extends ChatQuestModel {
   personaId: Nullable<number>
   chatModelId: Nullable<number>
   chatInstructionId: Nullable<number>
+  chatFallbackModelIds: Nullable<number[]>
   readonly lastTotalTokens: number
   readonly lastCompletionTokens: number
 }
@@ -39,6 +40,14 @@ export interface ChatMessage extends ChatQuestModel {
   characterId: Nullable<number>
   content: string
   reasoning: string
+  readonly activeAlternativeId: Nullable<number>
+}
+
+export interface ChatMessageAlternative extends ChatQuestModel {
+  chatMessageId: number
+  createdAt: Nullable<string>
+  content: string
+  reasoning: string
 }
 
 export interface ChatParticipant {
@@ -50,11 +59,40 @@ export interface ChatParticipant {
   newlyAdded: boolean
 }
 
+export interface ChatSessionSummary {
+  chatSessionId: number
+  upToMessageId: number
+  updatedAt: Nullable<string>
+  content: string
+}
+
+export interface Generation {
+  id: string
+  name: string
+  chatSessionId: Nullable<number>
+  messageId: Nullable<number>
+  startedAt: string
+}
+
+export interface ChatContextTrimmed {
+  chatSessionId: number
+  contextLength: number
+  usedTokens: number
+  includedMessages: number
+  droppedMessages: number
+}
+
 export const ChatSessionCreated: SseEvent<ChatSession> = 'ChatSessionCreated'
 export const ChatSessionUpdated: SseEvent<ChatSession> = 'ChatSessionUpdated'
 export const ChatSessionDeleted: SseEvent<number> = 'ChatSessionDeleted'
 export const ChatMessageCreated: SseEvent<ChatMessage> = 'ChatMessageCreated'
 export const ChatMessageUpdated: SseEvent<ChatMessage> = 'ChatMessageUpdated'
 export const ChatMessageDeleted: SseEvent<number> = 'ChatMessageDeleted'
+export const ChatSessionSummaryUpdated: SseEvent<ChatSessionSummary> = 'ChatSessionSummaryUpdated'
+export const ChatSessionSummaryDeleted: SseEvent<number> = 'ChatSessionSummaryDeleted'
 export const ChatParticipantAdded: SseEvent<ChatParticipant> = 'ChatParticipantAdded'
 export const ChatParticipantRemoved: SseEvent<ChatParticipant> = 'ChatParticipantRemoved'
+export const ChatContextTrimmed: SseEvent<ChatContextTrimmed> = 'ChatContextTrimmed'
+export const GenerationStarted: SseEvent<Generation> = 'GenerationStarted'
+export const GenerationUpdated: SseEvent<Generation> = 'GenerationUpdated'
+export const GenerationEnded: SseEvent<string> = 'GenerationEnded'
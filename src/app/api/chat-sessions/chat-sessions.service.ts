@@ -1,7 +1,14 @@
 import {inject, Injectable} from '@angular/core';
 import {HttpClient} from '@angular/common/http';
 import {Observable} from 'rxjs';
-import {ChatMessage, ChatParticipant, ChatSession} from './chat-sessions.model';
+import {
+  ChatMessage,
+  ChatMessageAlternative,
+  ChatParticipant,
+  ChatSession,
+  ChatSessionSummary,
+  Generation
+} from './chat-sessions.model';
 import {isNew} from '@api/common';
 
 @Injectable({
@@ -30,6 +37,26 @@ export class ChatSessions {
     return this.http.delete<void>(`/worlds/${worldId}/chat-sessions/${sessionId}`)
   }
 
+  getGenerations(worldId: number, sessionId: number): Observable<Generation[]> {
+    return this.http.get<Generation[]>(`/worlds/${worldId}/chat-sessions/${sessionId}/generations`)
+  }
+
+  cancelGenerations(worldId: number, sessionId: number): Observable<void> {
+    return this.http.delete<void>(`/worlds/${worldId}/chat-sessions/${sessionId}/generations`)
+  }
+
+  getSummary(worldId: number, sessionId: number): Observable<ChatSessionSummary> {
+    return this.http.get<ChatSessionSummary>(`/worlds/${worldId}/chat-sessions/${sessionId}/summary`)
+  }
+
+  saveSummary(worldId: number, sessionId: number, summary: ChatSessionSummary): Observable<ChatSessionSummary> {
+    return this.http.put<ChatSessionSummary>(`/worlds/${worldId}/chat-sessions/${sessionId}/summary`, summary)
+  }
+
+  deleteSummary(worldId: number, sessionId: number): Observable<void> {
+    return this.http.delete<void>(`/worlds/${worldId}/chat-sessions/${sessionId}/summary`)
+  }
+
   getParticipants(worldId: number, sessionId: number): Observable<ChatParticipant[]> {
     return this.http.get<ChatParticipant[]>(`/worlds/${worldId}/chat-sessions/${sessionId}/participants`);
   }
@@ -65,6 +92,22 @@ export class ChatSessions {
     return this.http.delete<void>(`/worlds/${worldId}/chat-sessions/${sessionId}/chat-messages/${messageId}`)
   }
 
+  getMessageAlternatives(worldId: number, sessionId: number, messageId: number): Observable<ChatMessageAlternative[]> {
+    return this.http.get<ChatMessageAlternative[]>(`/worlds/${worldId}/chat-sessions/${sessionId}/chat-messages/${messageId}/alternatives`)
+  }
+
+  activateMessageAlternative(worldId: number, sessionId: number, messageId: number, alternativeId: number): Observable<ChatMessage> {
+    return this.http.post<ChatMessage>(`/worlds/${worldId}/chat-sessions/${sessionId}/chat-messages/${messageId}/alternatives/${alternativeId}/activate`, null)
+  }
+
+  regenerateMessage(worldId: number, sessionId: number, messageId: number): Observable<void> {
+    return this.http.post<void>(`/worlds/${worldId}/chat-sessions/${sessionId}/chat-messages/${messageId}/regenerate`, null)
+  }
+
+  continueMessage(worldId: number, sessionId: number, messageId: number): Observable<void> {
+    return this.http.post<void>(`/worlds/${worldId}/chat-sessions/${sessionId}/chat-messages/${messageId}/continue`, null)
+  }
+
   forkChatSession(worldId: number, sessionId: number, messageId: number): Observable<ChatSession> {
     return this.http.post<ChatSession>(`/worlds/${worldId}/chat-sessions/${sessionId}/chat-messages/${messageId}/fork`, null)
   }
@@ -1,6 +1,6 @@
 import {ChatQuestModel} from '@api/common';
 
-export type InstructionType = 'CHAT' | 'MEMORIES' | 'TITLE_GENERATION' | 'CHARACTER_EXPORT' | 'CHARACTER_BUILDER';
+export type InstructionType = 'CHAT' | 'MEMORIES' | 'TITLE_GENERATION' | 'CHARACTER_EXPORT' | 'CHARACTER_BUILDER' | 'SUMMARY' | 'MEMORY_CONSOLIDATION';
 
 export interface Instruction extends ChatQuestModel {
   name: string
@@ -16,6 +16,14 @@ export interface Instruction extends ChatQuestModel {
   stopSequences: Nullable<string>
   includeReasoning: boolean
 
+  // Extended Model Settings (Not supported by all providers)
+  topK: Nullable<number>
+  minP: Nullable<number>
+  repeatPenalty: Nullable<number>
+  mirostat: Nullable<number>
+  mirostatTau: Nullable<number>
+  mirostatEta: Nullable<number>
+
   // Parsing
   allowMultiCharacterResponses: boolean,
   enableReasoningParsing: boolean,
@@ -41,6 +41,12 @@ export function instructionResolverFactory(idParam: string): ResolveFn<Instructi
           stream: true,
           stopSequences: null,
           includeReasoning: false,
+          topK: null,
+          minP: null,
+          repeatPenalty: null,
+          mirostat: null,
+          mirostatTau: null,
+          mirostatEta: null,
           allowMultiCharacterResponses: false,
           enableReasoningParsing: true,
           reasoningPrefix: '<think>',
@@ -0,0 +1,2 @@
+export * from "./jobs.model"
+export * from "./jobs.service"
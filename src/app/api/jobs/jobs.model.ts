@@ -0,0 +1,29 @@
+import {ChatQuestModel} from '@api/common';
+import {SseEvent} from '@api/sse';
+
+export type JobState = 'QUEUED' | 'RUNNING' | 'FAILED' | 'DONE'
+
+export interface Job extends ChatQuestModel {
+  type: string
+  state: JobState
+  orderingKey: Nullable<string>
+  payload: any
+  attempts: number
+  maxAttempts: number
+  lastError: Nullable<string>
+  runAfter: Nullable<string>
+  createdAt: Nullable<string>
+  updatedAt: Nullable<string>
+}
+
+export interface JobProgress {
+  jobId: number
+  type: string
+  progress: number
+  message: string
+}
+
+export const JobCreated: SseEvent<Job> = 'JobCreated'
+export const JobUpdated: SseEvent<Job> = 'JobUpdated'
+export const JobDeleted: SseEvent<number> = 'JobDeleted'
+export const JobProgressUpdated: SseEvent<JobProgress> = 'JobProgress'
@@ -0,0 +1,36 @@
+import {inject, Injectable} from '@angular/core';
+import {HttpClient, HttpParams} from '@angular/common/http';
+import {Observable} from 'rxjs';
+import {Job, JobState} from './jobs.model';
+
+@Injectable({
+  providedIn: 'root'
+})
+export class Jobs {
+  private http: HttpClient = inject(HttpClient)
+
+  getAll(state: JobState | null = null): Observable<Job[]> {
+    let params = new HttpParams()
+    if (!!state) {
+      params = params.set("state", state)
+    }
+
+    return this.http.get<Job[]>(`/jobs`, {params})
+  }
+
+  get(jobId: number): Observable<Job> {
+    return this.http.get<Job>(`/jobs/${jobId}`)
+  }
+
+  retry(jobId: number): Observable<Job> {
+    return this.http.post<Job>(`/jobs/${jobId}/retry`, null)
+  }
+
+  delete(jobId: number): Observable<void> {
+    return this.http.delete<void>(`/jobs/${jobId}`)
+  }
+
+  deleteByState(state: JobState): Observable<void> {
+    return this.http.delete<void>(`/jobs`, {params: {state}})
+  }
+}
@@ -0,0 +1,2 @@
+export * from "./lorebook.model"
+export * from "./lorebook.service"
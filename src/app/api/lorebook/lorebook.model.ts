@@ -0,0 +1,25 @@
+import {ChatQuestModel} from '@api/common';
+import {SseEvent} from '@api/sse';
+
+export type LorebookSecondaryLogic = 'AND_ANY' | 'AND_ALL' | 'NOT_ANY' | 'NOT_ALL'
+export type LorebookPosition = 'WORLD_INFO' | 'AFTER_CHARACTERS'
+
+export interface LorebookEntry extends ChatQuestModel {
+  worldId: number
+  characterId: Nullable<number>
+  name: string
+  content: string
+  keywords: string
+  secondaryKeywords: Nullable<string>
+  secondaryLogic: LorebookSecondaryLogic
+  caseSensitive: boolean
+  alwaysInclude: boolean
+  enabled: boolean
+  priority: number
+  position: LorebookPosition
+  tokenBudget: Nullable<number>
+}
+
+export const LorebookEntryCreated: SseEvent<LorebookEntry> = 'LorebookEntryCreated'
+export const LorebookEntryUpdated: SseEvent<LorebookEntry> = 'LorebookEntryUpdated'
+export const LorebookEntryDeleted: SseEvent<number> = 'LorebookEntryDeleted'
@@ -0,0 +1,32 @@
+import {inject, Injectable} from '@angular/core';
+import {HttpClient} from '@angular/common/http';
+import {Observable} from 'rxjs';
+import {LorebookEntry} from './lorebook.model';
+import {isNew} from '@api/common';
+
+@Injectable({
+  providedIn: 'root'
+})
+export class Lorebook {
+  private http: HttpClient = inject(HttpClient)
+
+  getAll(worldId: number): Observable<LorebookEntry[]> {
+    return this.http.get<LorebookEntry[]>(`/worlds/${worldId}/lorebook`)
+  }
+
+  get(worldId: number, entryId: number): Observable<LorebookEntry> {
+    return this.http.get<LorebookEntry>(`/worlds/${worldId}/lorebook/${entryId}`)
+  }
+
+  save(worldId: number, entry: LorebookEntry): Observable<LorebookEntry> {
+    if (isNew(entry)) {
+      return this.http.post<LorebookEntry>(`/worlds/${worldId}/lorebook`, entry)
+    } else {
+      return this.http.put<LorebookEntry>(`/worlds/${worldId}/lorebook/${entry.id}`, entry)
+    }
+  }
+
+  delete(worldId: number, entryId: number): Observable<void> {
+    return this.http.delete<void>(`/worlds/${worldId}/lorebook/${entryId}`)
+  }
+}
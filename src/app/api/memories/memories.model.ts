@@ -7,6 +7,84 @@ export interface Memory extends ChatQuestModel {
   createdAt: Nullable<string>
   content: string
   alwaysInclude: boolean
+  importance: number
+  readonly sourceChatSessionId: Nullable<number>
+  readonly sourceFromMessageId: Nullable<number>
+  readonly sourceToMessageId: Nullable<number>
+}
+
+export type MemorySelectionReason =
+  'ALWAYS_INCLUDED'
+  | 'SELECTED'
+  | 'BELOW_MIN_P'
+  | 'TOP_K_REACHED'
+  | 'TOKEN_BUDGET_EXCEEDED'
+  | 'NO_CHAT_HISTORY'
+  | 'MISSING_EMBEDDING'
+
+export interface ScoredMemory {
+  memory: Memory
+  similarity: number
+  keywordScore: number
+  relevance: number
+  recency: number
+  score: number
+  tokens: number
+  included: boolean
+  reason: MemorySelectionReason
+}
+
+export interface MemoryRetrievalExplanation {
+  chatSessionId: number
+  characterId: number
+  useMemories: boolean
+  subject: string
+  keywordQuery: string
+  minP: number
+  topK: number
+  tokenBudget: number
+  usedTokens: number
+  indexed: boolean
+  memories: ScoredMemory[]
+}
+
+export interface ProposedMemory {
+  content: string
+  importance: number
+}
+
+export interface ConsolidationProposal extends ChatQuestModel {
+  worldId: number
+  characterId: Nullable<number>
+  createdAt: Nullable<string>
+  sourceMemoryIds: number[]
+  memories: ProposedMemory[]
+}
+
+export interface MemoryMergeSource extends ChatQuestModel {
+  memoryId: number
+  sourceMemoryId: number
+  content: string
+  createdAt: Nullable<string>
+  mergedAt: Nullable<string>
+}
+
+export type MemoryTransferFormat = 'json' | 'jsonl'
+export type MemoryImportConflict = 'SKIP' | 'REPLACE' | 'DUPLICATE'
+
+export interface MemoryImportResult {
+  imported: number
+  replaced: number
+  skipped: number
+  embeddingsQueued: number
+}
+
+export interface EmbeddingsProgress {
+  embeddingModelId: number
+  done: number
+  total: number
+  errors: number
+  finished: boolean
 }
 
 export interface MemoryBookmarkEvent {
@@ -18,3 +96,5 @@ export const MemoryCreated: SseEvent<Memory> = 'MemoryCreated'
 export const MemoryUpdated: SseEvent<Memory> = 'MemoryUpdated'
 export const MemoryDeleted: SseEvent<number> = 'MemoryDeleted'
 export const MemoryBookmarkUpdated: SseEvent<MemoryBookmarkEvent> = 'MemoryBookmarkUpdated'
+export const MemoryConsolidationProposalsUpdated: SseEvent<number> = 'MemoryConsolidationProposalsUpdated'
+export const EmbeddingsProgressUpdated: SseEvent<EmbeddingsProgress> = 'EmbeddingsProgress'
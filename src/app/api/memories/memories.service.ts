@@ -1,8 +1,17 @@
 import {inject, Injectable} from '@angular/core';
 import {HttpClient, HttpParams} from '@angular/common/http';
 import {Observable} from 'rxjs';
-import {Memory} from './memories.model';
+import {
+  ConsolidationProposal,
+  Memory,
+  MemoryImportConflict,
+  MemoryImportResult,
+  MemoryMergeSource,
+  MemoryRetrievalExplanation,
+  MemoryTransferFormat
+} from './memories.model';
 import {isNew} from '@api/common';
+import {ChatMessage} from '@api/chat-sessions';
 
 @Injectable({
   providedIn: 'root'
@@ -30,6 +39,63 @@ export class Memories {
     return this.http.delete<void>(`/worlds/${worldId}/memories/${memoryId}`)
   }
 
+  getSourceMessages(worldId: number, memoryId: number): Observable<ChatMessage[]> {
+    return this.http.get<ChatMessage[]>(`/worlds/${worldId}/memories/${memoryId}/source-messages`)
+  }
+
+  getMergeSources(worldId: number, memoryId: number): Observable<MemoryMergeSource[]> {
+    return this.http.get<MemoryMergeSource[]>(`/worlds/${worldId}/memories/${memoryId}/sources`)
+  }
+
+  getConsolidationProposals(worldId: number): Observable<ConsolidationProposal[]> {
+    return this.http.get<ConsolidationProposal[]>(`/worlds/${worldId}/memories/consolidation`)
+  }
+
+  consolidate(worldId: number): Observable<void> {
+    return this.http.post<void>(`/worlds/${worldId}/memories/consolidation`, null)
+  }
+
+  applyConsolidationProposal(worldId: number, proposalId: number): Observable<Memory[]> {
+    return this.http.post<Memory[]>(`/worlds/${worldId}/memories/consolidation/${proposalId}/apply`, null)
+  }
+
+  rejectConsolidationProposal(worldId: number, proposalId: number): Observable<void> {
+    return this.http.delete<void>(`/worlds/${worldId}/memories/consolidation/${proposalId}`)
+  }
+
+  exportMemories(
+    worldId: number,
+    characterId: Nullable<number>,
+    format: MemoryTransferFormat,
+    includeEmbeddings: boolean
+  ): Observable<Blob> {
+    let params = new HttpParams()
+      .set('format', format)
+      .set('includeEmbeddings', includeEmbeddings)
+    if (!!characterId) params = params.set('characterId', characterId)
+
+    return this.http.get(`/worlds/${worldId}/memories/export`, {params, responseType: 'blob'})
+  }
+
+  importMemories(
+    worldId: number,
+    file: File,
+    conflict: MemoryImportConflict,
+    characterId: Nullable<number>
+  ): Observable<MemoryImportResult> {
+    let params = new HttpParams().set('conflict', conflict)
+    if (!!characterId) params = params.set('characterId', characterId)
+
+    const formData = new FormData()
+    formData.append('file', file)
+    return this.http.post<MemoryImportResult>(`/worlds/${worldId}/memories/import`, formData, {params})
+  }
+
+  explainRetrieval(worldId: number, chatSessionId: number, characterId: number): Observable<MemoryRetrievalExplanation> {
+    return this.http.get<MemoryRetrievalExplanation>(
+      `/worlds/${worldId}/chat-sessions/${chatSessionId}/memories/explain/${characterId}`)
+  }
+
   getBookmarkMessageId(worldId: number, chatSessionId: number): Observable<Nullable<number>> {
     return this.http.get<Nullable<number>>(`/worlds/${worldId}/memories/bookmarks/${chatSessionId}`)
   }
@@ -1,9 +1,12 @@
 import {SseEvent} from '@api/sse';
 
+export type MemoryMessageDeletePolicy = 'KEEP' | 'DELETE' | 'REGENERATE'
+
 export interface CQPreferences {
   chatModelId: Nullable<number>
   chatInstructionId: Nullable<number>
   maxMessagesInContext: number
+  chatFallbackModelIds: Nullable<number[]>
   embeddingModelId: Nullable<number>
   memoriesModelId: Nullable<number>
   memoriesInstructionId: Nullable<number>
@@ -12,9 +15,28 @@ export interface CQPreferences {
   memoryWindowSize: number
   memoryIncludeChatSize: number
   memoryIncludeChatNotes: boolean
+  memoryVectorWeight: number
+  memoryKeywordWeight: number
+  memoryTopK: number
+  memoryTokenBudget: number
+  memoryRecencyWeight: number
+  memoryRecencyHalfLifeDays: number
+  memoryImportanceWeight: number
+  memoryMmrLambda: number
+  memoryConsolidationModelId: Nullable<number>
+  memoryConsolidationInstructionId: Nullable<number>
+  memoryConsolidationThreshold: number
+  memoryConsolidationIntervalHours: number
+  memoryConsolidationAutoApply: boolean
+  memoryOnMessagesDeleted: MemoryMessageDeletePolicy
   titleGenerationModelId: Nullable<number>
   titleGenerationInstructionId: Nullable<number>
   titleGenerationMessageWindow: number
+  summaryModelId: Nullable<number>
+  summaryInstructionId: Nullable<number>
+  summaryTriggerAfter: number
+  lorebookScanDepth: number
+  lorebookTokenBudget: number
 }
 
 export const PreferencesUpdated: SseEvent<CQPreferences> = 'PreferencesUpdated'
@@ -1,6 +1,9 @@
 import {ChatQuestModel} from '@api/common';
 
-export type ProviderType = "OPEN_AI"
+export type ProviderType =
+  "OPEN_AI" |
+  "ANTHROPIC" |
+  "OLLAMA"
 export type LlmModelType =
   "UNKNOWN" |
   "CHAT_MODEL" |
@@ -11,6 +14,10 @@ export interface ConnectionProfile extends ChatQuestModel {
   providerType: ProviderType
   baseUrl: string
   apiKey: string
+  maxConcurrentRequests: number
+  requestsPerMinute: number
+  maxRetries: number
+  retryBackoffMillis: number
 }
 
 export interface LlmModel extends ChatQuestModel {
@@ -18,6 +25,7 @@ export interface LlmModel extends ChatQuestModel {
   modelId: string
   modelType: LlmModelType
   disabled: boolean
+  contextLength: Nullable<number>
 }
 
 export interface LlmModelView {
@@ -22,7 +22,11 @@ export function connectionProfileResolverFactory(idParam: string): ResolveFn<Con
         name: '',
         providerType: "OPEN_AI",
         baseUrl: '',
-        apiKey: ''
+        apiKey: '',
+        maxConcurrentRequests: 1,
+        requestsPerMinute: 0,
+        maxRetries: 2,
+        retryBackoffMillis: 1000
       }),
       id => service.get(id)
     )
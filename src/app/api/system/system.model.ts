@@ -0,0 +1,12 @@
+export interface BackupFile {
+  name: string
+  size: number
+  createdAt: string
+}
+
+export interface BackupManifest {
+  formatVersion: number
+  createdAt: string
+  migrationVersion: number
+  files: string[]
+}
@@ -1,6 +1,7 @@
 import {inject, Injectable} from '@angular/core';
 import {HttpClient} from '@angular/common/http';
 import {map, Observable} from 'rxjs';
+import {BackupFile, BackupManifest} from './system.model';
 
 @Injectable({
   providedIn: 'root'
@@ -18,6 +19,28 @@ export class System {
     return this.http.post<void>('/system/stop-current-generation', null)
   }
 
+  backups(): Observable<BackupFile[]> {
+    return this.http.get<BackupFile[]>('/system/backups')
+  }
+
+  createBackup(): Observable<Blob> {
+    return this.http.post('/system/backup', null, {responseType: 'blob'})
+  }
+
+  downloadBackup(name: string): Observable<Blob> {
+    return this.http.get(`/system/backups/${name}`, {responseType: 'blob'})
+  }
+
+  restoreBackup(file: File): Observable<BackupManifest> {
+    const formData = new FormData()
+    formData.append('file', file)
+    return this.http.post<BackupManifest>('/system/restore', formData)
+  }
+
+  restoreStoredBackup(name: string): Observable<BackupManifest> {
+    return this.http.post<BackupManifest>(`/system/backups/${name}/restore`, null)
+  }
+
   shutdown() {
     return this.http.post<void>('/system/shutdown', null)
   }
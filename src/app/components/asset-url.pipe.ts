@@ -0,0 +1,13 @@
+import {inject, Pipe, PipeTransform} from '@angular/core';
+import {Assets, ThumbnailSize} from '@api/assets';
+
+@Pipe({
+  name: 'assetUrl',
+})
+export class AssetUrlPipe implements PipeTransform {
+  private readonly assets = inject(Assets)
+
+  transform(value: Nullable<string>, size: Nullable<ThumbnailSize> = null): Nullable<string> {
+    return this.assets.resolveUrl(value, size)
+  }
+}
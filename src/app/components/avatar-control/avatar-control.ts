@@ -14,11 +14,14 @@ import {ControlValueAccessor, NG_VALUE_ACCESSOR} from '@angular/forms';
 import {Notifications} from '../notifications';
 import {AvatarImageCrop} from './avatar-image-crop';
 import {readBlobAsDataUrl} from '@util/blobs';
+import {Assets} from '@api/assets';
+import {AssetUrlPipe} from '../asset-url.pipe';
 
 @Component({
   selector: 'app-avatar-control',
   imports: [
-    AvatarImageCrop
+    AvatarImageCrop,
+    AssetUrlPipe
   ],
   templateUrl: './avatar-control.html',
   styleUrl: './avatar-control.scss',
@@ -35,6 +38,7 @@ import {readBlobAsDataUrl} from '@util/blobs';
 })
 export class AvatarControl implements ControlValueAccessor {
   private notifications = inject(Notifications)
+  private assets = inject(Assets)
 
   private onChange: (value: Nullable<string>) => void = () => null
   private onTouched: () => void = () => null
@@ -84,10 +88,17 @@ export class AvatarControl implements ControlValueAccessor {
     this.onTouched()
   }
 
-  onCropResult(dataUrl: string) {
-    this.currentValue.set(dataUrl)
+  async onCropResult(dataUrl: string) {
     this.cropperDataUrl.set(null)
-    this.onChange(this.currentValue())
+
+    const image = await fetch(dataUrl).then(res => res.blob())
+    this.assets.upload(image).subscribe({
+      next: asset => {
+        this.currentValue.set(asset.url)
+        this.onChange(this.currentValue())
+      },
+      error: () => this.notifications.toast("Failed to upload avatar image.", "DANGER")
+    })
   }
 
   onCropCanceled() {
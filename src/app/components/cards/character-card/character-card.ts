@@ -1,5 +1,6 @@
 import {Component, computed, inject, input, InputSignal, Signal} from '@angular/core';
 import {Character, Characters} from '@api/characters';
+import {Assets} from '@api/assets';
 
 @Component({
   selector: 'app-character-card',
@@ -11,6 +12,7 @@ import {Character, Characters} from '@api/characters';
   }
 })
 export class CharacterCard {
+  private readonly assets = inject(Assets)
   readonly characters = inject(Characters)
 
   readonly characterInp: InputSignal<Character | number> = input.required({alias: 'character'})
@@ -31,6 +33,6 @@ export class CharacterCard {
   protected readonly favorite: Signal<boolean> = computed(() => this.character()?.favorite || false)
   protected readonly avatarUrl: Signal<Nullable<string>> = computed(() => {
     const u = this.character()?.avatarUrl
-    return !!u ? `url(${u})` : null;
+    return !!u ? `url(${this.assets.resolveUrl(u, 512)})` : null;
   })
 }
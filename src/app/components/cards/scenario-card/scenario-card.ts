@@ -1,5 +1,6 @@
-import {Component, computed, input, InputSignal, Signal} from '@angular/core';
+import {Component, computed, inject, input, InputSignal, Signal} from '@angular/core';
 import {Scenario} from '@api/scenarios';
+import {Assets} from '@api/assets';
 
 @Component({
   selector: 'app-scenario-card',
@@ -10,10 +11,11 @@ import {Scenario} from '@api/scenarios';
   }
 })
 export class ScenarioCard {
+  private readonly assets = inject(Assets)
   readonly scenario: InputSignal<Scenario> = input.required()
   readonly name: Signal<string> = computed(() => this.scenario().name)
   protected readonly avatarUrl: Signal<Nullable<string>> = computed(() => {
     const u = this.scenario().avatarUrl
-    return !!u ? `url(${u})` : null;
+    return !!u ? `url(${this.assets.resolveUrl(u, 512)})` : null;
   })
 }
@@ -1,5 +1,6 @@
-import {Component, computed, input, InputSignal, Signal} from '@angular/core';
+import {Component, computed, inject, input, InputSignal, Signal} from '@angular/core';
 import {Species} from '@api/species';
+import {Assets} from '@api/assets';
 
 @Component({
   selector: 'species-card',
@@ -10,10 +11,11 @@ import {Species} from '@api/species';
   }
 })
 export class SpeciesCard {
+  private readonly assets = inject(Assets)
   readonly species: InputSignal<Species> = input.required()
   readonly name: Signal<string> = computed(() => this.species().name)
   protected readonly avatarUrl: Signal<Nullable<string>> = computed(() => {
     const u = this.species().avatarUrl
-    return !!u ? `url(${u})` : null;
+    return !!u ? `url(${this.assets.resolveUrl(u, 512)})` : null;
   })
 }
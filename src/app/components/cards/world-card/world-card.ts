@@ -1,5 +1,6 @@
-import {Component, computed, input, InputSignal, Signal} from '@angular/core';
+import {Component, computed, inject, input, InputSignal, Signal} from '@angular/core';
 import {World} from '@api/worlds';
+import {Assets} from '@api/assets';
 
 @Component({
   selector: 'world-card',
@@ -10,10 +11,11 @@ import {World} from '@api/worlds';
   }
 })
 export class WorldCard {
+  private readonly assets = inject(Assets)
   readonly world: InputSignal<World> = input.required()
   readonly name: Signal<string> = computed(() => this.world().name)
   protected readonly avatarUrl: Signal<Nullable<string>> = computed(() => {
     const u = this.world().avatarUrl
-    return !!u ? `url(${u})` : null;
+    return !!u ? `url(${this.assets.resolveUrl(u, 512)})` : null;
   })
 }
@@ -7,15 +7,19 @@ import {
   input,
   InputSignal,
   output,
-  OutputEmitterRef
+  OutputEmitterRef,
+  signal,
+  WritableSignal
 } from '@angular/core';
-import {Memory} from '@api/memories';
+import {Memories, Memory} from '@api/memories';
+import {ChatMessage} from '@api/chat-sessions';
+import {RouterLink} from '@angular/router';
 import {FormsModule, ReactiveFormsModule, Validators} from '@angular/forms';
 import {Characters} from '@api/characters';
 import {booleanSignal, BooleanSignal, formControl, formGroup, readOnlyControl} from '@util/ng';
 import {isNew} from '@api/common';
 import {TimeAgoPipe} from '@components/time-ago.pipe';
-import {AsyncPipe, DatePipe} from '@angular/common';
+import {AsyncPipe, DatePipe, DecimalPipe} from '@angular/common';
 
 @Component({
   selector: 'memory-list-item',
@@ -24,12 +28,15 @@ import {AsyncPipe, DatePipe} from '@angular/common';
     ReactiveFormsModule,
     TimeAgoPipe,
     AsyncPipe,
-    DatePipe
+    DatePipe,
+    DecimalPipe,
+    RouterLink
   ],
   templateUrl: './memory-list-item.html'
 })
 export class MemoryListItem {
   private readonly characters = inject(Characters)
+  private readonly memories = inject(Memories)
 
   readonly memory: InputSignal<Memory> = input.required()
   readonly characterId: InputSignal<Nullable<number>> = input()
@@ -41,6 +48,9 @@ export class MemoryListItem {
   protected readonly content = computed(() => this.memory()?.content)
   protected readonly createdAt = computed(() => this.memory()?.createdAt)
   protected readonly alwaysInclude = computed(() => this.memory()?.alwaysInclude)
+  protected readonly importance = computed(() => this.memory()?.importance)
+  protected readonly sourceChatSessionId = computed(() => this.memory()?.sourceChatSessionId)
+  protected readonly sourceMessages: WritableSignal<Nullable<ChatMessage[]>> = signal(null)
 
   protected readonly editMode: BooleanSignal = booleanSignal(false)
   protected readonly allCharacters = this.characters.all
@@ -53,7 +63,11 @@ export class MemoryListItem {
     characterId: formControl(null),
     createdAt: readOnlyControl(),
     content: formControl('', [Validators.required]),
-    alwaysInclude: formControl(false)
+    alwaysInclude: formControl(false),
+    importance: formControl(0.5, [Validators.required, Validators.min(0), Validators.max(1)]),
+    sourceChatSessionId: readOnlyControl(),
+    sourceFromMessageId: readOnlyControl(),
+    sourceToMessageId: readOnlyControl(),
   })
 
   constructor() {
@@ -64,6 +78,18 @@ export class MemoryListItem {
     });
   }
 
+  onToggleSourceMessages() {
+    if (!!this.sourceMessages()) {
+      this.sourceMessages.set(null)
+      return
+    }
+
+    const memory = this.memory()
+    this.memories
+      .getSourceMessages(memory.worldId, memory.id)
+      .subscribe(messages => this.sourceMessages.set(messages))
+  }
+
   onFormSubmit() {
     if (this.formGroup.invalid) return
 
@@ -10,15 +10,29 @@ import {
   signal,
   WritableSignal
 } from '@angular/core';
-import {Memories, Memory, MemoryCreated, MemoryDeleted, MemoryUpdated} from '@api/memories';
+import {
+  ConsolidationProposal,
+  Memories,
+  Memory,
+  MemoryConsolidationProposalsUpdated,
+  MemoryCreated,
+  MemoryDeleted,
+  MemoryImportConflict,
+  MemoryTransferFormat,
+  MemoryUpdated
+} from '@api/memories';
 import {MemoryListItem} from './memory-list-item';
 import {arrayAdd, arrayRemove, arrayReplace} from '@util/array';
 import {NEW_ID} from '@api/common';
-import {defer, map} from 'rxjs';
+import {defer, filter, map, merge, switchMap} from 'rxjs';
+import {toObservable} from '@angular/core/rxjs-interop';
 import {booleanSignal, controlValueSignal, formControl} from '@util/ng';
 import {SSE} from '@api/sse';
 import {ReactiveFormsModule} from '@angular/forms';
 import {Characters} from '@api/characters';
+import {DropdownContainer, DropdownMenu, DropdownToggle} from '@components/dropdown';
+import {Notifications} from '@components/notifications';
+import {dowloadBlob} from '@util/blobs';
 
 type SearchType = "CHARACTER" | "CONTENT"
 const PAGE_SIZE = 10
@@ -27,7 +41,10 @@ const PAGE_SIZE = 10
   selector: 'memory-list',
   imports: [
     MemoryListItem,
-    ReactiveFormsModule
+    ReactiveFormsModule,
+    DropdownContainer,
+    DropdownMenu,
+    DropdownToggle
   ],
   templateUrl: './memory-list.html',
   styleUrls: ['./memory-list.scss'],
@@ -36,6 +53,7 @@ export class MemoryList {
   private readonly memoriesService = inject(Memories)
   private readonly charactersService = inject(Characters)
   private readonly sse = inject(SSE)
+  private readonly notifications = inject(Notifications)
 
   readonly worldId: InputSignal<number> = input.required()
   readonly characterId: InputSignal<Nullable<number>> = input()
@@ -48,10 +66,26 @@ export class MemoryList {
     characterId: this.characterId(),
     createdAt: null,
     content: '',
-    alwaysInclude: false
+    alwaysInclude: false,
+    importance: 0.5,
+    sourceChatSessionId: null,
+    sourceFromMessageId: null,
+    sourceToMessageId: null,
   }))
 
   protected readonly memories: WritableSignal<Memory[]> = signal([])
+  private importConflict: MemoryImportConflict = 'SKIP'
+
+  // Consolidation proposals, for review before they are applied
+  protected readonly proposals: WritableSignal<ConsolidationProposal[]> = signal([])
+  protected readonly filteredProposals: Signal<ConsolidationProposal[]> = computed(() => {
+    const characterId = this.characterId()
+    const proposals = this.proposals()
+    if (characterId === undefined) return proposals
+    return proposals.filter(p => p.characterId === characterId)
+  })
+  protected readonly memoriesById: Signal<Map<number, Memory>> =
+    computed(() => new Map(this.memories().map(m => [m.id, m])))
 
   // Stage 1: Text search
   protected readonly searchControl = formControl('')
@@ -110,6 +144,15 @@ export class MemoryList {
         .subscribe(memories => this.memories.set(memories))
     });
 
+    const worldId$ = toObservable(this.worldId)
+    merge(
+      worldId$,
+      this.sse.on(MemoryConsolidationProposalsUpdated)
+        .pipe(filter(worldId => worldId === this.worldId()))
+    )
+      .pipe(switchMap(worldId => this.memoriesService.getConsolidationProposals(worldId)))
+      .subscribe(proposals => this.proposals.set(proposals))
+
     const eventFilter: (m: Memory) => boolean = m => {
       if (m.worldId !== this.worldId()) return false;
 
@@ -161,6 +204,64 @@ export class MemoryList {
       })
   }
 
+  onConsolidate() {
+    this.memoriesService
+      .consolidate(this.worldId())
+      .subscribe()
+  }
+
+  onApplyProposal(proposal: ConsolidationProposal) {
+    this.memoriesService
+      .applyConsolidationProposal(this.worldId(), proposal.id)
+      .subscribe(() => this.proposals.update(proposals =>
+        arrayRemove(proposals, p => p.id === proposal.id)))
+  }
+
+  onRejectProposal(proposal: ConsolidationProposal) {
+    this.memoriesService
+      .rejectConsolidationProposal(this.worldId(), proposal.id)
+      .subscribe(() => this.proposals.update(proposals =>
+        arrayRemove(proposals, p => p.id === proposal.id)))
+  }
+
+  onExport(format: MemoryTransferFormat, includeEmbeddings: boolean) {
+    const characterId = this.characterId()
+    const filename = `memories-${this.worldId()}${!!characterId ? '-' + characterId : ''}.${format}`
+
+    this.notifications
+      .run("Exporting memories...", "INFO", () => this.memoriesService
+        .exportMemories(this.worldId(), characterId, format, includeEmbeddings))
+      .subscribe(blob => {
+        dowloadBlob(blob, filename)
+        this.notifications.toast(`Export downloaded as ${filename}.`)
+      })
+  }
+
+  onImport(conflict: MemoryImportConflict, fileInput: HTMLInputElement) {
+    this.importConflict = conflict
+    fileInput.click()
+  }
+
+  onImportFileSelected(e: Event) {
+    const input = e.target as HTMLInputElement
+    const file = input.files?.item(0)
+    input.value = ''
+
+    if (!file) return
+
+    this.memoriesService
+      .importMemories(this.worldId(), file, this.importConflict, this.characterId())
+      .subscribe({
+        next: result => {
+          let message = `Imported ${result.imported} memories`
+          if (result.replaced > 0) message += `, replaced ${result.replaced}`
+          if (result.skipped > 0) message += `, skipped ${result.skipped}`
+          this.notifications.toast(`${message}.`)
+        },
+        error: () => this.notifications.toast("Could not import memories.", "DANGER")
+      })
+  }
+
   onDeleteMemory(id: number) {
     const doDelete = confirm('Are you sure you want to delete this memory?');
 
@@ -10,12 +10,13 @@ import {CharacterFormData} from './character-form-data';
 import {defer, forkJoin, mergeMap, tap} from 'rxjs';
 import {CharacterEditFormService} from './character-edit-form.service';
 import {takeUntilDestroyed} from '@angular/core/rxjs-interop';
-import {Character, Characters} from '@api/characters';
+import {Character, CharacterCardSpec, Characters} from '@api/characters';
 import {Species} from '@api/species';
 import {DropdownContainer, DropdownMenu, DropdownToggle} from '@components/dropdown';
 import {Instruction} from '@api/instructions';
 import {dowloadBlob} from '@util/blobs';
 import {CharacterBuilderFormService} from './character-builder-form.service';
+import {AssetUrlPipe} from '@components/asset-url.pipe';
 
 @Component({
   selector: 'app-edit-character-page',
@@ -29,6 +30,7 @@ import {CharacterBuilderFormService} from './character-builder-form.service';
     DropdownContainer,
     DropdownToggle,
     DropdownMenu,
+    AssetUrlPipe
   ],
   providers: [
     CharacterEditFormService,
@@ -179,4 +181,20 @@ export class EditCharacterPage {
         this.notifications.toast(`Export downloaded as ${filename}.`)
       })
   }
+
+  protected onExportCharacterAsCard(format: CharacterCardSpec | 'png') {
+    if (this.isNew()) return
+
+    const characterId = this.character().id
+    const filename = `${this.character().name}.${format === 'png' ? 'png' : 'json'}`
+
+    this.notifications
+      .run("Exporting character...", "INFO", () => format === 'png'
+        ? this.characters.exportAsPng(characterId)
+        : this.characters.exportAsCard(characterId, format))
+      .subscribe(blob => {
+        dowloadBlob(blob, filename)
+        this.notifications.toast(`Export downloaded as ${filename}.`)
+      })
+  }
 }
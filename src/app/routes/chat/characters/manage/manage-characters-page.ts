@@ -1,10 +1,11 @@
 import {Component, inject, Signal} from '@angular/core';
-import {RouterLink} from '@angular/router';
+import {ActivatedRoute, Router, RouterLink} from '@angular/router';
 import {PageHeader} from '@components/page-header';
 import {CharacterCard} from '@components/cards/character-card';
 import {NewItemCard} from '@components/cards/new-item-card';
 import {Character, Characters} from '@api/characters';
 import {Scalable} from '@components/scalable/scalable';
+import {Notifications} from '@components/notifications';
 
 @Component({
   selector: 'app-manage-characters',
@@ -19,6 +20,27 @@ import {Scalable} from '@components/scalable/scalable';
 })
 export class ManageCharactersPage {
   private readonly charactersService = inject(Characters)
+  private readonly notifications = inject(Notifications)
+  private readonly router = inject(Router)
+  private readonly activatedRoute = inject(ActivatedRoute)
 
   readonly characters: Signal<Character[]> = this.charactersService.all
+
+  onImportCardSelected(e: Event) {
+    const input = e.target as HTMLInputElement
+    const file = input.files?.item(0)
+    input.value = ''
+
+    if (!file) return
+
+    this.charactersService
+      .importCard(file)
+      .subscribe({
+        next: character => {
+          this.notifications.toast(`Imported ${character.name}.`)
+          this.router.navigate(['.', character.id], {relativeTo: this.activatedRoute})
+        },
+        error: () => this.notifications.toast("Could not import character card.", "DANGER")
+      })
+  }
 }
@@ -17,6 +17,7 @@ import {RenderedMessage} from '@components/rendered-message';
 import {TokenCount} from '@components/token-count';
 import {Scenario, Scenarios} from '@api/scenarios';
 import {isNew} from '@api/common';
+import {AssetUrlPipe} from '@components/asset-url.pipe';
 
 @Component({
   selector: 'app-edit-scenario',
@@ -26,7 +27,8 @@ import {isNew} from '@api/common';
     ReactiveFormsModule,
     AvatarControl,
     RenderedMessage,
-    TokenCount
+    TokenCount,
+    AssetUrlPipe
   ],
   templateUrl: './edit-scenario-page.html',
   styleUrls: ["./edit-scenario-page.scss"]
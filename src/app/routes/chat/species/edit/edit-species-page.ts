@@ -17,6 +17,7 @@ import {PageHeader} from '@components/page-header';
 import {AvatarControl} from '@components/avatar-control';
 import {RenderedMessage} from '@components/rendered-message';
 import {TokenCount} from '@components/token-count';
+import {AssetUrlPipe} from '@components/asset-url.pipe';
 
 @Component({
   selector: 'edit-species-page',
@@ -26,7 +27,8 @@ import {TokenCount} from '@components/token-count';
     PageHeader,
     AvatarControl,
     RenderedMessage,
-    TokenCount
+    TokenCount,
+    AssetUrlPipe
   ],
   templateUrl: './edit-species-page.html',
   styleUrl: './edit-species-page.scss'
@@ -41,6 +41,7 @@ export class WorldChatSessions {
       personaId: null,
       chatModelId: null,
       chatInstructionId: null,
+      chatFallbackModelIds: null,
       lastTotalTokens: 0,
       lastCompletionTokens: 0,
     }
@@ -16,6 +16,7 @@ import {ChatSessionData} from './chat-session-data';
 import {MemoryList} from '@components/memory-list';
 import {booleanSignal} from '@util/ng';
 import {ChatQuestUIConfig} from '@config/config';
+import {AssetUrlPipe} from '@components/asset-url.pipe';
 
 @Component({
   selector: 'chat-with-page',
@@ -26,6 +27,7 @@ import {ChatQuestUIConfig} from '@config/config';
     ChatSessionChatInputBlock,
     ChatSessionMessage,
     MemoryList,
+    AssetUrlPipe
   ],
   providers: [
     ChatSessionData
@@ -59,6 +59,7 @@ export class ChatSessionDetailsBlock {
     personaId: formControl(null),
     chatModelId: formControl(null, [Validators.required]),
     chatInstructionId: formControl(null, [Validators.required]),
+    chatFallbackModelIds: formControl(null),
     lastTotalTokens: readOnlyControl(),
     lastCompletionTokens: readOnlyControl(),
   })
@@ -94,6 +95,7 @@ export class ChatSessionDetailsBlock {
       'scenarioId',
       'chatModelId',
       'chatInstructionId',
+      'chatFallbackModelIds',
       'currentTimeOfDay'
     ];
 
@@ -9,10 +9,10 @@ import {ReactiveFormsModule, Validators} from '@angular/forms';
 import {Memories} from '@api/memories';
 import {mergeMap} from 'rxjs';
 import {ActivatedRoute, Router} from '@angular/router';
-import {System} from '@api/system';
 import {DropdownContainer, DropdownMenu, DropdownToggle} from '@components/dropdown';
 import {AsyncPipe, DatePipe} from '@angular/common';
 import {TimeAgoPipe} from '@components/time-ago.pipe';
+import {AssetUrlPipe} from '@components/asset-url.pipe';
 
 type MessageFormGroup = Pick<ChatMessage, 'content'>
 
@@ -26,7 +26,8 @@ type MessageFormGroup = Pick<ChatMessage, 'content'>
     DropdownMenu,
     DatePipe,
     TimeAgoPipe,
-    AsyncPipe
+    AsyncPipe,
+    AssetUrlPipe
   ],
   templateUrl: './chat-session-message.html',
   styleUrl: './chat-session-message.scss',
@@ -41,7 +42,6 @@ export class ChatSessionMessage {
   private readonly chatSessions = inject(ChatSessions)
   private readonly memories = inject(Memories)
   private readonly notifications = inject(Notifications)
-  private readonly system = inject(System)
 
   readonly worldId: Signal<number> = this.sessionData.worldId
 
@@ -153,8 +153,11 @@ Note that this and all subsequent messages will be deleted and this action can n
   }
 
   onCancelGeneration() {
-    this.system
-      .stopCurrentGeneration()
+    const worldId = this.worldId()
+    const {chatSessionId} = this.message();
+
+    this.chatSessions
+      .cancelGenerations(worldId, chatSessionId)
       .subscribe(() => this.notifications.toast('Generation cancelled!'));
   }
 }
@@ -0,0 +1,78 @@
+import {Component, inject, signal, WritableSignal} from '@angular/core';
+import {DatePipe} from '@angular/common';
+import {BackupFile, BackupManifest, System} from '@api/system';
+import {Observable} from 'rxjs';
+import {Notifications} from '@components/notifications';
+import {EmptyPipe} from '@components/empty.pipe';
+import {dowloadBlob} from '@util/blobs';
+
+@Component({
+  selector: 'backups-overview',
+  imports: [
+    DatePipe,
+    EmptyPipe
+  ],
+  templateUrl: './backups-overview.html'
+})
+export class BackupsOverview {
+  private readonly system = inject(System)
+  private readonly notifications = inject(Notifications)
+
+  readonly backups: WritableSignal<BackupFile[]> = signal([])
+
+  constructor() {
+    this.reloadBackups()
+  }
+
+  onCreateBackup() {
+    this.notifications
+      .run("Creating backup...", "INFO", () => this.system.createBackup())
+      .subscribe(blob => {
+        dowloadBlob(blob, `chat-quest-backup.zip`)
+        this.notifications.toast("Backup created and downloaded.")
+        this.reloadBackups()
+      })
+  }
+
+  onDownloadBackup(backup: BackupFile) {
+    this.system
+      .downloadBackup(backup.name)
+      .subscribe(blob => dowloadBlob(blob, backup.name))
+  }
+
+  onRestoreBackup(backup: BackupFile) {
+    const doRestore = confirm(`Are you sure you want to restore the backup '${backup.name}'?\n\nAll current data will be replaced!`)
+    if (!doRestore) return
+
+    this.restore(() => this.system.restoreStoredBackup(backup.name))
+  }
+
+  onRestoreFileSelected(e: Event) {
+    const input = e.target as HTMLInputElement
+    const file = input.files?.item(0)
+    input.value = ''
+    if (!file) return
+
+    const doRestore = confirm(`Are you sure you want to restore the backup '${file.name}'?\n\nAll current data will be replaced!`)
+    if (!doRestore) return
+
+    this.restore(() => this.system.restoreBackup(file))
+  }
+
+  private restore(action: () => Observable<BackupManifest>) {
+    this.notifications
+      .run("Restoring backup...", "INFO", action)
+      .subscribe({
+        next: () => {
+          this.notifications.toast("Backup restored, reloading...")
+          // All loaded data is outdated
+          setTimeout(() => window.location.reload(), 1000)
+        },
+        error: () => this.notifications.toast("Failed to restore backup.", "DANGER")
+      })
+  }
+
+  private reloadBackups() {
+    this.system.backups().subscribe(backups => this.backups.set(backups))
+  }
+}
@@ -0,0 +1 @@
+export * from "./backups-overview"
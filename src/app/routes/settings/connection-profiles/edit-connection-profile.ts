@@ -39,7 +39,11 @@ export class EditConnectionProfile {
     name: formControl('', [Validators.required]),
     providerType: formControl<ProviderType>('OPEN_AI', [Validators.required]),
     baseUrl: formControl('', [Validators.required]),
-    apiKey: formControl('', [Validators.required])
+    apiKey: formControl('', [Validators.required]),
+    maxConcurrentRequests: formControl(1, [Validators.required, Validators.min(1)]),
+    requestsPerMinute: formControl(0, [Validators.required, Validators.min(0)]),
+    maxRetries: formControl(2, [Validators.required, Validators.min(0), Validators.max(10)]),
+    retryBackoffMillis: formControl(1000, [Validators.required, Validators.min(0)]),
   })
 
   constructor() {
@@ -140,6 +144,17 @@ New models will be added and non-existent models will be removed.
       })
   }
 
+  onModelContextLengthChange(model: LlmModel, event: Event) {
+    const value = (event.target as HTMLInputElement).valueAsNumber;
+    const contextLength = isNaN(value) || value <= 0 ? null : value;
+    this.providers
+      .saveModel({...model, contextLength})
+      .subscribe(res => {
+        this.models.update(models => arrayReplace(models, res, m => m.id === res.id))
+        this.notifications.toast("Model updated!");
+      })
+  }
+
   onToggleModelDisabled(model: LlmModel) {
     this.providers
       .saveModel({...model, disabled: !model.disabled})
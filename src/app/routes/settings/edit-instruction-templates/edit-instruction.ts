@@ -41,6 +41,12 @@ export class EditInstruction {
     stream: formControl<boolean>(true),
     stopSequences: formControl<Nullable<string>>(null),
     includeReasoning: formControl(false),
+    topK: formControl<Nullable<number>>(null, [Validators.min(0)]),
+    minP: formControl<Nullable<number>>(null, [Validators.min(0), Validators.max(1.0)]),
+    repeatPenalty: formControl<Nullable<number>>(null, [Validators.min(0)]),
+    mirostat: formControl<Nullable<number>>(null, [Validators.min(0), Validators.max(2)]),
+    mirostatTau: formControl<Nullable<number>>(null, [Validators.min(0)]),
+    mirostatEta: formControl<Nullable<number>>(null, [Validators.min(0)]),
 
     allowMultiCharacterResponses: formControl(false),
     enableReasoningParsing: formControl(false),
@@ -1,9 +1,10 @@
-import {Component, computed, effect, inject, linkedSignal, Signal, WritableSignal} from '@angular/core';
+import {Component, computed, effect, inject, linkedSignal, signal, Signal, WritableSignal} from '@angular/core';
 import {PageHeader} from '@components/page-header';
 import {ConnectionProfilesOverview} from './components/connection-profiles';
 import {InstructionOverview} from './components/instructions';
+import {BackupsOverview} from './components/backups';
 import {ActivatedRoute} from '@angular/router';
-import {CQPreferences, Preferences, PreferencesUpdated} from '@api/preferences';
+import {CQPreferences, MemoryMessageDeletePolicy, Preferences, PreferencesUpdated} from '@api/preferences';
 import {Notifications} from '@components/notifications';
 import {SSE} from '@api/sse';
 import {booleanSignal, BooleanSignal, formControl, formGroup, routeDataSignal, routeQueryParamSignal} from '@util/ng';
@@ -12,6 +13,7 @@ import {ReactiveFormsModule, Validators} from '@angular/forms';
 import {Instruction} from '@api/instructions';
 import {LlmLabelPipe} from '@components/llm-label.pipe';
 import {ChatQuestUIConfig} from '@config/config';
+import {EmbeddingsProgress, EmbeddingsProgressUpdated} from '@api/memories';
 
 @Component({
   selector: 'app-settings-page',
@@ -19,6 +21,7 @@ import {ChatQuestUIConfig} from '@config/config';
     PageHeader,
     ConnectionProfilesOverview,
     InstructionOverview,
+    BackupsOverview,
     ReactiveFormsModule,
     LlmLabelPipe,
   ],
@@ -40,6 +43,12 @@ export class SettingsPage {
   private readonly validate: Signal<boolean> = routeQueryParamSignal(this.activatedRoute, 'validate', v => !!v);
 
   readonly uiSettingsAdvancedOpened: BooleanSignal = booleanSignal(false)
+  readonly embeddingsProgress: WritableSignal<Nullable<EmbeddingsProgress>> = signal(null)
+  readonly embeddingsProgressPercentage: Signal<number> = computed(() => {
+    const progress = this.embeddingsProgress()
+    if (!progress || progress.total === 0) return 0
+    return Math.round((progress.done + progress.errors) / progress.total * 100)
+  })
 
   readonly chatInstructionTemplates: Signal<Instruction[]> =
     computed(() => this.instructions().filter(i => i.type === 'CHAT'));
@@ -47,6 +56,10 @@ export class SettingsPage {
     computed(() => this.instructions().filter(i => i.type === 'MEMORIES'));
   readonly titleInstructionTemplates: Signal<Instruction[]> =
     computed(() => this.instructions().filter(i => i.type === 'TITLE_GENERATION'));
+  readonly summaryInstructionTemplates: Signal<Instruction[]> =
+    computed(() => this.instructions().filter(i => i.type === 'SUMMARY'));
+  readonly memoryConsolidationInstructionTemplates: Signal<Instruction[]> =
+    computed(() => this.instructions().filter(i => i.type === 'MEMORY_CONSOLIDATION'));
   readonly chatModels: Signal<LlmModelView[]> =
     computed(() => this.llmModelViews().filter(i => i.modelType === 'CHAT_MODEL'))
   readonly embeddingModels: Signal<LlmModelView[]> =
@@ -56,6 +69,7 @@ export class SettingsPage {
     chatModelId: formControl<Nullable<number>>(null, [Validators.required]),
     chatInstructionId: formControl<Nullable<number>>(null, [Validators.required]),
     maxMessagesInContext: formControl(0, [Validators.required, Validators.min(1)]),
+    chatFallbackModelIds: formControl<Nullable<number[]>>(null),
     embeddingModelId: formControl<Nullable<number>>(null, [Validators.required]),
     memoriesModelId: formControl<Nullable<number>>(null, [Validators.required]),
     memoriesInstructionId: formControl<Nullable<number>>(null, [Validators.required]),
@@ -64,9 +78,28 @@ export class SettingsPage {
     memoryWindowSize: formControl(0, [Validators.required, Validators.min(1)]),
     memoryIncludeChatSize: formControl(0, [Validators.required, Validators.min(1)]),
     memoryIncludeChatNotes: formControl(false),
+    memoryVectorWeight: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryKeywordWeight: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryTopK: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryTokenBudget: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryRecencyWeight: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryRecencyHalfLifeDays: formControl(0, [Validators.required, Validators.min(0.1)]),
+    memoryImportanceWeight: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryMmrLambda: formControl(0, [Validators.required, Validators.min(0), Validators.max(1)]),
+    memoryConsolidationModelId: formControl<Nullable<number>>(null),
+    memoryConsolidationInstructionId: formControl<Nullable<number>>(null),
+    memoryConsolidationThreshold: formControl(0, [Validators.required, Validators.min(0.01), Validators.max(1)]),
+    memoryConsolidationIntervalHours: formControl(0, [Validators.required, Validators.min(0)]),
+    memoryConsolidationAutoApply: formControl(false),
+    memoryOnMessagesDeleted: formControl<MemoryMessageDeletePolicy>('KEEP', [Validators.required]),
     titleGenerationModelId: formControl<Nullable<number>>(null, [Validators.required]),
     titleGenerationInstructionId: formControl<Nullable<number>>(null, [Validators.required]),
     titleGenerationMessageWindow: formControl<number>(0, [Validators.required, Validators.min(1)]),
+    summaryModelId: formControl<Nullable<number>>(null),
+    summaryInstructionId: formControl<Nullable<number>>(null),
+    summaryTriggerAfter: formControl<number>(0, [Validators.required, Validators.min(1)]),
+    lorebookScanDepth: formControl<number>(0, [Validators.required, Validators.min(0)]),
+    lorebookTokenBudget: formControl<number>(0, [Validators.required, Validators.min(0)]),
   })
 
   readonly uiSettingsFormGroup = formGroup<ChatQuestUIConfig>({
@@ -92,6 +125,9 @@ export class SettingsPage {
     this.sse
       .on(PreferencesUpdated)
       .subscribe(prefs => this.prefs.set(prefs));
+    this.sse
+      .on(EmbeddingsProgressUpdated)
+      .subscribe(progress => this.embeddingsProgress.set(progress));
   }
 
   onRevertChanges() {